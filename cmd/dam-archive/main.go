@@ -0,0 +1,161 @@
+// Command dam-archive appends finished requests to an archive directory and
+// restores archived requests into a namespace:
+//
+//	dam-archive archive -storage sqlite -path ./data/dam.db -dir ./archive -delete
+//	dam-archive restore -storage sqlite -path ./data/dam.db -dir ./archive -from support -to support
+//	dam-archive restore -storage sqlite -path ./data/dam.db -file ./archive/support/20261018T120000Z.jsonl.gz -to support
+//
+// The server archives on its own when ARCHIVE_DIR is set; this command is
+// for one-off runs and restores. Pebble allows only one process at a time,
+// so stop the server first when using pebbledb, and never run an archive
+// alongside a server writing to the same directory.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/georgeshao/ai-inference-dam/internal/archive"
+	"github.com/georgeshao/ai-inference-dam/internal/storage"
+	"github.com/georgeshao/ai-inference-dam/internal/storage/blob"
+	"github.com/georgeshao/ai-inference-dam/internal/storage/pebbledb"
+	"github.com/georgeshao/ai-inference-dam/internal/storage/postgres"
+	"github.com/georgeshao/ai-inference-dam/internal/storage/sqlite"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	switch os.Args[1] {
+	case "archive":
+		runArchive(os.Args[2:])
+	case "restore":
+		runRestore(os.Args[2:])
+	default:
+		usage()
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: dam-archive archive|restore [flags]")
+	os.Exit(2)
+}
+
+// storeFlags are the flags shared by every subcommand.
+type storeFlags struct {
+	storageType *string
+	path        *string
+	blobDir     *string
+}
+
+func addStoreFlags(fs *flag.FlagSet) storeFlags {
+	return storeFlags{
+		storageType: fs.String("storage", "", "storage type (sqlite, pebbledb, postgres)"),
+		path:        fs.String("path", "", "database path, or DSN for postgres"),
+		blobDir:     fs.String("blob-dir", "", "blob directory of a sqlite or pebbledb store that offloads payloads"),
+	}
+}
+
+func (f storeFlags) open(fs *flag.FlagSet) storage.Store {
+	if *f.storageType == "" || *f.path == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+	// Only the embedded backends store payloads themselves
+	if *f.blobDir != "" && *f.storageType != "sqlite" && *f.storageType != "pebbledb" {
+		log.Fatalf("-blob-dir is only supported for sqlite and pebbledb storage")
+	}
+	store, err := openStore(*f.storageType, *f.path, blob.Options{Dir: *f.blobDir})
+	if err != nil {
+		log.Fatalf("Failed to open %s storage: %v", *f.storageType, err)
+	}
+	return store
+}
+
+func runArchive(args []string) {
+	fs := flag.NewFlagSet("archive", flag.ExitOnError)
+	sf := addStoreFlags(fs)
+	dir := fs.String("dir", "", "archive directory")
+	deleteArchived := fs.Bool("delete", false, "remove archived requests from the store")
+	maxFileSize := fs.Int64("max-file-size", archive.DefaultMaxFileSize, "compressed bytes after which a namespace's file is rotated")
+	maxFileAge := fs.Duration("max-file-age", archive.DefaultMaxFileAge, "age after which a namespace's file is rotated")
+	batchSize := fs.Int("batch-size", archive.DefaultBatchSize, "requests read per batch")
+	fs.Parse(args)
+
+	if *dir == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+	store := sf.open(fs)
+	defer store.Close()
+
+	archiver, err := archive.New(store, archive.Options{
+		Dir:         *dir,
+		MaxFileSize: *maxFileSize,
+		MaxFileAge:  *maxFileAge,
+		Delete:      *deleteArchived,
+		BatchSize:   *batchSize,
+	})
+	if err != nil {
+		log.Fatalf("Failed to open archive: %v", err)
+	}
+
+	archived, err := archiver.Run(context.Background(), time.Now())
+	if err != nil {
+		log.Fatalf("Archive failed after %d requests: %v", archived, err)
+	}
+	log.Printf("Archived %d requests to %s", archived, *dir)
+}
+
+func runRestore(args []string) {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	sf := addStoreFlags(fs)
+	dir := fs.String("dir", "", "archive directory to restore a namespace from")
+	from := fs.String("from", "", "archived namespace to restore (default: -to)")
+	file := fs.String("file", "", "single archive file to restore instead of -dir")
+	to := fs.String("to", "", "namespace to import into; it must exist")
+	fs.Parse(args)
+
+	if *to == "" || (*dir == "") == (*file == "") {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if *from == "" {
+		*from = *to
+	}
+	store := sf.open(fs)
+	defer store.Close()
+
+	ctx := context.Background()
+	var restored int
+	var err error
+	if *file != "" {
+		restored, err = archive.RestoreFile(ctx, store, *file, *to)
+	} else {
+		restored, err = archive.Restore(ctx, store, *dir, *from, *to)
+	}
+	if err != nil {
+		log.Fatalf("Restore failed after %d requests: %v", restored, err)
+	}
+	log.Printf("Restored %d requests into %s", restored, *to)
+}
+
+// openStore opens a backend for offline use. Pebble runs without the
+// BatchWriter so every write is durable before the command exits.
+func openStore(storageType, path string, blobOpts blob.Options) (storage.Store, error) {
+	switch storageType {
+	case "sqlite":
+		return sqlite.New(path, sqlite.WithBlobs(blobOpts))
+	case "pebbledb":
+		return pebbledb.New(path, false, pebbledb.WithBlobs(blobOpts))
+	case "postgres":
+		return postgres.New(path)
+	}
+	return nil, fmt.Errorf("unknown storage type: %s (supported: sqlite, pebbledb, postgres)", storageType)
+}
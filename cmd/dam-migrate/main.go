@@ -0,0 +1,137 @@
+// Command dam-migrate copies every namespace and request from one storage
+// backend into another. Run it while the server is stopped:
+//
+//	dam-migrate -from sqlite -from-path ./data/dam.db -to pebbledb -to-path ./data/pebble
+//
+// Progress is checkpointed after every batch, so an interrupted run picks up
+// where it left off when started again with the same flags. A checkpoint
+// records the stores it belongs to and is refused by a run between others.
+// Once the copy finishes, a verification pass compares request counts and
+// namespace stats between the two stores.
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/georgeshao/ai-inference-dam/internal/storage"
+	"github.com/georgeshao/ai-inference-dam/internal/storage/blob"
+	"github.com/georgeshao/ai-inference-dam/internal/storage/compression"
+	"github.com/georgeshao/ai-inference-dam/internal/storage/pebbledb"
+	"github.com/georgeshao/ai-inference-dam/internal/storage/postgres"
+	"github.com/georgeshao/ai-inference-dam/internal/storage/sqlite"
+)
+
+func main() {
+	fromType := flag.String("from", "", "source storage type (sqlite, pebbledb, postgres)")
+	fromPath := flag.String("from-path", "", "source database path, or DSN for postgres")
+	toType := flag.String("to", "", "destination storage type (sqlite, pebbledb, postgres)")
+	toPath := flag.String("to-path", "", "destination database path, or DSN for postgres")
+	batchSize := flag.Int("batch-size", 500, "requests copied per batch")
+	checkpoint := flag.String("checkpoint", "dam-migrate.checkpoint", "file recording progress for resuming")
+	verifyOnly := flag.Bool("verify-only", false, "skip copying and only compare the two stores")
+	toCompress := flag.Bool("to-compress", false, "compress payloads with zstd in a sqlite or pebbledb destination")
+	fromBlobDir := flag.String("from-blob-dir", "", "blob directory of a sqlite or pebbledb source that offloads payloads")
+	toBlobDir := flag.String("to-blob-dir", "", "offload large payloads to this blob directory in a sqlite or pebbledb destination")
+	flag.Parse()
+
+	if *fromType == "" || *fromPath == "" || *toType == "" || *toPath == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *batchSize <= 0 {
+		log.Fatalf("-batch-size must be positive")
+	}
+	// Only the embedded backends store payloads themselves, so the others
+	// would silently ignore these
+	if *fromBlobDir != "" && !isEmbedded(*fromType) {
+		log.Fatalf("-from-blob-dir is only supported for a sqlite or pebbledb source")
+	}
+	if *toCompress && !isEmbedded(*toType) {
+		log.Fatalf("-to-compress is only supported for a sqlite or pebbledb destination")
+	}
+	if *toBlobDir != "" && !isEmbedded(*toType) {
+		log.Fatalf("-to-blob-dir is only supported for a sqlite or pebbledb destination")
+	}
+
+	src, err := openStore(*fromType, *fromPath, compression.Options{}, blob.Options{Dir: *fromBlobDir})
+	if err != nil {
+		log.Fatalf("Failed to open source %s storage: %v", *fromType, err)
+	}
+	defer src.Close()
+
+	dst, err := openStore(*toType, *toPath, compression.Options{Enabled: *toCompress}, blob.Options{Dir: *toBlobDir})
+	if err != nil {
+		log.Fatalf("Failed to open destination %s storage: %v", *toType, err)
+	}
+	defer dst.Close()
+
+	ctx := context.Background()
+	m := &Migrator{
+		Src:            src,
+		Dst:            dst,
+		BatchSize:      *batchSize,
+		CheckpointPath: *checkpoint,
+		From:           describeStore(*fromType, *fromPath),
+		To:             describeStore(*toType, *toPath),
+		Logf:           log.Printf,
+	}
+
+	if !*verifyOnly {
+		if err := m.Run(ctx); err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+	}
+
+	if err := m.Verify(ctx); err != nil {
+		log.Fatalf("Verification failed: %v", err)
+	}
+	log.Println("Verification passed")
+
+	if !*verifyOnly {
+		if err := os.Remove(*checkpoint); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to remove checkpoint: %v", err)
+		}
+	}
+}
+
+// describeStore identifies a store for the checkpoint. Paths are made
+// absolute so that a run from another directory still matches, and a
+// postgres DSN, which carries credentials, is recorded only as a digest.
+func describeStore(storageType, path string) string {
+	if storageType == "postgres" {
+		sum := sha256.Sum256([]byte(path))
+		return storageType + ":sha256:" + hex.EncodeToString(sum[:])
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	return storageType + ":" + path
+}
+
+func isEmbedded(storageType string) bool {
+	return storageType == "sqlite" || storageType == "pebbledb"
+}
+
+// openStore opens a backend for offline use. Pebble runs without the
+// BatchWriter so every imported request is durable before its checkpoint.
+// Compression and blob options only apply to sqlite and pebbledb; reading
+// compressed payloads needs no options, but reading offloaded ones needs
+// the blob directory.
+func openStore(storageType, path string, opts compression.Options, blobOpts blob.Options) (storage.Store, error) {
+	switch storageType {
+	case "sqlite":
+		return sqlite.New(path, sqlite.WithCompression(opts), sqlite.WithBlobs(blobOpts))
+	case "pebbledb":
+		return pebbledb.New(path, false, pebbledb.WithCompression(opts), pebbledb.WithBlobs(blobOpts))
+	case "postgres":
+		return postgres.New(path)
+	}
+	return nil, fmt.Errorf("unknown storage type: %s (supported: sqlite, pebbledb, postgres)", storageType)
+}
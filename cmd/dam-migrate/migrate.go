@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/georgeshao/ai-inference-dam/internal/dispatcher"
+	"github.com/georgeshao/ai-inference-dam/internal/storage"
+)
+
+// Migrator copies one store into another. Namespaces and the current budget
+// period's spend are copied on every run; requests are streamed in ID order
+// and the last copied ID is checkpointed after each batch. ImportRequest
+// replaces existing requests, so re-copying a partial batch is harmless.
+//
+// The response cache and cache hit/miss counters are not copied.
+type Migrator struct {
+	Src            storage.Store
+	Dst            storage.Store
+	BatchSize      int
+	CheckpointPath string
+	// From and To identify the source and destination in the checkpoint, so
+	// that a checkpoint left by a migration between other stores is refused
+	// rather than skipping requests it never copied.
+	From, To string
+	Logf     func(format string, args ...interface{})
+}
+
+type checkpoint struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	LastID string `json:"last_id"`
+	Copied int    `json:"copied"`
+}
+
+func (m *Migrator) Run(ctx context.Context) error {
+	namespaces, err := m.Src.ListNamespaces(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list namespaces: %w", err)
+	}
+
+	total := 0
+	for _, ns := range namespaces {
+		if err := m.copyNamespace(ctx, ns); err != nil {
+			return fmt.Errorf("namespace %s: %w", ns.Name, err)
+		}
+		stats, err := m.Src.GetNamespaceStats(ctx, ns.Name)
+		if err != nil {
+			return fmt.Errorf("failed to get stats for %s: %w", ns.Name, err)
+		}
+		total += stats.TotalRequests
+	}
+	m.Logf("Copied %d namespaces", len(namespaces))
+
+	cp, err := m.loadCheckpoint()
+	if err != nil {
+		return err
+	}
+	switch {
+	case cp.LastID == "":
+		cp.From, cp.To = m.From, m.To
+	case cp.From != m.From || cp.To != m.To:
+		return fmt.Errorf("checkpoint %s is for a migration from %q to %q; remove it or choose another -checkpoint", m.CheckpointPath, cp.From, cp.To)
+	default:
+		m.Logf("Resuming after request %s (%d already copied)", cp.LastID, cp.Copied)
+	}
+
+	for {
+		batch, err := m.Src.ExportRequests(ctx, cp.LastID, m.BatchSize)
+		if err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			break
+		}
+
+		for _, req := range batch {
+			if err := m.Dst.ImportRequest(ctx, req); err != nil {
+				return fmt.Errorf("failed to import request %s: %w", req.ID, err)
+			}
+		}
+
+		cp.LastID = batch[len(batch)-1].ID
+		cp.Copied += len(batch)
+		if err := m.saveCheckpoint(cp); err != nil {
+			return err
+		}
+		m.Logf("Copied %d/%d requests (%.1f%%)", cp.Copied, total, percent(cp.Copied, total))
+	}
+
+	m.Logf("Copy complete: %d requests", cp.Copied)
+	return nil
+}
+
+func (m *Migrator) copyNamespace(ctx context.Context, ns *storage.NamespaceRecord) error {
+	existing, err := m.Dst.GetNamespace(ctx, ns.Name)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		err = m.Dst.CreateNamespace(ctx, ns)
+	} else {
+		err = m.Dst.UpdateNamespace(ctx, ns.Name, ns)
+	}
+	if err != nil {
+		return err
+	}
+
+	if ns.Budget == nil {
+		return nil
+	}
+
+	// Only the current period affects dispatching. Add the difference so a
+	// resumed run does not count spend twice.
+	periodKey := dispatcher.BudgetPeriodKey(ns.Budget.Period, time.Now())
+	srcSpend, err := m.Src.GetBudgetSpend(ctx, ns.Name, periodKey)
+	if err != nil {
+		return err
+	}
+	dstSpend, err := m.Dst.GetBudgetSpend(ctx, ns.Name, periodKey)
+	if err != nil {
+		return err
+	}
+
+	costDelta := srcSpend.SpentUSD - dstSpend.SpentUSD
+	tokenDelta := srcSpend.SpentTokens - dstSpend.SpentTokens
+	if costDelta > 0 || tokenDelta > 0 {
+		if err := m.Dst.AddBudgetSpend(ctx, ns.Name, periodKey, math.Max(costDelta, 0), max(tokenDelta, 0)); err != nil {
+			return err
+		}
+	}
+	if srcSpend.ExhaustedAt != nil && dstSpend.ExhaustedAt == nil {
+		if err := m.Dst.SetBudgetExhausted(ctx, ns.Name, periodKey, srcSpend.ExhaustedAt); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Verify compares every source namespace with its copy and reports all
+// differences in request counts and usage.
+func (m *Migrator) Verify(ctx context.Context) error {
+	namespaces, err := m.Src.ListNamespaces(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list namespaces: %w", err)
+	}
+
+	var problems []string
+	for _, ns := range namespaces {
+		copied, err := m.Dst.GetNamespace(ctx, ns.Name)
+		if err != nil {
+			return err
+		}
+		if copied == nil {
+			problems = append(problems, fmt.Sprintf("%s: namespace missing", ns.Name))
+			continue
+		}
+
+		want, err := m.Src.GetNamespaceStats(ctx, ns.Name)
+		if err != nil {
+			return err
+		}
+		got, err := m.Dst.GetNamespaceStats(ctx, ns.Name)
+		if err != nil {
+			return err
+		}
+
+		for _, c := range []struct {
+			name      string
+			want, got int64
+		}{
+			{"total_requests", int64(want.TotalRequests), int64(got.TotalRequests)},
+			{"queued", int64(want.Queued), int64(got.Queued)},
+			{"processing", int64(want.Processing), int64(got.Processing)},
+			{"completed", int64(want.Completed), int64(got.Completed)},
+			{"failed", int64(want.Failed), int64(got.Failed)},
+			{"prompt_tokens", want.PromptTokens, got.PromptTokens},
+			{"completion_tokens", want.CompletionTokens, got.CompletionTokens},
+			{"cached_tokens", want.CachedTokens, got.CachedTokens},
+			{"reasoning_tokens", want.ReasoningTokens, got.ReasoningTokens},
+		} {
+			if c.want != c.got {
+				problems = append(problems, fmt.Sprintf("%s: %s is %d, want %d", ns.Name, c.name, c.got, c.want))
+			}
+		}
+		// Pebble keeps cost in nano-dollars
+		if math.Abs(want.CostUSD-got.CostUSD) > 1e-6 {
+			problems = append(problems, fmt.Sprintf("%s: cost_usd is %f, want %f", ns.Name, got.CostUSD, want.CostUSD))
+		}
+
+		m.Logf("Verified %s: %d requests", ns.Name, got.TotalRequests)
+	}
+
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func (m *Migrator) loadCheckpoint() (checkpoint, error) {
+	var cp checkpoint
+	data, err := os.ReadFile(m.CheckpointPath)
+	if os.IsNotExist(err) {
+		return cp, nil
+	}
+	if err != nil {
+		return cp, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return cp, fmt.Errorf("failed to parse checkpoint: %w", err)
+	}
+	return cp, nil
+}
+
+// saveCheckpoint replaces the checkpoint file atomically so an interrupted
+// write never leaves it truncated.
+func (m *Migrator) saveCheckpoint(cp checkpoint) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+
+	tmp := m.CheckpointPath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp, m.CheckpointPath); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	return nil
+}
+
+func percent(n, total int) float64 {
+	if total == 0 {
+		return 100
+	}
+	return float64(n) * 100 / float64(total)
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/georgeshao/ai-inference-dam/internal/dispatcher"
+	"github.com/georgeshao/ai-inference-dam/internal/storage"
+	"github.com/georgeshao/ai-inference-dam/internal/storage/memory"
+	"github.com/georgeshao/ai-inference-dam/internal/storage/pebbledb"
+	"github.com/georgeshao/ai-inference-dam/internal/storage/sqlite"
+	"github.com/georgeshao/ai-inference-dam/internal/storage/storagetest"
+	"github.com/georgeshao/ai-inference-dam/pkg/types"
+)
+
+// seedStore adds n requests to test-ns, which has a budget with some spend
+// in the current period.
+func seedStore(t *testing.T, store storage.Store, n int) {
+	t.Helper()
+	ctx := context.Background()
+	now := time.Now()
+
+	limit := 10.0
+	if err := store.CreateNamespace(ctx, &storage.NamespaceRecord{
+		Name:      "test-ns",
+		Budget:    &storage.Budget{LimitUSD: &limit, Period: types.BudgetPeriodMonth},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}); err != nil {
+		t.Fatalf("CreateNamespace failed: %v", err)
+	}
+	periodKey := dispatcher.BudgetPeriodKey(types.BudgetPeriodMonth, now)
+	if err := store.AddBudgetSpend(ctx, "test-ns", periodKey, 1.5, 100); err != nil {
+		t.Fatalf("AddBudgetSpend failed: %v", err)
+	}
+
+	storagetest.Seed(t, store, "test-ns", 0, n, json.RawMessage(`{"model":"gpt-4"}`))
+}
+
+func TestMigrateSQLiteToPebble(t *testing.T) {
+	dir := t.TempDir()
+
+	src, err := sqlite.New(filepath.Join(dir, "src.db"))
+	if err != nil {
+		t.Fatalf("Failed to create source: %v", err)
+	}
+	defer src.Close()
+
+	dst, err := pebbledb.New(filepath.Join(dir, "dst"), false)
+	if err != nil {
+		t.Fatalf("Failed to create destination: %v", err)
+	}
+	defer dst.Close()
+
+	seedStore(t, src, 25)
+
+	m := &Migrator{
+		Src:            src,
+		Dst:            dst,
+		BatchSize:      7,
+		CheckpointPath: filepath.Join(dir, "checkpoint"),
+		Logf:           t.Logf,
+	}
+	ctx := context.Background()
+	if err := m.Run(ctx); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if err := m.Verify(ctx); err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+
+	// Running again copies nothing new and does not double the budget spend
+	if err := m.Run(ctx); err != nil {
+		t.Fatalf("Second run failed: %v", err)
+	}
+	spend, err := dst.GetBudgetSpend(ctx, "test-ns", dispatcher.BudgetPeriodKey(types.BudgetPeriodMonth, time.Now()))
+	if err != nil {
+		t.Fatalf("GetBudgetSpend failed: %v", err)
+	}
+	if spend.SpentUSD != 1.5 || spend.SpentTokens != 100 {
+		t.Errorf("Expected budget spend 1.5/100, got %v/%d", spend.SpentUSD, spend.SpentTokens)
+	}
+
+	want, _ := src.GetRequest(ctx, "test-ns_000")
+	got, err := dst.GetRequest(ctx, "test-ns_000")
+	if err != nil || got == nil {
+		t.Fatalf("GetRequest failed: %v", err)
+	}
+	if got.Status != want.Status || string(got.ResponsePayload) != `{"id": "resp_test-ns_000"}` || got.Usage != want.Usage {
+		t.Errorf("Request not copied faithfully: %+v", got)
+	}
+	if !got.CreatedAt.Equal(want.CreatedAt) || !got.CompletedAt.Equal(*want.CompletedAt) {
+		t.Errorf("Timestamps not preserved: got %v/%v, want %v/%v", got.CreatedAt, got.CompletedAt, want.CreatedAt, want.CompletedAt)
+	}
+
+	failed, _ := dst.GetRequest(ctx, "test-ns_001")
+	if failed == nil || failed.Error == nil || *failed.Error != "upstream failed" {
+		t.Errorf("Error not preserved: %+v", failed)
+	}
+}
+
+// flakyStore fails imports after a number of successful ones
+type flakyStore struct {
+	storage.Store
+	remaining int
+}
+
+func (s *flakyStore) ImportRequest(ctx context.Context, req *storage.RequestRecord) error {
+	if s.remaining == 0 {
+		return errors.New("connection lost")
+	}
+	s.remaining--
+	return s.Store.ImportRequest(ctx, req)
+}
+
+func TestMigrateResumesFromCheckpoint(t *testing.T) {
+	ctx := context.Background()
+	src := memory.New()
+	dst := memory.New()
+	seedStore(t, src, 20)
+
+	checkpointPath := filepath.Join(t.TempDir(), "checkpoint")
+	m := &Migrator{
+		Src:            src,
+		Dst:            &flakyStore{Store: dst, remaining: 12},
+		BatchSize:      5,
+		CheckpointPath: checkpointPath,
+		From:           "memory:src",
+		To:             "memory:dst",
+		Logf:           t.Logf,
+	}
+	if err := m.Run(ctx); err == nil {
+		t.Fatal("Expected the interrupted run to fail")
+	}
+	if err := m.Verify(ctx); err == nil {
+		t.Fatal("Expected verification to fail on a partial copy")
+	}
+
+	cp, err := m.loadCheckpoint()
+	if err != nil {
+		t.Fatalf("loadCheckpoint failed: %v", err)
+	}
+	if cp.Copied != 10 || cp.LastID != "test-ns_009" {
+		t.Fatalf("Expected checkpoint after two batches, got %+v", cp)
+	}
+
+	m.Dst = dst
+	if err := m.Run(ctx); err != nil {
+		t.Fatalf("Resumed run failed: %v", err)
+	}
+	if err := m.Verify(ctx); err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+
+	cp, _ = m.loadCheckpoint()
+	if cp.Copied != 20 {
+		t.Errorf("Expected 20 copied in total, got %d", cp.Copied)
+	}
+}
+
+func TestMigrateRefusesOtherCheckpoint(t *testing.T) {
+	ctx := context.Background()
+	src := memory.New()
+	seedStore(t, src, 10)
+
+	checkpointPath := filepath.Join(t.TempDir(), "checkpoint")
+	m := &Migrator{
+		Src:            src,
+		Dst:            &flakyStore{Store: memory.New(), remaining: 5},
+		BatchSize:      5,
+		CheckpointPath: checkpointPath,
+		From:           "memory:src",
+		To:             "memory:dst",
+		Logf:           t.Logf,
+	}
+	if err := m.Run(ctx); err == nil {
+		t.Fatal("Expected the interrupted run to fail")
+	}
+
+	// A migration into another store must not skip what this one copied
+	other := memory.New()
+	m.Dst = other
+	m.To = "memory:other"
+	if err := m.Run(ctx); err == nil || !strings.Contains(err.Error(), "is for a migration from") {
+		t.Fatalf("Expected the checkpoint to be refused, got %v", err)
+	}
+	if stats, err := other.GetNamespaceStats(ctx, "test-ns"); err == nil && stats.TotalRequests != 0 {
+		t.Errorf("Expected no requests copied, got %d", stats.TotalRequests)
+	}
+}
@@ -2,9 +2,13 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"strconv"
+	"sync"
 	"syscall"
 	"time"
 
@@ -14,9 +18,14 @@ import (
 	"github.com/gofiber/fiber/v2/middleware/recover"
 
 	"github.com/georgeshao/ai-inference-dam/internal/api"
+	"github.com/georgeshao/ai-inference-dam/internal/archive"
 	"github.com/georgeshao/ai-inference-dam/internal/dispatcher"
 	"github.com/georgeshao/ai-inference-dam/internal/storage"
+	"github.com/georgeshao/ai-inference-dam/internal/storage/blob"
+	"github.com/georgeshao/ai-inference-dam/internal/storage/compression"
+	"github.com/georgeshao/ai-inference-dam/internal/storage/memory"
 	"github.com/georgeshao/ai-inference-dam/internal/storage/pebbledb"
+	"github.com/georgeshao/ai-inference-dam/internal/storage/postgres"
 	"github.com/georgeshao/ai-inference-dam/internal/storage/sqlite"
 )
 
@@ -28,6 +37,10 @@ const (
 )
 
 func main() {
+	migrateOnly := flag.Bool("migrate-only", false, "apply pending schema migrations and exit")
+	dryRun := flag.Bool("dry-run", false, "with -migrate-only, list pending migrations without applying them")
+	flag.Parse()
+
 	port := getEnv("PORT", DefaultPort)
 	if port[0] != ':' {
 		port = ":" + port
@@ -35,20 +48,60 @@ func main() {
 
 	storageType := getEnv("STORAGE_TYPE", DefaultStorageType)
 	storagePath := getEnv("STORAGE_PATH", DefaultStoragePath)
+	compressionOpts, err := compressionOptions()
+	if err != nil {
+		log.Fatalf("Invalid compression settings: %v", err)
+	}
+	blobOpts, err := blobOptions()
+	if err != nil {
+		log.Fatalf("Invalid blob settings: %v", err)
+	}
+	archiveOpts, err := archiveOptions()
+	if err != nil {
+		log.Fatalf("Invalid archive settings: %v", err)
+	}
+
+	// Only the embedded backends store payloads themselves, so the others
+	// cannot honour settings about how payloads are stored
+	embedded := storageType == "sqlite" || storageType == "pebbledb"
+	if compressionOpts.Enabled && !embedded {
+		log.Fatalf("STORAGE_COMPRESSION is only supported for sqlite and pebbledb storage")
+	}
+	if blobOpts.Dir != "" && !embedded {
+		log.Fatalf("STORAGE_BLOB_DIR is only supported for sqlite and pebbledb storage")
+	}
 
 	var store storage.Store
-	var err error
 
 	switch storageType {
 	case "sqlite":
 		if !hasExtension(storagePath, ".db") {
 			storagePath = storagePath + ".db"
 		}
-		store, err = sqlite.New(storagePath)
+		if *migrateOnly {
+			if err := migrateSQLite(storagePath, *dryRun); err != nil {
+				log.Fatalf("Migration failed: %v", err)
+			}
+			return
+		}
+		store, err = sqlite.New(storagePath, sqlite.WithCompression(compressionOpts), sqlite.WithBlobs(blobOpts))
 	case "pebbledb":
-		store, err = pebbledb.New(storagePath, true)
+		if *migrateOnly {
+			if err := migratePebble(storagePath, *dryRun); err != nil {
+				log.Fatalf("Migration failed: %v", err)
+			}
+			return
+		}
+		store, err = pebbledb.New(storagePath, true, pebbledb.WithCompression(compressionOpts), pebbledb.WithBlobs(blobOpts))
+	case "memory":
+		store = memory.New()
+		storagePath = "process memory"
+	case "postgres":
+		// The DSN carries credentials, so keep it out of the log line below
+		store, err = postgres.New(os.Getenv("POSTGRES_DSN"))
+		storagePath = "$POSTGRES_DSN"
 	default:
-		log.Fatalf("Unknown storage type: %s (supported: sqlite, pebbledb)", storageType)
+		log.Fatalf("Unknown storage type: %s (supported: sqlite, pebbledb, postgres, memory)", storageType)
 	}
 
 	if err != nil {
@@ -58,14 +111,80 @@ func main() {
 
 	log.Printf("Using %s storage at %s", storageType, storagePath)
 
+	// Other backends bring their schema up to date when opened
+	if *migrateOnly {
+		if *dryRun {
+			log.Fatalf("-dry-run is only supported for sqlite and pebbledb storage")
+		}
+		log.Printf("Schema for %s storage is up to date", storageType)
+		return
+	}
+
 	if err := ensureDefaultNamespace(store); err != nil {
 		log.Fatalf("Failed to create default namespace: %v", err)
 	}
 
 	// Initialize dispatcher
 	dispatcherConfig := dispatcher.DefaultConfig()
+	if pricingFile := os.Getenv("PRICING_FILE"); pricingFile != "" {
+		pricing, err := dispatcher.LoadPricing(pricingFile)
+		if err != nil {
+			log.Fatalf("Failed to load pricing: %v", err)
+		}
+		dispatcherConfig.Pricing = pricing
+		log.Printf("Loaded pricing for %d models from %s", len(pricing), pricingFile)
+	}
+	dispatcherConfig.InstanceID = getEnv("INSTANCE_ID", dispatcherConfig.InstanceID)
+	if grace := os.Getenv("SHUTDOWN_GRACE_PERIOD"); grace != "" {
+		gracePeriod, err := time.ParseDuration(grace)
+		if err != nil {
+			log.Fatalf("Invalid SHUTDOWN_GRACE_PERIOD: %v", err)
+		}
+		dispatcherConfig.ShutdownGracePeriod = gracePeriod
+	}
+	if interval := os.Getenv("RETENTION_INTERVAL"); interval != "" {
+		retentionInterval, err := time.ParseDuration(interval)
+		if err != nil || retentionInterval <= 0 {
+			log.Fatalf("Invalid RETENTION_INTERVAL: %s", interval)
+		}
+		dispatcherConfig.RetentionInterval = retentionInterval
+	}
+	var archiver *archive.Archiver
+	if archiveOpts.Dir != "" {
+		archiver, err = archive.New(store, archiveOpts)
+		if err != nil {
+			log.Fatalf("Failed to open archive: %v", err)
+		}
+		// Neither retention nor a purge may delete what the archive has yet
+		// to copy
+		dispatcherConfig.RetentionFloor = archiver.ArchivedThrough
+	}
 	d := dispatcher.New(store, dispatcherConfig)
 
+	// Requeue requests left processing by a crash before accepting work
+	if err := d.Recover(context.Background()); err != nil {
+		log.Fatalf("Failed to recover leased requests: %v", err)
+	}
+
+	sweepCtx, stopSweeper := context.WithCancel(context.Background())
+	defer stopSweeper()
+	var background sync.WaitGroup
+	goBackground := func(run func(context.Context)) {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			run(sweepCtx)
+		}()
+	}
+	goBackground(d.RunSweeper)
+	goBackground(d.RunJanitor)
+	if collector, ok := store.(storage.BlobCollector); ok && blobOpts.Dir != "" {
+		goBackground(func(ctx context.Context) { runBlobCollector(ctx, collector) })
+	}
+	if archiver != nil {
+		goBackground(func(ctx context.Context) { runArchiver(ctx, archiver) })
+	}
+
 	// Initialize Fiber app
 	app := fiber.New(fiber.Config{
 		ReadTimeout:  30 * time.Second,
@@ -104,6 +223,192 @@ func main() {
 	if err := app.Listen(port); err != nil {
 		log.Fatalf("Failed to start server: %v", err)
 	}
+
+	// Stop the background loops and drain dispatches before the deferred
+	// store.Close flushes the batch writer, so nothing writes to a closed
+	// store
+	stopSweeper()
+	background.Wait()
+	log.Printf("Waiting up to %s for active dispatches...", dispatcherConfig.ShutdownGracePeriod)
+	d.Shutdown()
+	log.Println("Dispatcher stopped")
+}
+
+// migrateSQLite applies pending migrations, or with dryRun only lists them.
+func migrateSQLite(path string, dryRun bool) error {
+	store, err := sqlite.Open(path)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	version, err := store.SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+	pending, err := store.PendingMigrations(ctx)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("SQLite database %s is at schema version %d with %d pending migrations", path, version, len(pending))
+	if dryRun {
+		for _, m := range pending {
+			log.Printf("Pending: %s", m.Name)
+		}
+		return nil
+	}
+
+	applied, err := store.Migrate(ctx)
+	for _, m := range applied {
+		log.Printf("Applied: %s", m.Name)
+	}
+	return err
+}
+
+// migratePebble upgrades the database format, or with dryRun only lists the
+// pending format migrations.
+func migratePebble(path string, dryRun bool) error {
+	store, err := pebbledb.Open(path, false)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	version, err := store.FormatVersion()
+	if err != nil {
+		return err
+	}
+	pending, err := store.PendingMigrations()
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Pebble database %s is at format version %d with %d pending migrations", path, version, len(pending))
+	if dryRun {
+		for _, m := range pending {
+			log.Printf("Pending: %d %s", m.Version, m.Name)
+		}
+		return nil
+	}
+
+	applied, err := store.Migrate()
+	for _, m := range applied {
+		log.Printf("Applied: %d %s", m.Version, m.Name)
+	}
+	return err
+}
+
+// compressionOptions reads payload compression settings for the sqlite and
+// pebbledb backends: STORAGE_COMPRESSION=zstd enables it and
+// STORAGE_COMPRESSION_LEVEL picks the zstd level.
+func compressionOptions() (compression.Options, error) {
+	var opts compression.Options
+	switch algo := getEnv("STORAGE_COMPRESSION", "none"); algo {
+	case "none":
+	case "zstd":
+		opts.Enabled = true
+	default:
+		return opts, fmt.Errorf("unknown STORAGE_COMPRESSION %q (supported: zstd, none)", algo)
+	}
+
+	if level := os.Getenv("STORAGE_COMPRESSION_LEVEL"); level != "" {
+		n, err := strconv.Atoi(level)
+		if err != nil {
+			return opts, fmt.Errorf("invalid STORAGE_COMPRESSION_LEVEL: %w", err)
+		}
+		opts.Level = n
+	}
+	return opts, nil
+}
+
+// blobOptions reads payload offloading settings for the sqlite and pebbledb
+// backends: STORAGE_BLOB_DIR enables it and STORAGE_BLOB_THRESHOLD sets the
+// payload size in bytes above which payloads are offloaded.
+func blobOptions() (blob.Options, error) {
+	opts := blob.Options{Dir: os.Getenv("STORAGE_BLOB_DIR")}
+
+	if threshold := os.Getenv("STORAGE_BLOB_THRESHOLD"); threshold != "" {
+		n, err := strconv.Atoi(threshold)
+		if err != nil || n <= 0 {
+			return opts, fmt.Errorf("invalid STORAGE_BLOB_THRESHOLD %q", threshold)
+		}
+		opts.Threshold = n
+	}
+	return opts, nil
+}
+
+// blobCollectInterval is how often blobs left behind by interrupted writes
+// are swept up. Blobs of deleted requests are removed as they are deleted.
+const blobCollectInterval = time.Hour
+
+func runBlobCollector(ctx context.Context, collector storage.BlobCollector) {
+	ticker := time.NewTicker(blobCollectInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			removed, err := collector.CollectBlobs(ctx)
+			if err != nil {
+				log.Printf("Failed to collect blobs: %v", err)
+			} else if removed > 0 {
+				log.Printf("Removed %d unreferenced blobs", removed)
+			}
+		}
+	}
+}
+
+// archiveOptions reads the archiver configuration. Archiving is off unless
+// ARCHIVE_DIR is set.
+func archiveOptions() (archive.Options, error) {
+	opts := archive.Options{
+		Dir:    os.Getenv("ARCHIVE_DIR"),
+		Delete: os.Getenv("ARCHIVE_DELETE") == "true",
+	}
+
+	if size := os.Getenv("ARCHIVE_MAX_FILE_SIZE"); size != "" {
+		n, err := strconv.ParseInt(size, 10, 64)
+		if err != nil || n <= 0 {
+			return opts, fmt.Errorf("invalid ARCHIVE_MAX_FILE_SIZE %q", size)
+		}
+		opts.MaxFileSize = n
+	}
+	if age := os.Getenv("ARCHIVE_MAX_FILE_AGE"); age != "" {
+		d, err := time.ParseDuration(age)
+		if err != nil || d <= 0 {
+			return opts, fmt.Errorf("invalid ARCHIVE_MAX_FILE_AGE %q", age)
+		}
+		opts.MaxFileAge = d
+	}
+	return opts, nil
+}
+
+// archiveInterval is how often finished requests are appended to the
+// archive.
+const archiveInterval = time.Hour
+
+func runArchiver(ctx context.Context, archiver *archive.Archiver) {
+	ticker := time.NewTicker(archiveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			archived, err := archiver.Run(ctx, time.Now())
+			if err != nil {
+				log.Printf("Failed to archive requests: %v", err)
+			}
+			if archived > 0 {
+				log.Printf("Archived %d requests", archived)
+			}
+		}
+	}
 }
 
 func getEnv(key, defaultValue string) string {
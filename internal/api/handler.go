@@ -1,6 +1,9 @@
 package api
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"strings"
 	"time"
 
@@ -9,6 +12,7 @@ import (
 
 	"github.com/georgeshao/ai-inference-dam/internal/dispatcher"
 	"github.com/georgeshao/ai-inference-dam/internal/storage"
+	"github.com/georgeshao/ai-inference-dam/internal/storage/compression"
 	"github.com/georgeshao/ai-inference-dam/pkg/types"
 )
 
@@ -34,6 +38,22 @@ func (h *Handler) CreateNamespace(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(types.ErrorResponse{Error: "Name is required"})
 	}
 
+	if err := validateProvider(req.Provider, nil); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(types.ErrorResponse{Error: err.Error()})
+	}
+
+	if err := validateBudget(req.Budget); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(types.ErrorResponse{Error: err.Error()})
+	}
+
+	if req.Cache != nil && req.Cache.TTLSeconds < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(types.ErrorResponse{Error: "Cache ttl_seconds must not be negative"})
+	}
+
+	if err := validateRetention(req.Retention); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(types.ErrorResponse{Error: err.Error()})
+	}
+
 	existing, err := h.store.GetNamespace(c.Context(), req.Name)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(types.ErrorResponse{Error: "Failed to check namespace"})
@@ -46,6 +66,9 @@ func (h *Handler) CreateNamespace(c *fiber.Ctx) error {
 	record := &storage.NamespaceRecord{
 		Name:        req.Name,
 		Description: req.Description,
+		Budget:      budgetToRecord(req.Budget),
+		Cache:       cacheToRecord(req.Cache),
+		Retention:   retentionToRecord(req.Retention),
 		CreatedAt:   now,
 		UpdatedAt:   now,
 	}
@@ -55,6 +78,10 @@ func (h *Handler) CreateNamespace(c *fiber.Ctx) error {
 		record.ProviderAPIKey = req.Provider.APIKey
 		record.ProviderModel = req.Provider.Model
 		record.ProviderHeaders = req.Provider.Headers
+		record.ProviderType = req.Provider.Type
+		record.ProviderAWS = awsToRecord(req.Provider.AWS, nil)
+		record.URLTemplate = req.Provider.URLTemplate
+		record.QueryParams = req.Provider.QueryParams
 	}
 
 	if err := h.store.CreateNamespace(c.Context(), record); err != nil {
@@ -91,6 +118,29 @@ func (h *Handler) GetNamespace(c *fiber.Ctx) error {
 		Processing:    stats.Processing,
 		Completed:     stats.Completed,
 		Failed:        stats.Failed,
+
+		PromptTokens:     stats.PromptTokens,
+		CompletionTokens: stats.CompletionTokens,
+		CachedTokens:     stats.CachedTokens,
+		ReasoningTokens:  stats.ReasoningTokens,
+		CostUSD:          stats.CostUSD,
+
+		CacheHits:   stats.CacheHits,
+		CacheMisses: stats.CacheMisses,
+
+		PayloadBytes:       stats.PayloadBytes,
+		StoredPayloadBytes: stats.StoredPayloadBytes,
+	}
+	if stats.StoredPayloadBytes > 0 {
+		resp.Stats.CompressionRatio = float64(stats.PayloadBytes) / float64(stats.StoredPayloadBytes)
+	}
+
+	if record.Budget != nil {
+		spend, err := h.store.GetBudgetSpend(c.Context(), name, dispatcher.BudgetPeriodKey(record.Budget.Period, time.Now()))
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(types.ErrorResponse{Error: "Failed to get budget status"})
+		}
+		resp.BudgetStatus = spendToBudgetStatus(spend)
 	}
 
 	return c.JSON(resp)
@@ -115,6 +165,22 @@ func (h *Handler) UpdateNamespace(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusNotFound).JSON(types.ErrorResponse{Error: "Namespace not found"})
 	}
 
+	if err := validateProvider(req.Provider, existing.ProviderAWS); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(types.ErrorResponse{Error: err.Error()})
+	}
+
+	if err := validateBudget(req.Budget); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(types.ErrorResponse{Error: err.Error()})
+	}
+
+	if req.Cache != nil && req.Cache.TTLSeconds < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(types.ErrorResponse{Error: "Cache ttl_seconds must not be negative"})
+	}
+
+	if err := validateRetention(req.Retention); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(types.ErrorResponse{Error: err.Error()})
+	}
+
 	if req.Description != nil {
 		existing.Description = *req.Description
 	}
@@ -123,6 +189,19 @@ func (h *Handler) UpdateNamespace(c *fiber.Ctx) error {
 		existing.ProviderAPIKey = req.Provider.APIKey
 		existing.ProviderModel = req.Provider.Model
 		existing.ProviderHeaders = req.Provider.Headers
+		existing.ProviderType = req.Provider.Type
+		existing.ProviderAWS = awsToRecord(req.Provider.AWS, existing.ProviderAWS)
+		existing.URLTemplate = req.Provider.URLTemplate
+		existing.QueryParams = req.Provider.QueryParams
+	}
+	if req.Budget != nil {
+		existing.Budget = budgetToRecord(req.Budget)
+	}
+	if req.Cache != nil {
+		existing.Cache = cacheToRecord(req.Cache)
+	}
+	if req.Retention != nil {
+		existing.Retention = retentionToRecord(req.Retention)
 	}
 	existing.UpdatedAt = time.Now()
 
@@ -130,6 +209,20 @@ func (h *Handler) UpdateNamespace(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).JSON(types.ErrorResponse{Error: "Failed to update namespace"})
 	}
 
+	// A raised limit takes effect immediately rather than on the next dispatch
+	if req.Budget != nil && existing.Budget != nil {
+		periodKey := dispatcher.BudgetPeriodKey(existing.Budget.Period, time.Now())
+		spend, err := h.store.GetBudgetSpend(c.Context(), name, periodKey)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(types.ErrorResponse{Error: "Failed to get budget status"})
+		}
+		if spend.ExhaustedAt != nil && !dispatcher.BudgetExceeded(existing.Budget, spend.SpentUSD, spend.SpentTokens) {
+			if err := h.store.SetBudgetExhausted(c.Context(), name, periodKey, nil); err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(types.ErrorResponse{Error: "Failed to update budget status"})
+			}
+		}
+	}
+
 	resp := recordToNamespace(existing)
 	return c.JSON(resp)
 }
@@ -156,6 +249,112 @@ func (h *Handler) DeleteNamespace(c *fiber.Ctx) error {
 	})
 }
 
+// ResetBudget clears the spend and exhausted state recorded against a
+// namespace budget so that dispatch can resume.
+func (h *Handler) ResetBudget(c *fiber.Ctx) error {
+	name := c.Params("name")
+	if name == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(types.ErrorResponse{Error: "Name is required"})
+	}
+
+	record, err := h.store.GetNamespace(c.Context(), name)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(types.ErrorResponse{Error: "Failed to get namespace"})
+	}
+	if record == nil {
+		return c.Status(fiber.StatusNotFound).JSON(types.ErrorResponse{Error: "Namespace not found"})
+	}
+
+	if err := h.store.ResetBudget(c.Context(), name); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(types.ErrorResponse{Error: "Failed to reset budget"})
+	}
+
+	resp := recordToNamespace(record)
+	if record.Budget != nil {
+		resp.BudgetStatus = &types.BudgetStatus{Period: dispatcher.BudgetPeriodKey(record.Budget.Period, time.Now())}
+	}
+	return c.JSON(resp)
+}
+
+func (h *Handler) PurgeNamespace(c *fiber.Ctx) error {
+	name := c.Params("name")
+	if name == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(types.ErrorResponse{Error: "Name is required"})
+	}
+
+	var req types.PurgeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(types.ErrorResponse{Error: "Invalid request body"})
+	}
+
+	statuses := []types.RequestStatus{types.StatusCompleted, types.StatusFailed}
+	switch req.Status {
+	case "":
+	case types.StatusCompleted, types.StatusFailed:
+		statuses = []types.RequestStatus{req.Status}
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(types.ErrorResponse{Error: "Only completed or failed requests can be purged"})
+	}
+	if req.OlderThanDays == nil || *req.OlderThanDays <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(types.ErrorResponse{Error: "older_than_days must be a positive number of days"})
+	}
+
+	record, err := h.store.GetNamespace(c.Context(), name)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(types.ErrorResponse{Error: "Failed to get namespace"})
+	}
+	if record == nil {
+		return c.Status(fiber.StatusNotFound).JSON(types.ErrorResponse{Error: "Namespace not found"})
+	}
+
+	before := time.Now().AddDate(0, 0, -*req.OlderThanDays)
+	var resp types.PurgeResponse
+	for _, status := range statuses {
+		purged, err := h.dispatcher.Purge(c.Context(), name, status, before)
+		resp.Purged += purged
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(types.ErrorResponse{Error: "Failed to purge requests"})
+		}
+	}
+	return c.JSON(resp)
+}
+
+func (h *Handler) TrainCompressionDictionary(c *fiber.Ctx) error {
+	name := c.Params("name")
+	if name == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(types.ErrorResponse{Error: "Name is required"})
+	}
+
+	trainer, ok := h.store.(storage.DictionaryTrainer)
+	if !ok {
+		return c.Status(fiber.StatusNotImplemented).JSON(types.ErrorResponse{Error: "Storage backend does not support compression dictionaries"})
+	}
+
+	record, err := h.store.GetNamespace(c.Context(), name)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(types.ErrorResponse{Error: "Failed to get namespace"})
+	}
+	if record == nil {
+		return c.Status(fiber.StatusNotFound).JSON(types.ErrorResponse{Error: "Namespace not found"})
+	}
+
+	dict, err := trainer.TrainDictionary(c.Context(), name)
+	if errors.Is(err, compression.ErrDisabled) || errors.Is(err, compression.ErrNoSamples) {
+		return c.Status(fiber.StatusBadRequest).JSON(types.ErrorResponse{Error: err.Error()})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(types.ErrorResponse{Error: "Failed to train compression dictionary"})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(types.CompressionDictionaryResponse{
+		ID:        dict.ID,
+		Namespace: dict.Namespace,
+		Size:      dict.Size,
+		Samples:   dict.Samples,
+		CreatedAt: dict.CreatedAt.Format(time.RFC3339),
+	})
+}
+
 func (h *Handler) ListNamespaces(c *fiber.Ctx) error {
 	records, err := h.store.ListNamespaces(c.Context())
 	if err != nil {
@@ -181,10 +380,13 @@ func (h *Handler) QueueChatCompletion(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusNotFound).JSON(types.ErrorResponse{Error: "Namespace not found: " + namespace})
 	}
 
-	var payload map[string]interface{}
-	if err := c.BodyParser(&payload); err != nil {
+	// The body is stored exactly as sent, so that the provider receives the
+	// same bytes; it only has to be a JSON object.
+	body := bytes.TrimSpace(c.Body())
+	if len(body) == 0 || body[0] != '{' || !json.Valid(body) {
 		return c.Status(fiber.StatusBadRequest).JSON(types.ErrorResponse{Error: "Invalid request body"})
 	}
+	payload := json.RawMessage(bytes.Clone(c.Body()))
 
 	var headerEndpoint, headerAPIKey *string
 	passthroughHeaders := make(map[string]string)
@@ -270,11 +472,15 @@ func (h *Handler) ListRequests(c *fiber.Ctx) error {
 		filter.Status = &s
 	}
 	if cursor != "" {
-		t, err := time.Parse(time.RFC3339Nano, cursor)
+		// A cursor is the last request's created_at and, so that requests
+		// created in the same second are not skipped, its ID
+		createdAt, id, _ := strings.Cut(cursor, ",")
+		t, err := time.Parse(time.RFC3339Nano, createdAt)
 		if err != nil {
 			return c.Status(fiber.StatusBadRequest).JSON(types.ErrorResponse{Error: "Invalid cursor format"})
 		}
 		filter.Cursor = &t
+		filter.CursorID = id
 	}
 
 	records, total, err := h.store.ListRequests(c.Context(), filter)
@@ -287,11 +493,12 @@ func (h *Handler) ListRequests(c *fiber.Ctx) error {
 		requests[i] = recordToRequest(record)
 	}
 
-	// Set next cursor from last item's created_at if we have results
+	// Set next cursor from last item's created_at and ID if we have results
 	var nextCursor *string
 	if len(records) == limit {
-		lastCreatedAt := records[len(records)-1].CreatedAt.Format(time.RFC3339Nano)
-		nextCursor = &lastCreatedAt
+		last := records[len(records)-1]
+		next := last.CreatedAt.Format(time.RFC3339Nano) + "," + last.ID
+		nextCursor = &next
 	}
 
 	return c.JSON(types.ListRequestsResponse{
@@ -320,12 +527,13 @@ func (h *Handler) TriggerDispatch(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusNotFound).JSON(types.ErrorResponse{Error: "Namespace not found"})
 	}
 
-	queuedRequests, err := h.store.GetQueuedRequests(c.Context(), req.Namespace)
+	// Count from stats rather than loading the queue, which may be large
+	stats, err := h.store.GetNamespaceStats(c.Context(), req.Namespace)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(types.ErrorResponse{Error: "Failed to get queued requests"})
 	}
 
-	if len(queuedRequests) == 0 {
+	if stats.Queued == 0 {
 		return c.Status(fiber.StatusOK).JSON(types.DispatchResponse{
 			DispatchID:  "disp_" + uuid.New().String(),
 			Namespace:   req.Namespace,
@@ -340,7 +548,7 @@ func (h *Handler) TriggerDispatch(c *fiber.Ctx) error {
 	return c.Status(fiber.StatusAccepted).JSON(types.DispatchResponse{
 		DispatchID:  dispatchID,
 		Namespace:   req.Namespace,
-		QueuedCount: len(queuedRequests),
+		QueuedCount: stats.Queued,
 		Status:      "dispatching",
 	})
 }
@@ -2,17 +2,22 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
-	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 
 	"github.com/georgeshao/ai-inference-dam/internal/dispatcher"
+	"github.com/georgeshao/ai-inference-dam/internal/storage"
+	"github.com/georgeshao/ai-inference-dam/internal/storage/compression"
+	"github.com/georgeshao/ai-inference-dam/internal/storage/memory"
 	"github.com/georgeshao/ai-inference-dam/internal/storage/sqlite"
 	"github.com/georgeshao/ai-inference-dam/pkg/types"
 )
@@ -20,20 +25,7 @@ import (
 func setupTestApp(t *testing.T) (*fiber.App, func()) {
 	t.Helper()
 
-	// Create temp directory
-	tempDir, err := os.MkdirTemp("", "api_test")
-	if err != nil {
-		t.Fatalf("Failed to create temp dir: %v", err)
-	}
-
-	dbPath := filepath.Join(tempDir, "test.db")
-	store, err := sqlite.New(dbPath)
-	if err != nil {
-		if removeErr := os.RemoveAll(tempDir); removeErr != nil {
-			t.Logf("Failed to remove temp dir: %v", removeErr)
-		}
-		t.Fatalf("Failed to create store: %v", err)
-	}
+	store := memory.New()
 
 	d := dispatcher.New(store, dispatcher.DefaultConfig())
 
@@ -46,9 +38,6 @@ func setupTestApp(t *testing.T) (*fiber.App, func()) {
 		if closeErr := store.Close(); closeErr != nil {
 			t.Logf("Failed to close store: %v", closeErr)
 		}
-		if removeErr := os.RemoveAll(tempDir); removeErr != nil {
-			t.Logf("Failed to remove temp dir: %v", removeErr)
-		}
 	}
 
 	return app, cleanup
@@ -219,6 +208,119 @@ func TestUpdateNamespace(t *testing.T) {
 	}
 }
 
+func TestCreateBedrockNamespace(t *testing.T) {
+	app, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	// Missing credentials are rejected
+	body := `{"name": "bedrock-ns", "provider": {"type": "bedrock"}}`
+	req := httptest.NewRequest(http.MethodPost, "/namespaces", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", resp.StatusCode)
+	}
+
+	body = `{"name": "bedrock-ns", "provider": {"type": "bedrock", "aws": {"region": "us-east-1", "access_key_id": "AKID", "secret_access_key": "secret"}}}`
+	req = httptest.NewRequest(http.MethodPost, "/namespaces", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err = app.Test(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", resp.StatusCode)
+	}
+
+	var ns types.Namespace
+	if err := json.NewDecoder(resp.Body).Decode(&ns); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if ns.Provider == nil || ns.Provider.Type != types.ProviderBedrock {
+		t.Fatalf("Provider type mismatch: %+v", ns.Provider)
+	}
+	if ns.Provider.AWS == nil || ns.Provider.AWS.Region != "us-east-1" || ns.Provider.AWS.AccessKeyID != "AKID" {
+		t.Errorf("AWS credentials mismatch: %+v", ns.Provider.AWS)
+	}
+	if ns.Provider.AWS != nil && ns.Provider.AWS.SecretAccessKey != nil {
+		t.Error("Secret access key should not be returned")
+	}
+}
+
+func TestNamespaceBudget(t *testing.T) {
+	app, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	body := `{"name": "budget-ns", "budget": {"limit_usd": 5, "period": "week"}}`
+	req := httptest.NewRequest(http.MethodPost, "/namespaces", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for invalid period, got %d", resp.StatusCode)
+	}
+
+	body = `{"name": "budget-ns", "budget": {"limit_usd": 5, "period": "day"}}`
+	req = httptest.NewRequest(http.MethodPost, "/namespaces", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err = app.Test(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", resp.StatusCode)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/namespaces/budget-ns", nil)
+	resp, err = app.Test(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+
+	var ns types.Namespace
+	if err := json.NewDecoder(resp.Body).Decode(&ns); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if ns.Budget == nil || ns.Budget.LimitUSD == nil || *ns.Budget.LimitUSD != 5 || ns.Budget.Period != types.BudgetPeriodDay {
+		t.Fatalf("Budget mismatch: %+v", ns.Budget)
+	}
+	if ns.BudgetStatus == nil || ns.BudgetStatus.Exhausted || len(ns.BudgetStatus.Period) != len("2006-01-02") {
+		t.Errorf("Budget status mismatch: %+v", ns.BudgetStatus)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/namespaces/budget-ns/budget/reset", nil)
+	resp, err = app.Test(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", resp.StatusCode)
+	}
+
+	// An empty budget removes it
+	body = `{"budget": {}}`
+	req = httptest.NewRequest(http.MethodPatch, "/namespaces/budget-ns", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err = app.Test(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+
+	ns = types.Namespace{}
+	if err := json.NewDecoder(resp.Body).Decode(&ns); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if ns.Budget != nil {
+		t.Errorf("Budget should be removed: %+v", ns.Budget)
+	}
+}
+
 func TestDeleteNamespace(t *testing.T) {
 	app, cleanup := setupTestApp(t)
 	defer cleanup()
@@ -280,6 +382,253 @@ func TestDeleteDefaultNamespace(t *testing.T) {
 	}
 }
 
+func TestPurgeNamespace(t *testing.T) {
+	store := memory.New()
+	d := dispatcher.New(store, dispatcher.DefaultConfig())
+	defer d.Wait()
+	app := fiber.New()
+	SetupRoutes(app, store, d)
+
+	post := func(path, body string) *http.Response {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		return resp
+	}
+
+	if resp := post("/namespaces/missing/purge", `{"older_than_days": 30}`); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", resp.StatusCode)
+	}
+
+	resp := post("/namespaces", `{"name": "test-ns", "retention": {"completed_days": 30, "failed_days": 90}}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", resp.StatusCode)
+	}
+	var ns types.Namespace
+	if err := json.NewDecoder(resp.Body).Decode(&ns); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if ns.Retention == nil || ns.Retention.CompletedDays != 30 || ns.Retention.FailedDays != 90 {
+		t.Errorf("Unexpected retention: %+v", ns.Retention)
+	}
+
+	if resp := post("/namespaces", `{"name": "bad-ns", "retention": {"failed_days": -1}}`); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for negative retention, got %d", resp.StatusCode)
+	}
+
+	ctx := context.Background()
+	now := time.Now()
+	// All created long ago; the last finished only yesterday
+	for i, status := range []types.RequestStatus{types.StatusCompleted, types.StatusFailed, types.StatusQueued, types.StatusCompleted} {
+		age := 40
+		if i == 3 {
+			age = 1
+		}
+		req := &storage.RequestRecord{
+			ID:             fmt.Sprintf("req-%d", i),
+			Namespace:      "test-ns",
+			Status:         status,
+			RequestPayload: json.RawMessage(`{"model":"gpt-4"}`),
+			CreatedAt:      now.AddDate(0, 0, -60),
+		}
+		if status != types.StatusQueued {
+			completedAt := now.AddDate(0, 0, -age)
+			req.CompletedAt = &completedAt
+		}
+		if err := store.ImportRequest(ctx, req); err != nil {
+			t.Fatalf("ImportRequest failed: %v", err)
+		}
+	}
+
+	for body, reason := range map[string]string{
+		`{"status": "queued", "older_than_days": 30}`: "a queued purge",
+		`{"older_than_days": -1}`:                     "negative days",
+		`{"older_than_days": 0}`:                      "zero days",
+		`{"status": "completed"}`:                     "missing days",
+		`{}`:                                          "an empty body",
+	} {
+		if resp := post("/namespaces/test-ns/purge", body); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %s, got %d", reason, resp.StatusCode)
+		}
+	}
+	if stats, _ := store.GetNamespaceStats(ctx, "test-ns"); stats.TotalRequests != 4 {
+		t.Errorf("Rejected purges deleted requests: %+v", stats)
+	}
+
+	resp = post("/namespaces/test-ns/purge", `{"older_than_days": 30}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+	var purge types.PurgeResponse
+	if err := json.NewDecoder(resp.Body).Decode(&purge); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if purge.Purged != 2 {
+		t.Errorf("Expected the old completed and failed requests purged, got %d", purge.Purged)
+	}
+
+	stats, err := store.GetNamespaceStats(ctx, "test-ns")
+	if err != nil {
+		t.Fatalf("GetNamespaceStats failed: %v", err)
+	}
+	if stats.TotalRequests != 2 || stats.Queued != 1 || stats.Completed != 1 {
+		t.Errorf("Unexpected stats after purge: %+v", stats)
+	}
+}
+
+func TestPurgeNamespaceKeepsUnarchived(t *testing.T) {
+	store := memory.New()
+	var floor time.Time
+	config := dispatcher.DefaultConfig()
+	config.RetentionFloor = func() time.Time { return floor }
+	d := dispatcher.New(store, config)
+	defer d.Wait()
+	app := fiber.New()
+	SetupRoutes(app, store, d)
+
+	ctx := context.Background()
+	now := time.Now()
+	if err := store.CreateNamespace(ctx, &storage.NamespaceRecord{Name: "test-ns", CreatedAt: now, UpdatedAt: now}); err != nil {
+		t.Fatalf("CreateNamespace failed: %v", err)
+	}
+	for id, age := range map[string]int{"archived": 60, "unarchived": 40} {
+		completedAt := now.AddDate(0, 0, -age)
+		if err := store.ImportRequest(ctx, &storage.RequestRecord{
+			ID:             id,
+			Namespace:      "test-ns",
+			Status:         types.StatusCompleted,
+			RequestPayload: json.RawMessage(`{"model":"gpt-4"}`),
+			CreatedAt:      completedAt,
+			CompletedAt:    &completedAt,
+		}); err != nil {
+			t.Fatalf("ImportRequest failed: %v", err)
+		}
+	}
+
+	purge := func() int {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/namespaces/test-ns/purge", bytes.NewBufferString(`{"older_than_days": 30}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+		}
+		var purged types.PurgeResponse
+		if err := json.NewDecoder(resp.Body).Decode(&purged); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return purged.Purged
+	}
+
+	// Nothing is purged before the archive's first run, and then only what
+	// it has copied
+	if purged := purge(); purged != 0 {
+		t.Errorf("Expected nothing purged before archiving, got %d", purged)
+	}
+	floor = now.AddDate(0, 0, -50)
+	if purged := purge(); purged != 1 {
+		t.Errorf("Expected the archived request purged, got %d", purged)
+	}
+	if req, err := store.GetRequest(ctx, "unarchived"); err != nil || req == nil {
+		t.Errorf("Expected the unarchived request kept: %v", err)
+	}
+}
+
+func TestTrainCompressionDictionary(t *testing.T) {
+	app, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	req := httptest.NewRequest(http.MethodPost, "/namespaces", bytes.NewBufferString(`{"name": "test-ns"}`))
+	req.Header.Set("Content-Type", "application/json")
+	if _, err := app.Test(req); err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+
+	// The memory store keeps payloads uncompressed
+	req = httptest.NewRequest(http.MethodPost, "/namespaces/test-ns/compression/dictionary", nil)
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusNotImplemented {
+		t.Errorf("Expected status 501, got %d", resp.StatusCode)
+	}
+
+	store, err := sqlite.New(filepath.Join(t.TempDir(), "test.db"), sqlite.WithCompression(compression.Options{Enabled: true}))
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+	d := dispatcher.New(store, dispatcher.DefaultConfig())
+	defer d.Wait()
+	app = fiber.New()
+	SetupRoutes(app, store, d)
+
+	ctx := context.Background()
+	now := time.Now()
+	if err := store.CreateNamespace(ctx, &storage.NamespaceRecord{Name: "test-ns", CreatedAt: now, UpdatedAt: now}); err != nil {
+		t.Fatalf("CreateNamespace failed: %v", err)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/namespaces/test-ns/compression/dictionary", nil)
+	resp, err = app.Test(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status 400 without payloads, got %d", resp.StatusCode)
+	}
+
+	for i := 0; i < 50; i++ {
+		payload := fmt.Sprintf(`{"model":"gpt-4o","messages":[{"role":"system","content":"You are a support assistant for an online store. Answer briefly and politely."},{"role":"user","content":"Where is my order #%d? It has not arrived yet."}]}`, 1000+i)
+		if err := store.CreateRequest(ctx, &storage.RequestRecord{
+			ID:             fmt.Sprintf("req-%d", i),
+			Namespace:      "test-ns",
+			Status:         types.StatusQueued,
+			RequestPayload: json.RawMessage(payload),
+			CreatedAt:      now.Add(time.Duration(i) * time.Second),
+		}); err != nil {
+			t.Fatalf("CreateRequest failed: %v", err)
+		}
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/namespaces/test-ns/compression/dictionary", nil)
+	resp, err = app.Test(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", resp.StatusCode)
+	}
+	var dict types.CompressionDictionaryResponse
+	if err := json.NewDecoder(resp.Body).Decode(&dict); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if dict.Namespace != "test-ns" || dict.Samples != 50 || dict.Size == 0 {
+		t.Errorf("Unexpected dictionary: %+v", dict)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/namespaces/test-ns", nil)
+	resp, err = app.Test(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	var ns types.Namespace
+	if err := json.NewDecoder(resp.Body).Decode(&ns); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if ns.Stats == nil || ns.Stats.CompressionRatio <= 1 {
+		t.Errorf("Expected a compression ratio above 1, got %+v", ns.Stats)
+	}
+}
+
 func TestListNamespaces(t *testing.T) {
 	app, cleanup := setupTestApp(t)
 	defer cleanup()
@@ -464,6 +813,57 @@ func TestGetRequest(t *testing.T) {
 	}
 }
 
+func TestQueueChatCompletionPreservesBody(t *testing.T) {
+	app, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	req := httptest.NewRequest(http.MethodPost, "/namespaces", bytes.NewBufferString(`{"name": "default"}`))
+	req.Header.Set("Content-Type", "application/json")
+	if _, err := app.Test(req); err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+
+	for _, body := range []string{`[1, 2]`, `{"model": "gpt-4"`, ``} {
+		req = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %q, got %d", body, resp.StatusCode)
+		}
+	}
+
+	// A seed beyond float64 precision and non-alphabetical key order
+	body := `{"seed":9007199254740993,"model":"gpt-4","messages":[{"role":"user","content":"Hello!"}]}`
+	req = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+
+	var queued types.QueuedRequestResponse
+	if err := json.NewDecoder(resp.Body).Decode(&queued); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/requests/"+queued.ID, nil)
+	resp, err = app.Test(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+
+	var request types.Request
+	if err := json.NewDecoder(resp.Body).Decode(&request); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if string(request.Request) != body {
+		t.Errorf("Request body not preserved:\ngot  %s\nwant %s", request.Request, body)
+	}
+}
+
 func TestListRequests(t *testing.T) {
 	app, cleanup := setupTestApp(t)
 	defer cleanup()
@@ -15,6 +15,9 @@ func SetupRoutes(app *fiber.App, store storage.Store, d *dispatcher.Dispatcher)
 	app.Get("/namespaces/:name", h.GetNamespace)
 	app.Patch("/namespaces/:name", h.UpdateNamespace)
 	app.Delete("/namespaces/:name", h.DeleteNamespace)
+	app.Post("/namespaces/:name/budget/reset", h.ResetBudget)
+	app.Post("/namespaces/:name/purge", h.PurgeNamespace)
+	app.Post("/namespaces/:name/compression/dictionary", h.TrainCompressionDictionary)
 
 	app.Get("/requests", h.ListRequests)
 	app.Get("/requests/:id", h.GetRequest)
@@ -1,8 +1,12 @@
 package api
 
 import (
+	"errors"
+	"net/url"
+	"strings"
 	"time"
 
+	"github.com/georgeshao/ai-inference-dam/internal/dispatcher"
 	"github.com/georgeshao/ai-inference-dam/internal/storage"
 	"github.com/georgeshao/ai-inference-dam/pkg/types"
 )
@@ -15,17 +19,180 @@ func recordToNamespace(record *storage.NamespaceRecord) types.Namespace {
 		UpdatedAt:   record.UpdatedAt.Format(time.RFC3339),
 	}
 
-	if record.ProviderEndpoint != nil || record.ProviderModel != nil || len(record.ProviderHeaders) > 0 {
+	if record.ProviderEndpoint != nil || record.ProviderModel != nil || len(record.ProviderHeaders) > 0 ||
+		record.ProviderType != "" || record.ProviderAWS != nil || record.URLTemplate != nil || len(record.QueryParams) > 0 {
 		ns.Provider = &types.ProviderOverride{
+			Type:        record.ProviderType,
 			APIEndpoint: record.ProviderEndpoint,
 			Model:       record.ProviderModel,
 			Headers:     record.ProviderHeaders,
+			URLTemplate: record.URLTemplate,
+			QueryParams: record.QueryParams,
+		}
+		// Only the non-secret half of the AWS credentials is echoed back
+		if record.ProviderAWS != nil {
+			ns.Provider.AWS = &types.AWSCredentials{
+				Region:      record.ProviderAWS.Region,
+				AccessKeyID: record.ProviderAWS.AccessKeyID,
+			}
+		}
+	}
+
+	if record.Budget != nil {
+		ns.Budget = &types.Budget{
+			LimitUSD:    record.Budget.LimitUSD,
+			LimitTokens: record.Budget.LimitTokens,
+			Period:      record.Budget.Period,
+		}
+	}
+
+	if record.Cache != nil {
+		ns.Cache = &types.CacheConfig{TTLSeconds: record.Cache.TTLSeconds}
+	}
+
+	if record.Retention != nil {
+		ns.Retention = &types.RetentionPolicy{
+			CompletedDays: record.Retention.CompletedDays,
+			FailedDays:    record.Retention.FailedDays,
 		}
 	}
 
 	return ns
 }
 
+func spendToBudgetStatus(spend *storage.BudgetSpend) *types.BudgetStatus {
+	status := &types.BudgetStatus{
+		Period:      spend.PeriodKey,
+		SpentUSD:    spend.SpentUSD,
+		SpentTokens: spend.SpentTokens,
+		Exhausted:   spend.ExhaustedAt != nil,
+	}
+	if spend.ExhaustedAt != nil {
+		exhaustedAt := spend.ExhaustedAt.Format(time.RFC3339)
+		status.ExhaustedAt = &exhaustedAt
+	}
+	return status
+}
+
+func validateBudget(b *types.Budget) error {
+	if b == nil {
+		return nil
+	}
+	switch b.Period {
+	case types.BudgetPeriodLifetime, types.BudgetPeriodDay, types.BudgetPeriodMonth:
+	default:
+		return errors.New("Invalid budget period: " + string(b.Period))
+	}
+	if b.LimitUSD != nil && *b.LimitUSD <= 0 {
+		return errors.New("Budget limit_usd must be positive")
+	}
+	if b.LimitTokens != nil && *b.LimitTokens <= 0 {
+		return errors.New("Budget limit_tokens must be positive")
+	}
+	return nil
+}
+
+// budgetToRecord converts an API budget to its stored form. A budget without
+// any limit removes the budget.
+func budgetToRecord(b *types.Budget) *storage.Budget {
+	if b == nil || (b.LimitUSD == nil && b.LimitTokens == nil) {
+		return nil
+	}
+	return &storage.Budget{
+		LimitUSD:    b.LimitUSD,
+		LimitTokens: b.LimitTokens,
+		Period:      b.Period,
+	}
+}
+
+// cacheToRecord converts an API cache config to its stored form. A zero TTL
+// disables the cache.
+func cacheToRecord(c *types.CacheConfig) *storage.CacheConfig {
+	if c == nil || c.TTLSeconds <= 0 {
+		return nil
+	}
+	return &storage.CacheConfig{TTLSeconds: c.TTLSeconds}
+}
+
+func validateRetention(r *types.RetentionPolicy) error {
+	if r != nil && (r.CompletedDays < 0 || r.FailedDays < 0) {
+		return errors.New("Retention days must not be negative")
+	}
+	return nil
+}
+
+// retentionToRecord converts an API retention policy to its stored form. A
+// policy that keeps everything forever removes the policy.
+func retentionToRecord(r *types.RetentionPolicy) *storage.RetentionPolicy {
+	if r == nil || (r.CompletedDays == 0 && r.FailedDays == 0) {
+		return nil
+	}
+	return &storage.RetentionPolicy{
+		CompletedDays: r.CompletedDays,
+		FailedDays:    r.FailedDays,
+	}
+}
+
+// validateProvider checks the URL template, the provider type and, for
+// bedrock, that a complete set of AWS credentials is available. existingAWS
+// is consulted on updates, where the secret may be omitted to keep the stored
+// one.
+func validateProvider(p *types.ProviderOverride, existingAWS *storage.AWSCredentials) error {
+	if p == nil {
+		return nil
+	}
+
+	if p.URLTemplate != nil && *p.URLTemplate != "" {
+		expanded := strings.NewReplacer("{model}", "model", "{namespace}", "namespace").Replace(*p.URLTemplate)
+		if _, err := url.Parse(expanded); err != nil {
+			return errors.New("Invalid url_template: " + err.Error())
+		}
+	}
+
+	if _, ok := dispatcher.LookupProvider(p.Type); !ok {
+		return errors.New("Unknown provider type: " + string(p.Type))
+	}
+	if p.Type != types.ProviderBedrock {
+		return nil
+	}
+
+	aws := awsToRecord(p.AWS, existingAWS)
+	if aws == nil || aws.Region == "" || aws.AccessKeyID == "" || aws.SecretAccessKey == "" {
+		return errors.New("Bedrock provider requires aws region, access_key_id and secret_access_key")
+	}
+	return nil
+}
+
+// awsToRecord converts API credentials to their stored form. A missing secret
+// or session token falls back to existing when the access key is unchanged.
+func awsToRecord(aws *types.AWSCredentials, existing *storage.AWSCredentials) *storage.AWSCredentials {
+	if aws == nil {
+		return nil
+	}
+
+	record := &storage.AWSCredentials{
+		Region:      aws.Region,
+		AccessKeyID: aws.AccessKeyID,
+	}
+	if aws.SecretAccessKey != nil {
+		record.SecretAccessKey = *aws.SecretAccessKey
+	}
+	if aws.SessionToken != nil {
+		record.SessionToken = *aws.SessionToken
+	}
+
+	if existing != nil && existing.AccessKeyID == aws.AccessKeyID {
+		if aws.SecretAccessKey == nil {
+			record.SecretAccessKey = existing.SecretAccessKey
+		}
+		if aws.SessionToken == nil {
+			record.SessionToken = existing.SessionToken
+		}
+	}
+
+	return record
+}
+
 func recordToRequest(record *storage.RequestRecord) types.Request {
 	req := types.Request{
 		ID:        record.ID,
@@ -52,6 +219,26 @@ func recordToRequest(record *storage.RequestRecord) types.Request {
 		req.Response = record.ResponsePayload
 	}
 
+	req.CacheHit = record.CacheHit
+	req.CoalescedWith = record.CoalescedWith
+	req.Attempts = record.Attempts
+	req.LeaseOwner = record.LeaseOwner
+
+	if record.LeaseExpiresAt != nil {
+		leaseExpiresAt := record.LeaseExpiresAt.Format(time.RFC3339)
+		req.LeaseExpiresAt = &leaseExpiresAt
+	}
+
+	if record.Status == types.StatusCompleted {
+		req.Usage = &types.RequestUsage{
+			PromptTokens:     record.Usage.PromptTokens,
+			CompletionTokens: record.Usage.CompletionTokens,
+			CachedTokens:     record.Usage.CachedTokens,
+			ReasoningTokens:  record.Usage.ReasoningTokens,
+			CostUSD:          record.Usage.CostUSD,
+		}
+	}
+
 	if record.Error != nil {
 		req.Error = record.Error
 	}
@@ -0,0 +1,356 @@
+// Package archive copies completed and failed requests out of a store into
+// gzip-compressed JSONL files, one series of files per namespace, and
+// imports them back.
+//
+// The archive directory holds manifest.json and a directory per namespace.
+// Each batch appends a gzip member to the namespace's current file, which
+// gzip readers see as one stream, and a new file is started once the
+// current one reaches MaxFileSize or MaxFileAge. The manifest records the
+// committed length of every file, so a member torn by a crash is cut off
+// before the next append and never read back.
+package archive
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/georgeshao/ai-inference-dam/internal/storage"
+	"github.com/georgeshao/ai-inference-dam/pkg/types"
+)
+
+// Options configures an Archiver.
+type Options struct {
+	Dir string
+	// A namespace's file is rotated once it holds MaxFileSize compressed
+	// bytes or was started MaxFileAge ago. A file may overshoot the size by
+	// up to one batch. Zero uses DefaultMaxFileSize and DefaultMaxFileAge.
+	MaxFileSize int64
+	MaxFileAge  time.Duration
+	// Delete removes archived requests from the store once their file and
+	// the manifest are on disk.
+	Delete bool
+	// BatchSize is how many requests are read from the store at a time.
+	// Zero uses DefaultBatchSize.
+	BatchSize int
+}
+
+const (
+	DefaultMaxFileSize = 64 << 20
+	DefaultMaxFileAge  = 24 * time.Hour
+	DefaultBatchSize   = 500
+
+	// settleTime leaves requests that finished moments ago, whose writes
+	// may still be buffered by the store, for the next run.
+	settleTime = time.Minute
+)
+
+// Record is one line of an archive file. Payloads are JSON strings holding
+// the stored bytes, which keeps them byte-for-byte and every record on a
+// single line. The per-request API key and the lease are left out.
+type Record struct {
+	ID                 string              `json:"id"`
+	Namespace          string              `json:"namespace"`
+	Status             types.RequestStatus `json:"status"`
+	Request            string              `json:"request"`
+	Response           *string             `json:"response,omitempty"`
+	PassthroughHeaders map[string]string   `json:"passthrough_headers,omitempty"`
+	HeaderEndpoint     *string             `json:"header_endpoint,omitempty"`
+	Error              *string             `json:"error,omitempty"`
+	PromptTokens       int64               `json:"prompt_tokens,omitempty"`
+	CompletionTokens   int64               `json:"completion_tokens,omitempty"`
+	CachedTokens       int64               `json:"cached_tokens,omitempty"`
+	ReasoningTokens    int64               `json:"reasoning_tokens,omitempty"`
+	CostUSD            float64             `json:"cost_usd,omitempty"`
+	CacheHit           bool                `json:"cache_hit,omitempty"`
+	CoalescedWith      *string             `json:"coalesced_with,omitempty"`
+	CreatedAt          time.Time           `json:"created_at"`
+	DispatchedAt       *time.Time          `json:"dispatched_at,omitempty"`
+	CompletedAt        *time.Time          `json:"completed_at,omitempty"`
+	Attempts           int                 `json:"attempts,omitempty"`
+}
+
+func newRecord(req *storage.RequestRecord) *Record {
+	record := &Record{
+		ID:                 req.ID,
+		Namespace:          req.Namespace,
+		Status:             req.Status,
+		Request:            string(req.RequestPayload),
+		PassthroughHeaders: req.PassthroughHeaders,
+		HeaderEndpoint:     req.HeaderEndpoint,
+		Error:              req.Error,
+		PromptTokens:       req.Usage.PromptTokens,
+		CompletionTokens:   req.Usage.CompletionTokens,
+		CachedTokens:       req.Usage.CachedTokens,
+		ReasoningTokens:    req.Usage.ReasoningTokens,
+		CostUSD:            req.Usage.CostUSD,
+		CacheHit:           req.CacheHit,
+		CoalescedWith:      req.CoalescedWith,
+		CreatedAt:          req.CreatedAt.UTC(),
+		DispatchedAt:       utc(req.DispatchedAt),
+		CompletedAt:        utc(req.CompletedAt),
+		Attempts:           req.Attempts,
+	}
+	if req.ResponsePayload != nil {
+		response := string(req.ResponsePayload)
+		record.Response = &response
+	}
+	return record
+}
+
+// toRequest returns the request to import for r into namespace.
+func (r *Record) toRequest(namespace string) *storage.RequestRecord {
+	req := &storage.RequestRecord{
+		ID:                 r.ID,
+		Namespace:          namespace,
+		Status:             r.Status,
+		RequestPayload:     json.RawMessage(r.Request),
+		PassthroughHeaders: r.PassthroughHeaders,
+		HeaderEndpoint:     r.HeaderEndpoint,
+		Error:              r.Error,
+		Usage: storage.Usage{
+			PromptTokens:     r.PromptTokens,
+			CompletionTokens: r.CompletionTokens,
+			CachedTokens:     r.CachedTokens,
+			ReasoningTokens:  r.ReasoningTokens,
+			CostUSD:          r.CostUSD,
+		},
+		CacheHit:      r.CacheHit,
+		CoalescedWith: r.CoalescedWith,
+		CreatedAt:     r.CreatedAt,
+		DispatchedAt:  r.DispatchedAt,
+		CompletedAt:   r.CompletedAt,
+		Attempts:      r.Attempts,
+	}
+	if r.Response != nil {
+		req.ResponsePayload = json.RawMessage(*r.Response)
+	}
+	return req
+}
+
+func utc(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := t.UTC()
+	return &u
+}
+
+// Archiver appends finished requests from a store to an archive directory.
+// Only one Archiver may write to a directory at a time.
+type Archiver struct {
+	store    storage.Store
+	opts     Options
+	manifest *Manifest
+
+	// mu guards through, the manifest's ArchivedThrough as last saved, which
+	// is read while a run is in progress.
+	mu      sync.Mutex
+	through time.Time
+}
+
+// New creates the archive directory if needed and loads its manifest.
+func New(store storage.Store, opts Options) (*Archiver, error) {
+	if opts.MaxFileSize == 0 {
+		opts.MaxFileSize = DefaultMaxFileSize
+	}
+	if opts.MaxFileAge == 0 {
+		opts.MaxFileAge = DefaultMaxFileAge
+	}
+	if opts.BatchSize == 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create archive directory: %w", err)
+	}
+
+	manifest, err := LoadManifest(opts.Dir)
+	if err != nil {
+		return nil, err
+	}
+	return &Archiver{store: store, opts: opts, manifest: manifest, through: manifest.ArchivedThrough}, nil
+}
+
+// ArchivedThrough returns the completion time before which every finished
+// request has been archived, or the zero time before the first complete
+// run. It is safe to call while Run is in progress.
+func (a *Archiver) ArchivedThrough() time.Time {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.through
+}
+
+// Run archives the completed and failed requests that finished before now
+// and returns how many were archived. Each namespace is read a page at a
+// time through the store's completion index, and without Delete only from
+// where the last run stopped. A run that fails part way is repeated by the
+// next, so a request may be archived twice; restoring keeps the last copy.
+func (a *Archiver) Run(ctx context.Context, now time.Time) (int, error) {
+	until := now.Add(-settleTime).Truncate(time.Second)
+	since := a.manifest.ArchivedThrough
+	if a.opts.Delete {
+		// Whatever is still in the store has not been archived, or was
+		// archived by a run that failed before deleting it
+		since = time.Time{}
+	}
+
+	namespaces, err := a.store.ListNamespaces(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list namespaces: %w", err)
+	}
+
+	archived := 0
+	for _, ns := range namespaces {
+		for _, status := range []types.RequestStatus{types.StatusCompleted, types.StatusFailed} {
+			n, err := a.archiveRequests(ctx, ns.Name, status, since, until, now)
+			archived += n
+			if err != nil {
+				return archived, fmt.Errorf("namespace %s: %w", ns.Name, err)
+			}
+		}
+	}
+
+	if until.After(a.manifest.ArchivedThrough) {
+		a.manifest.ArchivedThrough = until
+		if err := a.manifest.save(a.opts.Dir); err != nil {
+			return archived, err
+		}
+		a.mu.Lock()
+		a.through = until
+		a.mu.Unlock()
+	}
+	return archived, nil
+}
+
+// archiveRequests archives the requests in namespace with status that
+// finished at or after since and before until, and returns how many were
+// archived.
+func (a *Archiver) archiveRequests(ctx context.Context, namespace string, status types.RequestStatus, since, until, now time.Time) (int, error) {
+	archived := 0
+	afterID := ""
+	for {
+		batch, err := a.store.ListFinishedRequests(ctx, namespace, status, since, until, afterID, a.opts.BatchSize)
+		if err != nil {
+			return archived, err
+		}
+		if len(batch) == 0 {
+			return archived, nil
+		}
+
+		if err := a.append(namespace, batch, now); err != nil {
+			return archived, err
+		}
+		if err := a.manifest.save(a.opts.Dir); err != nil {
+			return archived, err
+		}
+		archived += len(batch)
+
+		if a.opts.Delete {
+			ids := make([]string, len(batch))
+			for i, req := range batch {
+				ids[i] = req.ID
+			}
+			if _, err := a.store.DeleteRequests(ctx, ids); err != nil {
+				return archived, err
+			}
+		}
+
+		last := batch[len(batch)-1]
+		since, afterID = *last.CompletedAt, last.ID
+	}
+}
+
+// append writes requests as a new gzip member of namespace's current file
+// and records it in the manifest once the file is synced.
+func (a *Archiver) append(namespace string, requests []*storage.RequestRecord, now time.Time) error {
+	file, isNew := a.currentFile(namespace, now)
+	path := filepath.Join(a.opts.Dir, file.Name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create archive directory: %w", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open archive file: %w", err)
+	}
+	defer f.Close()
+
+	// Cut off a member left by a write that never made it to the manifest
+	if err := f.Truncate(file.Size); err != nil {
+		return fmt.Errorf("failed to truncate archive file: %w", err)
+	}
+	if _, err := f.Seek(file.Size, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek archive file: %w", err)
+	}
+
+	counter := &countingWriter{w: f}
+	zw := gzip.NewWriter(counter)
+	enc := json.NewEncoder(zw)
+	enc.SetEscapeHTML(false)
+	for _, req := range requests {
+		if err := enc.Encode(newRecord(req)); err != nil {
+			return fmt.Errorf("failed to write archive record: %w", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to write archive file: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync archive file: %w", err)
+	}
+	if isNew {
+		// The archive directory itself is synced with the manifest
+		if err := syncDir(filepath.Dir(path)); err != nil {
+			return fmt.Errorf("failed to sync archive directory: %w", err)
+		}
+	}
+
+	file.Size += counter.n
+	file.Requests += len(requests)
+	file.UpdatedAt = now.UTC()
+	if isNew {
+		a.manifest.Files = append(a.manifest.Files, file)
+	}
+	return nil
+}
+
+// currentFile returns the file to append namespace's next batch to,
+// starting a new one when there is none or the last is due for rotation. A
+// new file is only added to the manifest once something is written to it.
+func (a *Archiver) currentFile(namespace string, now time.Time) (*File, bool) {
+	files := a.manifest.NamespaceFiles(namespace)
+	if n := len(files); n > 0 {
+		last := files[n-1]
+		if last.Size < a.opts.MaxFileSize && now.Sub(last.CreatedAt) < a.opts.MaxFileAge {
+			return last, false
+		}
+	}
+
+	// Files are named by when they were started, with a suffix for any
+	// started within the same second
+	dir := url.PathEscape(namespace)
+	stamp := now.UTC().Format("20060102T150405Z")
+	name := filepath.Join(dir, stamp+".jsonl.gz")
+	for i := 1; a.manifest.file(name) != nil; i++ {
+		name = filepath.Join(dir, fmt.Sprintf("%s-%d.jsonl.gz", stamp, i))
+	}
+	return &File{Name: name, Namespace: namespace, CreatedAt: now.UTC(), UpdatedAt: now.UTC()}, true
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
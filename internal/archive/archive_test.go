@@ -0,0 +1,316 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/georgeshao/ai-inference-dam/internal/storage"
+	"github.com/georgeshao/ai-inference-dam/internal/storage/memory"
+	"github.com/georgeshao/ai-inference-dam/internal/storage/storagetest"
+	"github.com/georgeshao/ai-inference-dam/pkg/types"
+)
+
+// A body as a client might send it, with spacing and key order to keep
+var prettyPayload = json.RawMessage("{\n  \"model\": \"gpt-4\",\n  \"seed\": 12345678901234567890,\n  \"messages\": [{\"role\": \"user\", \"content\": \"<b>Hi</b>\"}]\n}")
+
+func TestArchiveAndRestore(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	dir := t.TempDir()
+	storagetest.Seed(t, store, "alpha", 0, 6, prettyPayload)
+	storagetest.Seed(t, store, "beta", 0, 3, prettyPayload)
+
+	archiver, err := New(store, Options{Dir: dir})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	// Requests that only just finished wait for the next run
+	archived, err := archiver.Run(ctx, time.Now())
+	if err != nil || archived != 0 {
+		t.Errorf("Run = %d, %v; want nothing archived yet", archived, err)
+	}
+
+	later := time.Now().Add(2 * settleTime)
+	archived, err = archiver.Run(ctx, later)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if archived != 6 {
+		t.Errorf("Expected the 6 completed and failed requests archived, got %d", archived)
+	}
+
+	// Without Delete the requests stay, and are not archived again
+	if stats, err := store.GetNamespaceStats(ctx, "alpha"); err != nil || stats.TotalRequests != 6 {
+		t.Errorf("Expected alpha to keep its requests: %+v, %v", stats, err)
+	}
+	archived, err = archiver.Run(ctx, later.Add(time.Minute))
+	if err != nil || archived != 0 {
+		t.Errorf("Second run = %d, %v; want nothing archived", archived, err)
+	}
+
+	manifest, err := LoadManifest(dir)
+	if err != nil {
+		t.Fatalf("LoadManifest failed: %v", err)
+	}
+	if len(manifest.Files) != 2 {
+		t.Fatalf("Expected a file per namespace, got %d", len(manifest.Files))
+	}
+	for _, f := range manifest.Files {
+		info, err := os.Stat(filepath.Join(dir, f.Name))
+		if err != nil {
+			t.Fatalf("Archive file missing: %v", err)
+		}
+		if info.Size() != f.Size {
+			t.Errorf("%s: manifest size %d, file size %d", f.Name, f.Size, info.Size())
+		}
+	}
+	if files := manifest.NamespaceFiles("alpha"); len(files) != 1 || files[0].Requests != 4 {
+		t.Errorf("Unexpected alpha files: %+v", files)
+	}
+
+	// Restore alpha's archive into a fresh namespace
+	now := time.Now()
+	if err := store.CreateNamespace(ctx, &storage.NamespaceRecord{Name: "restored", CreatedAt: now, UpdatedAt: now}); err != nil {
+		t.Fatalf("CreateNamespace failed: %v", err)
+	}
+	restored, err := Restore(ctx, store, dir, "alpha", "restored")
+	if err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if restored != 4 {
+		t.Errorf("Expected 4 restored, got %d", restored)
+	}
+
+	req, err := store.GetRequest(ctx, "alpha_000")
+	if err != nil || req == nil {
+		t.Fatalf("GetRequest failed: %v", err)
+	}
+	if req.Namespace != "restored" || req.Status != types.StatusCompleted {
+		t.Errorf("Unexpected restored request: %s %s", req.Namespace, req.Status)
+	}
+	if !bytes.Equal(req.RequestPayload, []byte(prettyPayload)) {
+		t.Errorf("Request payload changed: %s", req.RequestPayload)
+	}
+	if string(req.ResponsePayload) != `{"id": "resp_alpha_000"}` {
+		t.Errorf("Response payload changed: %s", req.ResponsePayload)
+	}
+	if req.Usage.PromptTokens != 10 || req.CompletedAt == nil {
+		t.Errorf("Usage or completion time lost: %+v", req)
+	}
+
+	stats, err := store.GetNamespaceStats(ctx, "restored")
+	if err != nil {
+		t.Fatalf("GetNamespaceStats failed: %v", err)
+	}
+	if stats.Completed != 2 || stats.Failed != 2 || stats.PromptTokens != 20 {
+		t.Errorf("Unexpected stats after restore: %+v", stats)
+	}
+
+	if _, err := Restore(ctx, store, dir, "alpha", "missing"); err == nil {
+		t.Error("Expected an error restoring into a missing namespace")
+	}
+}
+
+func TestArchiveDelete(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	dir := t.TempDir()
+	storagetest.Seed(t, store, "alpha", 0, 6, prettyPayload)
+
+	archiver, err := New(store, Options{Dir: dir, Delete: true, BatchSize: 4})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if through := archiver.ArchivedThrough(); !through.IsZero() {
+		t.Errorf("Expected nothing archived yet, got %v", through)
+	}
+	now := time.Now().Add(2 * settleTime)
+	archived, err := archiver.Run(ctx, now)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if archived != 4 {
+		t.Errorf("Expected 4 archived, got %d", archived)
+	}
+	until := now.Add(-settleTime).Truncate(time.Second)
+	if through := archiver.ArchivedThrough(); !through.Equal(until) {
+		t.Errorf("Expected archived through %v, got %v", until, through)
+	}
+	if reopened, err := New(store, Options{Dir: dir}); err != nil || !reopened.ArchivedThrough().Equal(until) {
+		t.Errorf("Expected the reopened archive through %v: %v", until, err)
+	}
+
+	stats, err := store.GetNamespaceStats(ctx, "alpha")
+	if err != nil {
+		t.Fatalf("GetNamespaceStats failed: %v", err)
+	}
+	if stats.TotalRequests != 2 || stats.Queued != 2 {
+		t.Errorf("Expected only the queued requests left, got %+v", stats)
+	}
+
+	restored, err := Restore(ctx, store, dir, "alpha", "alpha")
+	if err != nil || restored != 4 {
+		t.Errorf("Restore = %d, %v; want 4", restored, err)
+	}
+	if stats, err := store.GetNamespaceStats(ctx, "alpha"); err != nil || stats.TotalRequests != 6 {
+		t.Errorf("Expected all requests back: %+v, %v", stats, err)
+	}
+}
+
+func TestArchiveRotation(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	dir := t.TempDir()
+	storagetest.Seed(t, store, "alpha", 0, 12, prettyPayload)
+
+	// Every batch fills a file
+	archiver, err := New(store, Options{Dir: dir, MaxFileSize: 1, BatchSize: 3, Delete: true})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	now := time.Now().Add(2 * settleTime)
+	if _, err := archiver.Run(ctx, now); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	manifest, err := LoadManifest(dir)
+	if err != nil {
+		t.Fatalf("LoadManifest failed: %v", err)
+	}
+	if len(manifest.Files) != 4 {
+		t.Errorf("Expected a file per batch, got %d", len(manifest.Files))
+	}
+
+	// Later runs share a file until it is old enough
+	store = memory.New()
+	dir = t.TempDir()
+	archiver, err = New(store, Options{Dir: dir, MaxFileAge: time.Hour, Delete: true})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	for i, at := range []time.Duration{0, 30 * time.Minute, 2 * time.Hour} {
+		storagetest.Seed(t, store, "alpha", i*3, 3, prettyPayload)
+		if _, err := archiver.Run(ctx, now.Add(at)); err != nil {
+			t.Fatalf("Run %d failed: %v", i, err)
+		}
+	}
+	manifest, err = LoadManifest(dir)
+	if err != nil {
+		t.Fatalf("LoadManifest failed: %v", err)
+	}
+	if len(manifest.Files) != 2 || manifest.Files[0].Requests != 4 || manifest.Files[1].Requests != 2 {
+		t.Errorf("Expected two files of 4 and 2 requests, got %+v", manifest.Files)
+	}
+}
+
+func TestArchiveReloadsManifest(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	dir := t.TempDir()
+	storagetest.Seed(t, store, "alpha", 0, 3, prettyPayload)
+
+	archiver, err := New(store, Options{Dir: dir, Delete: true})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	now := time.Now().Add(2 * settleTime)
+	if _, err := archiver.Run(ctx, now); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	// A restarted server picks up the manifest from disk and appends to
+	// the same file
+	storagetest.Seed(t, store, "alpha", 3, 3, prettyPayload)
+	reopened, err := New(store, Options{Dir: dir, Delete: true})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if archived, err := reopened.Run(ctx, now.Add(time.Minute)); err != nil || archived != 2 {
+		t.Fatalf("Run = %d, %v; want 2", archived, err)
+	}
+
+	manifest, err := LoadManifest(dir)
+	if err != nil {
+		t.Fatalf("LoadManifest failed: %v", err)
+	}
+	if len(manifest.Files) != 1 {
+		t.Fatalf("Expected 1 file, got %d", len(manifest.Files))
+	}
+	file := manifest.Files[0]
+	info, err := os.Stat(filepath.Join(dir, file.Name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.Requests != 4 || file.Size != info.Size() {
+		t.Errorf("Manifest has %d requests in %d bytes, want 4 in %d", file.Requests, file.Size, info.Size())
+	}
+
+	// No temporary manifest is left behind
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if entry.Name() != ManifestName && entry.Name() != "alpha" {
+			t.Errorf("Unexpected entry %s in the archive directory", entry.Name())
+		}
+	}
+
+	if n, err := Restore(ctx, store, dir, "alpha", "alpha"); err != nil || n != 4 {
+		t.Errorf("Restore = %d, %v; want 4", n, err)
+	}
+}
+
+func TestArchiveIgnoresTornWrite(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	dir := t.TempDir()
+	storagetest.Seed(t, store, "alpha", 0, 3, prettyPayload)
+
+	archiver, err := New(store, Options{Dir: dir, Delete: true})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	now := time.Now().Add(2 * settleTime)
+	if _, err := archiver.Run(ctx, now); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	// A crash part way through the next append leaves garbage past the
+	// committed size
+	manifest, err := LoadManifest(dir)
+	if err != nil {
+		t.Fatalf("LoadManifest failed: %v", err)
+	}
+	path := filepath.Join(dir, manifest.Files[0].Name)
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("\x1f\x8b\x08 torn")); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	if n, err := Restore(ctx, store, dir, "alpha", "alpha"); err != nil || n != 2 {
+		t.Errorf("Restore = %d, %v; want the 2 committed requests", n, err)
+	}
+
+	// The next append replaces the garbage
+	if _, err := store.DeleteRequests(ctx, []string{"alpha_000", "alpha_001"}); err != nil {
+		t.Fatalf("DeleteRequests failed: %v", err)
+	}
+	storagetest.Seed(t, store, "alpha", 3, 2, prettyPayload)
+	if _, err := archiver.Run(ctx, now.Add(time.Minute)); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	n, err := RestoreFile(ctx, store, path, "alpha")
+	if err != nil || n != 4 {
+		t.Errorf("RestoreFile = %d, %v; want 4", n, err)
+	}
+}
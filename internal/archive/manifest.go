@@ -0,0 +1,117 @@
+package archive
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ManifestName is the manifest's file name in the archive directory.
+const ManifestName = "manifest.json"
+
+// Manifest lists the files of an archive directory.
+type Manifest struct {
+	// ArchivedThrough is the completion time before which every finished
+	// request has been archived.
+	ArchivedThrough time.Time `json:"archived_through"`
+	// Files are in the order they were started.
+	Files []*File `json:"files"`
+}
+
+// File is one archive file. Size is its committed length in bytes; anything
+// beyond it is a torn write and is ignored.
+type File struct {
+	Name      string    `json:"name"` // relative to the archive directory
+	Namespace string    `json:"namespace"`
+	Requests  int       `json:"requests"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// LoadManifest reads the manifest of dir, which is empty if none has been
+// written yet.
+func LoadManifest(dir string) (*Manifest, error) {
+	m := &Manifest{}
+	data, err := os.ReadFile(filepath.Join(dir, ManifestName))
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	return m, nil
+}
+
+// NamespaceFiles returns the files of namespace, oldest first.
+func (m *Manifest) NamespaceFiles(namespace string) []*File {
+	var files []*File
+	for _, f := range m.Files {
+		if f.Namespace == namespace {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+func (m *Manifest) file(name string) *File {
+	for _, f := range m.Files {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// save replaces the manifest atomically so an interrupted write never
+// leaves it truncated. The new manifest is synced before the rename and the
+// directory after it, so a manifest that survives a crash never names more
+// than the archive files hold.
+func (m *Manifest) save(dir string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(dir, ManifestName)
+	tmp, err := os.CreateTemp(dir, ManifestName+".tmp-")
+	if err != nil {
+		return fmt.Errorf("failed to create manifest: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync manifest: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	if err := syncDir(dir); err != nil {
+		return fmt.Errorf("failed to sync manifest: %w", err)
+	}
+	return nil
+}
+
+// syncDir flushes the entries of dir, making files created or renamed in it
+// durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
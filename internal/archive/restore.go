@@ -0,0 +1,105 @@
+package archive
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/georgeshao/ai-inference-dam/internal/storage"
+)
+
+// maxLineSize bounds a single archived record, which holds a request and
+// its response.
+const maxLineSize = 256 << 20
+
+// Restore imports every request archived from namespace from in dir into
+// namespace to, which must exist, and returns how many were imported.
+// Requests are imported with their original IDs, replacing any request with
+// the same ID, so restoring into another namespace moves requests still in
+// the store.
+func Restore(ctx context.Context, store storage.Store, dir, from, to string) (int, error) {
+	manifest, err := LoadManifest(dir)
+	if err != nil {
+		return 0, err
+	}
+	files := manifest.NamespaceFiles(from)
+	if len(files) == 0 {
+		return 0, fmt.Errorf("no archive files for namespace %s", from)
+	}
+	if err := checkNamespace(ctx, store, to); err != nil {
+		return 0, err
+	}
+
+	restored := 0
+	for _, file := range files {
+		n, err := restoreFile(ctx, store, filepath.Join(dir, file.Name), file.Size, to)
+		restored += n
+		if err != nil {
+			return restored, fmt.Errorf("%s: %w", file.Name, err)
+		}
+	}
+	return restored, nil
+}
+
+// RestoreFile imports every request in a single archive file into namespace
+// to, which must exist, and returns how many were imported.
+func RestoreFile(ctx context.Context, store storage.Store, path, to string) (int, error) {
+	if err := checkNamespace(ctx, store, to); err != nil {
+		return 0, err
+	}
+	return restoreFile(ctx, store, path, -1, to)
+}
+
+func checkNamespace(ctx context.Context, store storage.Store, name string) error {
+	ns, err := store.GetNamespace(ctx, name)
+	if err != nil {
+		return err
+	}
+	if ns == nil {
+		return fmt.Errorf("namespace %s does not exist", name)
+	}
+	return nil
+}
+
+// restoreFile imports the first size bytes of the file at path, or all of
+// it when size is negative.
+func restoreFile(ctx context.Context, store storage.Store, path string, size int64, to string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open archive file: %w", err)
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if size >= 0 {
+		r = io.LimitReader(f, size)
+	}
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read archive file: %w", err)
+	}
+	defer zr.Close()
+
+	scanner := bufio.NewScanner(zr)
+	scanner.Buffer(nil, maxLineSize)
+	restored := 0
+	for scanner.Scan() {
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return restored, fmt.Errorf("failed to parse archive record: %w", err)
+		}
+		if err := store.ImportRequest(ctx, record.toRequest(to)); err != nil {
+			return restored, fmt.Errorf("failed to import request %s: %w", record.ID, err)
+		}
+		restored++
+	}
+	if err := scanner.Err(); err != nil {
+		return restored, fmt.Errorf("failed to read archive file: %w", err)
+	}
+	return restored, nil
+}
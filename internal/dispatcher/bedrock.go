@@ -0,0 +1,459 @@
+package dispatcher
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/georgeshao/ai-inference-dam/internal/storage"
+)
+
+const bedrockService = "bedrock"
+
+// bedrockEndpoint returns the Bedrock runtime base URL. A configured endpoint
+// (VPC endpoint, local stand-in) takes precedence over the regional default.
+func bedrockEndpoint(endpoint, region string) string {
+	if endpoint != "" {
+		return strings.TrimRight(endpoint, "/")
+	}
+	return "https://bedrock-runtime." + region + ".amazonaws.com"
+}
+
+// BedrockProvider targets the Bedrock Converse API, translating OpenAI chat
+// payloads and responses and signing requests with the namespace's AWS
+// credentials.
+type BedrockProvider struct{}
+
+func (BedrockProvider) Validate(target Target) error {
+	if target.Namespace.ProviderAWS == nil {
+		return errors.New("Missing required configuration: AWS credentials")
+	}
+	return nil
+}
+
+func (BedrockProvider) BuildRequest(ctx context.Context, target Target, payload json.RawMessage) (*http.Request, error) {
+	creds := *target.Namespace.ProviderAWS
+
+	decoded, err := decodeJSON(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse request payload: %w", err)
+	}
+	modelID, converse, err := toConverseRequest(decoded)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(converse)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request payload: %w", err)
+	}
+
+	fullURL := bedrockEndpoint(target.Endpoint, creds.Region) + "/model/" + url.PathEscape(modelID) + "/converse"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fullURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	for k, v := range target.Headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	signV4(req, body, creds, bedrockService, time.Now())
+
+	return req, nil
+}
+
+// ClassifyError uses the x-amzn-ErrorType header where present, since
+// Bedrock reports throttling and model timeouts with several status codes.
+func (BedrockProvider) ClassifyError(resp *http.Response, body []byte) *ProviderError {
+	message := string(body)
+	var parsed struct {
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(body, &parsed) == nil && parsed.Message != "" {
+		message = parsed.Message
+	}
+
+	e := classifyStatus(resp.StatusCode, message)
+
+	errorType, _, _ := strings.Cut(resp.Header.Get("X-Amzn-Errortype"), ":")
+	switch errorType {
+	case "ThrottlingException", "ServiceQuotaExceededException":
+		e.Kind, e.Retryable = ErrorKindRateLimit, true
+	case "ModelTimeoutException", "ModelNotReadyException", "ServiceUnavailableException":
+		e.Kind, e.Retryable = ErrorKindServer, true
+	case "AccessDeniedException", "UnrecognizedClientException":
+		e.Kind, e.Retryable = ErrorKindAuth, false
+	case "ValidationException", "ResourceNotFoundException":
+		e.Kind, e.Retryable = ErrorKindInvalidRequest, false
+	}
+
+	return e
+}
+
+func (BedrockProvider) ParseResponse(payload json.RawMessage, resp *http.Response, body []byte) (json.RawMessage, error) {
+	result, err := decodeJSON(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	id := resp.Header.Get("X-Amzn-Requestid")
+	if id == "" {
+		id = uuid.New().String()
+	}
+
+	return json.Marshal(fromConverseResponse(result, payloadModel(payload), "chatcmpl-"+id))
+}
+
+func (BedrockProvider) ParseUsage(response json.RawMessage) storage.Usage {
+	return parseOpenAIUsage(response)
+}
+
+// toConverseRequest maps an OpenAI chat completion payload onto a Converse
+// request body, returning the model ID separately since it is part of the URL.
+func toConverseRequest(payload map[string]interface{}) (string, map[string]interface{}, error) {
+	modelID, _ := payload["model"].(string)
+	if modelID == "" {
+		return "", nil, fmt.Errorf("request payload is missing model")
+	}
+
+	rawMessages, _ := payload["messages"].([]interface{})
+	if len(rawMessages) == 0 {
+		return "", nil, fmt.Errorf("request payload is missing messages")
+	}
+
+	var system []interface{}
+	var messages []map[string]interface{}
+
+	// Bedrock requires alternating roles, so consecutive blocks for the same
+	// role (e.g. several tool results) are merged into one message.
+	appendBlocks := func(role string, blocks []interface{}) {
+		if len(blocks) == 0 {
+			return
+		}
+		if n := len(messages); n > 0 && messages[n-1]["role"] == role {
+			messages[n-1]["content"] = append(messages[n-1]["content"].([]interface{}), blocks...)
+			return
+		}
+		messages = append(messages, map[string]interface{}{"role": role, "content": blocks})
+	}
+
+	for _, raw := range rawMessages {
+		msg, ok := raw.(map[string]interface{})
+		if !ok {
+			return "", nil, fmt.Errorf("invalid message: %v", raw)
+		}
+
+		role, _ := msg["role"].(string)
+		switch role {
+		case "system", "developer":
+			blocks, err := toConverseContent(msg["content"])
+			if err != nil {
+				return "", nil, err
+			}
+			system = append(system, blocks...)
+		case "user":
+			blocks, err := toConverseContent(msg["content"])
+			if err != nil {
+				return "", nil, err
+			}
+			appendBlocks("user", blocks)
+		case "assistant":
+			blocks, err := toConverseContent(msg["content"])
+			if err != nil {
+				return "", nil, err
+			}
+			toolUses, err := toConverseToolUses(msg["tool_calls"])
+			if err != nil {
+				return "", nil, err
+			}
+			appendBlocks("assistant", append(blocks, toolUses...))
+		case "tool":
+			text, err := contentText(msg["content"])
+			if err != nil {
+				return "", nil, err
+			}
+			toolCallID, _ := msg["tool_call_id"].(string)
+			appendBlocks("user", []interface{}{map[string]interface{}{
+				"toolResult": map[string]interface{}{
+					"toolUseId": toolCallID,
+					"content":   []interface{}{map[string]interface{}{"text": text}},
+				},
+			}})
+		default:
+			return "", nil, fmt.Errorf("unsupported message role: %q", role)
+		}
+	}
+
+	converse := map[string]interface{}{"messages": messages}
+	if len(system) > 0 {
+		converse["system"] = system
+	}
+
+	inference := map[string]interface{}{}
+	if v, ok := payload["max_completion_tokens"]; ok {
+		inference["maxTokens"] = v
+	} else if v, ok := payload["max_tokens"]; ok {
+		inference["maxTokens"] = v
+	}
+	if v, ok := payload["temperature"]; ok {
+		inference["temperature"] = v
+	}
+	if v, ok := payload["top_p"]; ok {
+		inference["topP"] = v
+	}
+	switch stop := payload["stop"].(type) {
+	case string:
+		inference["stopSequences"] = []interface{}{stop}
+	case []interface{}:
+		inference["stopSequences"] = stop
+	}
+	if len(inference) > 0 {
+		converse["inferenceConfig"] = inference
+	}
+
+	toolConfig, err := toConverseToolConfig(payload["tools"], payload["tool_choice"])
+	if err != nil {
+		return "", nil, err
+	}
+	if toolConfig != nil {
+		converse["toolConfig"] = toolConfig
+	}
+
+	return modelID, converse, nil
+}
+
+func toConverseContent(content interface{}) ([]interface{}, error) {
+	switch c := content.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		if c == "" {
+			return nil, nil
+		}
+		return []interface{}{map[string]interface{}{"text": c}}, nil
+	case []interface{}:
+		var blocks []interface{}
+		for _, raw := range c {
+			part, _ := raw.(map[string]interface{})
+			switch part["type"] {
+			case "text":
+				blocks = append(blocks, map[string]interface{}{"text": part["text"]})
+			case "image_url":
+				image, err := toConverseImage(part["image_url"])
+				if err != nil {
+					return nil, err
+				}
+				blocks = append(blocks, image)
+			default:
+				return nil, fmt.Errorf("unsupported content part type: %v", part["type"])
+			}
+		}
+		return blocks, nil
+	default:
+		return nil, fmt.Errorf("unsupported message content: %v", content)
+	}
+}
+
+// toConverseImage converts a base64 data URL image part. Bedrock cannot fetch
+// remote images, so plain http(s) URLs are rejected.
+func toConverseImage(imageURL interface{}) (map[string]interface{}, error) {
+	var u string
+	switch v := imageURL.(type) {
+	case string:
+		u = v
+	case map[string]interface{}:
+		u, _ = v["url"].(string)
+	}
+
+	mediaType, data, ok := strings.Cut(strings.TrimPrefix(u, "data:"), ";base64,")
+	if !ok || !strings.HasPrefix(u, "data:image/") {
+		return nil, fmt.Errorf("bedrock only supports base64 data URL images")
+	}
+
+	return map[string]interface{}{
+		"image": map[string]interface{}{
+			"format": strings.TrimPrefix(mediaType, "image/"),
+			"source": map[string]interface{}{"bytes": data},
+		},
+	}, nil
+}
+
+func toConverseToolUses(toolCalls interface{}) ([]interface{}, error) {
+	calls, _ := toolCalls.([]interface{})
+	var blocks []interface{}
+	for _, raw := range calls {
+		call, _ := raw.(map[string]interface{})
+		fn, _ := call["function"].(map[string]interface{})
+
+		var input interface{} = map[string]interface{}{}
+		if args, _ := fn["arguments"].(string); args != "" {
+			if err := json.Unmarshal([]byte(args), &input); err != nil {
+				return nil, fmt.Errorf("invalid tool call arguments: %w", err)
+			}
+		}
+
+		blocks = append(blocks, map[string]interface{}{
+			"toolUse": map[string]interface{}{
+				"toolUseId": call["id"],
+				"name":      fn["name"],
+				"input":     input,
+			},
+		})
+	}
+	return blocks, nil
+}
+
+func toConverseToolConfig(tools, toolChoice interface{}) (map[string]interface{}, error) {
+	list, _ := tools.([]interface{})
+	if len(list) == 0 {
+		return nil, nil
+	}
+
+	specs := make([]interface{}, 0, len(list))
+	for _, raw := range list {
+		tool, _ := raw.(map[string]interface{})
+		fn, ok := tool["function"].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("unsupported tool: %v", raw)
+		}
+
+		spec := map[string]interface{}{"name": fn["name"]}
+		if desc, ok := fn["description"]; ok {
+			spec["description"] = desc
+		}
+		params := fn["parameters"]
+		if params == nil {
+			params = map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+		}
+		spec["inputSchema"] = map[string]interface{}{"json": params}
+
+		specs = append(specs, map[string]interface{}{"toolSpec": spec})
+	}
+
+	config := map[string]interface{}{"tools": specs}
+
+	switch choice := toolChoice.(type) {
+	case string:
+		switch choice {
+		case "auto":
+			config["toolChoice"] = map[string]interface{}{"auto": map[string]interface{}{}}
+		case "required":
+			config["toolChoice"] = map[string]interface{}{"any": map[string]interface{}{}}
+		}
+	case map[string]interface{}:
+		if fn, ok := choice["function"].(map[string]interface{}); ok {
+			config["toolChoice"] = map[string]interface{}{"tool": map[string]interface{}{"name": fn["name"]}}
+		}
+	}
+
+	return config, nil
+}
+
+// fromConverseResponse maps a Converse response onto a chat.completion object.
+func fromConverseResponse(resp map[string]interface{}, model, id string) map[string]interface{} {
+	output, _ := resp["output"].(map[string]interface{})
+	msg, _ := output["message"].(map[string]interface{})
+	blocks, _ := msg["content"].([]interface{})
+
+	var text strings.Builder
+	var toolCalls []interface{}
+	for _, raw := range blocks {
+		block, _ := raw.(map[string]interface{})
+		if t, ok := block["text"].(string); ok {
+			text.WriteString(t)
+		}
+		if toolUse, ok := block["toolUse"].(map[string]interface{}); ok {
+			args, _ := json.Marshal(toolUse["input"])
+			toolCalls = append(toolCalls, map[string]interface{}{
+				"id":   toolUse["toolUseId"],
+				"type": "function",
+				"function": map[string]interface{}{
+					"name":      toolUse["name"],
+					"arguments": string(args),
+				},
+			})
+		}
+	}
+
+	message := map[string]interface{}{"role": "assistant", "content": nil}
+	if text.Len() > 0 {
+		message["content"] = text.String()
+	}
+	if len(toolCalls) > 0 {
+		message["tool_calls"] = toolCalls
+	}
+
+	result := map[string]interface{}{
+		"id":      id,
+		"object":  "chat.completion",
+		"created": time.Now().Unix(),
+		"model":   model,
+		"choices": []interface{}{map[string]interface{}{
+			"index":         0,
+			"message":       message,
+			"finish_reason": converseFinishReason(resp["stopReason"]),
+		}},
+	}
+
+	if usage, ok := resp["usage"].(map[string]interface{}); ok {
+		converted := map[string]interface{}{
+			"prompt_tokens":     usage["inputTokens"],
+			"completion_tokens": usage["outputTokens"],
+			"total_tokens":      usage["totalTokens"],
+		}
+		// Converse reports cache reads separately from inputTokens, while
+		// OpenAI counts them as part of prompt_tokens.
+		if cached := toInt64(usage["cacheReadInputTokens"]); cached > 0 {
+			converted["prompt_tokens"] = toInt64(usage["inputTokens"]) + cached
+			converted["prompt_tokens_details"] = map[string]interface{}{"cached_tokens": cached}
+		}
+		result["usage"] = converted
+	}
+
+	return result
+}
+
+func converseFinishReason(stopReason interface{}) string {
+	switch stopReason {
+	case "max_tokens":
+		return "length"
+	case "tool_use":
+		return "tool_calls"
+	case "content_filtered", "guardrail_intervened":
+		return "content_filter"
+	default:
+		return "stop"
+	}
+}
+
+// contentText flattens message content into plain text.
+func contentText(content interface{}) (string, error) {
+	switch c := content.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return c, nil
+	case []interface{}:
+		var b strings.Builder
+		for _, raw := range c {
+			part, _ := raw.(map[string]interface{})
+			if t, ok := part["text"].(string); ok {
+				b.WriteString(t)
+			}
+		}
+		return b.String(), nil
+	default:
+		return "", fmt.Errorf("unsupported message content: %v", content)
+	}
+}
@@ -0,0 +1,155 @@
+package dispatcher
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/georgeshao/ai-inference-dam/internal/storage"
+	"github.com/georgeshao/ai-inference-dam/pkg/types"
+)
+
+// newBedrockStandIn starts a server that verifies the SigV4 signature on each
+// request and answers with a canned Converse response.
+func newBedrockStandIn(t *testing.T, creds storage.AWSCredentials, received *map[string]interface{}) *httptest.Server {
+	t.Helper()
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("Failed to read body: %v", err)
+		}
+
+		if r.URL.EscapedPath() != "/model/anthropic.claude-3-haiku-20240307-v1:0/converse" {
+			t.Errorf("Unexpected path: %s", r.URL.EscapedPath())
+		}
+
+		signTime, err := time.Parse(sigV4TimeFormat, r.Header.Get("X-Amz-Date"))
+		if err != nil {
+			t.Errorf("Invalid X-Amz-Date: %v", err)
+		}
+
+		check, _ := http.NewRequest(r.Method, "http://"+r.Host+r.URL.RequestURI(), nil)
+		for k, v := range r.Header {
+			if k != "Authorization" && k != "Accept-Encoding" {
+				check.Header[k] = v
+			}
+		}
+		signV4(check, body, creds, bedrockService, signTime)
+		if got, want := r.Header.Get("Authorization"), check.Header.Get("Authorization"); got != want {
+			w.WriteHeader(http.StatusForbidden)
+			t.Errorf("Signature mismatch:\n got: %s\nwant: %s", got, want)
+			return
+		}
+
+		if err := json.Unmarshal(body, received); err != nil {
+			t.Errorf("Failed to decode body: %v", err)
+		}
+
+		w.Header().Set("X-Amzn-Requestid", "abc-123")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{
+			"output": {"message": {"role": "assistant", "content": [
+				{"text": "Let me check."},
+				{"toolUse": {"toolUseId": "tooluse_1", "name": "get_weather", "input": {"city": "Paris"}}}
+			]}},
+			"stopReason": "tool_use",
+			"usage": {"inputTokens": 12, "outputTokens": 7, "totalTokens": 19}
+		}`))
+	}))
+}
+
+func TestSendBedrockRequest(t *testing.T) {
+	creds := storage.AWSCredentials{
+		Region:          "us-east-1",
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "secret",
+		SessionToken:    "token",
+	}
+
+	var received map[string]interface{}
+	server := newBedrockStandIn(t, creds, &received)
+	defer server.Close()
+
+	payload := json.RawMessage(`{
+		"model": "anthropic.claude-3-haiku-20240307-v1:0",
+		"max_tokens": 256,
+		"temperature": 0,
+		"stop": "END",
+		"messages": [
+			{"role": "system", "content": "Be brief."},
+			{"role": "user", "content": "Weather in Paris?"},
+			{"role": "assistant", "content": null, "tool_calls": [
+				{"id": "call_1", "type": "function", "function": {"name": "get_weather", "arguments": "{\"city\":\"Paris\"}"}}
+			]},
+			{"role": "tool", "tool_call_id": "call_1", "content": "Sunny"}
+		],
+		"tools": [{"type": "function", "function": {"name": "get_weather", "parameters": {"type": "object"}}}],
+		"tool_choice": "auto"
+	}`)
+
+	target := Target{
+		Namespace: &storage.NamespaceRecord{ProviderType: types.ProviderBedrock, ProviderAWS: &creds},
+		Endpoint:  server.URL,
+	}
+
+	client := NewClient(5 * time.Second)
+	raw, err := client.Send(context.Background(), BedrockProvider{}, target, payload)
+	if err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	var resp map[string]interface{}
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	// Request translation
+	system := received["system"].([]interface{})
+	if system[0].(map[string]interface{})["text"] != "Be brief." {
+		t.Errorf("System prompt mismatch: %v", system)
+	}
+	messages := received["messages"].([]interface{})
+	if len(messages) != 3 {
+		t.Fatalf("Expected 3 converse messages, got %d", len(messages))
+	}
+	toolUse := messages[1].(map[string]interface{})["content"].([]interface{})[0].(map[string]interface{})["toolUse"].(map[string]interface{})
+	if toolUse["toolUseId"] != "call_1" || toolUse["input"].(map[string]interface{})["city"] != "Paris" {
+		t.Errorf("Tool use mismatch: %v", toolUse)
+	}
+	toolResult := messages[2].(map[string]interface{})["content"].([]interface{})[0].(map[string]interface{})["toolResult"].(map[string]interface{})
+	if messages[2].(map[string]interface{})["role"] != "user" || toolResult["toolUseId"] != "call_1" {
+		t.Errorf("Tool result mismatch: %v", messages[2])
+	}
+	inference := received["inferenceConfig"].(map[string]interface{})
+	if inference["maxTokens"] != float64(256) || inference["stopSequences"].([]interface{})[0] != "END" {
+		t.Errorf("Inference config mismatch: %v", inference)
+	}
+	if _, ok := received["toolConfig"].(map[string]interface{})["toolChoice"].(map[string]interface{})["auto"]; !ok {
+		t.Errorf("Tool choice mismatch: %v", received["toolConfig"])
+	}
+
+	// Response translation
+	if resp["id"] != "chatcmpl-abc-123" || resp["object"] != "chat.completion" {
+		t.Errorf("Response envelope mismatch: %v", resp)
+	}
+	choice := resp["choices"].([]interface{})[0].(map[string]interface{})
+	if choice["finish_reason"] != "tool_calls" {
+		t.Errorf("Finish reason mismatch: %v", choice["finish_reason"])
+	}
+	message := choice["message"].(map[string]interface{})
+	if message["content"] != "Let me check." {
+		t.Errorf("Content mismatch: %v", message["content"])
+	}
+	fn := message["tool_calls"].([]interface{})[0].(map[string]interface{})["function"].(map[string]interface{})
+	if fn["name"] != "get_weather" || fn["arguments"] != `{"city":"Paris"}` {
+		t.Errorf("Tool call mismatch: %v", fn)
+	}
+	usage := resp["usage"].(map[string]interface{})
+	if usage["prompt_tokens"] != float64(12) || usage["completion_tokens"] != float64(7) {
+		t.Errorf("Usage mismatch: %v", usage)
+	}
+}
@@ -0,0 +1,131 @@
+package dispatcher
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/georgeshao/ai-inference-dam/internal/storage"
+	"github.com/georgeshao/ai-inference-dam/pkg/types"
+)
+
+// BudgetPeriodKey identifies the spend period containing now. Day and month
+// periods follow the UTC calendar; a lifetime budget has a single period.
+func BudgetPeriodKey(period types.BudgetPeriod, now time.Time) string {
+	now = now.UTC()
+	switch period {
+	case types.BudgetPeriodDay:
+		return now.Format("2006-01-02")
+	case types.BudgetPeriodMonth:
+		return now.Format("2006-01")
+	}
+	return "lifetime"
+}
+
+// BudgetExceeded reports whether spend has reached either limit of budget.
+// Token limits count prompt and completion tokens.
+func BudgetExceeded(budget *storage.Budget, spentUSD float64, spentTokens int64) bool {
+	if budget == nil {
+		return false
+	}
+	if budget.LimitUSD != nil && spentUSD >= *budget.LimitUSD {
+		return true
+	}
+	if budget.LimitTokens != nil && spentTokens >= *budget.LimitTokens {
+		return true
+	}
+	return false
+}
+
+// budgetTracker keeps a running total of spend during a dispatch so that
+// workers can stop claiming requests without a store round trip.
+type budgetTracker struct {
+	store     storage.Store
+	namespace string
+	budget    *storage.Budget
+	periodKey string
+
+	mu          sync.Mutex
+	spentUSD    float64
+	spentTokens int64
+	marked      bool
+}
+
+// loadBudget returns a tracker seeded with the current period's spend, or nil
+// when the namespace has no budget. A limit raised since the budget was last
+// exhausted clears the recorded exhausted state.
+func (d *Dispatcher) loadBudget(ctx context.Context, ns *storage.NamespaceRecord) (*budgetTracker, error) {
+	if ns.Budget == nil {
+		return nil, nil
+	}
+
+	periodKey := BudgetPeriodKey(ns.Budget.Period, time.Now())
+	spend, err := d.store.GetBudgetSpend(ctx, ns.Name, periodKey)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &budgetTracker{
+		store:       d.store,
+		namespace:   ns.Name,
+		budget:      ns.Budget,
+		periodKey:   periodKey,
+		spentUSD:    spend.SpentUSD,
+		spentTokens: spend.SpentTokens,
+		marked:      spend.ExhaustedAt != nil,
+	}
+
+	if b.marked && !b.exhausted() {
+		if err := d.store.SetBudgetExhausted(ctx, ns.Name, periodKey, nil); err != nil {
+			return nil, err
+		}
+		b.marked = false
+	}
+
+	return b, nil
+}
+
+func (b *budgetTracker) exhausted() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return BudgetExceeded(b.budget, b.spentUSD, b.spentTokens)
+}
+
+// record adds the spend of a completed request and marks the budget exhausted
+// once a limit is reached.
+func (b *budgetTracker) record(ctx context.Context, usage storage.Usage, dispatchID string) {
+	tokens := usage.PromptTokens + usage.CompletionTokens
+	if err := b.store.AddBudgetSpend(ctx, b.namespace, b.periodKey, usage.CostUSD, tokens); err != nil {
+		log.Printf("[%s] Failed to record budget spend: %v", dispatchID, err)
+	}
+
+	b.mu.Lock()
+	b.spentUSD += usage.CostUSD
+	b.spentTokens += tokens
+	b.mu.Unlock()
+
+	if b.exhausted() {
+		b.markExhausted(ctx, dispatchID)
+	}
+}
+
+// markExhausted records the exhausted state once per dispatch.
+func (b *budgetTracker) markExhausted(ctx context.Context, dispatchID string) {
+	b.mu.Lock()
+	if b.marked {
+		b.mu.Unlock()
+		return
+	}
+	b.marked = true
+	spentUSD, spentTokens := b.spentUSD, b.spentTokens
+	b.mu.Unlock()
+
+	log.Printf("[%s] Budget exhausted for namespace %s ($%.6f, %d tokens spent in period %s)",
+		dispatchID, b.namespace, spentUSD, spentTokens, b.periodKey)
+
+	now := time.Now()
+	if err := b.store.SetBudgetExhausted(ctx, b.namespace, b.periodKey, &now); err != nil {
+		log.Printf("[%s] Failed to record budget exhaustion: %v", dispatchID, err)
+	}
+}
@@ -0,0 +1,108 @@
+package dispatcher
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/georgeshao/ai-inference-dam/internal/storage"
+	"github.com/georgeshao/ai-inference-dam/pkg/types"
+)
+
+// cacheKeyInput is hashed to form the response cache key. It holds
+// everything that decides where a request is sent. encoding/json writes map
+// keys in sorted order, so equal payloads and query parameters hash equally
+// regardless of the key order they were submitted with.
+type cacheKeyInput struct {
+	Provider    types.ProviderType     `json:"provider"`
+	Endpoint    string                 `json:"endpoint"`
+	URLTemplate string                 `json:"url_template,omitempty"`
+	QueryParams map[string]string      `json:"query_params,omitempty"`
+	Region      string                 `json:"region,omitempty"`
+	Payload     map[string]interface{} `json:"payload"`
+}
+
+// responseCacheKey returns the cache key for payload sent to target. Stream
+// options are ignored because streamed responses are stored aggregated.
+func responseCacheKey(target Target, payload json.RawMessage) (string, error) {
+	normalized, err := decodeJSON(payload)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode payload: %w", err)
+	}
+	delete(normalized, "stream")
+	delete(normalized, "stream_options")
+
+	providerType := target.Namespace.ProviderType
+	if providerType == "" {
+		providerType = types.ProviderOpenAI
+	}
+	input := cacheKeyInput{
+		Provider:    providerType,
+		Endpoint:    target.Endpoint,
+		QueryParams: target.Namespace.QueryParams,
+		Payload:     normalized,
+	}
+	if target.Namespace.URLTemplate != nil {
+		input.URLTemplate = *target.Namespace.URLTemplate
+	}
+	if target.Namespace.ProviderAWS != nil {
+		input.Region = target.Namespace.ProviderAWS.Region
+	}
+
+	encoded, err := json.Marshal(input)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode cache key: %w", err)
+	}
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// completeFromCache completes req with a cached response if one exists and
+// reports whether it did. Lookup failures are treated as misses.
+func (d *Dispatcher) completeFromCache(ctx context.Context, req *storage.RequestRecord, key, dispatchID string) bool {
+	entry, err := d.store.GetCachedResponse(ctx, req.Namespace, key)
+	if err != nil {
+		log.Printf("[%s] Failed to read response cache: %v", dispatchID, err)
+	}
+	hit := err == nil && entry != nil
+
+	if err := d.store.RecordCacheLookup(ctx, req.Namespace, hit); err != nil {
+		log.Printf("[%s] Failed to record cache lookup: %v", dispatchID, err)
+	}
+	if !hit {
+		return false
+	}
+
+	err = d.store.UpdateRequestCacheHit(ctx, req.ID, d.config.InstanceID, entry.Response)
+	if errors.Is(err, storage.ErrLeaseLost) {
+		// Another instance owns the request now; leave it to them
+		log.Printf("[%s] Skipping request %s: lease lost", dispatchID, req.ID)
+		return true
+	}
+	if err != nil {
+		log.Printf("[%s] Failed to update request from cache: %v", dispatchID, err)
+		return false
+	}
+
+	log.Printf("[%s] Request %s completed from cache", dispatchID, req.ID)
+	return true
+}
+
+func (d *Dispatcher) storeCachedResponse(ctx context.Context, ns *storage.NamespaceRecord, key string, response json.RawMessage, dispatchID string) {
+	now := time.Now()
+	err := d.store.PutCachedResponse(ctx, &storage.CacheEntry{
+		Namespace: ns.Name,
+		Key:       key,
+		Response:  response,
+		CreatedAt: now,
+		ExpiresAt: now.Add(time.Duration(ns.Cache.TTLSeconds) * time.Second),
+	})
+	if err != nil {
+		log.Printf("[%s] Failed to store cached response: %v", dispatchID, err)
+	}
+}
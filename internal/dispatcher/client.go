@@ -1,7 +1,6 @@
 package dispatcher
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -22,43 +21,36 @@ func NewClient(timeout time.Duration) *Client {
 	}
 }
 
-func (c *Client) SendRequest(ctx context.Context, url, apiKey string, headers map[string]string, payload map[string]interface{}) (map[string]interface{}, error) {
-	body, err := json.Marshal(payload)
+// Send dispatches payload through provider and returns the normalized
+// response. Upstream failures are returned as *ProviderError.
+func (c *Client) Send(ctx context.Context, provider Provider, target Target, payload json.RawMessage) (json.RawMessage, error) {
+	req, err := provider.BuildRequest(ctx, target, payload)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request payload: %w", err)
-	}
-
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+apiKey)
-
-	for k, v := range headers {
-		req.Header.Set(k, v)
+		return nil, err
 	}
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+		return nil, &ProviderError{
+			Kind:      ErrorKindTransport,
+			Message:   fmt.Sprintf("failed to send request: %v", err),
+			Retryable: true,
+		}
 	}
 	defer resp.Body.Close()
 
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
+		return nil, &ProviderError{
+			Kind:      ErrorKindTransport,
+			Message:   fmt.Sprintf("failed to read response body: %v", err),
+			Retryable: true,
+		}
 	}
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return nil, fmt.Errorf("provider returned status %d: %s", resp.StatusCode, string(respBody))
-	}
-
-	var result map[string]interface{}
-	if err := json.Unmarshal(respBody, &result); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
+		return nil, provider.ClassifyError(resp, respBody)
 	}
 
-	return result, nil
+	return provider.ParseResponse(payload, resp, respBody)
 }
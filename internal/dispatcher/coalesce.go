@@ -0,0 +1,203 @@
+package dispatcher
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"sync"
+
+	"github.com/georgeshao/ai-inference-dam/internal/storage"
+	"github.com/georgeshao/ai-inference-dam/pkg/types"
+)
+
+// requestGroup is a set of queued requests that resolve to the same upstream
+// call. Only the primary is sent; its outcome is copied to the duplicates.
+// A settled group's primary has already been sent, and only its outcome is
+// left to copy, so it carries just the primary's ID.
+type requestGroup struct {
+	primary    *storage.RequestRecord
+	primaryID  string
+	duplicates []*storage.RequestRecord
+	key        string
+	settled    bool
+}
+
+// coalescePages is how many claim pages' worth of settled keys a dispatch
+// remembers, so that duplicates claimed shortly after their primary finished
+// still join it.
+const coalescePages = 16
+
+// coalescer tracks the groups of one dispatch by coalesce key, so that a
+// duplicate claimed on a later page joins the request already sent for its
+// key rather than making another upstream call. Groups in flight are bounded
+// by the worker pool; once settled only the key and primary ID are kept, for
+// the most recently used limit keys, so memory stays flat however deep the
+// queue is.
+type coalescer struct {
+	mu      sync.Mutex
+	groups  map[string]*requestGroup
+	settled map[string]*list.Element
+	recent  *list.List // of settledGroup, most recently used first
+	limit   int
+}
+
+type settledGroup struct {
+	key       string
+	primaryID string
+}
+
+func newCoalescer(limit int) *coalescer {
+	return &coalescer{
+		groups:  make(map[string]*requestGroup),
+		settled: make(map[string]*list.Element),
+		recent:  list.New(),
+		limit:   max(limit, 1),
+	}
+}
+
+// add files a claimed request under its coalesce key. It returns the group
+// to hand to a worker: a new group with req as its primary, or a settled
+// group when the primary for the key has already finished. It returns nil
+// when req joined a group still in flight, whose worker fans out to it.
+func (c *coalescer) add(req *storage.RequestRecord) *requestGroup {
+	key, ok := coalesceKey(req)
+	if !ok {
+		return &requestGroup{primary: req, primaryID: req.ID}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if group, exists := c.groups[key]; exists {
+		group.duplicates = append(group.duplicates, req)
+		return nil
+	}
+	if elem, exists := c.settled[key]; exists {
+		c.recent.MoveToFront(elem)
+		primaryID := elem.Value.(settledGroup).primaryID
+		return &requestGroup{primaryID: primaryID, duplicates: []*storage.RequestRecord{req}, settled: true}
+	}
+
+	group := &requestGroup{primary: req, primaryID: req.ID, key: key}
+	c.groups[key] = group
+	return group
+}
+
+// settle closes group to new duplicates once its primary is done and
+// returns the duplicates to fan out to. Only the key and primary ID are
+// remembered from then on.
+func (c *coalescer) settle(group *requestGroup) []*storage.RequestRecord {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	duplicates := group.duplicates
+	group.duplicates = nil
+	group.settled = true
+	if group.key == "" || c.groups[group.key] != group {
+		return duplicates
+	}
+
+	delete(c.groups, group.key)
+	c.settled[group.key] = c.recent.PushFront(settledGroup{key: group.key, primaryID: group.primaryID})
+	for c.recent.Len() > c.limit {
+		oldest := c.recent.Remove(c.recent.Back()).(settledGroup)
+		delete(c.settled, oldest.key)
+	}
+	return duplicates
+}
+
+// forget drops the group for a primary that did not reach a final state, so
+// the next request with its key is sent again.
+func (c *coalescer) forget(group *requestGroup) {
+	if group.key == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.groups[group.key] == group {
+		delete(c.groups, group.key)
+	}
+	if elem, ok := c.settled[group.key]; ok && elem.Value.(settledGroup).primaryID == group.primaryID {
+		c.recent.Remove(elem)
+		delete(c.settled, group.key)
+	}
+}
+
+// coalesceKeyInput covers everything that shapes the upstream call: the
+// payload and the per-request endpoint, key and passthrough headers.
+type coalesceKeyInput struct {
+	Payload  map[string]interface{} `json:"payload"`
+	Endpoint *string                `json:"endpoint,omitempty"`
+	APIKey   *string                `json:"api_key,omitempty"`
+	Headers  map[string]string      `json:"headers,omitempty"`
+}
+
+func coalesceKey(req *storage.RequestRecord) (string, bool) {
+	payload, err := decodeJSON(req.RequestPayload)
+	if err != nil {
+		return "", false
+	}
+	encoded, err := json.Marshal(coalesceKeyInput{
+		Payload:  payload,
+		Endpoint: req.HeaderEndpoint,
+		APIKey:   req.HeaderAPIKey,
+		Headers:  req.PassthroughHeaders,
+	})
+	if err != nil {
+		return "", false
+	}
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:]), true
+}
+
+// fanOut copies the primary's final outcome to the duplicates and reports
+// whether there was one. If the primary did not reach a final state the
+// duplicates are released back to the queue for the next dispatch.
+func (d *Dispatcher) fanOut(ctx context.Context, primaryID string, duplicates []*storage.RequestRecord, dispatchID string) bool {
+	primary, err := d.store.GetRequest(ctx, primaryID)
+	if err != nil || primary == nil {
+		log.Printf("[%s] Failed to read primary request %s: %v", dispatchID, primaryID, err)
+		return false
+	}
+
+	var errMsg *string
+	switch primary.Status {
+	case types.StatusCompleted:
+	case types.StatusFailed:
+		errMsg = primary.Error
+		if errMsg == nil {
+			msg := "Coalesced request failed"
+			errMsg = &msg
+		}
+	default:
+		d.releaseRequests(ctx, duplicates, dispatchID)
+		return false
+	}
+
+	for _, dup := range duplicates {
+		if err := d.store.UpdateRequestCoalesced(ctx, dup.ID, d.config.InstanceID, primary.ID, primary.ResponsePayload, errMsg); err != nil {
+			log.Printf("[%s] Failed to update coalesced request %s: %v", dispatchID, dup.ID, err)
+		}
+	}
+
+	log.Printf("[%s] Fanned out request %s to %d coalesced requests", dispatchID, primary.ID, len(duplicates))
+	return true
+}
+
+// releaseGroup returns every request of an unsent group to the queue.
+func (d *Dispatcher) releaseGroup(ctx context.Context, c *coalescer, group *requestGroup, dispatchID string) {
+	duplicates := c.settle(group)
+	c.forget(group)
+	d.releaseRequests(ctx, append(duplicates, group.primary), dispatchID)
+}
+
+func (d *Dispatcher) releaseRequests(ctx context.Context, requests []*storage.RequestRecord, dispatchID string) {
+	for _, req := range requests {
+		if err := d.store.ReleaseRequest(ctx, req.ID, d.config.InstanceID); err != nil {
+			log.Printf("[%s] Failed to release request %s: %v", dispatchID, req.ID, err)
+		}
+	}
+}
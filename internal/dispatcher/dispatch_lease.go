@@ -0,0 +1,79 @@
+package dispatcher
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// dispatchLease is this instance's exclusive right, held in the store, to
+// dispatch a namespace. A heartbeat renews it until release; if a renewal
+// fails the lease is marked lost and the claim loop stops.
+type dispatchLease struct {
+	d         *Dispatcher
+	namespace string
+	lost      atomic.Bool
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+// acquireDispatchLease takes the namespace's dispatch lease, returning nil
+// if another instance holds an unexpired one.
+func (d *Dispatcher) acquireDispatchLease(ctx context.Context, namespace, dispatchID string) *dispatchLease {
+	now := time.Now()
+	acquired, err := d.store.AcquireDispatchLease(ctx, namespace, d.config.InstanceID, now, now.Add(d.config.DispatchLeaseTTL))
+	if err != nil {
+		log.Printf("[%s] Failed to acquire dispatch lease: %v", dispatchID, err)
+		return nil
+	}
+	if !acquired {
+		log.Printf("[%s] Namespace %s is being dispatched by another instance", dispatchID, namespace)
+		return nil
+	}
+
+	lease := &dispatchLease{
+		d:         d,
+		namespace: namespace,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go lease.heartbeat(ctx, dispatchID)
+	return lease
+}
+
+func (l *dispatchLease) heartbeat(ctx context.Context, dispatchID string) {
+	defer close(l.done)
+
+	ticker := time.NewTicker(l.d.config.DispatchLeaseTTL / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			now := time.Now()
+			renewed, err := l.d.store.AcquireDispatchLease(ctx, l.namespace, l.d.config.InstanceID, now, now.Add(l.d.config.DispatchLeaseTTL))
+			if err != nil || !renewed {
+				log.Printf("[%s] Lost dispatch lease for namespace %s: %v", dispatchID, l.namespace, err)
+				l.lost.Store(true)
+				return
+			}
+		}
+	}
+}
+
+// release stops the heartbeat and gives up the lease so another instance
+// can dispatch the namespace without waiting for it to expire.
+func (l *dispatchLease) release(ctx context.Context, dispatchID string) {
+	close(l.stop)
+	<-l.done
+
+	if l.lost.Load() {
+		return
+	}
+	if err := l.d.store.ReleaseDispatchLease(ctx, l.namespace, l.d.config.InstanceID); err != nil {
+		log.Printf("[%s] Failed to release dispatch lease: %v", dispatchID, err)
+	}
+}
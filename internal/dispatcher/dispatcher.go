@@ -2,29 +2,73 @@ package dispatcher
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"os"
 	"sync"
 	"time"
 
-	"golang.org/x/sync/errgroup"
 	"golang.org/x/time/rate"
 
 	"github.com/georgeshao/ai-inference-dam/internal/storage"
-	"github.com/georgeshao/ai-inference-dam/pkg/types"
 )
 
 type Config struct {
 	MaxWorkers        int
 	RequestTimeout    time.Duration
 	RequestsPerSecond float64
+	// Pricing converts token usage into a per-request cost. Models missing
+	// from the table are recorded with zero cost.
+	Pricing PricingTable
+	// InstanceID identifies this process as the owner of the leases it
+	// takes. It should stay the same across restarts of the same instance.
+	InstanceID string
+	// LeaseDuration bounds how long a request may stay processing before
+	// the sweeper considers its owner dead. A claimed request may wait up to
+	// one RequestTimeout for a free worker before it is sent, so this must
+	// exceed twice RequestTimeout.
+	LeaseDuration time.Duration
+	// MaxAttempts is the number of leases a request may take before an
+	// expired lease marks it failed rather than queued.
+	MaxAttempts   int
+	SweepInterval time.Duration
+	// DispatchLeaseTTL is how long a namespace dispatch lease lasts without
+	// a heartbeat. Another instance can take over a namespace this long
+	// after its dispatching instance dies.
+	DispatchLeaseTTL time.Duration
+	// ShutdownGracePeriod is how long Shutdown lets in-flight provider
+	// calls finish before cancelling them.
+	ShutdownGracePeriod time.Duration
+	// RetentionInterval is how often the janitor applies namespace retention
+	// policies, and PurgeBatchSize how many requests it deletes at a time.
+	RetentionInterval time.Duration
+	PurgeBatchSize    int
+	// RetentionFloor, when set, returns the completion time from which
+	// requests are kept however old they are, such as the point an archive
+	// has reached. Requests finished at or after it are never purged, by
+	// retention or on request.
+	RetentionFloor func() time.Time
 }
 
 func DefaultConfig() Config {
+	instanceID, err := os.Hostname()
+	if err != nil || instanceID == "" {
+		instanceID = "localhost"
+	}
+
 	return Config{
-		MaxWorkers:        10,
-		RequestTimeout:    300 * time.Second,
-		RequestsPerSecond: 1000,
+		MaxWorkers:          10,
+		RequestTimeout:      300 * time.Second,
+		RequestsPerSecond:   1000,
+		InstanceID:          instanceID,
+		LeaseDuration:       660 * time.Second,
+		MaxAttempts:         3,
+		SweepInterval:       60 * time.Second,
+		DispatchLeaseTTL:    30 * time.Second,
+		ShutdownGracePeriod: 30 * time.Second,
+		RetentionInterval:   time.Hour,
+		PurgeBatchSize:      500,
 	}
 }
 
@@ -36,39 +80,61 @@ type Dispatcher struct {
 	wg               sync.WaitGroup
 	activeDispatches map[string]bool
 	rateLimiters     map[string]*rate.Limiter
+	stopping         bool
+
+	// abortCtx is cancelled when the shutdown grace period runs out and
+	// interrupts in-flight provider calls.
+	abortCtx context.Context
+	abort    context.CancelFunc
 }
 
 func New(store storage.Store, config Config) *Dispatcher {
+	abortCtx, abort := context.WithCancel(context.Background())
 	return &Dispatcher{
 		store:            store,
 		client:           NewClient(config.RequestTimeout),
 		config:           config,
 		activeDispatches: make(map[string]bool),
 		rateLimiters:     make(map[string]*rate.Limiter),
+		abortCtx:         abortCtx,
+		abort:            abort,
 	}
 }
 
 func (d *Dispatcher) Dispatch(namespace string, dispatchID string) {
-	d.wg.Add(1)
-	defer d.wg.Done()
-
 	ctx := context.Background()
 
 	d.mu.Lock()
+	if d.stopping {
+		d.mu.Unlock()
+		log.Printf("[%s] Dispatcher is shutting down, not dispatching namespace: %s", dispatchID, namespace)
+		return
+	}
 	if d.activeDispatches[namespace] {
 		d.mu.Unlock()
 		log.Printf("[%s] Dispatch already in progress for namespace: %s", dispatchID, namespace)
 		return
 	}
 	d.activeDispatches[namespace] = true
+	d.wg.Add(1)
 	d.mu.Unlock()
 
+	defer d.wg.Done()
+
 	defer func() {
 		d.mu.Lock()
 		delete(d.activeDispatches, namespace)
 		d.mu.Unlock()
 	}()
 
+	// The in-memory map above excludes dispatches within this process; the
+	// store lease excludes other instances sharing the store
+	lease := d.acquireDispatchLease(ctx, namespace, dispatchID)
+	if lease == nil {
+		return
+	}
+	defer lease.release(ctx, dispatchID)
+
 	log.Printf("[%s] Starting dispatch for namespace: %s", dispatchID, namespace)
 
 	ns, err := d.store.GetNamespace(ctx, namespace)
@@ -77,99 +143,224 @@ func (d *Dispatcher) Dispatch(namespace string, dispatchID string) {
 		return
 	}
 
-	requests, err := d.store.GetQueuedRequests(ctx, namespace)
+	budget, err := d.loadBudget(ctx, ns)
 	if err != nil {
-		log.Printf("[%s] Failed to get queued requests: %v", dispatchID, err)
+		log.Printf("[%s] Failed to load budget: %v", dispatchID, err)
+		return
+	}
+	if budget != nil && budget.exhausted() {
+		budget.markExhausted(ctx, dispatchID)
+		log.Printf("[%s] Budget exhausted for namespace %s, leaving requests queued", dispatchID, namespace)
 		return
 	}
 
-	if len(requests) == 0 {
+	// A fixed pool of workers consumes groups as the claim loop pages
+	// through the queue, so memory stays flat regardless of queue depth
+	limiter := d.getRateLimiter(namespace)
+	groups := make(chan *requestGroup)
+	coalesced := newCoalescer(coalescePages * d.config.MaxWorkers)
+
+	var workers sync.WaitGroup
+	for i := 0; i < d.config.MaxWorkers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for group := range groups {
+				d.processGroup(ctx, ns, coalesced, group, budget, limiter, dispatchID)
+			}
+		}()
+	}
+
+	claimed := d.claimLoop(ctx, namespace, coalesced, budget, lease, groups, dispatchID)
+	close(groups)
+	workers.Wait()
+
+	if claimed == 0 {
 		log.Printf("[%s] No queued requests for namespace: %s", dispatchID, namespace)
 		return
 	}
 
-	log.Printf("[%s] Processing %d requests for namespace: %s", dispatchID, len(requests), namespace)
+	log.Printf("[%s] Dispatch completed for namespace: %s (%d requests claimed)", dispatchID, namespace, claimed)
+}
 
-	limiter := d.getRateLimiter(namespace)
+// claimLoop claims the queue one page at a time and hands each group of
+// duplicates to the workers. Duplicates of a request already handed out join
+// its group, whichever page they were claimed on. It returns the number of
+// requests claimed.
+func (d *Dispatcher) claimLoop(ctx context.Context, namespace string, coalesced *coalescer, budget *budgetTracker, lease *dispatchLease, groups chan<- *requestGroup, dispatchID string) int {
+	claimed := 0
+
+	for {
+		if lease.lost.Load() {
+			return claimed
+		}
+		if budget != nil && budget.exhausted() {
+			log.Printf("[%s] Budget exhausted for namespace %s, leaving remaining requests queued", dispatchID, namespace)
+			return claimed
+		}
+		if d.isStopping() {
+			return claimed
+		}
 
-	g, ctx := errgroup.WithContext(ctx)
-	sem := make(chan struct{}, d.config.MaxWorkers)
+		// Claimed requests hold a lease, so a page is no larger than the
+		// worker pool and the next page is claimed only once workers have
+		// taken every group of this one
+		requests, err := d.store.ClaimQueuedRequests(ctx, namespace, d.config.MaxWorkers, d.config.InstanceID, time.Now().Add(d.config.LeaseDuration))
+		if err != nil {
+			log.Printf("[%s] Failed to claim queued requests: %v", dispatchID, err)
+			return claimed
+		}
+		if len(requests) == 0 {
+			return claimed
+		}
+		claimed += len(requests)
 
-	for _, req := range requests {
-		req := req // Capture loop var
-		g.Go(func() error {
-			// Wait for rate limiter
-			if err := limiter.Wait(ctx); err != nil {
-				return err
+		var page []*requestGroup
+		for _, req := range requests {
+			if group := coalesced.add(req); group != nil {
+				page = append(page, group)
 			}
+		}
+		log.Printf("[%s] Claimed %d requests (%d to process) for namespace: %s", dispatchID, len(requests), len(page), namespace)
 
-			sem <- struct{}{}        // Acquire semaphore
-			defer func() { <-sem }() // Release semaphore
+		for _, group := range page {
+			groups <- group
+		}
+	}
+}
 
-			d.processRequest(ctx, ns, req, dispatchID)
-			return nil
-		})
+// processGroup sends the primary of a group and fans its outcome out to the
+// duplicates. Groups that are not sent are released back to the queue.
+func (d *Dispatcher) processGroup(ctx context.Context, ns *storage.NamespaceRecord, coalesced *coalescer, group *requestGroup, budget *budgetTracker, limiter *rate.Limiter, dispatchID string) {
+	// Late duplicates of a finished primary only need its outcome
+	if group.settled {
+		if !d.fanOut(ctx, group.primaryID, group.duplicates, dispatchID) {
+			coalesced.forget(group)
+		}
+		return
 	}
 
-	if err := g.Wait(); err != nil {
-		log.Printf("[%s] Dispatch completed with errors: %v", dispatchID, err)
-	} else {
-		log.Printf("[%s] Dispatch completed successfully for namespace: %s", dispatchID, namespace)
+	if err := limiter.Wait(ctx); err != nil {
+		log.Printf("[%s] Rate limiter wait failed: %v", dispatchID, err)
+		d.releaseGroup(ctx, coalesced, group, dispatchID)
+		return
 	}
-}
 
-func (d *Dispatcher) processRequest(ctx context.Context, ns *storage.NamespaceRecord, req *storage.RequestRecord, dispatchID string) {
-	endpoint := resolveEndpoint(ns, req.HeaderEndpoint)
-	apiKey := resolveAPIKey(ns, req.HeaderAPIKey)
+	// Leave the request queued once the budget runs out or the dispatcher
+	// starts shutting down
+	if (budget != nil && budget.exhausted()) || d.isStopping() {
+		d.releaseGroup(ctx, coalesced, group, dispatchID)
+		return
+	}
 
-	if endpoint == "" {
-		errMsg := "Missing required configuration: API endpoint"
-		log.Printf("[%s] Request %s failed: %s", dispatchID, req.ID, errMsg)
-		if err := d.store.UpdateRequestError(ctx, req.ID, errMsg); err != nil {
-			log.Printf("[%s] Failed to update request error: %v", dispatchID, err)
+	d.processRequest(ctx, ns, group.primary, budget, dispatchID)
+	if duplicates := coalesced.settle(group); len(duplicates) > 0 {
+		if !d.fanOut(ctx, group.primaryID, duplicates, dispatchID) {
+			coalesced.forget(group)
 		}
-		return
 	}
+}
 
-	if apiKey == "" {
-		errMsg := "Missing required configuration: API key"
+func (d *Dispatcher) processRequest(ctx context.Context, ns *storage.NamespaceRecord, req *storage.RequestRecord, budget *budgetTracker, dispatchID string) {
+	provider, ok := LookupProvider(ns.ProviderType)
+	if !ok {
+		errMsg := fmt.Sprintf("Unknown provider type: %s", ns.ProviderType)
 		log.Printf("[%s] Request %s failed: %s", dispatchID, req.ID, errMsg)
-		if err := d.store.UpdateRequestError(ctx, req.ID, errMsg); err != nil {
+		if err := d.store.UpdateRequestError(ctx, req.ID, d.config.InstanceID, errMsg); err != nil {
 			log.Printf("[%s] Failed to update request error: %v", dispatchID, err)
 		}
 		return
 	}
 
-	if err := d.store.UpdateRequestStatus(ctx, req.ID, types.StatusProcessing, time.Now()); err != nil {
-		log.Printf("[%s] Failed to update request status: %v", dispatchID, err)
-		return
+	target := Target{
+		Namespace: ns,
+		Endpoint:  resolveEndpoint(ns, req.HeaderEndpoint),
+		APIKey:    resolveAPIKey(ns, req.HeaderAPIKey),
+		Headers:   mergeHeaders(ns, req.PassthroughHeaders),
 	}
 
-	headers := mergeHeaders(ns, req.PassthroughHeaders)
+	if err := provider.Validate(target); err != nil {
+		log.Printf("[%s] Request %s failed: %s", dispatchID, req.ID, err)
+		if updateErr := d.store.UpdateRequestError(ctx, req.ID, d.config.InstanceID, err.Error()); updateErr != nil {
+			log.Printf("[%s] Failed to update request error: %v", dispatchID, updateErr)
+		}
+		return
+	}
 
 	payload := req.RequestPayload
 	if ns.ProviderModel != nil {
-		payload = cloneAndOverrideModel(req.RequestPayload, *ns.ProviderModel)
+		overridden, err := overrideModel(req.RequestPayload, *ns.ProviderModel)
+		if err != nil {
+			errMsg := fmt.Sprintf("Failed to override model: %v", err)
+			log.Printf("[%s] Request %s failed: %s", dispatchID, req.ID, errMsg)
+			if updateErr := d.store.UpdateRequestError(ctx, req.ID, d.config.InstanceID, errMsg); updateErr != nil {
+				log.Printf("[%s] Failed to update request error: %v", dispatchID, updateErr)
+			}
+			return
+		}
+		payload = overridden
+	}
+
+	var cacheKey string
+	if ns.Cache != nil && ns.Cache.TTLSeconds > 0 {
+		key, err := responseCacheKey(target, payload)
+		if err != nil {
+			log.Printf("[%s] Skipping response cache for request %s: %v", dispatchID, req.ID, err)
+		} else if d.completeFromCache(ctx, req, key, dispatchID) {
+			return
+		} else {
+			cacheKey = key
+		}
 	}
 
-	fullURL := endpoint + "/chat/completions"
+	sendCtx, cancelSend := context.WithCancel(ctx)
+	defer cancelSend()
+	stopAbort := context.AfterFunc(d.abortCtx, cancelSend)
+	defer stopAbort()
 
-	response, err := d.client.SendRequest(ctx, fullURL, apiKey, headers, payload)
+	response, err := d.client.Send(sendCtx, provider, target, payload)
+	if err != nil && d.abortCtx.Err() != nil {
+		log.Printf("[%s] Request %s interrupted by shutdown, returning to queue", dispatchID, req.ID)
+		if releaseErr := d.store.ReleaseRequest(ctx, req.ID, d.config.InstanceID); releaseErr != nil {
+			log.Printf("[%s] Failed to release request: %v", dispatchID, releaseErr)
+		}
+		return
+	}
 	if err != nil {
 		errMsg := fmt.Sprintf("Provider request failed: %v", err)
 		log.Printf("[%s] Request %s failed: %s", dispatchID, req.ID, errMsg)
-		if updateErr := d.store.UpdateRequestError(ctx, req.ID, errMsg); updateErr != nil {
+		if updateErr := d.store.UpdateRequestError(ctx, req.ID, d.config.InstanceID, errMsg); updateErr != nil {
 			log.Printf("[%s] Failed to update request error: %v", dispatchID, updateErr)
 		}
 		return
 	}
 
-	if err := d.store.UpdateRequestResponse(ctx, req.ID, response); err != nil {
+	usage := provider.ParseUsage(response)
+	usage.CostUSD = d.config.Pricing.Cost(responseModel(response, payload), usage)
+
+	err = d.store.UpdateRequestResponse(ctx, req.ID, d.config.InstanceID, response, usage)
+	if errors.Is(err, storage.ErrLeaseLost) {
+		// The provider was still paid, so the spend counts against the budget
+		log.Printf("[%s] Discarding response for request %s: lease lost", dispatchID, req.ID)
+		if budget != nil {
+			budget.record(ctx, usage, dispatchID)
+		}
+		return
+	}
+	if err != nil {
 		log.Printf("[%s] Failed to update request response: %v", dispatchID, err)
 		return
 	}
 
-	log.Printf("[%s] Request %s completed successfully", dispatchID, req.ID)
+	if budget != nil {
+		budget.record(ctx, usage, dispatchID)
+	}
+	if cacheKey != "" {
+		d.storeCachedResponse(ctx, ns, cacheKey, response, dispatchID)
+	}
+
+	log.Printf("[%s] Request %s completed successfully (%d prompt, %d completion tokens, $%.6f)",
+		dispatchID, req.ID, usage.PromptTokens, usage.CompletionTokens, usage.CostUSD)
 }
 
 func (d *Dispatcher) getRateLimiter(namespace string) *rate.Limiter {
@@ -190,3 +381,33 @@ func (d *Dispatcher) getRateLimiter(namespace string) *rate.Limiter {
 func (d *Dispatcher) Wait() {
 	d.wg.Wait()
 }
+
+func (d *Dispatcher) isStopping() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.stopping
+}
+
+// Shutdown stops new dispatches and requests from being claimed, then waits
+// for in-flight provider calls. Calls still running after the grace period
+// are cancelled and their requests returned to the queue. Shutdown returns
+// once every dispatch has exited, so the store can be closed afterwards.
+func (d *Dispatcher) Shutdown() {
+	d.mu.Lock()
+	d.stopping = true
+	d.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		d.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(d.config.ShutdownGracePeriod):
+		log.Printf("Shutdown grace period of %s elapsed, cancelling in-flight requests", d.config.ShutdownGracePeriod)
+		d.abort()
+		<-done
+	}
+}
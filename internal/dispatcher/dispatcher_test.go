@@ -0,0 +1,951 @@
+package dispatcher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/georgeshao/ai-inference-dam/internal/storage"
+	"github.com/georgeshao/ai-inference-dam/internal/storage/sqlite"
+	"github.com/georgeshao/ai-inference-dam/pkg/types"
+)
+
+func setupTestStore(t *testing.T) (storage.Store, func()) {
+	t.Helper()
+
+	tempDir, err := os.MkdirTemp("", "dispatcher_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+
+	store, err := sqlite.New(filepath.Join(tempDir, "test.db"))
+	if err != nil {
+		if removeErr := os.RemoveAll(tempDir); removeErr != nil {
+			t.Logf("Failed to remove temp dir: %v", removeErr)
+		}
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	cleanup := func() {
+		if closeErr := store.Close(); closeErr != nil {
+			t.Logf("Failed to close store: %v", closeErr)
+		}
+		if removeErr := os.RemoveAll(tempDir); removeErr != nil {
+			t.Logf("Failed to remove temp dir: %v", removeErr)
+		}
+	}
+
+	return store, cleanup
+}
+
+func createTestNamespace(t *testing.T, store storage.Store, ns *storage.NamespaceRecord) {
+	t.Helper()
+
+	now := time.Now()
+	ns.CreatedAt = now
+	ns.UpdatedAt = now
+	if err := store.CreateNamespace(context.Background(), ns); err != nil {
+		t.Fatalf("CreateNamespace failed: %v", err)
+	}
+}
+
+func queueTestRequest(t *testing.T, store storage.Store, id, namespace string, payload map[string]interface{}) {
+	t.Helper()
+
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatalf("Failed to encode payload: %v", err)
+	}
+	err = store.CreateRequest(context.Background(), &storage.RequestRecord{
+		ID:             id,
+		Namespace:      namespace,
+		Status:         types.StatusQueued,
+		RequestPayload: raw,
+		CreatedAt:      time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("CreateRequest failed: %v", err)
+	}
+}
+
+func responseID(response json.RawMessage) string {
+	var v struct {
+		ID string `json:"id"`
+	}
+	json.Unmarshal(response, &v)
+	return v.ID
+}
+
+// gatewayProvider is an in-house provider that authenticates with a custom
+// header instead of a bearer token.
+type gatewayProvider struct {
+	OpenAIProvider
+}
+
+func (gatewayProvider) Validate(target Target) error {
+	return nil
+}
+
+func (p gatewayProvider) BuildRequest(ctx context.Context, target Target, payload json.RawMessage) (*http.Request, error) {
+	req, err := p.OpenAIProvider.BuildRequest(ctx, target, payload)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Del("Authorization")
+	req.Header.Set("X-Gateway-Token", "gw-token")
+	return req, nil
+}
+
+func TestDispatchCustomProvider(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Gateway-Token") != "gw-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id": "chatcmpl-1", "object": "chat.completion", "choices": [], "usage": {"prompt_tokens": 3, "completion_tokens": 2, "total_tokens": 5}}`))
+	}))
+	defer server.Close()
+
+	RegisterProvider("gateway", gatewayProvider{})
+
+	endpoint := server.URL
+	createTestNamespace(t, store, &storage.NamespaceRecord{
+		Name:             "gw",
+		ProviderType:     "gateway",
+		ProviderEndpoint: &endpoint,
+	})
+	queueTestRequest(t, store, "req_1", "gw", map[string]interface{}{"model": "m"})
+
+	d := New(store, DefaultConfig())
+	d.Dispatch("gw", "disp_1")
+
+	req, err := store.GetRequest(context.Background(), "req_1")
+	if err != nil {
+		t.Fatalf("GetRequest failed: %v", err)
+	}
+	if req.Status != types.StatusCompleted {
+		t.Fatalf("Expected completed, got %s (error: %v)", req.Status, req.Error)
+	}
+	if responseID(req.ResponsePayload) != "chatcmpl-1" {
+		t.Errorf("Response mismatch: %v", req.ResponsePayload)
+	}
+}
+
+func TestDispatchPreservesPayloadBytes(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	const upstreamResponse = `{"object": "chat.completion", "id": "chatcmpl-1", "choices": [], "usage": {"prompt_tokens": 3, "completion_tokens": 2}}`
+	var sent []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent, _ = io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(upstreamResponse))
+	}))
+	defer server.Close()
+
+	endpoint := server.URL
+	apiKey := "sk-test"
+	model := "gpt-4o"
+	createTestNamespace(t, store, &storage.NamespaceRecord{
+		Name:             "raw",
+		ProviderEndpoint: &endpoint,
+		ProviderAPIKey:   &apiKey,
+		ProviderModel:    &model,
+	})
+
+	body := `{"seed": 9007199254740993, "model": "alias", "messages": [{"role": "user", "content": "hi"}]}`
+	if err := store.CreateRequest(context.Background(), &storage.RequestRecord{
+		ID:             "req_1",
+		Namespace:      "raw",
+		Status:         types.StatusQueued,
+		RequestPayload: json.RawMessage(body),
+		CreatedAt:      time.Now(),
+	}); err != nil {
+		t.Fatalf("CreateRequest failed: %v", err)
+	}
+
+	d := New(store, DefaultConfig())
+	d.Dispatch("raw", "disp_1")
+
+	want := `{"seed": 9007199254740993, "model": "gpt-4o", "messages": [{"role": "user", "content": "hi"}]}`
+	if string(sent) != want {
+		t.Errorf("Upstream body mismatch:\ngot  %s\nwant %s", sent, want)
+	}
+
+	req, err := store.GetRequest(context.Background(), "req_1")
+	if err != nil {
+		t.Fatalf("GetRequest failed: %v", err)
+	}
+	if req.Status != types.StatusCompleted {
+		t.Fatalf("Expected completed, got %s (error: %v)", req.Status, req.Error)
+	}
+	if string(req.RequestPayload) != body {
+		t.Errorf("Queued payload modified: %s", req.RequestPayload)
+	}
+	if string(req.ResponsePayload) != upstreamResponse {
+		t.Errorf("Response not stored verbatim: %s", req.ResponsePayload)
+	}
+	if req.Usage.PromptTokens != 3 || req.Usage.CompletionTokens != 2 {
+		t.Errorf("Usage mismatch: %+v", req.Usage)
+	}
+}
+
+func TestDispatchRecordsCost(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id": "chatcmpl-1", "model": "gpt-4o-2024-08-06", "choices": [], "usage": {"prompt_tokens": 1000, "completion_tokens": 500, "total_tokens": 1500, "prompt_tokens_details": {"cached_tokens": 400}, "completion_tokens_details": {"reasoning_tokens": 100}}}`))
+	}))
+	defer server.Close()
+
+	endpoint := server.URL
+	apiKey := "sk-test"
+	createTestNamespace(t, store, &storage.NamespaceRecord{
+		Name:             "priced",
+		ProviderEndpoint: &endpoint,
+		ProviderAPIKey:   &apiKey,
+	})
+	queueTestRequest(t, store, "req_1", "priced", map[string]interface{}{"model": "gpt-4o"})
+
+	config := DefaultConfig()
+	config.Pricing = PricingTable{
+		"gpt-4o*": {InputPerMillion: 2.5, CachedInputPerMillion: 1.25, OutputPerMillion: 10},
+	}
+	d := New(store, config)
+	d.Dispatch("priced", "disp_1")
+
+	req, err := store.GetRequest(context.Background(), "req_1")
+	if err != nil {
+		t.Fatalf("GetRequest failed: %v", err)
+	}
+	want := storage.Usage{
+		PromptTokens:     1000,
+		CompletionTokens: 500,
+		CachedTokens:     400,
+		ReasoningTokens:  100,
+		CostUSD:          (600*2.5 + 400*1.25 + 500*10) / 1e6,
+	}
+	if req.Usage != want {
+		t.Errorf("Usage mismatch: got %+v, want %+v", req.Usage, want)
+	}
+
+	stats, err := store.GetNamespaceStats(context.Background(), "priced")
+	if err != nil {
+		t.Fatalf("GetNamespaceStats failed: %v", err)
+	}
+	if stats.CostUSD != want.CostUSD || stats.PromptTokens != 1000 {
+		t.Errorf("Stats mismatch: %+v", stats)
+	}
+}
+
+func TestDispatchStopsAtBudget(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id": "chatcmpl-1", "choices": [], "usage": {"prompt_tokens": 6, "completion_tokens": 4, "total_tokens": 10}}`))
+	}))
+	defer server.Close()
+
+	endpoint := server.URL
+	apiKey := "sk-test"
+	limit := int64(20)
+	createTestNamespace(t, store, &storage.NamespaceRecord{
+		Name:             "capped",
+		ProviderEndpoint: &endpoint,
+		ProviderAPIKey:   &apiKey,
+		Budget:           &storage.Budget{LimitTokens: &limit, Period: types.BudgetPeriodMonth},
+	})
+	for i := 1; i <= 4; i++ {
+		queueTestRequest(t, store, fmt.Sprintf("req_%d", i), "capped", map[string]interface{}{"model": "m", "seed": i})
+	}
+
+	config := DefaultConfig()
+	config.MaxWorkers = 1
+	d := New(store, config)
+	d.Dispatch("capped", "disp_1")
+
+	stats, err := store.GetNamespaceStats(context.Background(), "capped")
+	if err != nil {
+		t.Fatalf("GetNamespaceStats failed: %v", err)
+	}
+	if stats.Completed != 2 || stats.Queued != 2 {
+		t.Fatalf("Expected 2 completed and 2 queued, got %d/%d", stats.Completed, stats.Queued)
+	}
+
+	periodKey := BudgetPeriodKey(types.BudgetPeriodMonth, time.Now())
+	spend, err := store.GetBudgetSpend(context.Background(), "capped", periodKey)
+	if err != nil {
+		t.Fatalf("GetBudgetSpend failed: %v", err)
+	}
+	if spend.SpentTokens != 20 || spend.ExhaustedAt == nil {
+		t.Errorf("Expected exhausted budget with 20 tokens spent, got %+v", spend)
+	}
+
+	// Nothing more is dispatched until the budget is reset
+	d.Dispatch("capped", "disp_2")
+	if stats, _ := store.GetNamespaceStats(context.Background(), "capped"); stats.Queued != 2 {
+		t.Errorf("Expected requests to stay queued, got %d queued", stats.Queued)
+	}
+
+	if err := store.ResetBudget(context.Background(), "capped"); err != nil {
+		t.Fatalf("ResetBudget failed: %v", err)
+	}
+	d.Dispatch("capped", "disp_3")
+	if stats, _ := store.GetNamespaceStats(context.Background(), "capped"); stats.Completed != 4 {
+		t.Errorf("Expected all requests completed after reset, got %d", stats.Completed)
+	}
+}
+
+func TestDispatchResponseCache(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id": "chatcmpl-1", "choices": [], "usage": {"prompt_tokens": 3, "completion_tokens": 2, "total_tokens": 5}}`))
+	}))
+	defer server.Close()
+
+	endpoint := server.URL
+	apiKey := "sk-test"
+	createTestNamespace(t, store, &storage.NamespaceRecord{
+		Name:             "cached",
+		ProviderEndpoint: &endpoint,
+		ProviderAPIKey:   &apiKey,
+		Cache:            &storage.CacheConfig{TTLSeconds: 60},
+	})
+
+	d := New(store, DefaultConfig())
+
+	queueTestRequest(t, store, "req_1", "cached", map[string]interface{}{"model": "m", "temperature": 0.0})
+	d.Dispatch("cached", "disp_1")
+
+	// Stream flags do not affect the cache key
+	queueTestRequest(t, store, "req_2", "cached", map[string]interface{}{"temperature": 0.0, "model": "m", "stream": true})
+	queueTestRequest(t, store, "req_3", "cached", map[string]interface{}{"model": "other", "temperature": 0.0})
+	d.Dispatch("cached", "disp_2")
+
+	if calls != 2 {
+		t.Errorf("Expected 2 provider calls, got %d", calls)
+	}
+
+	req, err := store.GetRequest(context.Background(), "req_2")
+	if err != nil {
+		t.Fatalf("GetRequest failed: %v", err)
+	}
+	if req.Status != types.StatusCompleted || !req.CacheHit || responseID(req.ResponsePayload) != "chatcmpl-1" {
+		t.Errorf("Expected cache hit, got %s (cache hit: %v, response: %v)", req.Status, req.CacheHit, req.ResponsePayload)
+	}
+	if req.Usage.PromptTokens != 0 {
+		t.Errorf("Cache hits should not record usage: %+v", req.Usage)
+	}
+
+	stats, err := store.GetNamespaceStats(context.Background(), "cached")
+	if err != nil {
+		t.Fatalf("GetNamespaceStats failed: %v", err)
+	}
+	if stats.CacheHits != 1 || stats.CacheMisses != 2 {
+		t.Errorf("Expected 1 hit and 2 misses, got %d/%d", stats.CacheHits, stats.CacheMisses)
+	}
+}
+
+func TestDispatchCoalescesDuplicates(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	var mu sync.Mutex
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id": "chatcmpl-1", "choices": [], "usage": {"prompt_tokens": 3, "completion_tokens": 2, "total_tokens": 5}}`))
+	}))
+	defer server.Close()
+
+	endpoint := server.URL
+	apiKey := "sk-test"
+	createTestNamespace(t, store, &storage.NamespaceRecord{
+		Name:             "dupes",
+		ProviderEndpoint: &endpoint,
+		ProviderAPIKey:   &apiKey,
+	})
+	// Far more duplicates than fit in one claim page
+	for i := 1; i <= 25; i++ {
+		queueTestRequest(t, store, fmt.Sprintf("req_%02d", i), "dupes", map[string]interface{}{"model": "m", "messages": []interface{}{"hi"}})
+	}
+	queueTestRequest(t, store, "req_26", "dupes", map[string]interface{}{"model": "m", "messages": []interface{}{"bye"}})
+
+	config := DefaultConfig()
+	config.MaxWorkers = 3
+	d := New(store, config)
+	d.Dispatch("dupes", "disp_1")
+
+	if calls != 2 {
+		t.Errorf("Expected 2 provider calls, got %d", calls)
+	}
+
+	namespace := "dupes"
+	requests, _, err := store.ListRequests(context.Background(), storage.RequestFilter{Namespace: &namespace, Limit: 100})
+	if err != nil {
+		t.Fatalf("ListRequests failed: %v", err)
+	}
+
+	coalesced := 0
+	for _, req := range requests {
+		if req.Status != types.StatusCompleted || responseID(req.ResponsePayload) != "chatcmpl-1" {
+			t.Errorf("Request %s: expected completed response, got %s", req.ID, req.Status)
+		}
+		if req.CoalescedWith == nil {
+			continue
+		}
+		coalesced++
+		if req.Usage.PromptTokens != 0 {
+			t.Errorf("Coalesced request %s should not record usage", req.ID)
+		}
+		if primary, _ := store.GetRequest(context.Background(), *req.CoalescedWith); primary == nil || primary.CoalescedWith != nil {
+			t.Errorf("Request %s points at invalid primary %s", req.ID, *req.CoalescedWith)
+		}
+	}
+	if len(requests) != 26 {
+		t.Errorf("Expected 26 requests, got %d", len(requests))
+	}
+	if coalesced != 24 {
+		t.Errorf("Expected 24 coalesced requests, got %d", coalesced)
+	}
+}
+
+func TestCoalescerStaysBounded(t *testing.T) {
+	c := newCoalescer(coalescePages * 3)
+
+	// Page through far more distinct requests than the window holds, the
+	// way a dispatch with three workers does
+	request := func(id string, n int) *storage.RequestRecord {
+		return &storage.RequestRecord{ID: id, RequestPayload: json.RawMessage(fmt.Sprintf(`{"model":"m","seed":%d}`, n))}
+	}
+	for n := 0; n < 10000; n += 3 {
+		var page []*requestGroup
+		for i := n; i < n+3; i++ {
+			if group := c.add(request(fmt.Sprintf("req_%d", i), i)); group != nil {
+				page = append(page, group)
+			}
+		}
+		for _, group := range page {
+			c.settle(group)
+		}
+	}
+
+	if len(c.groups) != 0 {
+		t.Errorf("Expected no groups in flight, got %d", len(c.groups))
+	}
+	if len(c.settled) != coalescePages*3 || c.recent.Len() != coalescePages*3 {
+		t.Errorf("Expected %d settled keys, got %d", coalescePages*3, len(c.settled))
+	}
+
+	// A recent key still coalesces with its primary; an evicted one is sent
+	// again
+	if group := c.add(request("late", 9998)); group == nil || !group.settled || group.primaryID != "req_9998" {
+		t.Errorf("Expected a late duplicate of req_9998, got %+v", group)
+	}
+	if group := c.add(request("early", 0)); group == nil || group.settled || group.primaryID != "early" {
+		t.Errorf("Expected an evicted key to start a new group, got %+v", group)
+	}
+}
+
+func TestPricingLookup(t *testing.T) {
+	table := PricingTable{
+		"gpt-4o":       {InputPerMillion: 1},
+		"gpt-4o*":      {InputPerMillion: 2},
+		"gpt-4o-mini*": {InputPerMillion: 3},
+	}
+
+	tests := []struct {
+		model string
+		input float64
+		found bool
+	}{
+		{"gpt-4o", 1, true},
+		{"gpt-4o-2024-08-06", 2, true},
+		{"gpt-4o-mini-2024-07-18", 3, true},
+		{"claude-3", 0, false},
+	}
+
+	for _, tt := range tests {
+		price, ok := table.Lookup(tt.model)
+		if ok != tt.found || price.InputPerMillion != tt.input {
+			t.Errorf("Lookup(%s): got %v/%v, want %v/%v", tt.model, price.InputPerMillion, ok, tt.input, tt.found)
+		}
+	}
+}
+
+func TestDispatchUnknownProvider(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	createTestNamespace(t, store, &storage.NamespaceRecord{Name: "ns", ProviderType: "missing"})
+	queueTestRequest(t, store, "req_1", "ns", map[string]interface{}{"model": "m"})
+
+	d := New(store, DefaultConfig())
+	d.Dispatch("ns", "disp_1")
+
+	req, err := store.GetRequest(context.Background(), "req_1")
+	if err != nil {
+		t.Fatalf("GetRequest failed: %v", err)
+	}
+	if req.Status != types.StatusFailed || req.Error == nil || !strings.Contains(*req.Error, "Unknown provider type") {
+		t.Errorf("Expected unknown provider failure, got %s (%v)", req.Status, req.Error)
+	}
+}
+
+func TestDispatchBoundedWorkerPool(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	var mu sync.Mutex
+	inFlight, maxInFlight, served := 0, 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		served++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"chatcmpl-1","model":"m","choices":[]}`))
+	}))
+	defer server.Close()
+
+	endpoint := server.URL
+	apiKey := "sk-test"
+	createTestNamespace(t, store, &storage.NamespaceRecord{
+		Name:             "deep",
+		ProviderEndpoint: &endpoint,
+		ProviderAPIKey:   &apiKey,
+	})
+	for i := 0; i < 25; i++ {
+		queueTestRequest(t, store, fmt.Sprintf("req_%02d", i), "deep", map[string]interface{}{"model": "m", "seed": i})
+	}
+
+	config := DefaultConfig()
+	config.MaxWorkers = 3
+	d := New(store, config)
+	d.Dispatch("deep", "disp_1")
+
+	stats, err := store.GetNamespaceStats(context.Background(), "deep")
+	if err != nil {
+		t.Fatalf("GetNamespaceStats failed: %v", err)
+	}
+	if stats.Completed != 25 {
+		t.Errorf("Expected 25 completed, got %+v", stats)
+	}
+	if served != 25 {
+		t.Errorf("Expected 25 provider calls, got %d", served)
+	}
+	if maxInFlight > config.MaxWorkers {
+		t.Errorf("Expected at most %d concurrent calls, got %d", config.MaxWorkers, maxInFlight)
+	}
+}
+
+func TestDispatchLeaseExcludesOtherInstances(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	started := make(chan struct{}, 10)
+	release := make(chan struct{})
+	var served atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served.Add(1)
+		started <- struct{}{}
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"chatcmpl-1","model":"m","choices":[]}`))
+	}))
+	defer server.Close()
+
+	endpoint := server.URL
+	apiKey := "sk-test"
+	createTestNamespace(t, store, &storage.NamespaceRecord{
+		Name:             "shared",
+		ProviderEndpoint: &endpoint,
+		ProviderAPIKey:   &apiKey,
+	})
+	for i := 0; i < 3; i++ {
+		queueTestRequest(t, store, fmt.Sprintf("req_%d", i), "shared", map[string]interface{}{"model": "m", "seed": i})
+	}
+
+	configA := DefaultConfig()
+	configA.InstanceID = "replica-a"
+	configA.MaxWorkers = 1
+	configB := DefaultConfig()
+	configB.InstanceID = "replica-b"
+	a := New(store, configA)
+	b := New(store, configB)
+
+	done := make(chan struct{})
+	go func() {
+		a.Dispatch("shared", "disp_a")
+		close(done)
+	}()
+	<-started
+
+	// Replica A holds the lease, so B returns without claiming anything
+	b.Dispatch("shared", "disp_b")
+	for i := 0; i < 3; i++ {
+		req, _ := store.GetRequest(context.Background(), fmt.Sprintf("req_%d", i))
+		if req.LeaseOwner != nil && *req.LeaseOwner != "replica-a" {
+			t.Errorf("%s claimed by %s while replica-a held the namespace", req.ID, *req.LeaseOwner)
+		}
+	}
+
+	close(release)
+	<-done
+
+	if served.Load() != 3 {
+		t.Errorf("Expected 3 provider calls, got %d", served.Load())
+	}
+
+	// A released its lease on completion, so B can dispatch straight away
+	queueTestRequest(t, store, "req_3", "shared", map[string]interface{}{"model": "m", "seed": 3})
+	b.Dispatch("shared", "disp_b2")
+	req, _ := store.GetRequest(context.Background(), "req_3")
+	if req.Status != types.StatusCompleted {
+		t.Errorf("Expected B to dispatch after A finished, got %s", req.Status)
+	}
+}
+
+func TestDispatchLeaseTakeoverAfterExpiry(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"chatcmpl-1","model":"m","choices":[]}`))
+	}))
+	defer server.Close()
+
+	endpoint := server.URL
+	apiKey := "sk-test"
+	createTestNamespace(t, store, &storage.NamespaceRecord{
+		Name:             "shared",
+		ProviderEndpoint: &endpoint,
+		ProviderAPIKey:   &apiKey,
+	})
+	queueTestRequest(t, store, "req_1", "shared", map[string]interface{}{"model": "m"})
+
+	// A replica that died while dispatching leaves its lease behind
+	ctx := context.Background()
+	now := time.Now()
+	if ok, err := store.AcquireDispatchLease(ctx, "shared", "replica-dead", now, now.Add(time.Hour)); !ok || err != nil {
+		t.Fatalf("AcquireDispatchLease failed: %v %v", ok, err)
+	}
+
+	config := DefaultConfig()
+	config.InstanceID = "replica-b"
+	b := New(store, config)
+
+	b.Dispatch("shared", "disp_1")
+	req, _ := store.GetRequest(ctx, "req_1")
+	if req.Status != types.StatusQueued {
+		t.Fatalf("Expected request to wait for the live lease, got %s", req.Status)
+	}
+
+	// Expire the dead replica's lease by renewing it into the past
+	if ok, err := store.AcquireDispatchLease(ctx, "shared", "replica-dead", now, now.Add(-2*time.Second)); !ok || err != nil {
+		t.Fatalf("AcquireDispatchLease failed: %v %v", ok, err)
+	}
+
+	b.Dispatch("shared", "disp_2")
+	req, _ = store.GetRequest(ctx, "req_1")
+	if req.Status != types.StatusCompleted {
+		t.Errorf("Expected B to take over after expiry, got %s", req.Status)
+	}
+}
+
+func TestRecoverRequeuesAbandonedRequests(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"chatcmpl-1","model":"m","choices":[]}`))
+	}))
+	defer server.Close()
+
+	endpoint := server.URL
+	apiKey := "sk-test"
+	createTestNamespace(t, store, &storage.NamespaceRecord{
+		Name:             "crashed",
+		ProviderEndpoint: &endpoint,
+		ProviderAPIKey:   &apiKey,
+	})
+	queueTestRequest(t, store, "req_1", "crashed", map[string]interface{}{"model": "m"})
+
+	// Simulate a crash after the request was leased by this instance
+	config := DefaultConfig()
+	config.InstanceID = "instance-a"
+	ctx := context.Background()
+	if _, err := store.ClaimQueuedRequests(ctx, "crashed", 1, config.InstanceID, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("ClaimQueuedRequests failed: %v", err)
+	}
+
+	d := New(store, config)
+	if err := d.Recover(ctx); err != nil {
+		t.Fatalf("Recover failed: %v", err)
+	}
+	d.Dispatch("crashed", "disp_1")
+
+	req, err := store.GetRequest(ctx, "req_1")
+	if err != nil {
+		t.Fatalf("GetRequest failed: %v", err)
+	}
+	if req.Status != types.StatusCompleted {
+		t.Fatalf("Expected completed after recovery, got %s", req.Status)
+	}
+	if req.Attempts != 2 {
+		t.Errorf("Expected 2 attempts, got %d", req.Attempts)
+	}
+	if req.LeaseOwner != nil || req.LeaseExpiresAt != nil {
+		t.Errorf("Lease should be cleared on completion")
+	}
+}
+
+func TestShutdownRequeuesInFlightRequests(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	endpoint := server.URL
+	apiKey := "sk-test"
+	createTestNamespace(t, store, &storage.NamespaceRecord{
+		Name:             "slow",
+		ProviderEndpoint: &endpoint,
+		ProviderAPIKey:   &apiKey,
+	})
+	queueTestRequest(t, store, "req_1", "slow", map[string]interface{}{"model": "m"})
+
+	config := DefaultConfig()
+	config.ShutdownGracePeriod = 50 * time.Millisecond
+	d := New(store, config)
+
+	go d.Dispatch("slow", "disp_1")
+	<-started
+	d.Shutdown()
+
+	req, err := store.GetRequest(context.Background(), "req_1")
+	if err != nil {
+		t.Fatalf("GetRequest failed: %v", err)
+	}
+	if req.Status != types.StatusQueued {
+		t.Errorf("Expected interrupted request to be queued, got %s", req.Status)
+	}
+	if req.Attempts != 0 || req.LeaseOwner != nil {
+		t.Errorf("Expected released lease, got %d attempts owned by %v", req.Attempts, req.LeaseOwner)
+	}
+
+	// A stopped dispatcher claims nothing
+	d.Dispatch("slow", "disp_2")
+	req, _ = store.GetRequest(context.Background(), "req_1")
+	if req.Status != types.StatusQueued {
+		t.Errorf("Expected request to stay queued after shutdown, got %s", req.Status)
+	}
+}
+
+func TestClassifyStatus(t *testing.T) {
+	tests := []struct {
+		status    int
+		kind      ErrorKind
+		retryable bool
+	}{
+		{http.StatusTooManyRequests, ErrorKindRateLimit, true},
+		{http.StatusUnauthorized, ErrorKindAuth, false},
+		{http.StatusBadRequest, ErrorKindInvalidRequest, false},
+		{http.StatusBadGateway, ErrorKindServer, true},
+	}
+
+	for _, tt := range tests {
+		e := classifyStatus(tt.status, "boom")
+		if e.Kind != tt.kind || e.Retryable != tt.retryable {
+			t.Errorf("Status %d: got %s/%v, want %s/%v", tt.status, e.Kind, e.Retryable, tt.kind, tt.retryable)
+		}
+		if want := fmt.Sprintf("provider returned status %d: boom", tt.status); e.Error() != want {
+			t.Errorf("Error message mismatch: got %s, want %s", e.Error(), want)
+		}
+	}
+}
+
+func TestApplyRetention(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	createTestNamespace(t, store, &storage.NamespaceRecord{
+		Name:      "kept",
+		Retention: &storage.RetentionPolicy{CompletedDays: 30, FailedDays: 90},
+	})
+	createTestNamespace(t, store, &storage.NamespaceRecord{Name: "forever"})
+
+	ctx := context.Background()
+	now := time.Now()
+	// Requests were all created long ago; age is days since they finished
+	create := func(id, namespace string, status types.RequestStatus, age int) {
+		t.Helper()
+		req := &storage.RequestRecord{
+			ID:             id,
+			Namespace:      namespace,
+			Status:         status,
+			RequestPayload: json.RawMessage(`{"model":"m"}`),
+			CreatedAt:      now.AddDate(0, 0, -500),
+		}
+		if status != types.StatusQueued {
+			completedAt := now.AddDate(0, 0, -age)
+			req.CompletedAt = &completedAt
+		}
+		if err := store.ImportRequest(ctx, req); err != nil {
+			t.Fatalf("ImportRequest failed: %v", err)
+		}
+	}
+	for i := 0; i < 5; i++ {
+		create(fmt.Sprintf("old_%d", i), "kept", types.StatusCompleted, 40)
+	}
+	create("recent", "kept", types.StatusCompleted, 10)
+	create("failed", "kept", types.StatusFailed, 40)
+	create("queued", "kept", types.StatusQueued, 400)
+	create("unmanaged", "forever", types.StatusCompleted, 400)
+
+	// A batch smaller than the backlog takes several rounds
+	config := DefaultConfig()
+	config.PurgeBatchSize = 2
+	d := New(store, config)
+
+	purged, err := d.ApplyRetention(ctx, now)
+	if err != nil {
+		t.Fatalf("ApplyRetention failed: %v", err)
+	}
+	if purged != 5 {
+		t.Errorf("Expected 5 purged, got %d", purged)
+	}
+
+	for _, id := range []string{"recent", "failed", "queued", "unmanaged"} {
+		req, err := store.GetRequest(ctx, id)
+		if err != nil {
+			t.Fatalf("GetRequest failed: %v", err)
+		}
+		if req == nil {
+			t.Errorf("Request %s should have been kept", id)
+		}
+	}
+}
+
+func TestApplyRetentionFloor(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	createTestNamespace(t, store, &storage.NamespaceRecord{
+		Name:      "archived",
+		Retention: &storage.RetentionPolicy{CompletedDays: 30},
+	})
+
+	ctx := context.Background()
+	now := time.Now()
+	for id, age := range map[string]int{"archived_old": 60, "unarchived_old": 40} {
+		completedAt := now.AddDate(0, 0, -age)
+		if err := store.ImportRequest(ctx, &storage.RequestRecord{
+			ID:             id,
+			Namespace:      "archived",
+			Status:         types.StatusCompleted,
+			RequestPayload: json.RawMessage(`{"model":"m"}`),
+			CreatedAt:      now.AddDate(0, 0, -100),
+			CompletedAt:    &completedAt,
+		}); err != nil {
+			t.Fatalf("ImportRequest failed: %v", err)
+		}
+	}
+
+	// Nothing is purged until the archive has made its first run
+	var floor time.Time
+	config := DefaultConfig()
+	config.RetentionFloor = func() time.Time { return floor }
+	d := New(store, config)
+
+	if purged, err := d.ApplyRetention(ctx, now); err != nil || purged != 0 {
+		t.Errorf("ApplyRetention = %d, %v; want nothing purged", purged, err)
+	}
+
+	// Both are past retention, but only one has been archived
+	floor = now.AddDate(0, 0, -50)
+	if purged, err := d.ApplyRetention(ctx, now); err != nil || purged != 1 {
+		t.Errorf("ApplyRetention = %d, %v; want 1 purged", purged, err)
+	}
+	if req, err := store.GetRequest(ctx, "archived_old"); err != nil || req != nil {
+		t.Errorf("Expected the archived request purged: %v, %v", req, err)
+	}
+	if req, err := store.GetRequest(ctx, "unarchived_old"); err != nil || req == nil {
+		t.Errorf("Expected the unarchived request kept: %v", err)
+	}
+}
+
+func TestResponseCacheKeyIncludesUpstream(t *testing.T) {
+	payload := json.RawMessage(`{"model": "m"}`)
+	key := func(ns *storage.NamespaceRecord) string {
+		t.Helper()
+		k, err := responseCacheKey(Target{Namespace: ns, Endpoint: "https://example.com"}, payload)
+		if err != nil {
+			t.Fatalf("responseCacheKey failed: %v", err)
+		}
+		return k
+	}
+
+	base := key(&storage.NamespaceRecord{QueryParams: map[string]string{"a": "1", "b": "2"}})
+	if k := key(&storage.NamespaceRecord{QueryParams: map[string]string{"b": "2", "a": "1"}}); k != base {
+		t.Error("Expected query parameter order not to affect the key")
+	}
+	if k := key(&storage.NamespaceRecord{QueryParams: map[string]string{"a": "1", "b": "3"}}); k == base {
+		t.Error("Expected query parameters to affect the key")
+	}
+
+	east := key(&storage.NamespaceRecord{ProviderType: types.ProviderBedrock, ProviderAWS: &storage.AWSCredentials{Region: "us-east-1"}})
+	west := key(&storage.NamespaceRecord{ProviderType: types.ProviderBedrock, ProviderAWS: &storage.AWSCredentials{Region: "us-west-2"}})
+	if east == west {
+		t.Error("Expected the Bedrock region to affect the key")
+	}
+}
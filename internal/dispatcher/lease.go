@@ -0,0 +1,42 @@
+package dispatcher
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Recover returns requests left processing by a previous run of this
+// instance, or by any instance whose lease has expired, to the queue. It is
+// meant to run once at startup, before the first dispatch.
+func (d *Dispatcher) Recover(ctx context.Context) error {
+	return d.recoverLeases(ctx, d.config.InstanceID)
+}
+
+// RunSweeper periodically recovers expired leases until ctx is cancelled.
+func (d *Dispatcher) RunSweeper(ctx context.Context) {
+	ticker := time.NewTicker(d.config.SweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := d.recoverLeases(ctx, ""); err != nil {
+				log.Printf("Failed to sweep expired leases: %v", err)
+			}
+		}
+	}
+}
+
+func (d *Dispatcher) recoverLeases(ctx context.Context, owner string) error {
+	requeued, failed, err := d.store.RecoverExpiredLeases(ctx, owner, time.Now(), d.config.MaxAttempts)
+	if err != nil {
+		return err
+	}
+	if requeued > 0 || failed > 0 {
+		log.Printf("Recovered expired leases: %d requeued, %d failed after %d attempts", requeued, failed, d.config.MaxAttempts)
+	}
+	return nil
+}
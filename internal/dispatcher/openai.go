@@ -0,0 +1,113 @@
+package dispatcher
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/georgeshao/ai-inference-dam/internal/storage"
+)
+
+// OpenAIProvider talks to any OpenAI-compatible chat completions endpoint.
+type OpenAIProvider struct{}
+
+func (OpenAIProvider) Validate(target Target) error {
+	hasAbsoluteTemplate := target.Namespace.URLTemplate != nil && isAbsoluteURL(*target.Namespace.URLTemplate)
+	if target.Endpoint == "" && !hasAbsoluteTemplate {
+		return errors.New("Missing required configuration: API endpoint")
+	}
+	if target.APIKey == "" {
+		return errors.New("Missing required configuration: API key")
+	}
+	return nil
+}
+
+// BuildRequest sends payload byte-for-byte, except that stream_options is
+// added to streaming requests that do not set it.
+func (OpenAIProvider) BuildRequest(ctx context.Context, target Target, payload json.RawMessage) (*http.Request, error) {
+	body, err := withStreamUsage(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare request payload: %w", err)
+	}
+
+	fullURL, err := buildUpstreamURL(target, payloadModel(payload))
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fullURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+target.APIKey)
+
+	for k, v := range target.Headers {
+		req.Header.Set(k, v)
+	}
+
+	return req, nil
+}
+
+func (OpenAIProvider) ClassifyError(resp *http.Response, body []byte) *ProviderError {
+	return classifyStatus(resp.StatusCode, string(body))
+}
+
+// ParseResponse returns a plain JSON body verbatim. For payloads queued with
+// "stream": true, an SSE body is aggregated into a single completion.
+func (OpenAIProvider) ParseResponse(payload json.RawMessage, resp *http.Response, body []byte) (json.RawMessage, error) {
+	if isEventStream(resp) {
+		result, err := aggregateChatStream(body)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(result)
+	}
+
+	if !isJSONObject(body) {
+		return nil, errors.New("failed to parse response: body is not a JSON object")
+	}
+	return json.RawMessage(body), nil
+}
+
+func (OpenAIProvider) ParseUsage(response json.RawMessage) storage.Usage {
+	return parseOpenAIUsage(response)
+}
+
+// parseOpenAIUsage reads the usage block of a chat.completion object.
+// Cached and reasoning tokens are subsets of the prompt and completion
+// counts respectively.
+func parseOpenAIUsage(response json.RawMessage) storage.Usage {
+	var parsed struct {
+		Usage map[string]interface{} `json:"usage"`
+	}
+	_ = json.Unmarshal(response, &parsed)
+	usage := parsed.Usage
+	promptDetails, _ := usage["prompt_tokens_details"].(map[string]interface{})
+	completionDetails, _ := usage["completion_tokens_details"].(map[string]interface{})
+	return storage.Usage{
+		PromptTokens:     toInt64(usage["prompt_tokens"]),
+		CompletionTokens: toInt64(usage["completion_tokens"]),
+		CachedTokens:     toInt64(promptDetails["cached_tokens"]),
+		ReasoningTokens:  toInt64(completionDetails["reasoning_tokens"]),
+	}
+}
+
+func toInt64(v interface{}) int64 {
+	switch n := v.(type) {
+	case float64:
+		return int64(n)
+	case int64:
+		return n
+	case int:
+		return int64(n)
+	case json.Number:
+		i, _ := n.Int64()
+		return i
+	}
+	return 0
+}
@@ -0,0 +1,93 @@
+package dispatcher
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Request payloads are kept as the bytes the client sent and are only
+// decoded where a structured view is needed. Decoding uses json.Number so
+// that integers beyond float64 precision survive being encoded again.
+
+func decodeJSON(raw []byte) (map[string]interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+
+	var v map[string]interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return nil, errors.New("expected a JSON object")
+	}
+	return v, nil
+}
+
+// isJSONObject reports whether b is a single valid JSON object.
+func isJSONObject(b []byte) bool {
+	trimmed := bytes.TrimSpace(b)
+	return len(trimmed) > 0 && trimmed[0] == '{' && json.Valid(trimmed)
+}
+
+// payloadModel returns the top-level "model" string of a payload or
+// response, or "" if it has none.
+func payloadModel(raw []byte) string {
+	var v struct {
+		Model string `json:"model"`
+	}
+	_ = json.Unmarshal(raw, &v)
+	return v.Model
+}
+
+// setJSONField returns a copy of the JSON object raw with key set to value.
+// Every other byte is left as it was: an existing member has only its value
+// replaced, and a new member is appended before the closing brace.
+func setJSONField(raw []byte, key string, value json.RawMessage) (json.RawMessage, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, errors.New("payload is not a JSON object")
+	}
+
+	members := 0
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, fmt.Errorf("invalid payload: %w", err)
+		}
+		var member json.RawMessage
+		if err := dec.Decode(&member); err != nil {
+			return nil, fmt.Errorf("invalid payload: %w", err)
+		}
+		members++
+
+		if name, _ := tok.(string); name == key {
+			end := int(dec.InputOffset())
+			start := end - len(member)
+			out := make([]byte, 0, len(raw)-len(member)+len(value))
+			out = append(out, raw[:start]...)
+			out = append(out, value...)
+			return append(out, raw[end:]...), nil
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, fmt.Errorf("invalid payload: %w", err)
+	}
+
+	closing := int(dec.InputOffset()) - 1
+	encodedKey, err := json.Marshal(key)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, len(raw)+len(encodedKey)+len(value)+2)
+	out = append(out, raw[:closing]...)
+	if members > 0 {
+		out = append(out, ',')
+	}
+	out = append(out, encodedKey...)
+	out = append(out, ':')
+	out = append(out, value...)
+	return append(out, raw[closing:]...), nil
+}
@@ -0,0 +1,58 @@
+package dispatcher
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSetJSONField(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want string
+	}{
+		{"replace", `{"b": 1, "model" : "a", "seed": 9007199254740993}`, `{"b": 1, "model" : "gpt-4o", "seed": 9007199254740993}`},
+		{"append", `{"seed": 9007199254740993 }`, `{"seed": 9007199254740993 ,"model":"gpt-4o"}`},
+		{"empty object", `{}`, `{"model":"gpt-4o"}`},
+		{"nested key untouched", `{"meta":{"model":"a"}}`, `{"meta":{"model":"a"},"model":"gpt-4o"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := setJSONField([]byte(tt.raw), "model", json.RawMessage(`"gpt-4o"`))
+			if err != nil {
+				t.Fatalf("setJSONField failed: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	for _, raw := range []string{`[1]`, `{"model":`, ``} {
+		if _, err := setJSONField([]byte(raw), "model", json.RawMessage(`"x"`)); err == nil {
+			t.Errorf("Expected error for %q", raw)
+		}
+	}
+}
+
+func TestWithStreamUsage(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{`{"model":"m"}`, `{"model":"m"}`},
+		{`{"model":"m","stream":true}`, `{"model":"m","stream":true,"stream_options":{"include_usage":true}}`},
+		{`{"stream":true,"stream_options":{"include_usage":false}}`, `{"stream":true,"stream_options":{"include_usage":false}}`},
+	}
+
+	for _, tt := range tests {
+		got, err := withStreamUsage(json.RawMessage(tt.raw))
+		if err != nil {
+			t.Fatalf("withStreamUsage failed: %v", err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("withStreamUsage(%s) = %s, want %s", tt.raw, got, tt.want)
+		}
+	}
+}
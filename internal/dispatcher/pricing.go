@@ -0,0 +1,81 @@
+package dispatcher
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/georgeshao/ai-inference-dam/internal/storage"
+)
+
+// ModelPrice is the USD price per million tokens for a model.
+type ModelPrice struct {
+	InputPerMillion float64 `json:"input_per_million"`
+	// CachedInputPerMillion applies to cached prompt tokens. Zero means
+	// cached tokens are billed at the input price.
+	CachedInputPerMillion float64 `json:"cached_input_per_million,omitempty"`
+	OutputPerMillion      float64 `json:"output_per_million"`
+}
+
+// PricingTable maps model names to prices. A key ending in "*" matches any
+// model with that prefix, so "gpt-4o*" covers dated snapshots.
+type PricingTable map[string]ModelPrice
+
+// LoadPricing reads a pricing table from a JSON file.
+func LoadPricing(path string) (PricingTable, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pricing file: %w", err)
+	}
+
+	var table PricingTable
+	if err := json.Unmarshal(data, &table); err != nil {
+		return nil, fmt.Errorf("failed to parse pricing file: %w", err)
+	}
+	return table, nil
+}
+
+// Lookup returns the price for model, preferring an exact match over the
+// longest matching prefix.
+func (p PricingTable) Lookup(model string) (ModelPrice, bool) {
+	if price, ok := p[model]; ok {
+		return price, true
+	}
+
+	var best ModelPrice
+	bestLen := -1
+	for key, price := range p {
+		prefix, ok := strings.CutSuffix(key, "*")
+		if !ok || !strings.HasPrefix(model, prefix) {
+			continue
+		}
+		if len(prefix) > bestLen {
+			best, bestLen = price, len(prefix)
+		}
+	}
+	return best, bestLen >= 0
+}
+
+// Cost returns the USD cost of usage for model, or 0 if the model is not
+// priced. Reasoning tokens are already included in the completion count.
+func (p PricingTable) Cost(model string, usage storage.Usage) float64 {
+	price, ok := p.Lookup(model)
+	if !ok {
+		return 0
+	}
+
+	cachedPrice := price.CachedInputPerMillion
+	if cachedPrice == 0 {
+		cachedPrice = price.InputPerMillion
+	}
+
+	uncached := usage.PromptTokens - usage.CachedTokens
+	if uncached < 0 {
+		uncached = 0
+	}
+
+	return (float64(uncached)*price.InputPerMillion +
+		float64(usage.CachedTokens)*cachedPrice +
+		float64(usage.CompletionTokens)*price.OutputPerMillion) / 1e6
+}
@@ -0,0 +1,112 @@
+package dispatcher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/georgeshao/ai-inference-dam/internal/storage"
+	"github.com/georgeshao/ai-inference-dam/pkg/types"
+)
+
+// Provider adapts the dispatcher to one upstream API. Responses are always
+// normalized to the OpenAI chat.completion shape before they are stored.
+type Provider interface {
+	// Validate reports missing configuration before a request is dispatched.
+	Validate(target Target) error
+	// BuildRequest creates the upstream HTTP request for payload, the raw
+	// request body as queued with any namespace model override applied.
+	BuildRequest(ctx context.Context, target Target, payload json.RawMessage) (*http.Request, error)
+	// ClassifyError converts a non-2xx upstream response into a ProviderError.
+	ClassifyError(resp *http.Response, body []byte) *ProviderError
+	// ParseResponse normalizes a successful response body. A body that is
+	// already a chat.completion object should be returned unchanged.
+	ParseResponse(payload json.RawMessage, resp *http.Response, body []byte) (json.RawMessage, error)
+	// ParseUsage extracts token usage from a normalized response. Cost is
+	// filled in by the dispatcher from its pricing table.
+	ParseUsage(response json.RawMessage) storage.Usage
+}
+
+// Target is the resolved upstream configuration for a single request.
+type Target struct {
+	Namespace *storage.NamespaceRecord
+	Endpoint  string
+	APIKey    string
+	Headers   map[string]string
+}
+
+type ErrorKind string
+
+const (
+	ErrorKindTransport      ErrorKind = "transport"
+	ErrorKindRateLimit      ErrorKind = "rate_limit"
+	ErrorKindAuth           ErrorKind = "auth"
+	ErrorKindInvalidRequest ErrorKind = "invalid_request"
+	ErrorKindServer         ErrorKind = "server"
+	ErrorKindUnknown        ErrorKind = "unknown"
+)
+
+type ProviderError struct {
+	Kind       ErrorKind
+	StatusCode int
+	Message    string
+	Retryable  bool
+}
+
+func (e *ProviderError) Error() string {
+	if e.StatusCode == 0 {
+		return e.Message
+	}
+	return fmt.Sprintf("provider returned status %d: %s", e.StatusCode, e.Message)
+}
+
+// classifyStatus is the status-code based classification shared by providers.
+func classifyStatus(statusCode int, message string) *ProviderError {
+	e := &ProviderError{Kind: ErrorKindUnknown, StatusCode: statusCode, Message: message}
+	switch {
+	case statusCode == http.StatusTooManyRequests:
+		e.Kind, e.Retryable = ErrorKindRateLimit, true
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden:
+		e.Kind = ErrorKindAuth
+	case statusCode == http.StatusRequestTimeout:
+		e.Kind, e.Retryable = ErrorKindTransport, true
+	case statusCode >= 400 && statusCode < 500:
+		e.Kind = ErrorKindInvalidRequest
+	case statusCode >= 500:
+		e.Kind, e.Retryable = ErrorKindServer, true
+	}
+	return e
+}
+
+var (
+	providersMu sync.RWMutex
+	providers   = map[types.ProviderType]Provider{}
+)
+
+// RegisterProvider makes a provider available under the given type,
+// replacing any provider previously registered for it.
+func RegisterProvider(providerType types.ProviderType, p Provider) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	providers[providerType] = p
+}
+
+// LookupProvider returns the provider registered for providerType. The empty
+// type resolves to the OpenAI provider.
+func LookupProvider(providerType types.ProviderType) (Provider, bool) {
+	if providerType == "" {
+		providerType = types.ProviderOpenAI
+	}
+
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+	p, ok := providers[providerType]
+	return p, ok
+}
+
+func init() {
+	RegisterProvider(types.ProviderOpenAI, OpenAIProvider{})
+	RegisterProvider(types.ProviderBedrock, BedrockProvider{})
+}
@@ -0,0 +1,96 @@
+package dispatcher
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/georgeshao/ai-inference-dam/internal/storage"
+	"github.com/georgeshao/ai-inference-dam/pkg/types"
+)
+
+// RunJanitor periodically applies namespace retention policies until ctx is
+// cancelled.
+func (d *Dispatcher) RunJanitor(ctx context.Context) {
+	ticker := time.NewTicker(d.config.RetentionInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purged, err := d.ApplyRetention(ctx, time.Now())
+			if err != nil {
+				log.Printf("Failed to apply retention policies: %v", err)
+			}
+			if purged > 0 {
+				log.Printf("Purged %d requests past their retention", purged)
+			}
+		}
+	}
+}
+
+// ApplyRetention purges the completed and failed requests that have outlived
+// their namespace's retention policy as of now. It returns how many were
+// purged, including those purged before an error.
+func (d *Dispatcher) ApplyRetention(ctx context.Context, now time.Time) (int, error) {
+	namespaces, err := d.store.ListNamespaces(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	total := 0
+	for _, ns := range namespaces {
+		if ns.Retention == nil {
+			continue
+		}
+		for status, days := range retentionDays(ns.Retention) {
+			if days <= 0 {
+				continue
+			}
+			purged, err := d.Purge(ctx, ns.Name, status, now.AddDate(0, 0, -days))
+			total += purged
+			if err != nil {
+				return total, err
+			}
+		}
+	}
+	return total, nil
+}
+
+func retentionDays(p *storage.RetentionPolicy) map[types.RequestStatus]int {
+	return map[types.RequestStatus]int{
+		types.StatusCompleted: p.CompletedDays,
+		types.StatusFailed:    p.FailedDays,
+	}
+}
+
+// Purge deletes the requests of namespace with status completed before before,
+// PurgeBatchSize at a time so that no single write grows unbounded. Requests
+// finished at or after the RetentionFloor, if one is set, are kept.
+func (d *Dispatcher) Purge(ctx context.Context, namespace string, status types.RequestStatus, before time.Time) (int, error) {
+	if d.config.RetentionFloor != nil {
+		floor := d.config.RetentionFloor()
+		if floor.IsZero() {
+			return 0, nil
+		}
+		if floor.Before(before) {
+			before = floor
+		}
+	}
+	batch := max(d.config.PurgeBatchSize, 1)
+
+	total := 0
+	for ctx.Err() == nil {
+		purged, err := d.store.PurgeRequests(ctx, namespace, status, before, batch)
+		total += purged
+		if err != nil {
+			return total, err
+		}
+		if purged < batch {
+			return total, nil
+		}
+	}
+	return total, ctx.Err()
+}
@@ -0,0 +1,246 @@
+package dispatcher
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+func isEventStream(resp *http.Response) bool {
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return mediaType == "text/event-stream"
+}
+
+// withStreamUsage asks the provider to report usage in the final chunk of a
+// streaming response, which is otherwise omitted.
+func withStreamUsage(payload json.RawMessage) (json.RawMessage, error) {
+	var fields struct {
+		Stream        bool             `json:"stream"`
+		StreamOptions *json.RawMessage `json:"stream_options"`
+	}
+	if json.Unmarshal(payload, &fields) != nil || !fields.Stream || fields.StreamOptions != nil {
+		return payload, nil
+	}
+	return setJSONField(payload, "stream_options", json.RawMessage(`{"include_usage":true}`))
+}
+
+// streamChoice accumulates the deltas for one choice index.
+type streamChoice struct {
+	role         string
+	content      strings.Builder
+	hasContent   bool
+	refusal      strings.Builder
+	hasRefusal   bool
+	toolCalls    map[int]*streamToolCall
+	logprobs     []interface{}
+	hasLogprobs  bool
+	finishReason interface{}
+}
+
+type streamToolCall struct {
+	id        interface{}
+	callType  interface{}
+	name      strings.Builder
+	arguments strings.Builder
+}
+
+// aggregateChatStream assembles the chat.completion.chunk events of an SSE
+// body into the chat.completion object a non-streaming request would return.
+func aggregateChatStream(body []byte) (map[string]interface{}, error) {
+	result := map[string]interface{}{"object": "chat.completion"}
+	choices := map[int]*streamChoice{}
+	sawChunk := false
+
+	for _, data := range sseEvents(body) {
+		if data == "[DONE]" {
+			break
+		}
+
+		var chunk map[string]interface{}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return nil, fmt.Errorf("failed to parse stream chunk: %w", err)
+		}
+		if errObj, ok := chunk["error"]; ok {
+			msg, _ := json.Marshal(errObj)
+			return nil, fmt.Errorf("provider stream error: %s", msg)
+		}
+		sawChunk = true
+
+		for _, key := range []string{"id", "created", "model", "system_fingerprint", "service_tier"} {
+			if v, ok := chunk[key]; ok && v != nil {
+				result[key] = v
+			}
+		}
+		if usage, ok := chunk["usage"]; ok && usage != nil {
+			result["usage"] = usage
+		}
+
+		rawChoices, _ := chunk["choices"].([]interface{})
+		for _, raw := range rawChoices {
+			c, _ := raw.(map[string]interface{})
+			index := int(toInt64(c["index"]))
+			acc, ok := choices[index]
+			if !ok {
+				acc = &streamChoice{toolCalls: map[int]*streamToolCall{}}
+				choices[index] = acc
+			}
+			acc.apply(c)
+		}
+	}
+
+	if !sawChunk {
+		return nil, fmt.Errorf("stream contained no chunks")
+	}
+
+	indexes := make([]int, 0, len(choices))
+	for index := range choices {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	out := make([]interface{}, 0, len(indexes))
+	for _, index := range indexes {
+		out = append(out, choices[index].build(index))
+	}
+	result["choices"] = out
+
+	return result, nil
+}
+
+func (acc *streamChoice) apply(c map[string]interface{}) {
+	if reason, ok := c["finish_reason"]; ok && reason != nil {
+		acc.finishReason = reason
+	}
+	if lp, ok := c["logprobs"].(map[string]interface{}); ok {
+		acc.hasLogprobs = true
+		if content, ok := lp["content"].([]interface{}); ok {
+			acc.logprobs = append(acc.logprobs, content...)
+		}
+	}
+
+	delta, _ := c["delta"].(map[string]interface{})
+	if role, ok := delta["role"].(string); ok && role != "" {
+		acc.role = role
+	}
+	if content, ok := delta["content"].(string); ok {
+		acc.content.WriteString(content)
+		acc.hasContent = true
+	}
+	if refusal, ok := delta["refusal"].(string); ok {
+		acc.refusal.WriteString(refusal)
+		acc.hasRefusal = true
+	}
+
+	toolCalls, _ := delta["tool_calls"].([]interface{})
+	for _, raw := range toolCalls {
+		tc, _ := raw.(map[string]interface{})
+		index := int(toInt64(tc["index"]))
+		call, ok := acc.toolCalls[index]
+		if !ok {
+			call = &streamToolCall{}
+			acc.toolCalls[index] = call
+		}
+		if id, ok := tc["id"]; ok && id != nil {
+			call.id = id
+		}
+		if t, ok := tc["type"]; ok && t != nil {
+			call.callType = t
+		}
+		if fn, ok := tc["function"].(map[string]interface{}); ok {
+			if name, ok := fn["name"].(string); ok {
+				call.name.WriteString(name)
+			}
+			if args, ok := fn["arguments"].(string); ok {
+				call.arguments.WriteString(args)
+			}
+		}
+	}
+}
+
+func (acc *streamChoice) build(index int) map[string]interface{} {
+	role := acc.role
+	if role == "" {
+		role = "assistant"
+	}
+
+	message := map[string]interface{}{
+		"role":    role,
+		"content": nil,
+		"refusal": nil,
+	}
+	if acc.hasContent {
+		message["content"] = acc.content.String()
+	}
+	if acc.hasRefusal {
+		message["refusal"] = acc.refusal.String()
+	}
+
+	if len(acc.toolCalls) > 0 {
+		indexes := make([]int, 0, len(acc.toolCalls))
+		for i := range acc.toolCalls {
+			indexes = append(indexes, i)
+		}
+		sort.Ints(indexes)
+
+		calls := make([]interface{}, 0, len(indexes))
+		for _, i := range indexes {
+			call := acc.toolCalls[i]
+			callType := call.callType
+			if callType == nil {
+				callType = "function"
+			}
+			calls = append(calls, map[string]interface{}{
+				"id":   call.id,
+				"type": callType,
+				"function": map[string]interface{}{
+					"name":      call.name.String(),
+					"arguments": call.arguments.String(),
+				},
+			})
+		}
+		message["tool_calls"] = calls
+	}
+
+	var logprobs interface{}
+	if acc.hasLogprobs {
+		logprobs = map[string]interface{}{"content": acc.logprobs}
+	}
+
+	return map[string]interface{}{
+		"index":         index,
+		"message":       message,
+		"logprobs":      logprobs,
+		"finish_reason": acc.finishReason,
+	}
+}
+
+// sseEvents returns the data payload of each event in an SSE body.
+func sseEvents(body []byte) []string {
+	var events []string
+	var data []string
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 64*1024), len(body)+1)
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		switch {
+		case line == "":
+			if len(data) > 0 {
+				events = append(events, strings.Join(data, "\n"))
+				data = nil
+			}
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if len(data) > 0 {
+		events = append(events, strings.Join(data, "\n"))
+	}
+
+	return events
+}
@@ -0,0 +1,125 @@
+package dispatcher
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/georgeshao/ai-inference-dam/internal/storage"
+)
+
+const testChatStream = `data: {"id":"chatcmpl-9","object":"chat.completion.chunk","created":1700000000,"model":"gpt-4o","choices":[{"index":0,"delta":{"role":"assistant","content":""},"finish_reason":null}]}
+
+data: {"id":"chatcmpl-9","object":"chat.completion.chunk","created":1700000000,"model":"gpt-4o","choices":[{"index":0,"delta":{"content":"Checking "},"finish_reason":null}]}
+
+data: {"id":"chatcmpl-9","object":"chat.completion.chunk","created":1700000000,"model":"gpt-4o","choices":[{"index":0,"delta":{"content":"now."},"finish_reason":null}]}
+
+data: {"id":"chatcmpl-9","object":"chat.completion.chunk","created":1700000000,"model":"gpt-4o","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_a","type":"function","function":{"name":"get_weather","arguments":""}}]},"finish_reason":null}]}
+
+data: {"id":"chatcmpl-9","object":"chat.completion.chunk","created":1700000000,"model":"gpt-4o","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"city\":"}}]},"finish_reason":null}]}
+
+data: {"id":"chatcmpl-9","object":"chat.completion.chunk","created":1700000000,"model":"gpt-4o","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"Paris\"}"}}]},"finish_reason":null}]}
+
+data: {"id":"chatcmpl-9","object":"chat.completion.chunk","created":1700000000,"model":"gpt-4o","choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}
+
+data: {"id":"chatcmpl-9","object":"chat.completion.chunk","created":1700000000,"model":"gpt-4o","choices":[],"usage":{"prompt_tokens":20,"completion_tokens":9,"total_tokens":29}}
+
+data: [DONE]
+
+`
+
+func TestAggregateChatStream(t *testing.T) {
+	got, err := aggregateChatStream([]byte(testChatStream))
+	if err != nil {
+		t.Fatalf("aggregateChatStream failed: %v", err)
+	}
+
+	var want map[string]interface{}
+	err = json.Unmarshal([]byte(`{
+		"id": "chatcmpl-9",
+		"object": "chat.completion",
+		"created": 1700000000,
+		"model": "gpt-4o",
+		"choices": [{
+			"index": 0,
+			"message": {
+				"role": "assistant",
+				"content": "Checking now.",
+				"refusal": null,
+				"tool_calls": [{"id": "call_a", "type": "function", "function": {"name": "get_weather", "arguments": "{\"city\":\"Paris\"}"}}]
+			},
+			"logprobs": null,
+			"finish_reason": "tool_calls"
+		}],
+		"usage": {"prompt_tokens": 20, "completion_tokens": 9, "total_tokens": 29}
+	}`), &want)
+	if err != nil {
+		t.Fatalf("Failed to decode expected: %v", err)
+	}
+
+	// Round-trip so numeric types match what a stored response looks like
+	encoded, _ := json.Marshal(got)
+	var roundTripped map[string]interface{}
+	if err := json.Unmarshal(encoded, &roundTripped); err != nil {
+		t.Fatalf("Failed to round-trip: %v", err)
+	}
+
+	if !reflect.DeepEqual(roundTripped, want) {
+		t.Errorf("Aggregated response mismatch:\n got: %s", encoded)
+	}
+}
+
+func TestAggregateChatStreamError(t *testing.T) {
+	body := "data: {\"error\": {\"message\": \"overloaded\"}}\n\n"
+	if _, err := aggregateChatStream([]byte(body)); err == nil {
+		t.Error("Expected error for stream error event")
+	}
+}
+
+func TestSendStreamingRequest(t *testing.T) {
+	var sent map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &sent); err != nil {
+			t.Errorf("Failed to decode body: %v", err)
+		}
+		w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+		w.Write([]byte(testChatStream))
+	}))
+	defer server.Close()
+
+	target := Target{
+		Namespace: &storage.NamespaceRecord{},
+		Endpoint:  server.URL,
+		APIKey:    "sk-test",
+	}
+	payload := json.RawMessage(`{"model":"gpt-4o","stream":true}`)
+
+	client := NewClient(5 * time.Second)
+	raw, err := client.Send(context.Background(), OpenAIProvider{}, target, payload)
+	if err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	var resp map[string]interface{}
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if opts, _ := sent["stream_options"].(map[string]interface{}); opts["include_usage"] != true {
+		t.Errorf("Expected include_usage to be requested, got %v", sent["stream_options"])
+	}
+	if string(payload) != `{"model":"gpt-4o","stream":true}` {
+		t.Error("Queued payload should not be modified")
+	}
+	if resp["object"] != "chat.completion" {
+		t.Errorf("Expected chat.completion, got %v", resp["object"])
+	}
+	if usage := (OpenAIProvider{}).ParseUsage(raw); usage.PromptTokens != 20 || usage.CompletionTokens != 9 {
+		t.Errorf("Usage mismatch: %+v", usage)
+	}
+}
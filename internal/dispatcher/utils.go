@@ -1,6 +1,11 @@
 package dispatcher
 
 import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
 	"github.com/georgeshao/ai-inference-dam/internal/storage"
 )
 
@@ -42,11 +47,70 @@ func mergeHeaders(ns *storage.NamespaceRecord, passthroughHeaders map[string]str
 	return result
 }
 
-func cloneAndOverrideModel(payload map[string]interface{}, model string) map[string]interface{} {
-	cloned := make(map[string]interface{}, len(payload))
-	for k, v := range payload {
-		cloned[k] = v
+// overrideModel returns a copy of payload with its model replaced, leaving
+// the rest of the body untouched.
+func overrideModel(payload json.RawMessage, model string) (json.RawMessage, error) {
+	encoded, err := json.Marshal(model)
+	if err != nil {
+		return nil, err
+	}
+	return setJSONField(payload, "model", encoded)
+}
+
+// responseModel returns the model the provider reports having served,
+// falling back to the model that was requested.
+func responseModel(response, payload json.RawMessage) string {
+	if model := payloadModel(response); model != "" {
+		return model
+	}
+	return payloadModel(payload)
+}
+
+// buildUpstreamURL resolves the chat completions URL for target. A namespace
+// URL template takes precedence; otherwise "/chat/completions" is appended to
+// the endpoint unless the endpoint already points at it.
+func buildUpstreamURL(target Target, model string) (string, error) {
+	ns := target.Namespace
+
+	var u *url.URL
+	var err error
+	if ns.URLTemplate != nil && *ns.URLTemplate != "" {
+		raw := expandURLTemplate(*ns.URLTemplate, model, ns.Name, url.PathEscape)
+		if !isAbsoluteURL(raw) {
+			raw = strings.TrimRight(target.Endpoint, "/") + "/" + strings.TrimLeft(raw, "/")
+		}
+		u, err = url.Parse(raw)
+	} else {
+		u, err = url.Parse(target.Endpoint)
+		if err == nil && !strings.HasSuffix(strings.TrimRight(u.Path, "/"), "/chat/completions") {
+			u = u.JoinPath("chat/completions")
+		}
+	}
+	if err != nil {
+		return "", fmt.Errorf("invalid upstream URL: %w", err)
+	}
+
+	if len(ns.QueryParams) > 0 {
+		query := u.Query()
+		for k, v := range ns.QueryParams {
+			query.Set(k, expandURLTemplate(v, model, ns.Name, nil))
+		}
+		u.RawQuery = query.Encode()
+	}
+
+	return u.String(), nil
+}
+
+// expandURLTemplate substitutes the {model} and {namespace} placeholders,
+// passing each value through escape when it is non-nil.
+func expandURLTemplate(template, model, namespace string, escape func(string) string) string {
+	if escape != nil {
+		model = escape(model)
+		namespace = escape(namespace)
 	}
-	cloned["model"] = model
-	return cloned
+	return strings.NewReplacer("{model}", model, "{namespace}", namespace).Replace(template)
+}
+
+func isAbsoluteURL(raw string) bool {
+	return strings.HasPrefix(raw, "http://") || strings.HasPrefix(raw, "https://")
 }
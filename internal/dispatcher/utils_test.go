@@ -0,0 +1,70 @@
+package dispatcher
+
+import (
+	"testing"
+
+	"github.com/georgeshao/ai-inference-dam/internal/storage"
+)
+
+func TestBuildUpstreamURL(t *testing.T) {
+	strPtr := func(s string) *string { return &s }
+
+	tests := []struct {
+		name        string
+		endpoint    string
+		template    *string
+		queryParams map[string]string
+		want        string
+	}{
+		{
+			name:     "default path",
+			endpoint: "https://api.openai.com/v1",
+			want:     "https://api.openai.com/v1/chat/completions",
+		},
+		{
+			name:     "endpoint already includes path",
+			endpoint: "https://gateway.internal/v1/chat/completions",
+			want:     "https://gateway.internal/v1/chat/completions",
+		},
+		{
+			name:     "endpoint with query",
+			endpoint: "https://gateway.internal/v1?tenant=a",
+			want:     "https://gateway.internal/v1/chat/completions?tenant=a",
+		},
+		{
+			name:        "relative template with query params",
+			endpoint:    "https://example.openai.azure.com/",
+			template:    strPtr("/openai/deployments/{model}/chat/completions"),
+			queryParams: map[string]string{"api-version": "2024-06-01"},
+			want:        "https://example.openai.azure.com/openai/deployments/gpt-4o/chat/completions?api-version=2024-06-01",
+		},
+		{
+			name:        "absolute template",
+			endpoint:    "https://ignored.example.com",
+			template:    strPtr("https://gw.example.com/{namespace}/chat?model={model}"),
+			queryParams: map[string]string{"route": "{namespace}-{model}"},
+			want:        "https://gw.example.com/team-a/chat?model=gpt-4o&route=team-a-gpt-4o",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := Target{
+				Namespace: &storage.NamespaceRecord{
+					Name:        "team-a",
+					URLTemplate: tt.template,
+					QueryParams: tt.queryParams,
+				},
+				Endpoint: tt.endpoint,
+			}
+
+			got, err := buildUpstreamURL(target, "gpt-4o")
+			if err != nil {
+				t.Fatalf("buildUpstreamURL failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("URL mismatch:\n got: %s\nwant: %s", got, tt.want)
+			}
+		})
+	}
+}
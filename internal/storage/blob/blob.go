@@ -0,0 +1,234 @@
+// Package blob keeps large payloads in a content-addressed directory
+// instead of the database. A stored request holds a reference in place of
+// each offloaded payload, and identical payloads share one file.
+//
+// Files are named by the SHA-256 of the payload and hold it as written by
+// the store's compression codec, without a namespace dictionary since a
+// file may be shared between namespaces.
+package blob
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/georgeshao/ai-inference-dam/internal/storage/compression"
+)
+
+// Options configures payload offloading for a store. The zero value keeps
+// every payload in the database; references already stored need Dir to be
+// read.
+type Options struct {
+	Dir string
+	// Payloads larger than Threshold bytes are offloaded. Zero uses
+	// DefaultThreshold.
+	Threshold int
+	// GracePeriod is how long an unreferenced blob is kept after it was
+	// last written, so a request being stored is not collected before its
+	// reference is committed. Zero uses DefaultGracePeriod.
+	GracePeriod time.Duration
+}
+
+const (
+	DefaultThreshold   = 256 << 10
+	DefaultGracePeriod = 10 * time.Minute
+)
+
+// ErrNoStore is returned for a reference read by a store opened without a
+// blob directory.
+var ErrNoStore = errors.New("payload is stored in a blob but no blob directory is configured")
+
+// Ref points at an offloaded payload. Size is the payload's length.
+type Ref struct {
+	Hash string
+	Size int64
+}
+
+// refPrefix starts every stored reference. Payloads are JSON objects and
+// compressed payloads zstd frames, so neither can be mistaken for one.
+var refPrefix = []byte("blob:sha256:")
+
+// Encode returns the value stored in place of the payload.
+func (r Ref) Encode() []byte {
+	return []byte(fmt.Sprintf("%s%s:%d", refPrefix, r.Hash, r.Size))
+}
+
+// ParseRef reports whether a stored value is a reference, and decodes it.
+func ParseRef(value []byte) (Ref, bool) {
+	if !bytes.HasPrefix(value, refPrefix) {
+		return Ref{}, false
+	}
+	rest := value[len(refPrefix):]
+	i := bytes.IndexByte(rest, ':')
+	if i != sha256.Size*2 {
+		return Ref{}, false
+	}
+	size, err := strconv.ParseInt(string(rest[i+1:]), 10, 64)
+	if err != nil {
+		return Ref{}, false
+	}
+	return Ref{Hash: string(rest[:i]), Size: size}, true
+}
+
+// Store reads and writes blobs under a directory. It is safe for concurrent
+// use, including by several processes sharing the directory.
+type Store struct {
+	dir         string
+	threshold   int
+	gracePeriod time.Duration
+	codec       *compression.Codec
+}
+
+// Open creates the blob directory if needed. Blobs are compressed with
+// codec.
+func Open(opts Options, codec *compression.Codec) (*Store, error) {
+	if opts.Threshold == 0 {
+		opts.Threshold = DefaultThreshold
+	}
+	if opts.GracePeriod == 0 {
+		opts.GracePeriod = DefaultGracePeriod
+	}
+	if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create blob directory: %w", err)
+	}
+
+	return &Store{
+		dir:         opts.Dir,
+		threshold:   opts.Threshold,
+		gracePeriod: opts.GracePeriod,
+		codec:       codec,
+	}, nil
+}
+
+// Offload reports whether a payload is large enough to keep in a blob.
+func (s *Store) Offload(payload []byte) bool {
+	return len(payload) > s.threshold
+}
+
+func (s *Store) path(hash string) string {
+	return filepath.Join(s.dir, hash[:2], hash)
+}
+
+// Put stores payload and returns its reference. When the blob already
+// exists it is only touched, which restarts its grace period.
+func (s *Store) Put(payload []byte) (Ref, error) {
+	sum := sha256.Sum256(payload)
+	ref := Ref{Hash: hex.EncodeToString(sum[:]), Size: int64(len(payload))}
+	path := s.path(ref.Hash)
+
+	now := time.Now()
+	if err := os.Chtimes(path, now, now); err == nil {
+		return ref, nil
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return Ref{}, fmt.Errorf("failed to touch blob %s: %w", ref.Hash, err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return Ref{}, fmt.Errorf("failed to create blob directory: %w", err)
+	}
+
+	// Write to a temporary file and rename it into place, so readers never
+	// see a partial blob
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return Ref{}, fmt.Errorf("failed to create blob: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(s.codec.CompressShared(payload)); err != nil {
+		tmp.Close()
+		return Ref{}, fmt.Errorf("failed to write blob %s: %w", ref.Hash, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return Ref{}, fmt.Errorf("failed to sync blob %s: %w", ref.Hash, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return Ref{}, fmt.Errorf("failed to write blob %s: %w", ref.Hash, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return Ref{}, fmt.Errorf("failed to store blob %s: %w", ref.Hash, err)
+	}
+
+	return ref, nil
+}
+
+// Get returns the payload ref points at.
+func (s *Store) Get(ref Ref) ([]byte, error) {
+	data, err := os.ReadFile(s.path(ref.Hash))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blob %s: %w", ref.Hash, err)
+	}
+	payload, err := s.codec.Decompress(data)
+	if err != nil {
+		return nil, fmt.Errorf("blob %s: %w", ref.Hash, err)
+	}
+	if int64(len(payload)) != ref.Size {
+		return nil, fmt.Errorf("blob %s is %d bytes, want %d", ref.Hash, len(payload), ref.Size)
+	}
+	return payload, nil
+}
+
+// Collect removes the blobs among hashes that referenced reports as unused,
+// unless they were written within the grace period. It returns how many
+// were removed.
+func (s *Store) Collect(hashes []string, referenced func(hash string) (bool, error)) (int, error) {
+	removed := 0
+	for _, hash := range hashes {
+		used, err := referenced(hash)
+		if err != nil {
+			return removed, err
+		}
+		if used {
+			continue
+		}
+
+		// Check the age after the references: a writer touches the blob
+		// before committing its reference, so a blob that is old here had
+		// no reference in flight when referenced was called
+		info, err := os.Stat(s.path(hash))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return removed, fmt.Errorf("failed to stat blob %s: %w", hash, err)
+		}
+		if time.Since(info.ModTime()) < s.gracePeriod {
+			continue
+		}
+
+		if err := os.Remove(s.path(hash)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return removed, fmt.Errorf("failed to remove blob %s: %w", hash, err)
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// Hashes lists every blob in the directory.
+func (s *Store) Hashes() ([]string, error) {
+	var hashes []string
+	err := filepath.WalkDir(s.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if name := d.Name(); len(name) == sha256.Size*2 && filepath.Base(filepath.Dir(path)) == name[:2] {
+			hashes = append(hashes, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list blobs: %w", err)
+	}
+	return hashes, nil
+}
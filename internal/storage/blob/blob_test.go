@@ -0,0 +1,96 @@
+package blob
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/georgeshao/ai-inference-dam/internal/storage/compression"
+)
+
+func openTestStore(t *testing.T, gracePeriod time.Duration) *Store {
+	t.Helper()
+	codec, err := compression.NewCodec(compression.Options{Enabled: true})
+	if err != nil {
+		t.Fatalf("NewCodec failed: %v", err)
+	}
+	t.Cleanup(codec.Close)
+
+	store, err := Open(Options{Dir: t.TempDir(), Threshold: 16, GracePeriod: gracePeriod}, codec)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	return store
+}
+
+func TestPutGet(t *testing.T) {
+	store := openTestStore(t, time.Nanosecond)
+	payload := bytes.Repeat([]byte(`{"image":"iVBORw0KGgo="}`), 100)
+
+	ref, err := store.Put(payload)
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if again, _ := store.Put(payload); again != ref {
+		t.Errorf("Expected identical payloads to share a blob, got %v and %v", ref, again)
+	}
+	if hashes, _ := store.Hashes(); len(hashes) != 1 || hashes[0] != ref.Hash {
+		t.Errorf("Expected one blob %s, got %v", ref.Hash, hashes)
+	}
+
+	parsed, ok := ParseRef(ref.Encode())
+	if !ok || parsed != ref {
+		t.Fatalf("ParseRef(%s) = %v, %v", ref.Encode(), parsed, ok)
+	}
+	got, err := store.Get(parsed)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if !bytes.Equal(got, payload) {
+		t.Error("Get returned a different payload")
+	}
+
+	if info, err := os.Stat(store.path(ref.Hash)); err != nil || info.Size() >= int64(len(payload)) {
+		t.Errorf("Expected blob to be stored compressed, got %v", err)
+	}
+}
+
+func TestParseRefRejectsPayloads(t *testing.T) {
+	for _, value := range []string{
+		`{"model":"gpt-4o"}`,
+		"blob:sha256:abc:10",
+		"blob:sha256:" + string(bytes.Repeat([]byte("a"), 64)) + ":x",
+	} {
+		if _, ok := ParseRef([]byte(value)); ok {
+			t.Errorf("ParseRef(%q) should fail", value)
+		}
+	}
+}
+
+func TestCollect(t *testing.T) {
+	store := openTestStore(t, time.Nanosecond)
+	kept, _ := store.Put(bytes.Repeat([]byte("k"), 64))
+	unused, _ := store.Put(bytes.Repeat([]byte("u"), 64))
+
+	removed, err := store.Collect([]string{kept.Hash, unused.Hash, "missing"}, func(hash string) (bool, error) {
+		return hash == kept.Hash, nil
+	})
+	if err != nil || removed != 1 {
+		t.Fatalf("Collect = %d, %v; want 1 removed", removed, err)
+	}
+	if _, err := store.Get(kept); err != nil {
+		t.Errorf("Referenced blob was removed: %v", err)
+	}
+	if _, err := store.Get(unused); err == nil {
+		t.Error("Unreferenced blob was kept")
+	}
+
+	// Blobs written within the grace period are kept
+	store.gracePeriod = time.Hour
+	recent, _ := store.Put(bytes.Repeat([]byte("r"), 64))
+	removed, _ = store.Collect([]string{recent.Hash}, func(string) (bool, error) { return false, nil })
+	if removed != 0 {
+		t.Error("Blob within its grace period was removed")
+	}
+}
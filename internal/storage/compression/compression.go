@@ -0,0 +1,298 @@
+// Package compression compresses request and response payloads at rest with
+// zstd. Stores keep what Compress returns in place of the payload and pass
+// it back through Decompress when reading.
+//
+// Compressed values are plain zstd frames. Payloads are JSON objects, which
+// never start with the zstd magic number, so values written before
+// compression was enabled, or left uncompressed because they were small,
+// are read back unchanged.
+package compression
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Options configures payload compression for a store. The zero value stores
+// new payloads uncompressed; compressed payloads are readable either way.
+type Options struct {
+	Enabled bool
+	// Level is the zstd compression level, from 1 (fastest) to 22. Zero
+	// uses the zstd default of 3.
+	Level int
+	// MinSize is the smallest payload worth compressing. Zero uses
+	// DefaultMinSize.
+	MinSize int
+}
+
+// DefaultMinSize is the payload size below which compression rarely pays
+// for the frame header.
+const DefaultMinSize = 128
+
+// FirstDictionaryID is the lowest ID handed to trained dictionaries. Lower
+// IDs are reserved by the zstd format.
+const FirstDictionaryID = 1 << 15
+
+// MaxDictionarySize bounds the history of a trained dictionary.
+const MaxDictionarySize = 112 << 10
+
+var magic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+// Dictionary is a zstd dictionary trained on the payloads of one namespace.
+type Dictionary struct {
+	ID        uint32
+	Namespace string
+	Data      []byte
+	CreatedAt time.Time
+}
+
+// Codec compresses and decompresses payloads. It is safe for concurrent use.
+type Codec struct {
+	opts Options
+
+	mu       sync.RWMutex
+	encoder  *zstd.Encoder
+	decoder  *zstd.Decoder
+	byNs     map[string]*zstd.Encoder // namespace → encoder using its newest dictionary
+	nsDictID map[string]uint32
+	byDictID map[uint32]*zstd.Decoder
+}
+
+func NewCodec(opts Options) (*Codec, error) {
+	if opts.Level < 0 || opts.Level > 22 {
+		return nil, fmt.Errorf("invalid zstd level %d", opts.Level)
+	}
+	if opts.Level == 0 {
+		opts.Level = 3
+	}
+	if opts.MinSize == 0 {
+		opts.MinSize = DefaultMinSize
+	}
+
+	encoder, err := newEncoder(opts.Level, nil)
+	if err != nil {
+		return nil, err
+	}
+	decoder, err := zstd.NewReader(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create zstd decoder: %w", err)
+	}
+
+	return &Codec{
+		opts:     opts,
+		encoder:  encoder,
+		decoder:  decoder,
+		byNs:     make(map[string]*zstd.Encoder),
+		nsDictID: make(map[string]uint32),
+		byDictID: make(map[uint32]*zstd.Decoder),
+	}, nil
+}
+
+func newEncoder(level int, dict []byte) (*zstd.Encoder, error) {
+	// Single segment frames always record their content size, which RawSize
+	// reads; otherwise it is left out for payloads under 256 bytes.
+	opts := []zstd.EOption{
+		zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)),
+		zstd.WithSingleSegment(true),
+	}
+	if dict != nil {
+		opts = append(opts, zstd.WithEncoderDict(dict))
+	}
+	encoder, err := zstd.NewWriter(nil, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create zstd encoder: %w", err)
+	}
+	return encoder, nil
+}
+
+// Enabled reports whether new payloads are compressed.
+func (c *Codec) Enabled() bool {
+	return c.opts.Enabled
+}
+
+// Compress returns the value to store for a payload of namespace. Payloads
+// are returned as they are when compression is disabled, they are shorter
+// than MinSize, or compressing them does not save space.
+func (c *Codec) Compress(namespace string, payload []byte) []byte {
+	if !c.opts.Enabled || len(payload) < c.opts.MinSize {
+		return payload
+	}
+
+	c.mu.RLock()
+	encoder, ok := c.byNs[namespace]
+	if !ok {
+		encoder = c.encoder
+	}
+	c.mu.RUnlock()
+
+	return compress(encoder, payload)
+}
+
+// CompressShared is Compress without a namespace dictionary, for values
+// shared between namespaces.
+func (c *Codec) CompressShared(payload []byte) []byte {
+	if !c.opts.Enabled || len(payload) < c.opts.MinSize {
+		return payload
+	}
+	return compress(c.encoder, payload)
+}
+
+func compress(encoder *zstd.Encoder, payload []byte) []byte {
+	compressed := encoder.EncodeAll(payload, make([]byte, 0, len(payload)/2))
+	if len(compressed) >= len(payload) {
+		return payload
+	}
+	return compressed
+}
+
+// Decompress returns the payload for a stored value.
+func (c *Codec) Decompress(value []byte) ([]byte, error) {
+	if !IsCompressed(value) {
+		return value, nil
+	}
+
+	var header zstd.Header
+	if err := header.Decode(value); err != nil {
+		return nil, fmt.Errorf("invalid zstd frame: %w", err)
+	}
+
+	decoder := c.decoder
+	if header.DictionaryID != 0 {
+		c.mu.RLock()
+		decoder = c.byDictID[header.DictionaryID]
+		c.mu.RUnlock()
+		if decoder == nil {
+			return nil, fmt.Errorf("unknown compression dictionary %d", header.DictionaryID)
+		}
+	}
+
+	var dst []byte
+	if header.HasFCS {
+		dst = make([]byte, 0, header.FrameContentSize)
+	}
+	payload, err := decoder.DecodeAll(value, dst)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress payload: %w", err)
+	}
+	return payload, nil
+}
+
+// AddDictionary makes d available for decompression and, unless the
+// namespace already uses a newer one, for compressing its new payloads.
+func (c *Codec) AddDictionary(d *Dictionary) error {
+	decoder, err := zstd.NewReader(nil, zstd.WithDecoderDicts(d.Data))
+	if err != nil {
+		return fmt.Errorf("failed to load dictionary %d: %w", d.ID, err)
+	}
+	encoder, err := newEncoder(c.opts.Level, d.Data)
+	if err != nil {
+		decoder.Close()
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if old, ok := c.byDictID[d.ID]; ok {
+		old.Close()
+	}
+	c.byDictID[d.ID] = decoder
+	if d.ID >= c.nsDictID[d.Namespace] {
+		c.byNs[d.Namespace] = encoder
+		c.nsDictID[d.Namespace] = d.ID
+	}
+	return nil
+}
+
+// RemoveNamespace forgets the dictionaries of a deleted namespace.
+func (c *Codec) RemoveNamespace(namespace string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.byNs, namespace)
+	delete(c.nsDictID, namespace)
+}
+
+func (c *Codec) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.decoder.Close()
+	for _, decoder := range c.byDictID {
+		decoder.Close()
+	}
+}
+
+// IsCompressed reports whether value is a zstd frame.
+func IsCompressed(value []byte) bool {
+	return bytes.HasPrefix(value, magic)
+}
+
+// RawSize returns the uncompressed size of a stored value, read from the
+// frame header without decompressing.
+func RawSize(value []byte) int64 {
+	if !IsCompressed(value) {
+		return int64(len(value))
+	}
+	var header zstd.Header
+	if header.Decode(value) != nil || !header.HasFCS {
+		return int64(len(value))
+	}
+	return int64(header.FrameContentSize)
+}
+
+var (
+	// ErrNoSamples is returned by Train when there is nothing to train on.
+	ErrNoSamples = errors.New("no payloads to train a dictionary on")
+	// ErrDisabled is returned when training a dictionary for a store that
+	// does not compress new payloads.
+	ErrDisabled = errors.New("payload compression is disabled")
+)
+
+// Train builds a dictionary with the given ID from sample payloads, oldest
+// first. The newest samples become the dictionary history that matches are
+// drawn from, and the rest tune its entropy tables.
+func Train(id uint32, samples [][]byte) (dict []byte, err error) {
+	limit := 0
+	for _, sample := range samples {
+		limit += len(sample)
+	}
+	limit = min(limit/2, MaxDictionarySize)
+
+	start, size := len(samples), 0
+	for start > 0 && size < limit {
+		start--
+		size += len(samples[start])
+	}
+	history := bytes.Join(samples[start:], nil)
+	if len(history) > MaxDictionarySize {
+		history = history[len(history)-MaxDictionarySize:]
+	}
+	if len(history) < 8 || start == 0 {
+		return nil, ErrNoSamples
+	}
+
+	// BuildDict divides by the literal count and panics when the samples
+	// are entirely covered by the history, e.g. all identical.
+	defer func() {
+		if r := recover(); r != nil {
+			dict, err = nil, fmt.Errorf("failed to build dictionary: %v", r)
+		}
+	}()
+
+	dict, err = zstd.BuildDict(zstd.BuildDictOptions{
+		ID:       id,
+		Contents: samples[:start],
+		History:  history,
+		Offsets:  [3]int{1, 4, 8},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to build dictionary: %w", err)
+	}
+	return dict, nil
+}
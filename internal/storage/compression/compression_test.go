@@ -0,0 +1,113 @@
+package compression
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func samplePayload(i int) []byte {
+	return []byte(fmt.Sprintf(`{"model":"gpt-4o","temperature":0.2,"messages":[{"role":"system","content":"You are a support assistant for an online store. Answer briefly and politely."},{"role":"user","content":"Where is my order #%d? It has not arrived yet."}]}`, 1000+i))
+}
+
+func TestCompressRoundTrip(t *testing.T) {
+	codec, err := NewCodec(Options{Enabled: true})
+	if err != nil {
+		t.Fatalf("NewCodec failed: %v", err)
+	}
+	defer codec.Close()
+
+	payload := bytes.Repeat(samplePayload(1), 4)
+	stored := codec.Compress("ns", payload)
+	if !IsCompressed(stored) || len(stored) >= len(payload) {
+		t.Fatalf("Expected payload to be compressed, got %d of %d bytes", len(stored), len(payload))
+	}
+	if RawSize(stored) != int64(len(payload)) {
+		t.Errorf("RawSize = %d, want %d", RawSize(stored), len(payload))
+	}
+
+	got, err := codec.Decompress(stored)
+	if err != nil {
+		t.Fatalf("Decompress failed: %v", err)
+	}
+	if !bytes.Equal(got, payload) {
+		t.Error("Round trip changed the payload")
+	}
+}
+
+func TestCompressLeavesPayloadsAlone(t *testing.T) {
+	disabled, _ := NewCodec(Options{})
+	enabled, _ := NewCodec(Options{Enabled: true, MinSize: 64})
+
+	for name, tt := range map[string]struct {
+		codec   *Codec
+		payload []byte
+	}{
+		"disabled":       {disabled, bytes.Repeat(samplePayload(1), 4)},
+		"below min size": {enabled, []byte(`{"model":"gpt-4o"}`)},
+	} {
+		stored := tt.codec.Compress("ns", tt.payload)
+		if !bytes.Equal(stored, tt.payload) {
+			t.Errorf("%s: expected payload stored as is", name)
+		}
+		got, err := tt.codec.Decompress(stored)
+		if err != nil || !bytes.Equal(got, tt.payload) {
+			t.Errorf("%s: Decompress = %q, %v", name, got, err)
+		}
+	}
+}
+
+func TestDictionary(t *testing.T) {
+	var samples [][]byte
+	for i := 0; i < 200; i++ {
+		samples = append(samples, samplePayload(i))
+	}
+	data, err := Train(FirstDictionaryID, samples)
+	if err != nil {
+		t.Fatalf("Train failed: %v", err)
+	}
+
+	codec, _ := NewCodec(Options{Enabled: true, MinSize: 1})
+	defer codec.Close()
+
+	payload := samplePayload(500)
+	plain := codec.Compress("ns", payload)
+
+	if err := codec.AddDictionary(&Dictionary{ID: FirstDictionaryID, Namespace: "ns", Data: data}); err != nil {
+		t.Fatalf("AddDictionary failed: %v", err)
+	}
+	withDict := codec.Compress("ns", payload)
+	if len(withDict) >= len(plain) {
+		t.Errorf("Expected dictionary to help: %d bytes with, %d without", len(withDict), len(plain))
+	}
+	if RawSize(withDict) != int64(len(payload)) {
+		t.Errorf("RawSize = %d, want %d", RawSize(withDict), len(payload))
+	}
+	if other := codec.Compress("other", payload); !bytes.Equal(other, plain) {
+		t.Error("Dictionary should only apply to its namespace")
+	}
+
+	for _, stored := range [][]byte{plain, withDict} {
+		got, err := codec.Decompress(stored)
+		if err != nil || !bytes.Equal(got, payload) {
+			t.Errorf("Decompress = %q, %v", got, err)
+		}
+	}
+
+	// A codec that has not loaded the dictionary cannot read the payload
+	fresh, _ := NewCodec(Options{})
+	if _, err := fresh.Decompress(withDict); err == nil {
+		t.Error("Expected error for unknown dictionary")
+	}
+}
+
+func TestTrainWithoutSamples(t *testing.T) {
+	if _, err := Train(FirstDictionaryID, nil); err != ErrNoSamples {
+		t.Errorf("Expected ErrNoSamples, got %v", err)
+	}
+
+	identical := [][]byte{samplePayload(1), samplePayload(1), samplePayload(1)}
+	if _, err := Train(FirstDictionaryID, identical); err == nil {
+		t.Error("Expected error training on identical samples")
+	}
+}
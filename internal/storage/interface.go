@@ -2,11 +2,15 @@ package storage
 
 import (
 	"context"
+	"encoding/json"
 	"time"
 
 	"github.com/georgeshao/ai-inference-dam/pkg/types"
 )
 
+// Store persists namespaces, requests and their bookkeeping. Implementations
+// keep timestamps at whole-second precision; storagetest.Run checks the
+// full contract.
 type Store interface {
 	CreateNamespace(ctx context.Context, ns *NamespaceRecord) error
 	GetNamespace(ctx context.Context, name string) (*NamespaceRecord, error)
@@ -15,13 +19,94 @@ type Store interface {
 	ListNamespaces(ctx context.Context) ([]*NamespaceRecord, error)
 	GetNamespaceStats(ctx context.Context, name string) (*types.NamespaceStats, error)
 
+	// Budget spend is tracked per period key. Spend recorded under a
+	// different period key than the one requested reads as zero.
+	GetBudgetSpend(ctx context.Context, namespace, periodKey string) (*BudgetSpend, error)
+	AddBudgetSpend(ctx context.Context, namespace, periodKey string, costUSD float64, tokens int64) error
+	SetBudgetExhausted(ctx context.Context, namespace, periodKey string, exhaustedAt *time.Time) error
+	ResetBudget(ctx context.Context, namespace string) error
+
+	// GetCachedResponse returns nil when no unexpired entry exists for key.
+	GetCachedResponse(ctx context.Context, namespace, key string) (*CacheEntry, error)
+	PutCachedResponse(ctx context.Context, entry *CacheEntry) error
+	RecordCacheLookup(ctx context.Context, namespace string, hit bool) error
+
+	// AcquireDispatchLease takes or renews the exclusive right to dispatch
+	// namespace until leaseUntil. It succeeds when no lease exists, the
+	// current lease expired before now, or owner already holds it.
+	AcquireDispatchLease(ctx context.Context, namespace, owner string, now, leaseUntil time.Time) (bool, error)
+	// ReleaseDispatchLease drops the lease if owner still holds it.
+	ReleaseDispatchLease(ctx context.Context, namespace, owner string) error
+
 	CreateRequest(ctx context.Context, req *RequestRecord) error
 	GetRequest(ctx context.Context, id string) (*RequestRecord, error)
 	ListRequests(ctx context.Context, filter RequestFilter) ([]*RequestRecord, int, error)
 	UpdateRequestStatus(ctx context.Context, id string, status types.RequestStatus, dispatchedAt time.Time) error
-	UpdateRequestResponse(ctx context.Context, id string, response map[string]interface{}) error
-	UpdateRequestError(ctx context.Context, id string, errMsg string) error
+	// UpdateRequestResponse, UpdateRequestCacheHit, UpdateRequestCoalesced
+	// and UpdateRequestError finish a request. When leaseOwner is non-empty
+	// they only apply while the request is processing under leaseOwner, and
+	// return ErrLeaseLost otherwise; an empty leaseOwner finishes the request
+	// whatever its state.
+	UpdateRequestResponse(ctx context.Context, id, leaseOwner string, response json.RawMessage, usage Usage) error
+	// UpdateRequestCacheHit completes a request with a cached response. No
+	// usage is recorded since the provider was never called.
+	UpdateRequestCacheHit(ctx context.Context, id, leaseOwner string, response json.RawMessage) error
+	// UpdateRequestCoalesced copies the outcome of primaryID onto a duplicate
+	// request: completed with response, or failed with errMsg when non-nil.
+	UpdateRequestCoalesced(ctx context.Context, id, leaseOwner, primaryID string, response json.RawMessage, errMsg *string) error
+	UpdateRequestError(ctx context.Context, id, leaseOwner string, errMsg string) error
 	GetQueuedRequests(ctx context.Context, namespace string) ([]*RequestRecord, error)
 
+	// ExportRequests returns up to limit requests across all namespaces with
+	// IDs after afterID, in ID order, for copying one store into another.
+	ExportRequests(ctx context.Context, afterID string, limit int) ([]*RequestRecord, error)
+	// ListFinishedRequests returns up to limit of the requests in namespace
+	// with status that were completed at or after since and before until,
+	// ordered by completion time and then ID. A non-empty afterID skips the
+	// requests completed at since up to and including that ID, so the last
+	// request of a page is where the next one starts.
+	ListFinishedRequests(ctx context.Context, namespace string, status types.RequestStatus, since, until time.Time, afterID string, limit int) ([]*RequestRecord, error)
+	// ImportRequest writes req exactly as given, replacing any request with
+	// the same ID, and keeps the namespace stats in step.
+	ImportRequest(ctx context.Context, req *RequestRecord) error
+	// PurgeRequests deletes up to limit of the requests in namespace with
+	// status that were completed before before, longest finished first, and
+	// keeps the namespace stats in step. It returns how many were deleted.
+	PurgeRequests(ctx context.Context, namespace string, status types.RequestStatus, before time.Time, limit int) (int, error)
+	// DeleteRequests deletes the requests with ids, skipping any that do not
+	// exist, and keeps the namespace stats in step. It returns how many were
+	// deleted.
+	DeleteRequests(ctx context.Context, ids []string) (int, error)
+
+	// ClaimQueuedRequests atomically moves up to n of the oldest queued
+	// requests in namespace to processing under leaseOwner until leaseUntil,
+	// incrementing their attempt counts. A request is returned by at most one
+	// concurrent claim.
+	ClaimQueuedRequests(ctx context.Context, namespace string, n int, leaseOwner string, leaseUntil time.Time) ([]*RequestRecord, error)
+	// ReleaseRequest returns a request processing under leaseOwner to the
+	// queue without counting the interrupted attempt. It does nothing to a
+	// request in any other state.
+	ReleaseRequest(ctx context.Context, id, leaseOwner string) error
+	// RecoverExpiredLeases returns processing requests whose lease expired
+	// before now, or is held by owner when owner is non-empty, to the queue.
+	// Requests that already used maxAttempts are marked failed instead.
+	RecoverExpiredLeases(ctx context.Context, owner string, now time.Time, maxAttempts int) (requeued, failed int, err error)
+
 	Close() error
 }
+
+// DictionaryTrainer is implemented by stores that compress payloads at rest
+// and can train a zstd dictionary on a namespace's recent payloads. New
+// payloads in the namespace are compressed with the newest dictionary;
+// payloads written with older ones stay readable.
+type DictionaryTrainer interface {
+	TrainDictionary(ctx context.Context, namespace string) (*CompressionDictionary, error)
+}
+
+// BlobCollector is implemented by stores that can offload large payloads to
+// a blob directory. Blobs of deleted requests are removed as they go;
+// CollectBlobs sweeps the directory for any left behind, such as a blob
+// written for a request that was never stored.
+type BlobCollector interface {
+	CollectBlobs(ctx context.Context) (removed int, err error)
+}
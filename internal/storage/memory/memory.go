@@ -0,0 +1,796 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/georgeshao/ai-inference-dam/internal/storage"
+	"github.com/georgeshao/ai-inference-dam/pkg/types"
+)
+
+// MemoryStore keeps everything in process memory. Records are copied on the
+// way in and out and timestamps are truncated to whole seconds like they are
+// in the persistent backends, so callers see the same values either way.
+type MemoryStore struct {
+	mu sync.RWMutex
+
+	namespaces     map[string]*storage.NamespaceRecord
+	requests       map[string]*requestEntry
+	budgets        map[string]*storage.BudgetSpend
+	cache          map[string]map[string]*storage.CacheEntry
+	cacheStats     map[string]*cacheStats
+	dispatchLeases map[string]*dispatchLease
+
+	// seq orders requests created within the same instant
+	seq uint64
+}
+
+type requestEntry struct {
+	record *storage.RequestRecord
+	seq    uint64
+}
+
+type cacheStats struct {
+	hits   int64
+	misses int64
+}
+
+type dispatchLease struct {
+	owner     string
+	expiresAt time.Time
+}
+
+func New() *MemoryStore {
+	return &MemoryStore{
+		namespaces:     make(map[string]*storage.NamespaceRecord),
+		requests:       make(map[string]*requestEntry),
+		budgets:        make(map[string]*storage.BudgetSpend),
+		cache:          make(map[string]map[string]*storage.CacheEntry),
+		cacheStats:     make(map[string]*cacheStats),
+		dispatchLeases: make(map[string]*dispatchLease),
+	}
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+func (s *MemoryStore) CreateNamespace(ctx context.Context, ns *storage.NamespaceRecord) error {
+	record := copyNamespace(ns)
+	record.CreatedAt = timestamp(ns.CreatedAt)
+	record.UpdatedAt = timestamp(ns.UpdatedAt)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.namespaces[ns.Name]; exists {
+		return fmt.Errorf("namespace already exists: %s", ns.Name)
+	}
+	s.namespaces[ns.Name] = record
+	return nil
+}
+
+func (s *MemoryStore) GetNamespace(ctx context.Context, name string) (*storage.NamespaceRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ns, ok := s.namespaces[name]
+	if !ok {
+		return nil, nil
+	}
+	return copyNamespace(ns), nil
+}
+
+func (s *MemoryStore) UpdateNamespace(ctx context.Context, name string, ns *storage.NamespaceRecord) error {
+	record := copyNamespace(ns)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.namespaces[name]
+	if !ok {
+		return nil
+	}
+	record.Name = existing.Name
+	record.CreatedAt = existing.CreatedAt
+	record.UpdatedAt = timestamp(ns.UpdatedAt)
+	s.namespaces[name] = record
+	return nil
+}
+
+func (s *MemoryStore) DeleteNamespace(ctx context.Context, name string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleted := 0
+	for id, entry := range s.requests {
+		if entry.record.Namespace == name {
+			delete(s.requests, id)
+			deleted++
+		}
+	}
+
+	delete(s.budgets, name)
+	delete(s.cache, name)
+	delete(s.cacheStats, name)
+	delete(s.dispatchLeases, name)
+	delete(s.namespaces, name)
+
+	return deleted, nil
+}
+
+func (s *MemoryStore) ListNamespaces(ctx context.Context) ([]*storage.NamespaceRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	records := make([]*storage.NamespaceRecord, 0, len(s.namespaces))
+	for _, ns := range s.namespaces {
+		records = append(records, copyNamespace(ns))
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Name < records[j].Name
+	})
+
+	return records, nil
+}
+
+func (s *MemoryStore) GetNamespaceStats(ctx context.Context, name string) (*types.NamespaceStats, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stats := &types.NamespaceStats{}
+	for _, entry := range s.requests {
+		req := entry.record
+		if req.Namespace != name {
+			continue
+		}
+
+		stats.TotalRequests++
+		switch req.Status {
+		case types.StatusQueued:
+			stats.Queued++
+		case types.StatusProcessing:
+			stats.Processing++
+		case types.StatusCompleted:
+			stats.Completed++
+		case types.StatusFailed:
+			stats.Failed++
+		}
+
+		stats.PromptTokens += req.Usage.PromptTokens
+		stats.CompletionTokens += req.Usage.CompletionTokens
+		stats.CachedTokens += req.Usage.CachedTokens
+		stats.ReasoningTokens += req.Usage.ReasoningTokens
+		stats.CostUSD += req.Usage.CostUSD
+	}
+
+	if cs, ok := s.cacheStats[name]; ok {
+		stats.CacheHits = cs.hits
+		stats.CacheMisses = cs.misses
+	}
+
+	return stats, nil
+}
+
+func (s *MemoryStore) GetBudgetSpend(ctx context.Context, namespace, periodKey string) (*storage.BudgetSpend, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	spend, ok := s.budgets[namespace]
+	if !ok || spend.PeriodKey != periodKey {
+		return &storage.BudgetSpend{PeriodKey: periodKey}, nil
+	}
+
+	result := *spend
+	result.ExhaustedAt = copyTime(spend.ExhaustedAt)
+	return &result, nil
+}
+
+func (s *MemoryStore) AddBudgetSpend(ctx context.Context, namespace, periodKey string, costUSD float64, tokens int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	spend, ok := s.budgets[namespace]
+	if !ok || spend.PeriodKey != periodKey {
+		spend = &storage.BudgetSpend{PeriodKey: periodKey}
+		s.budgets[namespace] = spend
+	}
+	spend.SpentUSD += costUSD
+	spend.SpentTokens += tokens
+	return nil
+}
+
+func (s *MemoryStore) SetBudgetExhausted(ctx context.Context, namespace, periodKey string, exhaustedAt *time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	spend, ok := s.budgets[namespace]
+	if !ok || spend.PeriodKey != periodKey {
+		spend = &storage.BudgetSpend{PeriodKey: periodKey}
+		s.budgets[namespace] = spend
+	}
+	spend.ExhaustedAt = nil
+	if exhaustedAt != nil {
+		t := timestamp(*exhaustedAt)
+		spend.ExhaustedAt = &t
+	}
+	return nil
+}
+
+func (s *MemoryStore) ResetBudget(ctx context.Context, namespace string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.budgets, namespace)
+	return nil
+}
+
+func (s *MemoryStore) GetCachedResponse(ctx context.Context, namespace, key string) (*storage.CacheEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entry, ok := s.cache[namespace][key]
+	if !ok || !entry.ExpiresAt.After(timestamp(time.Now())) {
+		return nil, nil
+	}
+
+	result := *entry
+	result.Response = bytes.Clone(entry.Response)
+	return &result, nil
+}
+
+func (s *MemoryStore) PutCachedResponse(ctx context.Context, entry *storage.CacheEntry) error {
+	stored := *entry
+	stored.Response = bytes.Clone(entry.Response)
+	stored.CreatedAt = timestamp(entry.CreatedAt)
+	stored.ExpiresAt = timestamp(entry.ExpiresAt)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, ok := s.cache[entry.Namespace]
+	if !ok {
+		entries = make(map[string]*storage.CacheEntry)
+		s.cache[entry.Namespace] = entries
+	}
+	entries[entry.Key] = &stored
+	return nil
+}
+
+func (s *MemoryStore) RecordCacheLookup(ctx context.Context, namespace string, hit bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cs, ok := s.cacheStats[namespace]
+	if !ok {
+		cs = &cacheStats{}
+		s.cacheStats[namespace] = cs
+	}
+	if hit {
+		cs.hits++
+	} else {
+		cs.misses++
+	}
+	return nil
+}
+
+func (s *MemoryStore) AcquireDispatchLease(ctx context.Context, namespace, owner string, now, leaseUntil time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if lease, ok := s.dispatchLeases[namespace]; ok && lease.owner != owner && !lease.expiresAt.Before(timestamp(now)) {
+		return false, nil
+	}
+	s.dispatchLeases[namespace] = &dispatchLease{owner: owner, expiresAt: timestamp(leaseUntil)}
+	return true, nil
+}
+
+func (s *MemoryStore) ReleaseDispatchLease(ctx context.Context, namespace, owner string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if lease, ok := s.dispatchLeases[namespace]; ok && lease.owner == owner {
+		delete(s.dispatchLeases, namespace)
+	}
+	return nil
+}
+
+func (s *MemoryStore) CreateRequest(ctx context.Context, req *storage.RequestRecord) error {
+	record := copyRequest(req)
+	record.CreatedAt = timestamp(req.CreatedAt)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.requests[req.ID]; exists {
+		return fmt.Errorf("request already exists: %s", req.ID)
+	}
+	s.seq++
+	s.requests[req.ID] = &requestEntry{record: record, seq: s.seq}
+	return nil
+}
+
+func (s *MemoryStore) GetRequest(ctx context.Context, id string) (*storage.RequestRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entry, ok := s.requests[id]
+	if !ok {
+		return nil, nil
+	}
+	return copyRequest(entry.record), nil
+}
+
+func (s *MemoryStore) ListRequests(ctx context.Context, filter storage.RequestFilter) ([]*storage.RequestRecord, int, error) {
+	limit := filter.Limit
+	if limit == 0 {
+		limit = 100 // Default limit
+	}
+
+	if filter.Namespace == nil {
+		return nil, 0, fmt.Errorf("namespace is required")
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var matched []*requestEntry
+	total := 0
+	for _, entry := range s.requests {
+		req := entry.record
+		if req.Namespace != *filter.Namespace {
+			continue
+		}
+		if filter.Status != nil && req.Status != *filter.Status {
+			continue
+		}
+		total++
+		if filter.Cursor != nil {
+			cursor := timestamp(*filter.Cursor)
+			if req.CreatedAt.After(cursor) || req.CreatedAt.Equal(cursor) && req.ID >= filter.CursorID {
+				continue
+			}
+		}
+		matched = append(matched, entry)
+	}
+
+	// Newest first, then by ID like the other backends
+	sort.Slice(matched, func(i, j int) bool {
+		a, b := matched[i].record, matched[j].record
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+		return a.ID > b.ID
+	})
+	if len(matched) > limit {
+		matched = matched[:limit]
+	}
+
+	return copyEntries(matched), total, nil
+}
+
+func (s *MemoryStore) UpdateRequestStatus(ctx context.Context, id string, status types.RequestStatus, dispatchedAt time.Time) error {
+	return s.update(id, func(req *storage.RequestRecord) {
+		t := timestamp(dispatchedAt)
+		req.Status = status
+		req.DispatchedAt = &t
+	})
+}
+
+func (s *MemoryStore) UpdateRequestResponse(ctx context.Context, id, leaseOwner string, response json.RawMessage, usage storage.Usage) error {
+	responseCopy := bytes.Clone(response)
+	return s.finish(id, leaseOwner, func(req *storage.RequestRecord) {
+		now := timestamp(time.Now())
+		req.Status = types.StatusCompleted
+		req.ResponsePayload = responseCopy
+		req.CompletedAt = &now
+		req.Usage = usage
+		clearLease(req)
+	})
+}
+
+func (s *MemoryStore) UpdateRequestCacheHit(ctx context.Context, id, leaseOwner string, response json.RawMessage) error {
+	responseCopy := bytes.Clone(response)
+	return s.finish(id, leaseOwner, func(req *storage.RequestRecord) {
+		now := timestamp(time.Now())
+		req.Status = types.StatusCompleted
+		req.ResponsePayload = responseCopy
+		req.CompletedAt = &now
+		req.CacheHit = true
+		clearLease(req)
+	})
+}
+
+func (s *MemoryStore) UpdateRequestCoalesced(ctx context.Context, id, leaseOwner, primaryID string, response json.RawMessage, errMsg *string) error {
+	var responseCopy json.RawMessage
+	if errMsg == nil {
+		responseCopy = bytes.Clone(response)
+	}
+
+	return s.finish(id, leaseOwner, func(req *storage.RequestRecord) {
+		now := timestamp(time.Now())
+		req.Status = types.StatusCompleted
+		if errMsg != nil {
+			req.Status = types.StatusFailed
+		}
+		req.ResponsePayload = responseCopy
+		req.Error = copyString(errMsg)
+		req.CompletedAt = &now
+		req.CoalescedWith = &primaryID
+		clearLease(req)
+	})
+}
+
+func (s *MemoryStore) UpdateRequestError(ctx context.Context, id, leaseOwner string, errMsg string) error {
+	return s.finish(id, leaseOwner, func(req *storage.RequestRecord) {
+		now := timestamp(time.Now())
+		req.Status = types.StatusFailed
+		req.Error = &errMsg
+		req.CompletedAt = &now
+		clearLease(req)
+	})
+}
+
+func (s *MemoryStore) GetQueuedRequests(ctx context.Context, namespace string) ([]*storage.RequestRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return copyEntries(s.queued(namespace)), nil
+}
+
+func (s *MemoryStore) ExportRequests(ctx context.Context, afterID string, limit int) ([]*storage.RequestRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var entries []*requestEntry
+	for id, entry := range s.requests {
+		if id > afterID {
+			entries = append(entries, entry)
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].record.ID < entries[j].record.ID
+	})
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+
+	return copyEntries(entries), nil
+}
+
+func (s *MemoryStore) ListFinishedRequests(ctx context.Context, namespace string, status types.RequestStatus, since, until time.Time, afterID string, limit int) ([]*storage.RequestRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	since, until = timestamp(since), timestamp(until)
+	var entries []*requestEntry
+	for _, entry := range s.requests {
+		req := entry.record
+		if req.Namespace != namespace || req.Status != status || req.CompletedAt == nil {
+			continue
+		}
+		completed := *req.CompletedAt
+		if completed.Before(since) || !completed.Before(until) || (completed.Equal(since) && req.ID <= afterID) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i].record, entries[j].record
+		if !a.CompletedAt.Equal(*b.CompletedAt) {
+			return a.CompletedAt.Before(*b.CompletedAt)
+		}
+		return a.ID < b.ID
+	})
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+
+	return copyEntries(entries), nil
+}
+
+func (s *MemoryStore) ImportRequest(ctx context.Context, req *storage.RequestRecord) error {
+	record := copyRequest(req)
+	record.CreatedAt = timestamp(req.CreatedAt)
+	for _, t := range []*time.Time{record.DispatchedAt, record.CompletedAt, record.LeaseExpiresAt} {
+		if t != nil {
+			*t = timestamp(*t)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry, ok := s.requests[req.ID]; ok {
+		entry.record = record
+		return nil
+	}
+	s.seq++
+	s.requests[req.ID] = &requestEntry{record: record, seq: s.seq}
+	return nil
+}
+
+func (s *MemoryStore) PurgeRequests(ctx context.Context, namespace string, status types.RequestStatus, before time.Time, limit int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	before = timestamp(before)
+	var entries []*requestEntry
+	for _, entry := range s.requests {
+		req := entry.record
+		if req.Namespace == namespace && req.Status == status && req.CompletedAt != nil && req.CompletedAt.Before(before) {
+			entries = append(entries, entry)
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].record.CompletedAt.Before(*entries[j].record.CompletedAt)
+	})
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+
+	for _, entry := range entries {
+		delete(s.requests, entry.record.ID)
+	}
+	return len(entries), nil
+}
+
+func (s *MemoryStore) DeleteRequests(ctx context.Context, ids []string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleted := 0
+	for _, id := range ids {
+		if _, ok := s.requests[id]; ok {
+			delete(s.requests, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (s *MemoryStore) ClaimQueuedRequests(ctx context.Context, namespace string, n int, leaseOwner string, leaseUntil time.Time) ([]*storage.RequestRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := s.queued(namespace)
+	if len(entries) > n {
+		entries = entries[:n]
+	}
+
+	now := timestamp(time.Now())
+	leaseUntil = timestamp(leaseUntil)
+	for _, entry := range entries {
+		req := entry.record
+		req.Status = types.StatusProcessing
+		req.DispatchedAt = &now
+		req.LeaseOwner = &leaseOwner
+		req.LeaseExpiresAt = &leaseUntil
+		req.Attempts++
+	}
+
+	return copyEntries(entries), nil
+}
+
+func (s *MemoryStore) ReleaseRequest(ctx context.Context, id, leaseOwner string) error {
+	return s.update(id, func(req *storage.RequestRecord) {
+		if req.Status != types.StatusProcessing || !leaseHeld(req, leaseOwner) {
+			return
+		}
+		req.Status = types.StatusQueued
+		req.DispatchedAt = nil
+		clearLease(req)
+		if req.Attempts > 0 {
+			req.Attempts--
+		}
+	})
+}
+
+func (s *MemoryStore) RecoverExpiredLeases(ctx context.Context, owner string, now time.Time, maxAttempts int) (int, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now = timestamp(now)
+	requeued, failed := 0, 0
+	for _, entry := range s.requests {
+		req := entry.record
+		if req.Status != types.StatusProcessing {
+			continue
+		}
+
+		expired := req.LeaseExpiresAt == nil || req.LeaseExpiresAt.Before(now)
+		owned := owner != "" && req.LeaseOwner != nil && *req.LeaseOwner == owner
+		if !expired && !owned {
+			continue
+		}
+
+		clearLease(req)
+		if req.Attempts >= maxAttempts {
+			errMsg := storage.MaxAttemptsError
+			completedAt := now
+			req.Status = types.StatusFailed
+			req.Error = &errMsg
+			req.CompletedAt = &completedAt
+			failed++
+		} else {
+			req.Status = types.StatusQueued
+			req.DispatchedAt = nil
+			requeued++
+		}
+	}
+
+	return requeued, failed, nil
+}
+
+// update applies fn to the stored request under the write lock. Missing
+// requests are ignored, matching the UPDATE ... WHERE id = ? backends.
+func (s *MemoryStore) update(id string, fn func(req *storage.RequestRecord)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry, ok := s.requests[id]; ok {
+		fn(entry.record)
+	}
+	return nil
+}
+
+// finish applies fn to request id when leaseOwner may finish it, and
+// returns ErrLeaseLost otherwise.
+func (s *MemoryStore) finish(id, leaseOwner string, fn func(req *storage.RequestRecord)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.requests[id]
+	if !ok || !leaseHeld(entry.record, leaseOwner) {
+		if leaseOwner != "" {
+			return storage.ErrLeaseLost
+		}
+		return nil
+	}
+	fn(entry.record)
+	return nil
+}
+
+// leaseHeld reports whether a write on behalf of leaseOwner may change req:
+// always for an empty leaseOwner, and otherwise only while req is
+// processing under leaseOwner.
+func leaseHeld(req *storage.RequestRecord, leaseOwner string) bool {
+	if leaseOwner == "" {
+		return true
+	}
+	return req.Status == types.StatusProcessing && req.LeaseOwner != nil && *req.LeaseOwner == leaseOwner
+}
+
+// queued returns the queued requests in namespace, oldest first. The caller
+// must hold mu.
+func (s *MemoryStore) queued(namespace string) []*requestEntry {
+	var entries []*requestEntry
+	for _, entry := range s.requests {
+		if entry.record.Namespace == namespace && entry.record.Status == types.StatusQueued {
+			entries = append(entries, entry)
+		}
+	}
+	sortEntries(entries)
+	return entries
+}
+
+// sortEntries orders entries oldest first, breaking ties by creation order.
+func sortEntries(entries []*requestEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if !a.record.CreatedAt.Equal(b.record.CreatedAt) {
+			return a.record.CreatedAt.Before(b.record.CreatedAt)
+		}
+		return a.seq < b.seq
+	})
+}
+
+// timestamp truncates t to the whole-second precision of the SQL backends.
+func timestamp(t time.Time) time.Time {
+	return t.Truncate(time.Second)
+}
+
+func copyEntries(entries []*requestEntry) []*storage.RequestRecord {
+	records := make([]*storage.RequestRecord, len(entries))
+	for i, entry := range entries {
+		records[i] = copyRequest(entry.record)
+	}
+	return records
+}
+
+func clearLease(req *storage.RequestRecord) {
+	req.LeaseOwner = nil
+	req.LeaseExpiresAt = nil
+}
+
+func copyNamespace(ns *storage.NamespaceRecord) *storage.NamespaceRecord {
+	record := *ns
+	record.ProviderEndpoint = copyString(ns.ProviderEndpoint)
+	record.ProviderAPIKey = copyString(ns.ProviderAPIKey)
+	record.ProviderModel = copyString(ns.ProviderModel)
+	record.URLTemplate = copyString(ns.URLTemplate)
+	record.ProviderHeaders = copyStringMap(ns.ProviderHeaders)
+	record.QueryParams = copyStringMap(ns.QueryParams)
+
+	if ns.ProviderAWS != nil {
+		aws := *ns.ProviderAWS
+		record.ProviderAWS = &aws
+	}
+
+	if ns.Budget != nil {
+		budget := *ns.Budget
+		if ns.Budget.LimitUSD != nil {
+			limit := *ns.Budget.LimitUSD
+			budget.LimitUSD = &limit
+		}
+		if ns.Budget.LimitTokens != nil {
+			limit := *ns.Budget.LimitTokens
+			budget.LimitTokens = &limit
+		}
+		record.Budget = &budget
+	}
+
+	if ns.Cache != nil {
+		cache := *ns.Cache
+		record.Cache = &cache
+	}
+
+	if ns.Retention != nil {
+		retention := *ns.Retention
+		record.Retention = &retention
+	}
+
+	return &record
+}
+
+func copyRequest(req *storage.RequestRecord) *storage.RequestRecord {
+	record := *req
+	record.HeaderEndpoint = copyString(req.HeaderEndpoint)
+	record.HeaderAPIKey = copyString(req.HeaderAPIKey)
+	record.CoalescedWith = copyString(req.CoalescedWith)
+	record.Error = copyString(req.Error)
+	record.LeaseOwner = copyString(req.LeaseOwner)
+	record.DispatchedAt = copyTime(req.DispatchedAt)
+	record.CompletedAt = copyTime(req.CompletedAt)
+	record.LeaseExpiresAt = copyTime(req.LeaseExpiresAt)
+	record.PassthroughHeaders = copyStringMap(req.PassthroughHeaders)
+	record.RequestPayload = bytes.Clone(req.RequestPayload)
+	record.ResponsePayload = bytes.Clone(req.ResponsePayload)
+	return &record
+}
+
+func copyStringMap(m map[string]string) map[string]string {
+	if len(m) == 0 {
+		return nil
+	}
+	clone := make(map[string]string, len(m))
+	for k, v := range m {
+		clone[k] = v
+	}
+	return clone
+}
+
+func copyString(s *string) *string {
+	if s == nil {
+		return nil
+	}
+	v := *s
+	return &v
+}
+
+func copyTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	v := *t
+	return &v
+}
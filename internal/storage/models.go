@@ -1,6 +1,8 @@
 package storage
 
 import (
+	"encoding/json"
+	"errors"
 	"time"
 
 	"github.com/georgeshao/ai-inference-dam/pkg/types"
@@ -13,28 +15,125 @@ type NamespaceRecord struct {
 	ProviderAPIKey   *string
 	ProviderModel    *string
 	ProviderHeaders  map[string]string
+	ProviderType     types.ProviderType
+	ProviderAWS      *AWSCredentials
+	URLTemplate      *string
+	QueryParams      map[string]string
+	Budget           *Budget
+	Cache            *CacheConfig
+	Retention        *RetentionPolicy
 	CreatedAt        time.Time
 	UpdatedAt        time.Time
 }
 
+type AWSCredentials struct {
+	Region          string `json:"region"`
+	AccessKeyID     string `json:"access_key_id"`
+	SecretAccessKey string `json:"secret_access_key"`
+	SessionToken    string `json:"session_token,omitempty"`
+}
+
+type Budget struct {
+	LimitUSD    *float64           `json:"limit_usd,omitempty"`
+	LimitTokens *int64             `json:"limit_tokens,omitempty"`
+	Period      types.BudgetPeriod `json:"period,omitempty"`
+}
+
+// BudgetSpend is the spend recorded against a namespace budget in one
+// period. PeriodKey identifies the period, e.g. "2024-06-01" or "2024-06".
+type BudgetSpend struct {
+	PeriodKey   string
+	SpentUSD    float64
+	SpentTokens int64
+	ExhaustedAt *time.Time
+}
+
+type CacheConfig struct {
+	TTLSeconds int64 `json:"ttl_seconds"`
+}
+
+// RetentionPolicy is how many days completed and failed requests are kept.
+// Zero keeps them forever.
+type RetentionPolicy struct {
+	CompletedDays int `json:"completed_days,omitempty"`
+	FailedDays    int `json:"failed_days,omitempty"`
+}
+
+// CacheEntry is a provider response stored under a normalized payload hash.
+type CacheEntry struct {
+	Namespace string
+	Key       string
+	Response  json.RawMessage
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// RequestRecord is a queued chat completion. RequestPayload holds the body
+// exactly as the client sent it and ResponsePayload the normalized provider
+// response; stores keep both byte-for-byte.
 type RequestRecord struct {
 	ID                 string
 	Namespace          string
 	Status             types.RequestStatus
-	RequestPayload     map[string]interface{}
+	RequestPayload     json.RawMessage
 	PassthroughHeaders map[string]string
 	HeaderEndpoint     *string
 	HeaderAPIKey       *string
-	ResponsePayload    map[string]interface{}
+	ResponsePayload    json.RawMessage
+	Usage              Usage
+	CacheHit           bool
+	CoalescedWith      *string
 	Error              *string
 	CreatedAt          time.Time
 	DispatchedAt       *time.Time
 	CompletedAt        *time.Time
+	// LeaseOwner and LeaseExpiresAt are set while a dispatcher instance is
+	// processing the request. Attempts counts how many times it was leased.
+	LeaseOwner     *string
+	LeaseExpiresAt *time.Time
+	Attempts       int
 }
 
+// MaxAttemptsError is recorded on requests failed by RecoverExpiredLeases.
+const MaxAttemptsError = "Request lease expired after maximum attempts"
+
+// ErrLeaseLost is returned by a write on behalf of a lease owner when the
+// request is no longer processing under that owner, because its lease was
+// recovered and it was requeued, claimed again or failed. The request is
+// left as it is.
+var ErrLeaseLost = errors.New("request is no longer leased by this owner")
+
+// Usage is the token usage and priced cost of a completed request.
+type Usage struct {
+	PromptTokens     int64
+	CompletionTokens int64
+	CachedTokens     int64
+	ReasoningTokens  int64
+	CostUSD          float64
+}
+
+// RequestFilter selects requests to list, newest first. Requests created in
+// the same second are ordered by ID, highest first.
 type RequestFilter struct {
 	Namespace *string
 	Status    *types.RequestStatus
 	Limit     int
 	Cursor    *time.Time // created_at cursor for pagination (get items before this time)
+	// CursorID is the ID of the last request of the previous page. With it,
+	// requests created in the cursor's second that sort after it are listed
+	// too; without it they are skipped.
+	CursorID string
+}
+
+// CompressionDictionary describes a dictionary trained by TrainDictionary.
+type CompressionDictionary struct {
+	ID        uint32
+	Namespace string
+	Size      int // bytes
+	Samples   int // payloads trained on
+	CreatedAt time.Time
 }
+
+// DictionarySampleLimit is how many of a namespace's newest requests
+// TrainDictionary samples.
+const DictionarySampleLimit = 500
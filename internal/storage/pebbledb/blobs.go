@@ -0,0 +1,165 @@
+package pebbledb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/cockroachdb/pebble"
+
+	"github.com/georgeshao/ai-inference-dam/internal/storage/blob"
+)
+
+// An offloaded payload's field holds its blob reference, and a blob: key
+// per referencing request records that the blob is in use. Keys start with
+// the hash so that checking a blob is a single prefix scan.
+
+func blobKey(hash, ns, id string) []byte {
+	return []byte(fmt.Sprintf("%s%s:%s:%s", prefixBlob, hash, nsKeyPart(ns), id))
+}
+
+func blobHashPrefix(hash string) []byte {
+	return []byte(prefixBlob + hash + ":")
+}
+
+// storePayload returns the value to store for a payload of namespace: a
+// blob reference when it is over the threshold, and the compressed payload
+// otherwise.
+func (s *PebbleStore) storePayload(namespace string, raw []byte) ([]byte, error) {
+	if raw == nil || s.blobs == nil || !s.blobs.Offload(raw) {
+		return s.codec.Compress(namespace, raw), nil
+	}
+
+	ref, err := s.blobs.Put(raw)
+	if err != nil {
+		return nil, err
+	}
+	return ref.Encode(), nil
+}
+
+// loadPayload returns the payload for a stored value.
+func (s *PebbleStore) loadPayload(value []byte) ([]byte, error) {
+	if ref, ok := blob.ParseRef(value); ok {
+		if s.blobs == nil {
+			return nil, blob.ErrNoStore
+		}
+		return s.blobs.Get(ref)
+	}
+	return s.codec.Decompress(value)
+}
+
+// blobKeys returns the blob: keys of the payloads of data, keyed by the
+// blob hash. data may be nil.
+func blobKeys(data *requestData) map[string][]byte {
+	keys := make(map[string][]byte)
+	if data == nil {
+		return keys
+	}
+	for _, value := range [][]byte{data.RequestPayload, data.ResponsePayload} {
+		if ref, ok := blob.ParseRef(value); ok {
+			keys[string(blobKey(ref.Hash, data.Namespace, data.ID))] = []byte(ref.Hash)
+		}
+	}
+	return keys
+}
+
+// setBlobKeys moves the blob: keys of a request stored as old, or not
+// stored when nil, to those of data, or deletes them when data is nil. It
+// returns the hashes of blobs that lost a reference, to collect once the
+// batch is committed.
+func setBlobKeys(batch *pebble.Batch, old, data *requestData) []string {
+	before, after := blobKeys(old), blobKeys(data)
+
+	var released []string
+	for key, hash := range before {
+		if _, ok := after[key]; !ok {
+			batch.Delete([]byte(key), nil)
+			released = append(released, string(hash))
+		}
+	}
+	for key := range after {
+		if _, ok := before[key]; !ok {
+			batch.Set([]byte(key), nil, nil)
+		}
+	}
+	return released
+}
+
+// deleteNamespaceBlobKeys deletes the blob: keys of every request in
+// namespace and returns the hashes they referenced.
+func (s *PebbleStore) deleteNamespaceBlobKeys(batch *pebble.Batch, namespace string) ([]string, error) {
+	prefix := []byte(prefixBlob)
+	iter, err := s.db.NewIter(&pebble.IterOptions{
+		LowerBound: prefix,
+		UpperBound: upperBound(prefix),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create iterator: %w", err)
+	}
+	defer iter.Close()
+
+	// blob:{hash}:{ns}:{id}, where the hash has a fixed length and IDs
+	// contain no colons
+	part := nsKeyPart(namespace)
+	var hashes []string
+	for iter.First(); iter.Valid(); iter.Next() {
+		key := iter.Key()[len(prefix):]
+		hash, rest, ok := bytes.Cut(key, []byte(":"))
+		if !ok {
+			continue
+		}
+		i := bytes.LastIndexByte(rest, ':')
+		if i < 0 || string(rest[:i]) != part {
+			continue
+		}
+		batch.Delete(iter.Key(), nil)
+		hashes = append(hashes, string(hash))
+	}
+	if err := iter.Error(); err != nil {
+		return nil, fmt.Errorf("failed to iterate blob references: %w", err)
+	}
+	return hashes, nil
+}
+
+// collectBlobs removes the blobs among hashes that no request references.
+func (s *PebbleStore) collectBlobs(hashes []string) (int, error) {
+	if s.blobs == nil || len(hashes) == 0 {
+		return 0, nil
+	}
+
+	return s.blobs.Collect(hashes, func(hash string) (bool, error) {
+		prefix := blobHashPrefix(hash)
+		iter, err := s.db.NewIter(&pebble.IterOptions{
+			LowerBound: prefix,
+			UpperBound: upperBound(prefix),
+		})
+		if err != nil {
+			return false, fmt.Errorf("failed to create iterator: %w", err)
+		}
+		defer iter.Close()
+		return iter.First(), iter.Error()
+	})
+}
+
+// releaseBlobs removes the blobs among hashes that a committed write stopped
+// referencing. The write has already succeeded, so a blob that fails to be
+// removed is only logged and left for CollectBlobs.
+func (s *PebbleStore) releaseBlobs(hashes []string) {
+	if _, err := s.collectBlobs(hashes); err != nil {
+		log.Printf("Failed to remove released blobs: %v", err)
+	}
+}
+
+// CollectBlobs removes every blob no request references.
+func (s *PebbleStore) CollectBlobs(ctx context.Context) (int, error) {
+	if s.blobs == nil {
+		return 0, nil
+	}
+
+	hashes, err := s.blobs.Hashes()
+	if err != nil {
+		return 0, err
+	}
+	return s.collectBlobs(hashes)
+}
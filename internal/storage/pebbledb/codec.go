@@ -0,0 +1,264 @@
+package pebbledb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Binary request layout, after the encodingBinary tag. Fields are written in
+// this fixed order; adding a field means adding a new encoding tag.
+//
+//	id, namespace, status            string
+//	request_payload                  bytes (raw JSON)
+//	passthrough_headers              string map
+//	header_endpoint, header_api_key  optional string
+//	response_payload                 bytes (raw JSON)
+//	prompt, completion, cached,
+//	reasoning tokens                 varint
+//	cost_usd                         float64
+//	cache_hit                        bool
+//	coalesced_with, error            optional string
+//	created_at                       varint
+//	dispatched_at, completed_at      optional varint
+//	lease_owner                      optional string
+//	lease_expires_at                 optional varint
+//	attempts                         varint
+//
+// Strings and bytes are uvarint length-prefixed, maps are a uvarint count
+// followed by key/value strings, and optional values are a presence byte
+// followed by the value.
+
+func encodeRequest(data *requestData) []byte {
+	e := &encoder{buf: make([]byte, 0, 64+len(data.RequestPayload)+len(data.ResponsePayload))}
+	e.buf = append(e.buf, encodingBinary)
+
+	e.string(data.ID)
+	e.string(data.Namespace)
+	e.string(data.Status)
+	e.bytes(data.RequestPayload)
+	e.stringMap(data.PassthroughHeaders)
+	e.optString(data.HeaderEndpoint)
+	e.optString(data.HeaderAPIKey)
+	e.bytes(data.ResponsePayload)
+	e.varint(data.PromptTokens)
+	e.varint(data.CompletionTokens)
+	e.varint(data.CachedTokens)
+	e.varint(data.ReasoningTokens)
+	e.float64(data.CostUSD)
+	e.bool(data.CacheHit)
+	e.optString(data.CoalescedWith)
+	e.optString(data.Error)
+	e.varint(data.CreatedAt)
+	e.optVarint(data.DispatchedAt)
+	e.optVarint(data.CompletedAt)
+	e.optString(data.LeaseOwner)
+	e.optVarint(data.LeaseExpiresAt)
+	e.varint(int64(data.Attempts))
+
+	return e.buf
+}
+
+// decodeRequest reads a request in any encoding this build has written.
+func decodeRequest(value []byte, data *requestData) error {
+	if len(value) == 0 {
+		return errors.New("empty record")
+	}
+	if value[0] != encodingBinary {
+		return decodeRecord(value, data)
+	}
+
+	d := &decoder{buf: value[1:]}
+	data.ID = d.string()
+	data.Namespace = d.string()
+	data.Status = d.string()
+	data.RequestPayload = d.bytes()
+	data.PassthroughHeaders = d.stringMap()
+	data.HeaderEndpoint = d.optString()
+	data.HeaderAPIKey = d.optString()
+	data.ResponsePayload = d.bytes()
+	data.PromptTokens = d.varint()
+	data.CompletionTokens = d.varint()
+	data.CachedTokens = d.varint()
+	data.ReasoningTokens = d.varint()
+	data.CostUSD = d.float64()
+	data.CacheHit = d.bool()
+	data.CoalescedWith = d.optString()
+	data.Error = d.optString()
+	data.CreatedAt = d.varint()
+	data.DispatchedAt = d.optVarint()
+	data.CompletedAt = d.optVarint()
+	data.LeaseOwner = d.optString()
+	data.LeaseExpiresAt = d.optVarint()
+	data.Attempts = int(d.varint())
+
+	if d.err == nil && len(d.buf) != 0 {
+		d.err = fmt.Errorf("%d trailing bytes", len(d.buf))
+	}
+	return d.err
+}
+
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) uvarint(v uint64) {
+	e.buf = binary.AppendUvarint(e.buf, v)
+}
+
+func (e *encoder) varint(v int64) {
+	e.buf = binary.AppendVarint(e.buf, v)
+}
+
+func (e *encoder) bytes(b []byte) {
+	e.uvarint(uint64(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+func (e *encoder) string(s string) {
+	e.uvarint(uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *encoder) bool(b bool) {
+	if b {
+		e.buf = append(e.buf, 1)
+	} else {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+func (e *encoder) float64(f float64) {
+	e.buf = binary.LittleEndian.AppendUint64(e.buf, math.Float64bits(f))
+}
+
+func (e *encoder) optString(s *string) {
+	e.bool(s != nil)
+	if s != nil {
+		e.string(*s)
+	}
+}
+
+func (e *encoder) optVarint(v *int64) {
+	e.bool(v != nil)
+	if v != nil {
+		e.varint(*v)
+	}
+}
+
+func (e *encoder) stringMap(m map[string]string) {
+	e.uvarint(uint64(len(m)))
+	for k, v := range m {
+		e.string(k)
+		e.string(v)
+	}
+}
+
+// decoder reads the fields written by encoder. The first error is kept and
+// every later read returns a zero value, so callers check err once at the end.
+type decoder struct {
+	buf []byte
+	err error
+}
+
+var errTruncated = errors.New("truncated record")
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.err = errTruncated
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.buf)
+	if n <= 0 {
+		d.err = errTruncated
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *decoder) next(n uint64) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if uint64(len(d.buf)) < n {
+		d.err = errTruncated
+		return nil
+	}
+	b := d.buf[:n:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+// bytes copies the value out, since Pebble reuses the buffers it returns.
+func (d *decoder) bytes() []byte {
+	b := d.next(d.uvarint())
+	if len(b) == 0 {
+		return nil
+	}
+	return append([]byte(nil), b...)
+}
+
+func (d *decoder) string() string {
+	return string(d.next(d.uvarint()))
+}
+
+func (d *decoder) bool() bool {
+	b := d.next(1)
+	return len(b) == 1 && b[0] != 0
+}
+
+func (d *decoder) float64() float64 {
+	b := d.next(8)
+	if len(b) != 8 {
+		return 0
+	}
+	return math.Float64frombits(binary.LittleEndian.Uint64(b))
+}
+
+func (d *decoder) optString() *string {
+	if !d.bool() {
+		return nil
+	}
+	s := d.string()
+	return &s
+}
+
+func (d *decoder) optVarint() *int64 {
+	if !d.bool() {
+		return nil
+	}
+	v := d.varint()
+	return &v
+}
+
+func (d *decoder) stringMap() map[string]string {
+	n := d.uvarint()
+	if n == 0 || d.err != nil {
+		return nil
+	}
+	// Each entry takes at least two bytes, which bounds a corrupt count
+	if n > uint64(len(d.buf))/2 {
+		d.err = errTruncated
+		return nil
+	}
+	m := make(map[string]string, n)
+	for i := uint64(0); i < n; i++ {
+		k := d.string()
+		m[k] = d.string()
+	}
+	return m
+}
@@ -0,0 +1,176 @@
+package pebbledb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/georgeshao/ai-inference-dam/internal/storage"
+	"github.com/georgeshao/ai-inference-dam/pkg/types"
+)
+
+func sampleRequestData() *requestData {
+	endpoint := "https://api.example.com"
+	owner := "instance-1"
+	errMsg := "upstream failed"
+	dispatched := time.Now().Truncate(time.Second).UnixNano()
+	lease := dispatched + int64(time.Minute)
+
+	return &requestData{
+		ID:                 "req_123",
+		Namespace:          "test-ns",
+		Status:             string(types.StatusProcessing),
+		RequestPayload:     json.RawMessage(`{"model":"gpt-4","messages":[{"role":"user","content":"Hello"}]}`),
+		PassthroughHeaders: map[string]string{"X-Trace": "abc", "X-Team": "ml"},
+		HeaderEndpoint:     &endpoint,
+		ResponsePayload:    json.RawMessage(`{"id":"resp_1"}`),
+		PromptTokens:       120,
+		CompletionTokens:   48,
+		CachedTokens:       -1,
+		CostUSD:            0.0042,
+		CacheHit:           true,
+		Error:              &errMsg,
+		CreatedAt:          dispatched - int64(time.Hour),
+		DispatchedAt:       &dispatched,
+		LeaseOwner:         &owner,
+		LeaseExpiresAt:     &lease,
+		Attempts:           3,
+	}
+}
+
+func TestRequestCodecRoundTrip(t *testing.T) {
+	for name, want := range map[string]*requestData{
+		"full":  sampleRequestData(),
+		"empty": {ID: "req_empty", Namespace: "ns", Status: string(types.StatusQueued)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var got requestData
+			if err := decodeRequest(encodeRequest(want), &got); err != nil {
+				t.Fatalf("decodeRequest failed: %v", err)
+			}
+			if !reflect.DeepEqual(&got, want) {
+				t.Errorf("Round trip mismatch:\ngot  %+v\nwant %+v", got, *want)
+			}
+		})
+	}
+}
+
+func TestDecodeRequestJSON(t *testing.T) {
+	want := sampleRequestData()
+	value, err := encodeRecord(want)
+	if err != nil {
+		t.Fatalf("encodeRecord failed: %v", err)
+	}
+
+	var got requestData
+	if err := decodeRequest(value, &got); err != nil {
+		t.Fatalf("decodeRequest failed: %v", err)
+	}
+	if got.ID != want.ID || got.Attempts != want.Attempts || string(got.RequestPayload) != string(want.RequestPayload) {
+		t.Errorf("JSON value decoded incorrectly: %+v", got)
+	}
+}
+
+func TestDecodeRequestTruncated(t *testing.T) {
+	value := encodeRequest(sampleRequestData())
+	for _, n := range []int{1, 5, len(value) / 2, len(value) - 1} {
+		var data requestData
+		if err := decodeRequest(value[:n], &data); err == nil {
+			t.Errorf("Expected error decoding %d of %d bytes", n, len(value))
+		}
+	}
+}
+
+// legacyRequestData is requestData as it was kept before the binary
+// encoding, with payloads decoded into maps on every read and write.
+type legacyRequestData struct {
+	requestData
+	RequestPayload  map[string]interface{} `json:"request_payload"`
+	ResponsePayload map[string]interface{} `json:"response_payload,omitempty"`
+}
+
+func BenchmarkRequestEncoding(b *testing.B) {
+	data := sampleRequestData()
+	var legacy legacyRequestData
+	legacy.requestData = *data
+	json.Unmarshal(data.RequestPayload, &legacy.RequestPayload)
+	json.Unmarshal(data.ResponsePayload, &legacy.ResponsePayload)
+
+	b.Run("json", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			value, _ := json.Marshal(&legacy)
+			var out legacyRequestData
+			if err := json.Unmarshal(value, &out); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("binary", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			value := encodeRequest(data)
+			var out requestData
+			if err := decodeRequest(value, &out); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func newBenchStore(b *testing.B) *PebbleStore {
+	b.Helper()
+	store, err := New(filepath.Join(b.TempDir(), "db"), false)
+	if err != nil {
+		b.Fatalf("Failed to create store: %v", err)
+	}
+	b.Cleanup(func() { store.Close() })
+	return store
+}
+
+func benchRequest(id string) *storage.RequestRecord {
+	return &storage.RequestRecord{
+		ID:             id,
+		Namespace:      "bench",
+		Status:         types.StatusQueued,
+		RequestPayload: json.RawMessage(`{"model":"gpt-4","messages":[{"role":"system","content":"You are a helpful assistant."},{"role":"user","content":"Summarize the following document in three sentences."}],"temperature":0.7}`),
+		CreatedAt:      time.Now(),
+	}
+}
+
+func BenchmarkCreateRequest(b *testing.B) {
+	store := newBenchStore(b)
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := store.CreateRequest(ctx, benchRequest(fmt.Sprintf("req_%09d", i))); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGetQueuedRequests(b *testing.B) {
+	store := newBenchStore(b)
+	ctx := context.Background()
+	for i := 0; i < 1000; i++ {
+		if err := store.CreateRequest(ctx, benchRequest(fmt.Sprintf("req_%09d", i))); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		records, err := store.GetQueuedRequests(ctx, "bench")
+		if err != nil || len(records) != 1000 {
+			b.Fatalf("GetQueuedRequests returned %d records: %v", len(records), err)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package pebbledb
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+
+	"github.com/georgeshao/ai-inference-dam/internal/storage"
+	"github.com/georgeshao/ai-inference-dam/internal/storage/compression"
+)
+
+type dictionaryData struct {
+	Namespace  string `json:"namespace"`
+	Dictionary []byte `json:"dictionary"`
+	CreatedAt  int64  `json:"created_at"` // Unix nano
+}
+
+// dictKey zero-pads the ID so that dictionaries sort by ID.
+func dictKey(id uint32) []byte {
+	return []byte(fmt.Sprintf("%s%010d", prefixDict, id))
+}
+
+// forEachDictionary calls fn with every stored dictionary, in ID order.
+func (s *PebbleStore) forEachDictionary(fn func(key []byte, id uint32, data *dictionaryData) error) error {
+	prefix := []byte(prefixDict)
+	iter, err := s.db.NewIter(&pebble.IterOptions{
+		LowerBound: prefix,
+		UpperBound: upperBound(prefix),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create iterator: %w", err)
+	}
+	defer iter.Close()
+
+	for iter.First(); iter.Valid(); iter.Next() {
+		id, err := strconv.ParseUint(string(iter.Key()[len(prefix):]), 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid dictionary key %s: %w", iter.Key(), err)
+		}
+		var data dictionaryData
+		if err := decodeRecord(iter.Value(), &data); err != nil {
+			return fmt.Errorf("failed to unmarshal dictionary %d: %w", id, err)
+		}
+		if err := fn(iter.Key(), uint32(id), &data); err != nil {
+			return err
+		}
+	}
+	return iter.Error()
+}
+
+func (s *PebbleStore) loadDictionaries() error {
+	return s.forEachDictionary(func(_ []byte, id uint32, data *dictionaryData) error {
+		return s.codec.AddDictionary(&compression.Dictionary{
+			ID:        id,
+			Namespace: data.Namespace,
+			Data:      data.Dictionary,
+			CreatedAt: time.Unix(0, data.CreatedAt),
+		})
+	})
+}
+
+func (s *PebbleStore) deleteDictionaries(batch *pebble.Batch, namespace string) error {
+	return s.forEachDictionary(func(key []byte, _ uint32, data *dictionaryData) error {
+		if data.Namespace == namespace {
+			batch.Delete(key, nil)
+		}
+		return nil
+	})
+}
+
+// TrainDictionary trains a dictionary on the newest payloads of namespace
+// and compresses its new payloads with it.
+func (s *PebbleStore) TrainDictionary(ctx context.Context, namespace string) (*storage.CompressionDictionary, error) {
+	if !s.codec.Enabled() {
+		return nil, compression.ErrDisabled
+	}
+
+	s.dictMu.Lock()
+	defer s.dictMu.Unlock()
+
+	records, _, err := s.ListRequests(ctx, storage.RequestFilter{
+		Namespace: &namespace,
+		Limit:     storage.DictionarySampleLimit,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Records are newest first and Train wants the oldest first. Payloads
+	// large enough to be offloaded to blobs are never compressed with a
+	// dictionary, so they are left out.
+	var samples [][]byte
+	for i := len(records) - 1; i >= 0; i-- {
+		for _, payload := range [][]byte{records[i].RequestPayload, records[i].ResponsePayload} {
+			if payload != nil && (s.blobs == nil || !s.blobs.Offload(payload)) {
+				samples = append(samples, payload)
+			}
+		}
+	}
+
+	id := uint32(compression.FirstDictionaryID)
+	if err := s.forEachDictionary(func(_ []byte, existing uint32, _ *dictionaryData) error {
+		id = max(id, existing+1)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	dict, err := compression.Train(id, samples)
+	if err != nil {
+		return nil, err
+	}
+
+	now := unixNano(time.Now())
+	value, err := encodeRecord(dictionaryData{
+		Namespace:  namespace,
+		Dictionary: dict,
+		CreatedAt:  now,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal dictionary: %w", err)
+	}
+	if err := s.db.Set(dictKey(id), value, pebble.Sync); err != nil {
+		return nil, fmt.Errorf("failed to save compression dictionary: %w", err)
+	}
+
+	if err := s.codec.AddDictionary(&compression.Dictionary{
+		ID:        id,
+		Namespace: namespace,
+		Data:      dict,
+		CreatedAt: time.Unix(0, now),
+	}); err != nil {
+		return nil, err
+	}
+
+	return &storage.CompressionDictionary{
+		ID:        id,
+		Namespace: namespace,
+		Size:      len(dict),
+		Samples:   len(samples),
+		CreatedAt: time.Unix(0, now),
+	}, nil
+}
@@ -0,0 +1,419 @@
+package pebbledb
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/cockroachdb/pebble"
+
+	"github.com/georgeshao/ai-inference-dam/pkg/types"
+)
+
+// formatVersionKey records the layout of keys and values in the database.
+// Databases written before the marker existed have no key and are treated
+// as version 1.
+var formatVersionKey = []byte(prefixMeta + "format_version")
+
+// Record encodings. Every ns: and req: value starts with one of these bytes,
+// so a new encoding can be introduced without guessing at old values.
+const (
+	encodingJSON   byte = 1
+	encodingBinary byte = 2 // requests only, see encodeRequest
+)
+
+// Migration upgrades the database from the previous format version. Migrate
+// must be safe to run again on a partially upgraded database, because the
+// version marker only advances once the whole migration has committed.
+type Migration struct {
+	Version int
+	Name    string
+	Migrate func(db *pebble.DB) error
+}
+
+var migrations = []Migration{
+	{Version: 2, Name: "tag record encodings", Migrate: tagRecordEncodings},
+	{Version: 3, Name: "binary request encoding", Migrate: encodeRequestsBinary},
+	{Version: 4, Name: "payload size counters", Migrate: countPayloadSizes},
+	{Version: 5, Name: "completion time index", Migrate: indexCompletionTimes},
+	{Version: 6, Name: "escape namespace names in keys", Migrate: escapeNamespaceKeys},
+}
+
+// currentFormatVersion is the version this build writes.
+var currentFormatVersion = migrations[len(migrations)-1].Version
+
+// migrationBatchSize bounds how many keys a migration rewrites per commit.
+const migrationBatchSize = 1000
+
+func encodeRecord(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{encodingJSON}, data...), nil
+}
+
+func decodeRecord(value []byte, v interface{}) error {
+	if len(value) == 0 {
+		return errors.New("empty record")
+	}
+	switch value[0] {
+	case encodingJSON:
+		return json.Unmarshal(value[1:], v)
+	}
+	return fmt.Errorf("unknown record encoding %d", value[0])
+}
+
+// FormatVersion returns the format version recorded in the database.
+func (s *PebbleStore) FormatVersion() (int, error) {
+	value, closer, err := s.db.Get(formatVersionKey)
+	if err == pebble.ErrNotFound {
+		empty, err := s.isEmpty()
+		if err != nil {
+			return 0, err
+		}
+		if empty {
+			return 0, nil
+		}
+		return 1, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read format version: %w", err)
+	}
+	defer closer.Close()
+
+	return int(decodeInt64(value)), nil
+}
+
+// PendingMigrations lists the migrations Migrate would apply, without
+// changing the database. A new, empty database needs none.
+func (s *PebbleStore) PendingMigrations() ([]Migration, error) {
+	version, err := s.FormatVersion()
+	if err != nil {
+		return nil, err
+	}
+	if version > currentFormatVersion {
+		return nil, fmt.Errorf("database format version %d is newer than this build supports (%d)", version, currentFormatVersion)
+	}
+	if version == 0 {
+		return nil, nil
+	}
+
+	var pending []Migration
+	for _, m := range migrations {
+		if m.Version > version {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+// Migrate upgrades the database to the current format version and returns
+// the migrations it applied. The marker is written after each migration, so
+// an interrupted upgrade resumes with the migration that was cut short.
+func (s *PebbleStore) Migrate() ([]Migration, error) {
+	version, err := s.FormatVersion()
+	if err != nil {
+		return nil, err
+	}
+	if version == 0 {
+		return nil, s.setFormatVersion(currentFormatVersion)
+	}
+
+	pending, err := s.PendingMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	for i, m := range pending {
+		if err := m.Migrate(s.db); err != nil {
+			return pending[:i], fmt.Errorf("migration to format version %d (%s) failed: %w", m.Version, m.Name, err)
+		}
+		if err := s.setFormatVersion(m.Version); err != nil {
+			return pending[:i], err
+		}
+	}
+
+	return pending, nil
+}
+
+func (s *PebbleStore) setFormatVersion(version int) error {
+	if err := s.db.Set(formatVersionKey, encodeInt64(int64(version)), pebble.Sync); err != nil {
+		return fmt.Errorf("failed to write format version: %w", err)
+	}
+	return nil
+}
+
+func (s *PebbleStore) isEmpty() (bool, error) {
+	iter, err := s.db.NewIter(nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to create iterator: %w", err)
+	}
+	defer iter.Close()
+	return !iter.First(), nil
+}
+
+// rewritePrefix passes every key under prefix to fn and stores the key and
+// value it returns in place of the original. Returning a nil key deletes the
+// entry. Writes are committed in chunks; the iterator reads a snapshot, so
+// keys written under the same prefix are not visited again.
+func rewritePrefix(db *pebble.DB, prefix []byte, fn func(key, value []byte) ([]byte, []byte, error)) error {
+	iter, err := db.NewIter(&pebble.IterOptions{
+		LowerBound: prefix,
+		UpperBound: upperBound(prefix),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create iterator: %w", err)
+	}
+	defer iter.Close()
+
+	batch := db.NewBatch()
+	defer func() { batch.Close() }()
+
+	for iter.First(); iter.Valid(); iter.Next() {
+		key, value := iter.Key(), iter.Value()
+		newKey, newValue, err := fn(key, value)
+		if err != nil {
+			return fmt.Errorf("failed to rewrite %s: %w", key, err)
+		}
+
+		switch {
+		case newKey == nil:
+			batch.Delete(key, nil)
+		case !bytes.Equal(newKey, key):
+			batch.Delete(key, nil)
+			batch.Set(newKey, newValue, nil)
+		case !bytes.Equal(newValue, value):
+			batch.Set(key, newValue, nil)
+		}
+
+		if batch.Count() >= migrationBatchSize {
+			if err := batch.Commit(pebble.Sync); err != nil {
+				return fmt.Errorf("failed to commit migration batch: %w", err)
+			}
+			batch.Close()
+			batch = db.NewBatch()
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return fmt.Errorf("failed to iterate %s: %w", prefix, err)
+	}
+
+	return batch.Commit(pebble.Sync)
+}
+
+// tagRecordEncodings prefixes the untagged JSON namespace and request values
+// of version 1 with encodingJSON. Values that already carry a tag are left
+// alone, since JSON objects always start with '{'.
+func tagRecordEncodings(db *pebble.DB) error {
+	tag := func(key, value []byte) ([]byte, []byte, error) {
+		if len(value) == 0 || value[0] != '{' {
+			return key, value, nil
+		}
+		return key, append([]byte{encodingJSON}, value...), nil
+	}
+
+	for _, prefix := range []string{prefixNs, prefixReq} {
+		if err := rewritePrefix(db, []byte(prefix), tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeRequestsBinary rewrites JSON request values in the binary encoding.
+func encodeRequestsBinary(db *pebble.DB) error {
+	return rewritePrefix(db, []byte(prefixReq), func(key, value []byte) ([]byte, []byte, error) {
+		if len(value) == 0 || value[0] == encodingBinary {
+			return key, value, nil
+		}
+		var data requestData
+		if err := decodeRequest(value, &data); err != nil {
+			return nil, nil, err
+		}
+		return key, encodeRequest(&data), nil
+	})
+}
+
+// countPayloadSizes sets the payload size counters of every namespace from
+// its stored requests. The counters are overwritten rather than merged, so
+// running it again gives the same result.
+func countPayloadSizes(db *pebble.DB) error {
+	prefix := []byte(prefixReq)
+	iter, err := db.NewIter(&pebble.IterOptions{
+		LowerBound: prefix,
+		UpperBound: upperBound(prefix),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create iterator: %w", err)
+	}
+	defer iter.Close()
+
+	rawSizes := make(map[string]int64)
+	storedSizes := make(map[string]int64)
+	for iter.First(); iter.Valid(); iter.Next() {
+		var data requestData
+		if err := decodeRequest(iter.Value(), &data); err != nil {
+			return fmt.Errorf("failed to decode %s: %w", iter.Key(), err)
+		}
+		rawSize, storedSize := payloadSizes(data.RequestPayload, data.ResponsePayload)
+		rawSizes[data.Namespace] += rawSize
+		storedSizes[data.Namespace] += storedSize
+	}
+	if err := iter.Error(); err != nil {
+		return fmt.Errorf("failed to iterate requests: %w", err)
+	}
+
+	batch := db.NewBatch()
+	defer batch.Close()
+	for ns, rawSize := range rawSizes {
+		batch.Set(usageKey(ns, usagePayloadBytes), encodeInt64(rawSize), nil)
+		batch.Set(usageKey(ns, usageStoredPayloadBytes), encodeInt64(storedSizes[ns]), nil)
+	}
+	return batch.Commit(pebble.Sync)
+}
+
+// indexCompletionTimes writes the done: key of every completed and failed
+// request. Setting a key that already exists is harmless, so running it
+// again gives the same result.
+func indexCompletionTimes(db *pebble.DB) error {
+	prefix := []byte(prefixReq)
+	iter, err := db.NewIter(&pebble.IterOptions{
+		LowerBound: prefix,
+		UpperBound: upperBound(prefix),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create iterator: %w", err)
+	}
+	defer iter.Close()
+
+	batch := db.NewBatch()
+	defer func() { batch.Close() }()
+
+	for iter.First(); iter.Valid(); iter.Next() {
+		var data requestData
+		if err := decodeRequest(iter.Value(), &data); err != nil {
+			return fmt.Errorf("failed to decode %s: %w", iter.Key(), err)
+		}
+		setDoneKey(batch, nil, &data)
+
+		if batch.Count() >= migrationBatchSize {
+			if err := batch.Commit(pebble.Sync); err != nil {
+				return fmt.Errorf("failed to commit migration batch: %w", err)
+			}
+			batch.Close()
+			batch = db.NewBatch()
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return fmt.Errorf("failed to iterate requests: %w", err)
+	}
+
+	return batch.Commit(pebble.Sync)
+}
+
+// escapeNamespaceKeys moves the keys of namespaces whose names contain ':'
+// or '%' under the escaped names nsKeyPart gives. Longer names are moved
+// first, so that the keys of "a:b:c" are not taken for those of "a:b".
+// Moved keys no longer match the old prefixes, so running it again moves
+// nothing.
+func escapeNamespaceKeys(db *pebble.DB) error {
+	names, err := namespaceNames(db)
+	if err != nil {
+		return err
+	}
+	escaped := make(map[string]string)
+	var order []string
+	for _, name := range names {
+		if part := nsKeyPart(name); part != name {
+			escaped[name] = part
+			order = append(order, name)
+		}
+	}
+	if len(order) == 0 {
+		return nil
+	}
+	sort.Slice(order, func(i, j int) bool { return len(order[i]) > len(order[j]) })
+
+	for _, name := range order {
+		part := escaped[name]
+		// A status index key of namespace "a" may look like one of "a:b"
+		// up to the status; only the latter has a status after the name
+		for _, prefix := range []string{prefixSt, prefixDone} {
+			if err := movePrefix(db, prefix+name+":", prefix+part+":", startsWithStatus); err != nil {
+				return err
+			}
+		}
+		for _, prefix := range []string{prefixCount, prefixUsage, prefixBudget, prefixCache} {
+			if err := movePrefix(db, prefix+name+":", prefix+part+":", nil); err != nil {
+				return err
+			}
+		}
+		if err := movePrefix(db, prefixLease+name, prefixLease+part, func(rest []byte) bool { return len(rest) == 0 }); err != nil {
+			return err
+		}
+	}
+
+	// blob:{hash}:{ns}:{id}, where the hash has a fixed length and IDs
+	// contain no colons
+	return rewritePrefix(db, []byte(prefixBlob), func(key, value []byte) ([]byte, []byte, error) {
+		hash, rest, ok := bytes.Cut(key[len(prefixBlob):], []byte(":"))
+		i := bytes.LastIndexByte(rest, ':')
+		if !ok || i < 0 {
+			return key, value, nil
+		}
+		name := string(rest[:i])
+		if _, ok := escaped[name]; !ok {
+			return key, value, nil
+		}
+		return blobKey(string(hash), name, string(rest[i+1:])), value, nil
+	})
+}
+
+// movePrefix moves the keys under from to the same keys under to. When
+// match is set, only keys whose remainder after from it accepts are moved.
+func movePrefix(db *pebble.DB, from, to string, match func(rest []byte) bool) error {
+	return rewritePrefix(db, []byte(from), func(key, value []byte) ([]byte, []byte, error) {
+		rest := key[len(from):]
+		if match != nil && !match(rest) {
+			return key, value, nil
+		}
+		return append([]byte(to), rest...), value, nil
+	})
+}
+
+func startsWithStatus(rest []byte) bool {
+	status, _, ok := bytes.Cut(rest, []byte(":"))
+	if !ok {
+		return false
+	}
+	switch types.RequestStatus(status) {
+	case types.StatusQueued, types.StatusProcessing, types.StatusCompleted, types.StatusFailed:
+		return true
+	}
+	return false
+}
+
+// namespaceNames returns the names of the stored namespaces.
+func namespaceNames(db *pebble.DB) ([]string, error) {
+	prefix := []byte(prefixNs)
+	iter, err := db.NewIter(&pebble.IterOptions{
+		LowerBound: prefix,
+		UpperBound: upperBound(prefix),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create iterator: %w", err)
+	}
+	defer iter.Close()
+
+	var names []string
+	for iter.First(); iter.Valid(); iter.Next() {
+		names = append(names, string(iter.Key()[len(prefix):]))
+	}
+	if err := iter.Error(); err != nil {
+		return nil, fmt.Errorf("failed to iterate namespaces: %w", err)
+	}
+	return names, nil
+}
@@ -0,0 +1,260 @@
+package pebbledb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+
+	"github.com/georgeshao/ai-inference-dam/internal/storage"
+	"github.com/georgeshao/ai-inference-dam/pkg/types"
+)
+
+func TestFormatVersionFreshDatabase(t *testing.T) {
+	store, err := New(filepath.Join(t.TempDir(), "db"), false)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	version, err := store.FormatVersion()
+	if err != nil {
+		t.Fatalf("FormatVersion failed: %v", err)
+	}
+	if version != currentFormatVersion {
+		t.Errorf("Expected version %d, got %d", currentFormatVersion, version)
+	}
+
+	pending, err := store.PendingMigrations()
+	if err != nil || len(pending) != 0 {
+		t.Errorf("Expected no pending migrations, got %d (err %v)", len(pending), err)
+	}
+}
+
+// writeLegacyDatabase writes a namespace and request the way version 1 did,
+// as untagged JSON without a format marker.
+func writeLegacyDatabase(t *testing.T, path string) {
+	t.Helper()
+	store, err := Open(path, false)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	defer store.Close()
+
+	now := time.Now().Truncate(time.Second).UnixNano()
+	ns, _ := json.Marshal(namespaceData{Name: "legacy", CreatedAt: now, UpdatedAt: now})
+	req, _ := json.Marshal(requestData{
+		ID:             "req_legacy",
+		Namespace:      "legacy",
+		Status:         string(types.StatusQueued),
+		RequestPayload: json.RawMessage(`{"model":"gpt-4"}`),
+		CreatedAt:      now,
+	})
+
+	batch := store.db.NewBatch()
+	batch.Set(nsKey("legacy"), ns, nil)
+	batch.Set(reqKey("req_legacy"), req, nil)
+	batch.Set(stKey("legacy", string(types.StatusQueued), now, "req_legacy"), nil, nil)
+	batch.Merge(countKey("legacy", string(types.StatusQueued)), encodeInt64(1), nil)
+	if err := batch.Commit(pebble.Sync); err != nil {
+		t.Fatalf("Failed to write legacy records: %v", err)
+	}
+}
+
+func TestMigrateLegacyDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	writeLegacyDatabase(t, path)
+
+	store, err := Open(path, false)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	defer store.Close()
+
+	if version, _ := store.FormatVersion(); version != 1 {
+		t.Errorf("Expected unmarked database to be version 1, got %d", version)
+	}
+	pending, err := store.PendingMigrations()
+	if err != nil {
+		t.Fatalf("PendingMigrations failed: %v", err)
+	}
+	if len(pending) != len(migrations) {
+		t.Errorf("Expected %d pending migrations, got %d", len(migrations), len(pending))
+	}
+
+	// Running a migration twice must be harmless
+	if err := tagRecordEncodings(store.db); err != nil {
+		t.Fatalf("tagRecordEncodings failed: %v", err)
+	}
+	if _, err := store.Migrate(); err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+	if version, _ := store.FormatVersion(); version != currentFormatVersion {
+		t.Errorf("Expected version %d after migrating, got %d", currentFormatVersion, version)
+	}
+
+	ctx := context.Background()
+	ns, err := store.GetNamespace(ctx, "legacy")
+	if err != nil || ns == nil {
+		t.Fatalf("GetNamespace failed: %v", err)
+	}
+	req, err := store.GetRequest(ctx, "req_legacy")
+	if err != nil || req == nil {
+		t.Fatalf("GetRequest failed: %v", err)
+	}
+	if string(req.RequestPayload) != `{"model":"gpt-4"}` || req.Status != types.StatusQueued {
+		t.Errorf("Request not preserved: %+v", req)
+	}
+
+	// Payload size counters are backfilled, and a second run leaves them be
+	if err := countPayloadSizes(store.db); err != nil {
+		t.Fatalf("countPayloadSizes failed: %v", err)
+	}
+	stats, _ := store.GetNamespaceStats(ctx, "legacy")
+	if size := int64(len(`{"model":"gpt-4"}`)); stats.PayloadBytes != size || stats.StoredPayloadBytes != size {
+		t.Errorf("Expected %d payload bytes, got %d stored as %d", size, stats.PayloadBytes, stats.StoredPayloadBytes)
+	}
+
+	value, closer, err := store.db.Get(reqKey("req_legacy"))
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	defer closer.Close()
+	if value[0] != encodingBinary {
+		t.Errorf("Expected request rewritten in the binary encoding, got tag %d", value[0])
+	}
+}
+
+func TestIndexCompletionTimes(t *testing.T) {
+	store, err := New(filepath.Join(t.TempDir(), "db"), false)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	now := time.Now()
+	if err := store.CreateNamespace(ctx, &storage.NamespaceRecord{Name: "test-ns", CreatedAt: now, UpdatedAt: now}); err != nil {
+		t.Fatalf("CreateNamespace failed: %v", err)
+	}
+	for _, id := range []string{"req_done", "req_queued"} {
+		err := store.CreateRequest(ctx, &storage.RequestRecord{
+			ID:             id,
+			Namespace:      "test-ns",
+			Status:         types.StatusQueued,
+			RequestPayload: json.RawMessage(`{"model":"gpt-4"}`),
+			CreatedAt:      now,
+		})
+		if err != nil {
+			t.Fatalf("CreateRequest failed: %v", err)
+		}
+	}
+	if err := store.UpdateRequestError(ctx, "req_done", "", "boom"); err != nil {
+		t.Fatalf("UpdateRequestError failed: %v", err)
+	}
+
+	// Drop the index as a version 4 database would lack it
+	prefix := []byte(prefixDone)
+	if err := store.db.DeleteRange(prefix, upperBound(prefix), pebble.Sync); err != nil {
+		t.Fatalf("DeleteRange failed: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := indexCompletionTimes(store.db); err != nil {
+			t.Fatalf("indexCompletionTimes failed: %v", err)
+		}
+	}
+
+	purged, err := store.PurgeRequests(ctx, "test-ns", types.StatusFailed, now.Add(time.Hour), 10)
+	if err != nil || purged != 1 {
+		t.Errorf("PurgeRequests = %d, %v; want the failed request", purged, err)
+	}
+	if req, _ := store.GetRequest(ctx, "req_queued"); req == nil {
+		t.Error("Expected the queued request to be kept")
+	}
+}
+
+func TestEscapeNamespaceKeys(t *testing.T) {
+	store, err := New(filepath.Join(t.TempDir(), "db"), false)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	now := time.Now()
+	for i, name := range []string{"a", "a:b", "a:b:c"} {
+		if err := store.CreateNamespace(ctx, &storage.NamespaceRecord{Name: name, CreatedAt: now, UpdatedAt: now}); err != nil {
+			t.Fatalf("CreateNamespace failed: %v", err)
+		}
+		if err := store.AddBudgetSpend(ctx, name, "2024-06-01", 0.25, 100); err != nil {
+			t.Fatalf("AddBudgetSpend failed: %v", err)
+		}
+		if _, err := store.AcquireDispatchLease(ctx, name, "owner", now, now.Add(time.Hour)); err != nil {
+			t.Fatalf("AcquireDispatchLease failed: %v", err)
+		}
+		completedAt := now.Add(-time.Hour)
+		if err := store.ImportRequest(ctx, &storage.RequestRecord{
+			ID:             fmt.Sprintf("req_%d", i),
+			Namespace:      name,
+			Status:         types.StatusCompleted,
+			RequestPayload: json.RawMessage(`{"model":"gpt-4"}`),
+			CreatedAt:      completedAt,
+			CompletedAt:    &completedAt,
+		}); err != nil {
+			t.Fatalf("ImportRequest failed: %v", err)
+		}
+	}
+
+	// Write the keys with the names unescaped, as a version 5 database has
+	// them
+	unescape := strings.NewReplacer("%3A", ":", "%25", "%")
+	for _, prefix := range []string{prefixSt, prefixDone, prefixCount, prefixUsage, prefixBudget, prefixLease} {
+		if err := rewritePrefix(store.db, []byte(prefix), func(key, value []byte) ([]byte, []byte, error) {
+			return []byte(unescape.Replace(string(key))), value, nil
+		}); err != nil {
+			t.Fatalf("Failed to unescape keys: %v", err)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if err := escapeNamespaceKeys(store.db); err != nil {
+			t.Fatalf("escapeNamespaceKeys failed: %v", err)
+		}
+	}
+
+	for _, name := range []string{"a", "a:b", "a:b:c"} {
+		if stats, err := store.GetNamespaceStats(ctx, name); err != nil || stats.TotalRequests != 1 {
+			t.Errorf("Expected 1 request in %s, got %+v, %v", name, stats, err)
+		}
+		if spend, err := store.GetBudgetSpend(ctx, name, "2024-06-01"); err != nil || spend.SpentUSD != 0.25 {
+			t.Errorf("Expected %s's spend kept, got %+v, %v", name, spend, err)
+		}
+		if ok, err := store.AcquireDispatchLease(ctx, name, "other", now, now.Add(time.Hour)); err != nil || ok {
+			t.Errorf("Expected %s's lease kept: %v", name, err)
+		}
+	}
+	if purged, err := store.PurgeRequests(ctx, "a:b", types.StatusCompleted, now, 10); err != nil || purged != 1 {
+		t.Errorf("PurgeRequests = %d, %v; want a:b's request", purged, err)
+	}
+}
+
+func TestRefuseNewerFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	store, err := New(path, false)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	if err := store.setFormatVersion(currentFormatVersion + 1); err != nil {
+		t.Fatalf("setFormatVersion failed: %v", err)
+	}
+	store.Close()
+
+	if store, err := New(path, false); err == nil {
+		store.Close()
+		t.Fatal("Expected New to refuse a newer format version")
+	}
+}
@@ -7,63 +7,208 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/cockroachdb/pebble"
 
 	"github.com/georgeshao/ai-inference-dam/internal/storage"
+	"github.com/georgeshao/ai-inference-dam/internal/storage/blob"
+	"github.com/georgeshao/ai-inference-dam/internal/storage/compression"
 	"github.com/georgeshao/ai-inference-dam/pkg/types"
 )
 
-// Key prefixes
+// Key prefixes. {ns} is escaped by nsKeyPart; the name in ns: keys is not,
+// since nothing follows it.
 const (
-	prefixNs    = "ns:"    // ns:{name} → namespace JSON
-	prefixReq   = "req:"   // req:{id} → request JSON
-	prefixSt    = "st:"    // st:{ns}:{status}:{ts}:{id} → empty
-	prefixCount = "count:" // count:{ns}:{status} → int64
+	prefixNs     = "ns:"     // ns:{name} → namespace record
+	prefixReq    = "req:"    // req:{id} → request record
+	prefixSt     = "st:"     // st:{ns}:{status}:{ts}:{id} → empty
+	prefixDone   = "done:"   // done:{ns}:{status}:{completed ts}:{id} → empty
+	prefixCount  = "count:"  // count:{ns}:{status} → int64
+	prefixUsage  = "usage:"  // usage:{ns}:{metric} → int64
+	prefixBudget = "budget:" // budget:{ns}:{period}:{field} → int64
+	prefixCache  = "cache:"  // cache:{ns}:{key} → cache entry JSON
+	prefixLease  = "lease:"  // lease:{ns} → dispatch lease JSON
+	prefixMeta   = "meta:"   // meta:{name} → database metadata
+	prefixDict   = "dict:"   // dict:{id} → compression dictionary
+	prefixBlob   = "blob:"   // blob:{hash}:{ns}:{id} → empty
 )
 
+// Budget fields. Spend uses the int64_add merger; exhausted_at is a plain
+// Unix nano timestamp.
+const (
+	budgetSpentNanoUSD = "spent_nano_usd"
+	budgetSpentTokens  = "spent_tokens"
+	budgetExhaustedAt  = "exhausted_at"
+)
+
+// Usage counter metrics. Cost is kept in nano-USD so it can share the
+// int64_add merger with the token counters.
+const (
+	usagePromptTokens     = "prompt_tokens"
+	usageCompletionTokens = "completion_tokens"
+	usageCachedTokens     = "cached_tokens"
+	usageReasoningTokens  = "reasoning_tokens"
+	usageCostNanoUSD      = "cost_nano_usd"
+	usageCacheHits        = "cache_hits"
+	usageCacheMisses      = "cache_misses"
+	// Payload sizes before and after compression
+	usagePayloadBytes       = "payload_bytes"
+	usageStoredPayloadBytes = "stored_payload_bytes"
+)
+
+var usageMetrics = []string{usagePromptTokens, usageCompletionTokens, usageCachedTokens, usageReasoningTokens, usageCostNanoUSD, usageCacheHits, usageCacheMisses, usagePayloadBytes, usageStoredPayloadBytes}
+
 type PebbleStore struct {
 	db          *pebble.DB
 	batchWriter *BatchWriter
 	useBatch    bool
+	codec       *compression.Codec
+	blobs       *blob.Store
+
+	// reqMu serializes the read-modify-write of existing requests, so a
+	// claim, completion, release or lease recovery never reads a request
+	// another is changing, and the status index and counters stay in step.
+	reqMu sync.Mutex
+	// leaseMu makes the read-check-write of dispatch leases atomic.
+	leaseMu sync.Mutex
+	// dictMu serializes TrainDictionary so dictionary IDs are unique.
+	dictMu sync.Mutex
+}
+
+// Option configures a store when it is opened.
+type Option func(*options)
+
+type options struct {
+	compression compression.Options
+	blobs       blob.Options
+}
+
+// WithCompression compresses new request and response payloads at rest.
+// Payloads already stored are readable whatever the options.
+func WithCompression(opts compression.Options) Option {
+	return func(o *options) {
+		o.compression = opts
+	}
+}
+
+// WithBlobs offloads new payloads over the threshold to a blob directory.
+// Payloads already offloaded need the directory to be read.
+func WithBlobs(opts blob.Options) Option {
+	return func(o *options) {
+		o.blobs = opts
+	}
 }
 
 type namespaceData struct {
-	Name             string            `json:"name"`
-	Description      string            `json:"description"`
-	ProviderEndpoint *string           `json:"provider_endpoint,omitempty"`
-	ProviderAPIKey   *string           `json:"provider_api_key,omitempty"`
-	ProviderModel    *string           `json:"provider_model,omitempty"`
-	ProviderHeaders  map[string]string `json:"provider_headers,omitempty"`
-	CreatedAt        int64             `json:"created_at"` // Unix nano
-	UpdatedAt        int64             `json:"updated_at"` // Unix nano
+	Name             string                   `json:"name"`
+	Description      string                   `json:"description"`
+	ProviderEndpoint *string                  `json:"provider_endpoint,omitempty"`
+	ProviderAPIKey   *string                  `json:"provider_api_key,omitempty"`
+	ProviderModel    *string                  `json:"provider_model,omitempty"`
+	ProviderHeaders  map[string]string        `json:"provider_headers,omitempty"`
+	ProviderType     string                   `json:"provider_type,omitempty"`
+	ProviderAWS      *storage.AWSCredentials  `json:"provider_aws,omitempty"`
+	URLTemplate      *string                  `json:"url_template,omitempty"`
+	QueryParams      map[string]string        `json:"query_params,omitempty"`
+	Budget           *storage.Budget          `json:"budget,omitempty"`
+	Cache            *storage.CacheConfig     `json:"cache,omitempty"`
+	Retention        *storage.RetentionPolicy `json:"retention,omitempty"`
+	CreatedAt        int64                    `json:"created_at"` // Unix nano
+	UpdatedAt        int64                    `json:"updated_at"` // Unix nano
 }
 
+// requestData is a request as stored. RequestPayload and ResponsePayload
+// hold the stored values, which are zstd frames when compressed and blob
+// references when offloaded.
 type requestData struct {
-	ID                 string                 `json:"id"`
-	Namespace          string                 `json:"namespace"`
-	Status             string                 `json:"status"`
-	RequestPayload     map[string]interface{} `json:"request_payload"`
-	PassthroughHeaders map[string]string      `json:"passthrough_headers,omitempty"`
-	HeaderEndpoint     *string                `json:"header_endpoint,omitempty"`
-	HeaderAPIKey       *string                `json:"header_api_key,omitempty"`
-	ResponsePayload    map[string]interface{} `json:"response_payload,omitempty"`
-	Error              *string                `json:"error,omitempty"`
-	CreatedAt          int64                  `json:"created_at"` // Unix nano
-	DispatchedAt       *int64                 `json:"dispatched_at,omitempty"`
-	CompletedAt        *int64                 `json:"completed_at,omitempty"`
-}
-
-func New(dbPath string, useBatch bool) (*PebbleStore, error) {
+	ID                 string            `json:"id"`
+	Namespace          string            `json:"namespace"`
+	Status             string            `json:"status"`
+	RequestPayload     json.RawMessage   `json:"request_payload"`
+	PassthroughHeaders map[string]string `json:"passthrough_headers,omitempty"`
+	HeaderEndpoint     *string           `json:"header_endpoint,omitempty"`
+	HeaderAPIKey       *string           `json:"header_api_key,omitempty"`
+	ResponsePayload    json.RawMessage   `json:"response_payload,omitempty"`
+	PromptTokens       int64             `json:"prompt_tokens,omitempty"`
+	CompletionTokens   int64             `json:"completion_tokens,omitempty"`
+	CachedTokens       int64             `json:"cached_tokens,omitempty"`
+	ReasoningTokens    int64             `json:"reasoning_tokens,omitempty"`
+	CostUSD            float64           `json:"cost_usd,omitempty"`
+	CacheHit           bool              `json:"cache_hit,omitempty"`
+	CoalescedWith      *string           `json:"coalesced_with,omitempty"`
+	Error              *string           `json:"error,omitempty"`
+	CreatedAt          int64             `json:"created_at"` // Unix nano
+	DispatchedAt       *int64            `json:"dispatched_at,omitempty"`
+	CompletedAt        *int64            `json:"completed_at,omitempty"`
+	LeaseOwner         *string           `json:"lease_owner,omitempty"`
+	LeaseExpiresAt     *int64            `json:"lease_expires_at,omitempty"` // Unix nano
+	Attempts           int               `json:"attempts,omitempty"`
+}
+
+type dispatchLeaseData struct {
+	Owner     string `json:"owner"`
+	ExpiresAt int64  `json:"expires_at"` // Unix nano
+}
+
+type cacheData struct {
+	Response  json.RawMessage `json:"response"`
+	CreatedAt int64           `json:"created_at"` // Unix nano
+	ExpiresAt int64           `json:"expires_at"` // Unix nano
+}
+
+// New opens the database and upgrades it to the current format version.
+func New(dbPath string, useBatch bool, opts ...Option) (*PebbleStore, error) {
+	store, err := Open(dbPath, useBatch, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := store.Migrate(); err != nil {
+		store.Close()
+		return nil, fmt.Errorf("failed to upgrade database format: %w", err)
+	}
+
+	if err := store.loadDictionaries(); err != nil {
+		store.Close()
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// Open opens the database without upgrading it, for inspecting pending
+// format migrations before applying them.
+func Open(dbPath string, useBatch bool, opts ...Option) (*PebbleStore, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	codec, err := compression.NewCodec(o.compression)
+	if err != nil {
+		return nil, err
+	}
+
+	var blobs *blob.Store
+	if o.blobs.Dir != "" {
+		if blobs, err = blob.Open(o.blobs, codec); err != nil {
+			return nil, err
+		}
+	}
+
 	dir := filepath.Dir(dbPath)
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create database directory: %w", err)
 	}
 
-	opts := &pebble.Options{
+	pebbleOpts := &pebble.Options{
 		Merger: &pebble.Merger{
 			Name: "int64_add",
 			Merge: func(key, value []byte) (pebble.ValueMerger, error) {
@@ -72,7 +217,7 @@ func New(dbPath string, useBatch bool) (*PebbleStore, error) {
 		},
 	}
 
-	db, err := pebble.Open(dbPath, opts)
+	db, err := pebble.Open(dbPath, pebbleOpts)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open pebble database: %w", err)
 	}
@@ -80,6 +225,8 @@ func New(dbPath string, useBatch bool) (*PebbleStore, error) {
 	store := &PebbleStore{
 		db:       db,
 		useBatch: useBatch,
+		codec:    codec,
+		blobs:    blobs,
 	}
 
 	if useBatch {
@@ -96,6 +243,7 @@ func (s *PebbleStore) Close() error {
 			return fmt.Errorf("failed to close batch writer: %w", err)
 		}
 	}
+	s.codec.Close()
 	return s.db.Close()
 }
 
@@ -108,15 +256,95 @@ func reqKey(id string) []byte {
 }
 
 func stKey(ns, status string, ts int64, id string) []byte {
-	return []byte(fmt.Sprintf("%s%s:%s:%020d:%s", prefixSt, ns, status, ts, id))
+	return []byte(fmt.Sprintf("%s%s:%s:%020d:%s", prefixSt, nsKeyPart(ns), status, ts, id))
 }
 
 func stPrefix(ns, status string) []byte {
-	return []byte(fmt.Sprintf("%s%s:%s:", prefixSt, ns, status))
+	return []byte(fmt.Sprintf("%s%s:%s:", prefixSt, nsKeyPart(ns), status))
+}
+
+func doneKey(ns, status string, ts int64, id string) []byte {
+	return []byte(fmt.Sprintf("%s%s:%s:%020d:%s", prefixDone, nsKeyPart(ns), status, ts, id))
+}
+
+func donePrefix(ns, status string) []byte {
+	return []byte(fmt.Sprintf("%s%s:%s:", prefixDone, nsKeyPart(ns), status))
+}
+
+// finishedKey returns the done: key of a completed or failed request, or
+// nil for any other request. data may be nil.
+func finishedKey(data *requestData) []byte {
+	if data == nil || data.CompletedAt == nil {
+		return nil
+	}
+	if data.Status != string(types.StatusCompleted) && data.Status != string(types.StatusFailed) {
+		return nil
+	}
+	return doneKey(data.Namespace, data.Status, *data.CompletedAt, data.ID)
+}
+
+// setDoneKey moves the done: key of a request stored as old, or not stored
+// when nil, to that of data, or deletes it when data is nil.
+func setDoneKey(batch *pebble.Batch, old, data *requestData) {
+	before, after := finishedKey(old), finishedKey(data)
+	if before != nil && !bytes.Equal(before, after) {
+		batch.Delete(before, nil)
+	}
+	if after != nil {
+		batch.Set(after, nil, nil)
+	}
 }
 
 func countKey(ns, status string) []byte {
-	return []byte(fmt.Sprintf("%s%s:%s", prefixCount, ns, status))
+	return []byte(fmt.Sprintf("%s%s:%s", prefixCount, nsKeyPart(ns), status))
+}
+
+func usageKey(ns, metric string) []byte {
+	return []byte(fmt.Sprintf("%s%s:%s", prefixUsage, nsKeyPart(ns), metric))
+}
+
+func budgetKey(ns, periodKey, field string) []byte {
+	return []byte(fmt.Sprintf("%s%s:%s:%s", prefixBudget, nsKeyPart(ns), periodKey, field))
+}
+
+func cacheKey(ns, key string) []byte {
+	return []byte(fmt.Sprintf("%s%s:%s", prefixCache, nsKeyPart(ns), key))
+}
+
+func cachePrefix(ns string) []byte {
+	return []byte(fmt.Sprintf("%s%s:", prefixCache, nsKeyPart(ns)))
+}
+
+func leaseKey(ns string) []byte {
+	return []byte(prefixLease + nsKeyPart(ns))
+}
+
+func budgetPrefix(ns string) []byte {
+	return []byte(fmt.Sprintf("%s%s:", prefixBudget, nsKeyPart(ns)))
+}
+
+func doneNamespacePrefix(ns string) []byte {
+	return []byte(fmt.Sprintf("%s%s:", prefixDone, nsKeyPart(ns)))
+}
+
+// nsKeyEscaper escapes the colons that separate key parts, and the escape
+// character itself.
+var nsKeyEscaper = strings.NewReplacer("%", "%25", ":", "%3A")
+
+// nsKeyPart returns namespace as it appears inside a key. Escaping keeps a
+// name such as "a:b" from falling under the prefixes of namespace "a";
+// names without ':' or '%' are unchanged.
+func nsKeyPart(namespace string) string {
+	if !strings.ContainsAny(namespace, ":%") {
+		return namespace
+	}
+	return nsKeyEscaper.Replace(namespace)
+}
+
+// unixNano converts t for storage. Timestamps are kept at whole-second
+// precision so they compare the same way as in the SQL backends.
+func unixNano(t time.Time) int64 {
+	return t.Truncate(time.Second).UnixNano()
 }
 
 func encodeInt64(n int64) []byte {
@@ -171,11 +399,18 @@ func (s *PebbleStore) CreateNamespace(ctx context.Context, ns *storage.Namespace
 		ProviderAPIKey:   ns.ProviderAPIKey,
 		ProviderModel:    ns.ProviderModel,
 		ProviderHeaders:  ns.ProviderHeaders,
-		CreatedAt:        ns.CreatedAt.UnixNano(),
-		UpdatedAt:        ns.UpdatedAt.UnixNano(),
+		ProviderType:     string(ns.ProviderType),
+		ProviderAWS:      ns.ProviderAWS,
+		URLTemplate:      ns.URLTemplate,
+		QueryParams:      ns.QueryParams,
+		Budget:           ns.Budget,
+		Cache:            ns.Cache,
+		Retention:        ns.Retention,
+		CreatedAt:        unixNano(ns.CreatedAt),
+		UpdatedAt:        unixNano(ns.UpdatedAt),
 	}
 
-	value, err := json.Marshal(data)
+	value, err := encodeRecord(data)
 	if err != nil {
 		return fmt.Errorf("failed to marshal namespace: %w", err)
 	}
@@ -194,7 +429,7 @@ func (s *PebbleStore) GetNamespace(ctx context.Context, name string) (*storage.N
 	defer closer.Close()
 
 	var data namespaceData
-	if err := json.Unmarshal(value, &data); err != nil {
+	if err := decodeRecord(value, &data); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal namespace: %w", err)
 	}
 
@@ -217,11 +452,18 @@ func (s *PebbleStore) UpdateNamespace(ctx context.Context, name string, ns *stor
 		ProviderAPIKey:   ns.ProviderAPIKey,
 		ProviderModel:    ns.ProviderModel,
 		ProviderHeaders:  ns.ProviderHeaders,
-		CreatedAt:        existing.CreatedAt.UnixNano(),
-		UpdatedAt:        ns.UpdatedAt.UnixNano(),
+		ProviderType:     string(ns.ProviderType),
+		ProviderAWS:      ns.ProviderAWS,
+		URLTemplate:      ns.URLTemplate,
+		QueryParams:      ns.QueryParams,
+		Budget:           ns.Budget,
+		Cache:            ns.Cache,
+		Retention:        ns.Retention,
+		CreatedAt:        unixNano(existing.CreatedAt),
+		UpdatedAt:        unixNano(ns.UpdatedAt),
 	}
 
-	value, err := json.Marshal(data)
+	value, err := encodeRecord(data)
 	if err != nil {
 		return fmt.Errorf("failed to marshal namespace: %w", err)
 	}
@@ -230,6 +472,9 @@ func (s *PebbleStore) UpdateNamespace(ctx context.Context, name string, ns *stor
 }
 
 func (s *PebbleStore) DeleteNamespace(ctx context.Context, name string) (int, error) {
+	s.reqMu.Lock()
+	defer s.reqMu.Unlock()
+
 	batch := s.db.NewBatch()
 	defer batch.Close()
 
@@ -260,6 +505,30 @@ func (s *PebbleStore) DeleteNamespace(ctx context.Context, name string) (int, er
 		batch.Delete(countKey(name, status), nil)
 	}
 
+	for _, metric := range usageMetrics {
+		batch.Delete(usageKey(name, metric), nil)
+	}
+
+	prefix := doneNamespacePrefix(name)
+	batch.DeleteRange(prefix, upperBound(prefix), nil)
+
+	prefix = budgetPrefix(name)
+	batch.DeleteRange(prefix, upperBound(prefix), nil)
+
+	prefix = cachePrefix(name)
+	batch.DeleteRange(prefix, upperBound(prefix), nil)
+
+	batch.Delete(leaseKey(name), nil)
+
+	if err := s.deleteDictionaries(batch, name); err != nil {
+		return 0, err
+	}
+
+	blobHashes, err := s.deleteNamespaceBlobKeys(batch, name)
+	if err != nil {
+		return 0, err
+	}
+
 	// Delete namespace
 	batch.Delete(nsKey(name), nil)
 
@@ -267,6 +536,10 @@ func (s *PebbleStore) DeleteNamespace(ctx context.Context, name string) (int, er
 		return 0, fmt.Errorf("failed to commit batch: %w", err)
 	}
 
+	s.codec.RemoveNamespace(name)
+
+	s.releaseBlobs(blobHashes)
+
 	return deletedCount, nil
 }
 
@@ -285,7 +558,7 @@ func (s *PebbleStore) ListNamespaces(ctx context.Context) ([]*storage.NamespaceR
 
 	for iter.First(); iter.Valid(); iter.Next() {
 		var data namespaceData
-		if err := json.Unmarshal(iter.Value(), &data); err != nil {
+		if err := decodeRecord(iter.Value(), &data); err != nil {
 			return nil, fmt.Errorf("failed to unmarshal namespace: %w", err)
 		}
 		records = append(records, toNamespaceRecord(&data))
@@ -312,11 +585,167 @@ func (s *PebbleStore) GetNamespaceStats(ctx context.Context, name string) (*type
 		stats.TotalRequests += int(count)
 	}
 
+	stats.PromptTokens = s.getCounter(usageKey(name, usagePromptTokens))
+	stats.CompletionTokens = s.getCounter(usageKey(name, usageCompletionTokens))
+	stats.CachedTokens = s.getCounter(usageKey(name, usageCachedTokens))
+	stats.ReasoningTokens = s.getCounter(usageKey(name, usageReasoningTokens))
+	stats.CostUSD = float64(s.getCounter(usageKey(name, usageCostNanoUSD))) / 1e9
+	stats.CacheHits = s.getCounter(usageKey(name, usageCacheHits))
+	stats.CacheMisses = s.getCounter(usageKey(name, usageCacheMisses))
+	stats.PayloadBytes = s.getCounter(usageKey(name, usagePayloadBytes))
+	stats.StoredPayloadBytes = s.getCounter(usageKey(name, usageStoredPayloadBytes))
+
 	return stats, nil
 }
 
+func (s *PebbleStore) GetBudgetSpend(ctx context.Context, namespace, periodKey string) (*storage.BudgetSpend, error) {
+	spend := &storage.BudgetSpend{
+		PeriodKey:   periodKey,
+		SpentUSD:    float64(s.getCounter(budgetKey(namespace, periodKey, budgetSpentNanoUSD))) / 1e9,
+		SpentTokens: s.getCounter(budgetKey(namespace, periodKey, budgetSpentTokens)),
+	}
+
+	value, closer, err := s.db.Get(budgetKey(namespace, periodKey, budgetExhaustedAt))
+	if err == pebble.ErrNotFound {
+		return spend, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get budget state: %w", err)
+	}
+	defer closer.Close()
+
+	exhaustedAt := time.Unix(0, decodeInt64(value))
+	spend.ExhaustedAt = &exhaustedAt
+	return spend, nil
+}
+
+func (s *PebbleStore) AddBudgetSpend(ctx context.Context, namespace, periodKey string, costUSD float64, tokens int64) error {
+	batch := s.db.NewBatch()
+	defer batch.Close()
+
+	batch.Merge(budgetKey(namespace, periodKey, budgetSpentNanoUSD), encodeInt64(int64(math.Round(costUSD*1e9))), nil)
+	batch.Merge(budgetKey(namespace, periodKey, budgetSpentTokens), encodeInt64(tokens), nil)
+
+	return batch.Commit(pebble.Sync)
+}
+
+func (s *PebbleStore) SetBudgetExhausted(ctx context.Context, namespace, periodKey string, exhaustedAt *time.Time) error {
+	key := budgetKey(namespace, periodKey, budgetExhaustedAt)
+	if exhaustedAt == nil {
+		return s.db.Delete(key, pebble.Sync)
+	}
+	return s.db.Set(key, encodeInt64(unixNano(*exhaustedAt)), pebble.Sync)
+}
+
+func (s *PebbleStore) ResetBudget(ctx context.Context, namespace string) error {
+	prefix := budgetPrefix(namespace)
+	return s.db.DeleteRange(prefix, upperBound(prefix), pebble.Sync)
+}
+
+func (s *PebbleStore) GetCachedResponse(ctx context.Context, namespace, key string) (*storage.CacheEntry, error) {
+	value, closer, err := s.db.Get(cacheKey(namespace, key))
+	if err == pebble.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cached response: %w", err)
+	}
+	defer closer.Close()
+
+	var data cacheData
+	if err := json.Unmarshal(value, &data); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal cached response: %w", err)
+	}
+	if unixNano(time.Now()) >= data.ExpiresAt {
+		return nil, nil
+	}
+
+	return &storage.CacheEntry{
+		Namespace: namespace,
+		Key:       key,
+		Response:  data.Response,
+		CreatedAt: time.Unix(0, data.CreatedAt),
+		ExpiresAt: time.Unix(0, data.ExpiresAt),
+	}, nil
+}
+
+func (s *PebbleStore) PutCachedResponse(ctx context.Context, entry *storage.CacheEntry) error {
+	value, err := json.Marshal(cacheData{
+		Response:  entry.Response,
+		CreatedAt: unixNano(entry.CreatedAt),
+		ExpiresAt: unixNano(entry.ExpiresAt),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal cached response: %w", err)
+	}
+
+	return s.db.Set(cacheKey(entry.Namespace, entry.Key), value, pebble.Sync)
+}
+
+func (s *PebbleStore) RecordCacheLookup(ctx context.Context, namespace string, hit bool) error {
+	metric := usageCacheMisses
+	if hit {
+		metric = usageCacheHits
+	}
+	return s.db.Merge(usageKey(namespace, metric), encodeInt64(1), pebble.Sync)
+}
+
+func (s *PebbleStore) AcquireDispatchLease(ctx context.Context, namespace, owner string, now, leaseUntil time.Time) (bool, error) {
+	s.leaseMu.Lock()
+	defer s.leaseMu.Unlock()
+
+	current, err := s.getDispatchLease(namespace)
+	if err != nil {
+		return false, err
+	}
+	if current != nil && current.Owner != owner && current.ExpiresAt >= unixNano(now) {
+		return false, nil
+	}
+
+	value, err := json.Marshal(dispatchLeaseData{Owner: owner, ExpiresAt: unixNano(leaseUntil)})
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal dispatch lease: %w", err)
+	}
+	if err := s.db.Set(leaseKey(namespace), value, pebble.Sync); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *PebbleStore) ReleaseDispatchLease(ctx context.Context, namespace, owner string) error {
+	s.leaseMu.Lock()
+	defer s.leaseMu.Unlock()
+
+	current, err := s.getDispatchLease(namespace)
+	if err != nil || current == nil || current.Owner != owner {
+		return err
+	}
+	return s.db.Delete(leaseKey(namespace), pebble.Sync)
+}
+
+func (s *PebbleStore) getDispatchLease(namespace string) (*dispatchLeaseData, error) {
+	value, closer, err := s.db.Get(leaseKey(namespace))
+	if err == pebble.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dispatch lease: %w", err)
+	}
+	defer closer.Close()
+
+	var data dispatchLeaseData
+	if err := json.Unmarshal(value, &data); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal dispatch lease: %w", err)
+	}
+	return &data, nil
+}
+
 func (s *PebbleStore) getCount(ns, status string) int64 {
-	value, closer, err := s.db.Get(countKey(ns, status))
+	return s.getCounter(countKey(ns, status))
+}
+
+func (s *PebbleStore) getCounter(key []byte) int64 {
+	value, closer, err := s.db.Get(key)
 	if err != nil {
 		return 0
 	}
@@ -325,27 +754,35 @@ func (s *PebbleStore) getCount(ns, status string) int64 {
 }
 
 func (s *PebbleStore) CreateRequest(ctx context.Context, req *storage.RequestRecord) error {
-	data := requestData{
+	payload, err := s.storePayload(req.Namespace, req.RequestPayload)
+	if err != nil {
+		return err
+	}
+
+	data := &requestData{
 		ID:                 req.ID,
 		Namespace:          req.Namespace,
 		Status:             string(req.Status),
-		RequestPayload:     req.RequestPayload,
+		RequestPayload:     payload,
 		PassthroughHeaders: req.PassthroughHeaders,
 		HeaderEndpoint:     req.HeaderEndpoint,
 		HeaderAPIKey:       req.HeaderAPIKey,
-		CreatedAt:          req.CreatedAt.UnixNano(),
+		CreatedAt:          unixNano(req.CreatedAt),
 	}
 
-	value, err := json.Marshal(data)
-	if err != nil {
-		return fmt.Errorf("failed to marshal request: %w", err)
-	}
+	value := encodeRequest(data)
+	rawSize, storedSize := payloadSizes(data.RequestPayload)
 
 	if s.useBatch {
 		// Queue writes to batch writer for batched commits
 		s.batchWriter.Set(reqKey(req.ID), value)
 		s.batchWriter.Set(stKey(req.Namespace, string(req.Status), data.CreatedAt, req.ID), nil)
 		s.batchWriter.Merge(countKey(req.Namespace, string(req.Status)), encodeInt64(1))
+		s.batchWriter.Merge(usageKey(req.Namespace, usagePayloadBytes), encodeInt64(rawSize))
+		s.batchWriter.Merge(usageKey(req.Namespace, usageStoredPayloadBytes), encodeInt64(storedSize))
+		for key := range blobKeys(data) {
+			s.batchWriter.Set([]byte(key), nil)
+		}
 		return nil
 	}
 
@@ -355,6 +792,9 @@ func (s *PebbleStore) CreateRequest(ctx context.Context, req *storage.RequestRec
 	batch.Set(reqKey(req.ID), value, nil)
 	batch.Set(stKey(req.Namespace, string(req.Status), data.CreatedAt, req.ID), nil, nil)
 	batch.Merge(countKey(req.Namespace, string(req.Status)), encodeInt64(1), nil)
+	batch.Merge(usageKey(req.Namespace, usagePayloadBytes), encodeInt64(rawSize), nil)
+	batch.Merge(usageKey(req.Namespace, usageStoredPayloadBytes), encodeInt64(storedSize), nil)
+	setBlobKeys(batch, nil, data)
 	return batch.Commit(pebble.Sync)
 }
 
@@ -366,11 +806,15 @@ func (s *PebbleStore) GetRequest(ctx context.Context, id string) (*storage.Reque
 	if data == nil {
 		return nil, nil
 	}
-	return toRequestRecord(data), nil
+	return s.toRequestRecord(data)
 }
 
 func (s *PebbleStore) getRequestData(id string) (*requestData, error) {
-	value, closer, err := s.db.Get(reqKey(id))
+	return readRequestData(s.db, id)
+}
+
+func readRequestData(r pebble.Reader, id string) (*requestData, error) {
+	value, closer, err := r.Get(reqKey(id))
 	if err == pebble.ErrNotFound {
 		return nil, nil
 	}
@@ -380,7 +824,7 @@ func (s *PebbleStore) getRequestData(id string) (*requestData, error) {
 	defer closer.Close()
 
 	var data requestData
-	if err := json.Unmarshal(value, &data); err != nil {
+	if err := decodeRequest(value, &data); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal request: %w", err)
 	}
 	return &data, nil
@@ -409,54 +853,82 @@ func (s *PebbleStore) ListRequests(ctx context.Context, filter storage.RequestFi
 		}
 	}
 
-	var allRecords []*storage.RequestRecord
+	// Each status index is ordered by time, so take the newest limit entries
+	// before the cursor from each and merge them.
+	type indexEntry struct {
+		ts int64
+		id string
+	}
+	var entries []indexEntry
 	total := 0
 
 	for _, status := range statuses {
+		total += int(s.getCount(*filter.Namespace, status))
+
 		prefix := stPrefix(*filter.Namespace, status)
+		upper := upperBound(prefix)
+		if filter.Cursor != nil {
+			upper = stKey(*filter.Namespace, status, unixNano(*filter.Cursor), filter.CursorID)
+		}
+
 		iter, err := s.db.NewIter(&pebble.IterOptions{
 			LowerBound: prefix,
-			UpperBound: upperBound(prefix),
+			UpperBound: upper,
 		})
 		if err != nil {
 			return nil, 0, fmt.Errorf("failed to create iterator: %w", err)
 		}
 
-		// If cursor provided, seek to it
-		var cursorKey []byte
-		if filter.Cursor != nil {
-			cursorKey = stKey(*filter.Namespace, status, filter.Cursor.UnixNano(), "")
-		}
-
-		for iter.First(); iter.Valid(); iter.Next() {
-			total++
-
-			// Skip entries at or before cursor
-			if cursorKey != nil && bytes.Compare(iter.Key(), cursorKey) <= 0 {
+		taken := 0
+		for iter.Last(); iter.Valid() && taken < limit; iter.Prev() {
+			key := iter.Key()
+			id := extractIDFromStKey(key)
+			if id == "" {
 				continue
 			}
-
-			if len(allRecords) < limit {
-				id := extractIDFromStKey(iter.Key())
-				if id != "" {
-					data, err := s.getRequestData(id)
-					if err != nil {
-						iter.Close()
-						return nil, 0, err
-					}
-					if data != nil {
-						allRecords = append(allRecords, toRequestRecord(data))
-					}
-				}
+			ts, err := strconv.ParseInt(string(key[len(prefix):len(prefix)+20]), 10, 64)
+			if err != nil {
+				iter.Close()
+				return nil, 0, fmt.Errorf("failed to parse status index key: %w", err)
 			}
+			entries = append(entries, indexEntry{ts: ts, id: id})
+			taken++
 		}
 		iter.Close()
 	}
 
-	return allRecords, total, nil
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].ts != entries[j].ts {
+			return entries[i].ts > entries[j].ts
+		}
+		return entries[i].id > entries[j].id
+	})
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+
+	records := make([]*storage.RequestRecord, 0, len(entries))
+	for _, entry := range entries {
+		data, err := s.getRequestData(entry.id)
+		if err != nil {
+			return nil, 0, err
+		}
+		if data != nil {
+			record, err := s.toRequestRecord(data)
+			if err != nil {
+				return nil, 0, err
+			}
+			records = append(records, record)
+		}
+	}
+
+	return records, total, nil
 }
 
 func (s *PebbleStore) UpdateRequestStatus(ctx context.Context, id string, status types.RequestStatus, dispatchedAt time.Time) error {
+	s.reqMu.Lock()
+	defer s.reqMu.Unlock()
+
 	data, err := s.getRequestData(id)
 	if err != nil {
 		return err
@@ -465,17 +937,15 @@ func (s *PebbleStore) UpdateRequestStatus(ctx context.Context, id string, status
 		return fmt.Errorf("request not found: %s", id)
 	}
 
+	old := *data
 	oldStatus := data.Status
 	oldTs := data.CreatedAt
 
 	data.Status = string(status)
-	dispatchedNano := dispatchedAt.UnixNano()
+	dispatchedNano := unixNano(dispatchedAt)
 	data.DispatchedAt = &dispatchedNano
 
-	value, err := json.Marshal(data)
-	if err != nil {
-		return fmt.Errorf("failed to marshal request: %w", err)
-	}
+	value := encodeRequest(data)
 
 	batch := s.db.NewBatch()
 	defer batch.Close()
@@ -485,11 +955,15 @@ func (s *PebbleStore) UpdateRequestStatus(ctx context.Context, id string, status
 	batch.Set(stKey(data.Namespace, string(status), oldTs, id), nil, nil)
 	batch.Merge(countKey(data.Namespace, oldStatus), encodeInt64(-1), nil)
 	batch.Merge(countKey(data.Namespace, string(status)), encodeInt64(1), nil)
+	setDoneKey(batch, &old, data)
 
 	return batch.Commit(pebble.Sync)
 }
 
-func (s *PebbleStore) UpdateRequestResponse(ctx context.Context, id string, response map[string]interface{}) error {
+func (s *PebbleStore) UpdateRequestResponse(ctx context.Context, id, leaseOwner string, response json.RawMessage, usage storage.Usage) error {
+	s.reqMu.Lock()
+	defer s.reqMu.Unlock()
+
 	data, err := s.getRequestData(id)
 	if err != nil {
 		return err
@@ -497,19 +971,31 @@ func (s *PebbleStore) UpdateRequestResponse(ctx context.Context, id string, resp
 	if data == nil {
 		return fmt.Errorf("request not found: %s", id)
 	}
+	if !leaseHeld(data, leaseOwner) {
+		return storage.ErrLeaseLost
+	}
 
+	old := *data
 	oldStatus := data.Status
 	oldTs := data.CreatedAt
 
+	oldResponse := data.ResponsePayload
+
 	data.Status = string(types.StatusCompleted)
-	data.ResponsePayload = response
-	completedNano := time.Now().UnixNano()
+	if data.ResponsePayload, err = s.storePayload(data.Namespace, response); err != nil {
+		return err
+	}
+	data.PromptTokens = usage.PromptTokens
+	data.CompletionTokens = usage.CompletionTokens
+	data.CachedTokens = usage.CachedTokens
+	data.ReasoningTokens = usage.ReasoningTokens
+	data.CostUSD = usage.CostUSD
+	data.LeaseOwner = nil
+	data.LeaseExpiresAt = nil
+	completedNano := unixNano(time.Now())
 	data.CompletedAt = &completedNano
 
-	value, err := json.Marshal(data)
-	if err != nil {
-		return fmt.Errorf("failed to marshal request: %w", err)
-	}
+	value := encodeRequest(data)
 
 	batch := s.db.NewBatch()
 	defer batch.Close()
@@ -519,11 +1005,27 @@ func (s *PebbleStore) UpdateRequestResponse(ctx context.Context, id string, resp
 	batch.Set(stKey(data.Namespace, string(types.StatusCompleted), oldTs, id), nil, nil)
 	batch.Merge(countKey(data.Namespace, oldStatus), encodeInt64(-1), nil)
 	batch.Merge(countKey(data.Namespace, string(types.StatusCompleted)), encodeInt64(1), nil)
+	batch.Merge(usageKey(data.Namespace, usagePromptTokens), encodeInt64(usage.PromptTokens), nil)
+	batch.Merge(usageKey(data.Namespace, usageCompletionTokens), encodeInt64(usage.CompletionTokens), nil)
+	batch.Merge(usageKey(data.Namespace, usageCachedTokens), encodeInt64(usage.CachedTokens), nil)
+	batch.Merge(usageKey(data.Namespace, usageReasoningTokens), encodeInt64(usage.ReasoningTokens), nil)
+	batch.Merge(usageKey(data.Namespace, usageCostNanoUSD), encodeInt64(int64(math.Round(usage.CostUSD*1e9))), nil)
+	mergePayloadSizes(batch, data.Namespace, -1, oldResponse)
+	mergePayloadSizes(batch, data.Namespace, 1, data.ResponsePayload)
+	setDoneKey(batch, &old, data)
+	released := setBlobKeys(batch, &old, data)
 
-	return batch.Commit(pebble.Sync)
+	if err := batch.Commit(pebble.Sync); err != nil {
+		return err
+	}
+	s.releaseBlobs(released)
+	return nil
 }
 
-func (s *PebbleStore) UpdateRequestError(ctx context.Context, id string, errMsg string) error {
+func (s *PebbleStore) UpdateRequestCacheHit(ctx context.Context, id, leaseOwner string, response json.RawMessage) error {
+	s.reqMu.Lock()
+	defer s.reqMu.Unlock()
+
 	data, err := s.getRequestData(id)
 	if err != nil {
 		return err
@@ -531,54 +1033,174 @@ func (s *PebbleStore) UpdateRequestError(ctx context.Context, id string, errMsg
 	if data == nil {
 		return fmt.Errorf("request not found: %s", id)
 	}
+	if !leaseHeld(data, leaseOwner) {
+		return storage.ErrLeaseLost
+	}
 
+	old := *data
 	oldStatus := data.Status
 	oldTs := data.CreatedAt
 
-	data.Status = string(types.StatusFailed)
-	data.Error = &errMsg
-	completedNano := time.Now().UnixNano()
-	data.CompletedAt = &completedNano
+	oldResponse := data.ResponsePayload
 
-	value, err := json.Marshal(data)
-	if err != nil {
-		return fmt.Errorf("failed to marshal request: %w", err)
+	data.Status = string(types.StatusCompleted)
+	if data.ResponsePayload, err = s.storePayload(data.Namespace, response); err != nil {
+		return err
 	}
+	data.CacheHit = true
+	data.LeaseOwner = nil
+	data.LeaseExpiresAt = nil
+	completedNano := unixNano(time.Now())
+	data.CompletedAt = &completedNano
+
+	value := encodeRequest(data)
 
 	batch := s.db.NewBatch()
 	defer batch.Close()
 
 	batch.Set(reqKey(id), value, nil)
 	batch.Delete(stKey(data.Namespace, oldStatus, oldTs, id), nil)
-	batch.Set(stKey(data.Namespace, string(types.StatusFailed), oldTs, id), nil, nil)
+	batch.Set(stKey(data.Namespace, string(types.StatusCompleted), oldTs, id), nil, nil)
 	batch.Merge(countKey(data.Namespace, oldStatus), encodeInt64(-1), nil)
-	batch.Merge(countKey(data.Namespace, string(types.StatusFailed)), encodeInt64(1), nil)
+	batch.Merge(countKey(data.Namespace, string(types.StatusCompleted)), encodeInt64(1), nil)
+	mergePayloadSizes(batch, data.Namespace, -1, oldResponse)
+	mergePayloadSizes(batch, data.Namespace, 1, data.ResponsePayload)
+	setDoneKey(batch, &old, data)
+	released := setBlobKeys(batch, &old, data)
 
-	return batch.Commit(pebble.Sync)
+	if err := batch.Commit(pebble.Sync); err != nil {
+		return err
+	}
+	s.releaseBlobs(released)
+	return nil
 }
 
-func (s *PebbleStore) GetQueuedRequests(ctx context.Context, namespace string) ([]*storage.RequestRecord, error) {
-	prefix := stPrefix(namespace, string(types.StatusQueued))
-	iter, err := s.db.NewIter(&pebble.IterOptions{
-		LowerBound: prefix,
-		UpperBound: upperBound(prefix),
-	})
+func (s *PebbleStore) UpdateRequestCoalesced(ctx context.Context, id, leaseOwner, primaryID string, response json.RawMessage, errMsg *string) error {
+	s.reqMu.Lock()
+	defer s.reqMu.Unlock()
+
+	data, err := s.getRequestData(id)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create iterator: %w", err)
+		return err
+	}
+	if data == nil {
+		return fmt.Errorf("request not found: %s", id)
+	}
+	if !leaseHeld(data, leaseOwner) {
+		return storage.ErrLeaseLost
 	}
-	defer iter.Close()
 
-	var records []*storage.RequestRecord
+	old := *data
+	oldStatus := data.Status
+	oldTs := data.CreatedAt
 
-	for iter.First(); iter.Valid(); iter.Next() {
-		id := extractIDFromStKey(iter.Key())
+	oldResponse := data.ResponsePayload
+
+	newStatus := string(types.StatusCompleted)
+	if errMsg != nil {
+		newStatus = string(types.StatusFailed)
+		data.Error = errMsg
+	} else {
+		if data.ResponsePayload, err = s.storePayload(data.Namespace, response); err != nil {
+			return err
+		}
+	}
+	data.Status = newStatus
+	data.CoalescedWith = &primaryID
+	data.LeaseOwner = nil
+	data.LeaseExpiresAt = nil
+	completedNano := unixNano(time.Now())
+	data.CompletedAt = &completedNano
+
+	value := encodeRequest(data)
+
+	batch := s.db.NewBatch()
+	defer batch.Close()
+
+	batch.Set(reqKey(id), value, nil)
+	batch.Delete(stKey(data.Namespace, oldStatus, oldTs, id), nil)
+	batch.Set(stKey(data.Namespace, newStatus, oldTs, id), nil, nil)
+	batch.Merge(countKey(data.Namespace, oldStatus), encodeInt64(-1), nil)
+	batch.Merge(countKey(data.Namespace, newStatus), encodeInt64(1), nil)
+	mergePayloadSizes(batch, data.Namespace, -1, oldResponse)
+	mergePayloadSizes(batch, data.Namespace, 1, data.ResponsePayload)
+	setDoneKey(batch, &old, data)
+	released := setBlobKeys(batch, &old, data)
+
+	if err := batch.Commit(pebble.Sync); err != nil {
+		return err
+	}
+	s.releaseBlobs(released)
+	return nil
+}
+
+func (s *PebbleStore) UpdateRequestError(ctx context.Context, id, leaseOwner string, errMsg string) error {
+	s.reqMu.Lock()
+	defer s.reqMu.Unlock()
+
+	data, err := s.getRequestData(id)
+	if err != nil {
+		return err
+	}
+	if data == nil {
+		return fmt.Errorf("request not found: %s", id)
+	}
+	if !leaseHeld(data, leaseOwner) {
+		return storage.ErrLeaseLost
+	}
+
+	old := *data
+	oldStatus := data.Status
+	oldTs := data.CreatedAt
+
+	data.Status = string(types.StatusFailed)
+	data.Error = &errMsg
+	data.LeaseOwner = nil
+	data.LeaseExpiresAt = nil
+	completedNano := unixNano(time.Now())
+	data.CompletedAt = &completedNano
+
+	value := encodeRequest(data)
+
+	batch := s.db.NewBatch()
+	defer batch.Close()
+
+	batch.Set(reqKey(id), value, nil)
+	batch.Delete(stKey(data.Namespace, oldStatus, oldTs, id), nil)
+	batch.Set(stKey(data.Namespace, string(types.StatusFailed), oldTs, id), nil, nil)
+	batch.Merge(countKey(data.Namespace, oldStatus), encodeInt64(-1), nil)
+	batch.Merge(countKey(data.Namespace, string(types.StatusFailed)), encodeInt64(1), nil)
+	setDoneKey(batch, &old, data)
+
+	return batch.Commit(pebble.Sync)
+}
+
+func (s *PebbleStore) GetQueuedRequests(ctx context.Context, namespace string) ([]*storage.RequestRecord, error) {
+	prefix := stPrefix(namespace, string(types.StatusQueued))
+	iter, err := s.db.NewIter(&pebble.IterOptions{
+		LowerBound: prefix,
+		UpperBound: upperBound(prefix),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create iterator: %w", err)
+	}
+	defer iter.Close()
+
+	var records []*storage.RequestRecord
+
+	for iter.First(); iter.Valid(); iter.Next() {
+		id := extractIDFromStKey(iter.Key())
 		if id != "" {
 			data, err := s.getRequestData(id)
 			if err != nil {
 				return nil, err
 			}
 			if data != nil {
-				records = append(records, toRequestRecord(data))
+				record, err := s.toRequestRecord(data)
+				if err != nil {
+					return nil, err
+				}
+				records = append(records, record)
 			}
 		}
 	}
@@ -586,6 +1208,427 @@ func (s *PebbleStore) GetQueuedRequests(ctx context.Context, namespace string) (
 	return records, nil
 }
 
+func (s *PebbleStore) ExportRequests(ctx context.Context, afterID string, limit int) ([]*storage.RequestRecord, error) {
+	prefix := []byte(prefixReq)
+	lower := prefix
+	if afterID != "" {
+		// The smallest key after req:{afterID}
+		lower = append(reqKey(afterID), 0)
+	}
+
+	iter, err := s.db.NewIter(&pebble.IterOptions{
+		LowerBound: lower,
+		UpperBound: upperBound(prefix),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create iterator: %w", err)
+	}
+	defer iter.Close()
+
+	var records []*storage.RequestRecord
+	for iter.First(); iter.Valid() && len(records) < limit; iter.Next() {
+		var data requestData
+		if err := decodeRequest(iter.Value(), &data); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal request: %w", err)
+		}
+		record, err := s.toRequestRecord(&data)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+func (s *PebbleStore) ListFinishedRequests(ctx context.Context, namespace string, status types.RequestStatus, since, until time.Time, afterID string, limit int) ([]*storage.RequestRecord, error) {
+	lower := doneKey(namespace, string(status), unixNano(since), afterID)
+	if afterID != "" {
+		// The smallest key after that of afterID
+		lower = append(lower, 0)
+	}
+
+	iter, err := s.db.NewIter(&pebble.IterOptions{
+		LowerBound: lower,
+		UpperBound: doneKey(namespace, string(status), unixNano(until), ""),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create iterator: %w", err)
+	}
+	defer iter.Close()
+
+	var records []*storage.RequestRecord
+	for iter.First(); iter.Valid() && len(records) < limit; iter.Next() {
+		data, err := s.getRequestData(extractIDFromStKey(iter.Key()))
+		if err != nil {
+			return nil, err
+		}
+		if data == nil {
+			continue
+		}
+		record, err := s.toRequestRecord(data)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+func (s *PebbleStore) ImportRequest(ctx context.Context, req *storage.RequestRecord) error {
+	data := fromRequestRecord(req)
+	var err error
+	if data.RequestPayload, err = s.storePayload(data.Namespace, data.RequestPayload); err != nil {
+		return err
+	}
+	if data.ResponsePayload, err = s.storePayload(data.Namespace, data.ResponsePayload); err != nil {
+		return err
+	}
+
+	value := encodeRequest(data)
+
+	s.reqMu.Lock()
+	defer s.reqMu.Unlock()
+
+	existing, err := s.getRequestData(req.ID)
+	if err != nil {
+		return err
+	}
+
+	batch := s.db.NewBatch()
+	defer batch.Close()
+
+	if existing != nil {
+		batch.Delete(stKey(existing.Namespace, existing.Status, existing.CreatedAt, existing.ID), nil)
+		batch.Merge(countKey(existing.Namespace, existing.Status), encodeInt64(-1), nil)
+		mergeUsage(batch, existing, -1)
+		mergePayloadSizes(batch, existing.Namespace, -1, existing.RequestPayload, existing.ResponsePayload)
+	}
+
+	batch.Set(reqKey(data.ID), value, nil)
+	batch.Set(stKey(data.Namespace, data.Status, data.CreatedAt, data.ID), nil, nil)
+	batch.Merge(countKey(data.Namespace, data.Status), encodeInt64(1), nil)
+	mergeUsage(batch, data, 1)
+	mergePayloadSizes(batch, data.Namespace, 1, data.RequestPayload, data.ResponsePayload)
+	setDoneKey(batch, existing, data)
+	released := setBlobKeys(batch, existing, data)
+
+	if err := batch.Commit(pebble.Sync); err != nil {
+		return err
+	}
+	s.releaseBlobs(released)
+	return nil
+}
+
+// mergeUsage adds sign times the usage recorded on data to its namespace
+// counters.
+func mergeUsage(batch *pebble.Batch, data *requestData, sign int64) {
+	batch.Merge(usageKey(data.Namespace, usagePromptTokens), encodeInt64(sign*data.PromptTokens), nil)
+	batch.Merge(usageKey(data.Namespace, usageCompletionTokens), encodeInt64(sign*data.CompletionTokens), nil)
+	batch.Merge(usageKey(data.Namespace, usageCachedTokens), encodeInt64(sign*data.CachedTokens), nil)
+	batch.Merge(usageKey(data.Namespace, usageReasoningTokens), encodeInt64(sign*data.ReasoningTokens), nil)
+	batch.Merge(usageKey(data.Namespace, usageCostNanoUSD), encodeInt64(sign*int64(math.Round(data.CostUSD*1e9))), nil)
+}
+
+// mergePayloadSizes adds sign times the uncompressed and stored sizes of
+// the stored payloads values to the namespace counters. An offloaded
+// payload counts its reference as stored, since the blob may be shared.
+func mergePayloadSizes(batch *pebble.Batch, namespace string, sign int64, values ...[]byte) {
+	rawSize, storedSize := payloadSizes(values...)
+	if rawSize == 0 && storedSize == 0 {
+		return
+	}
+	batch.Merge(usageKey(namespace, usagePayloadBytes), encodeInt64(sign*rawSize), nil)
+	batch.Merge(usageKey(namespace, usageStoredPayloadBytes), encodeInt64(sign*storedSize), nil)
+}
+
+func payloadSizes(values ...[]byte) (rawSize, storedSize int64) {
+	for _, v := range values {
+		if ref, ok := blob.ParseRef(v); ok {
+			rawSize += ref.Size
+		} else {
+			rawSize += compression.RawSize(v)
+		}
+		storedSize += int64(len(v))
+	}
+	return rawSize, storedSize
+}
+
+func (s *PebbleStore) PurgeRequests(ctx context.Context, namespace string, status types.RequestStatus, before time.Time, limit int) (int, error) {
+	// The completion index is ordered by completion time, so the requests to
+	// purge are the first entries below before
+	prefix := donePrefix(namespace, string(status))
+	iter, err := s.db.NewIter(&pebble.IterOptions{
+		LowerBound: prefix,
+		UpperBound: doneKey(namespace, string(status), unixNano(before), ""),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to create iterator: %w", err)
+	}
+
+	var ids []string
+	for iter.First(); iter.Valid() && len(ids) < limit; iter.Next() {
+		if id := extractIDFromStKey(iter.Key()); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	if err := iter.Close(); err != nil {
+		return 0, fmt.Errorf("failed to iterate completion index: %w", err)
+	}
+
+	return s.deleteRequests(ids)
+}
+
+func (s *PebbleStore) DeleteRequests(ctx context.Context, ids []string) (int, error) {
+	return s.deleteRequests(ids)
+}
+
+// deleteRequests deletes the requests with ids along with their index
+// entries, counters and blob references, and returns how many existed.
+func (s *PebbleStore) deleteRequests(ids []string) (int, error) {
+	s.reqMu.Lock()
+	defer s.reqMu.Unlock()
+
+	batch := s.db.NewBatch()
+	defer batch.Close()
+
+	var released []string
+	deleted := 0
+	for _, id := range ids {
+		data, err := s.getRequestData(id)
+		if err != nil {
+			return 0, err
+		}
+		if data == nil {
+			continue
+		}
+
+		batch.Delete(reqKey(id), nil)
+		batch.Delete(stKey(data.Namespace, data.Status, data.CreatedAt, id), nil)
+		batch.Merge(countKey(data.Namespace, data.Status), encodeInt64(-1), nil)
+		mergeUsage(batch, data, -1)
+		mergePayloadSizes(batch, data.Namespace, -1, data.RequestPayload, data.ResponsePayload)
+		setDoneKey(batch, data, nil)
+		released = append(released, setBlobKeys(batch, data, nil)...)
+		deleted++
+	}
+
+	if err := batch.Commit(pebble.Sync); err != nil {
+		return 0, fmt.Errorf("failed to commit batch: %w", err)
+	}
+
+	s.releaseBlobs(released)
+
+	return deleted, nil
+}
+
+func (s *PebbleStore) ClaimQueuedRequests(ctx context.Context, namespace string, n int, leaseOwner string, leaseUntil time.Time) ([]*storage.RequestRecord, error) {
+	s.reqMu.Lock()
+	defer s.reqMu.Unlock()
+
+	// An indexed batch reads its own writes, so each request is checked
+	// against the claim state built up so far
+	batch := s.db.NewIndexedBatch()
+	defer batch.Close()
+
+	prefix := stPrefix(namespace, string(types.StatusQueued))
+	iter, err := batch.NewIter(&pebble.IterOptions{
+		LowerBound: prefix,
+		UpperBound: upperBound(prefix),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create iterator: %w", err)
+	}
+
+	var ids []string
+	for iter.First(); iter.Valid() && len(ids) < n; iter.Next() {
+		if id := extractIDFromStKey(iter.Key()); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	if err := iter.Close(); err != nil {
+		return nil, fmt.Errorf("failed to scan queued requests: %w", err)
+	}
+
+	dispatchedNano := unixNano(time.Now())
+	leaseNano := unixNano(leaseUntil)
+	records := make([]*storage.RequestRecord, 0, len(ids))
+
+	for _, id := range ids {
+		data, err := readRequestData(batch, id)
+		if err != nil {
+			return nil, err
+		}
+		// Skip index entries that no longer match the request
+		if data == nil || data.Status != string(types.StatusQueued) {
+			continue
+		}
+
+		data.Status = string(types.StatusProcessing)
+		data.DispatchedAt = &dispatchedNano
+		data.LeaseOwner = &leaseOwner
+		data.LeaseExpiresAt = &leaseNano
+		data.Attempts++
+
+		value := encodeRequest(data)
+
+		batch.Set(reqKey(id), value, nil)
+		batch.Delete(stKey(namespace, string(types.StatusQueued), data.CreatedAt, id), nil)
+		batch.Set(stKey(namespace, string(types.StatusProcessing), data.CreatedAt, id), nil, nil)
+		batch.Merge(countKey(namespace, string(types.StatusQueued)), encodeInt64(-1), nil)
+		batch.Merge(countKey(namespace, string(types.StatusProcessing)), encodeInt64(1), nil)
+
+		record, err := s.toRequestRecord(data)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+
+	if len(records) == 0 {
+		return nil, nil
+	}
+	if err := batch.Commit(pebble.Sync); err != nil {
+		return nil, fmt.Errorf("failed to commit claim: %w", err)
+	}
+
+	return records, nil
+}
+
+func (s *PebbleStore) ReleaseRequest(ctx context.Context, id, leaseOwner string) error {
+	s.reqMu.Lock()
+	defer s.reqMu.Unlock()
+
+	data, err := s.getRequestData(id)
+	if err != nil {
+		return err
+	}
+	if data == nil {
+		return fmt.Errorf("request not found: %s", id)
+	}
+	if data.Status != string(types.StatusProcessing) || !leaseHeld(data, leaseOwner) {
+		return nil
+	}
+
+	oldTs := data.CreatedAt
+
+	data.Status = string(types.StatusQueued)
+	data.DispatchedAt = nil
+	data.LeaseOwner = nil
+	data.LeaseExpiresAt = nil
+	if data.Attempts > 0 {
+		data.Attempts--
+	}
+
+	value := encodeRequest(data)
+
+	batch := s.db.NewBatch()
+	defer batch.Close()
+
+	batch.Set(reqKey(id), value, nil)
+	batch.Delete(stKey(data.Namespace, string(types.StatusProcessing), oldTs, id), nil)
+	batch.Set(stKey(data.Namespace, string(types.StatusQueued), oldTs, id), nil, nil)
+	batch.Merge(countKey(data.Namespace, string(types.StatusProcessing)), encodeInt64(-1), nil)
+	batch.Merge(countKey(data.Namespace, string(types.StatusQueued)), encodeInt64(1), nil)
+
+	return batch.Commit(pebble.Sync)
+}
+
+func (s *PebbleStore) RecoverExpiredLeases(ctx context.Context, owner string, now time.Time, maxAttempts int) (int, int, error) {
+	namespaces, err := s.ListNamespaces(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	s.reqMu.Lock()
+	defer s.reqMu.Unlock()
+
+	batch := s.db.NewBatch()
+	defer batch.Close()
+
+	requeued, failed := 0, 0
+	nowNano := unixNano(now)
+
+	for _, ns := range namespaces {
+		ids, err := s.scanStatusIDs(ns.Name, string(types.StatusProcessing))
+		if err != nil {
+			return 0, 0, err
+		}
+
+		for _, id := range ids {
+			data, err := s.getRequestData(id)
+			if err != nil {
+				return 0, 0, err
+			}
+			if data == nil {
+				continue
+			}
+
+			expired := data.LeaseExpiresAt == nil || *data.LeaseExpiresAt < nowNano
+			owned := owner != "" && data.LeaseOwner != nil && *data.LeaseOwner == owner
+			if !expired && !owned {
+				continue
+			}
+
+			oldStatus := data.Status
+			data.LeaseOwner = nil
+			data.LeaseExpiresAt = nil
+			if data.Attempts >= maxAttempts {
+				data.Status = string(types.StatusFailed)
+				errMsg := storage.MaxAttemptsError
+				data.Error = &errMsg
+				data.CompletedAt = &nowNano
+				failed++
+			} else {
+				data.Status = string(types.StatusQueued)
+				data.DispatchedAt = nil
+				requeued++
+			}
+
+			value := encodeRequest(data)
+
+			batch.Set(reqKey(id), value, nil)
+			batch.Delete(stKey(data.Namespace, oldStatus, data.CreatedAt, id), nil)
+			batch.Set(stKey(data.Namespace, data.Status, data.CreatedAt, id), nil, nil)
+			batch.Merge(countKey(data.Namespace, oldStatus), encodeInt64(-1), nil)
+			batch.Merge(countKey(data.Namespace, data.Status), encodeInt64(1), nil)
+			setDoneKey(batch, nil, data)
+		}
+	}
+
+	if batch.Empty() {
+		return 0, 0, nil
+	}
+	if err := batch.Commit(pebble.Sync); err != nil {
+		return 0, 0, err
+	}
+
+	return requeued, failed, nil
+}
+
+// scanStatusIDs returns the IDs of a namespace's requests in status, oldest
+// first.
+func (s *PebbleStore) scanStatusIDs(namespace, status string) ([]string, error) {
+	prefix := stPrefix(namespace, status)
+	iter, err := s.db.NewIter(&pebble.IterOptions{
+		LowerBound: prefix,
+		UpperBound: upperBound(prefix),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create iterator: %w", err)
+	}
+	defer iter.Close()
+
+	var ids []string
+	for iter.First(); iter.Valid(); iter.Next() {
+		if id := extractIDFromStKey(iter.Key()); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids, iter.Error()
+}
+
 // --- Conversion helpers ---
 
 func toNamespaceRecord(data *namespaceData) *storage.NamespaceRecord {
@@ -596,25 +1639,56 @@ func toNamespaceRecord(data *namespaceData) *storage.NamespaceRecord {
 		ProviderAPIKey:   data.ProviderAPIKey,
 		ProviderModel:    data.ProviderModel,
 		ProviderHeaders:  data.ProviderHeaders,
+		ProviderType:     types.ProviderType(data.ProviderType),
+		ProviderAWS:      data.ProviderAWS,
+		URLTemplate:      data.URLTemplate,
+		QueryParams:      data.QueryParams,
+		Budget:           data.Budget,
+		Cache:            data.Cache,
+		Retention:        data.Retention,
 		CreatedAt:        time.Unix(0, data.CreatedAt),
 		UpdatedAt:        time.Unix(0, data.UpdatedAt),
 	}
 }
 
-func toRequestRecord(data *requestData) *storage.RequestRecord {
+func (s *PebbleStore) toRequestRecord(data *requestData) (*storage.RequestRecord, error) {
+	payload, err := s.loadPayload(data.RequestPayload)
+	if err != nil {
+		return nil, fmt.Errorf("request %s: %w", data.ID, err)
+	}
+	response, err := s.loadPayload(data.ResponsePayload)
+	if err != nil {
+		return nil, fmt.Errorf("request %s: %w", data.ID, err)
+	}
+
 	record := &storage.RequestRecord{
 		ID:                 data.ID,
 		Namespace:          data.Namespace,
 		Status:             types.RequestStatus(data.Status),
-		RequestPayload:     data.RequestPayload,
+		RequestPayload:     payload,
 		PassthroughHeaders: data.PassthroughHeaders,
 		HeaderEndpoint:     data.HeaderEndpoint,
 		HeaderAPIKey:       data.HeaderAPIKey,
-		ResponsePayload:    data.ResponsePayload,
-		Error:              data.Error,
-		CreatedAt:          time.Unix(0, data.CreatedAt),
+		ResponsePayload:    response,
+		Usage: storage.Usage{
+			PromptTokens:     data.PromptTokens,
+			CompletionTokens: data.CompletionTokens,
+			CachedTokens:     data.CachedTokens,
+			ReasoningTokens:  data.ReasoningTokens,
+			CostUSD:          data.CostUSD,
+		},
+		CacheHit:      data.CacheHit,
+		CoalescedWith: data.CoalescedWith,
+		Error:         data.Error,
+		CreatedAt:     time.Unix(0, data.CreatedAt),
+		LeaseOwner:    data.LeaseOwner,
+		Attempts:      data.Attempts,
 	}
 
+	if data.LeaseExpiresAt != nil {
+		t := time.Unix(0, *data.LeaseExpiresAt)
+		record.LeaseExpiresAt = &t
+	}
 	if data.DispatchedAt != nil {
 		t := time.Unix(0, *data.DispatchedAt)
 		record.DispatchedAt = &t
@@ -624,7 +1698,57 @@ func toRequestRecord(data *requestData) *storage.RequestRecord {
 		record.CompletedAt = &t
 	}
 
-	return record
+	return record, nil
+}
+
+// fromRequestRecord converts a record to its stored form; payloads are copied as given.
+func fromRequestRecord(req *storage.RequestRecord) *requestData {
+	data := &requestData{
+		ID:                 req.ID,
+		Namespace:          req.Namespace,
+		Status:             string(req.Status),
+		RequestPayload:     req.RequestPayload,
+		PassthroughHeaders: req.PassthroughHeaders,
+		HeaderEndpoint:     req.HeaderEndpoint,
+		HeaderAPIKey:       req.HeaderAPIKey,
+		ResponsePayload:    req.ResponsePayload,
+		PromptTokens:       req.Usage.PromptTokens,
+		CompletionTokens:   req.Usage.CompletionTokens,
+		CachedTokens:       req.Usage.CachedTokens,
+		ReasoningTokens:    req.Usage.ReasoningTokens,
+		CostUSD:            req.Usage.CostUSD,
+		CacheHit:           req.CacheHit,
+		CoalescedWith:      req.CoalescedWith,
+		Error:              req.Error,
+		CreatedAt:          unixNano(req.CreatedAt),
+		LeaseOwner:         req.LeaseOwner,
+		Attempts:           req.Attempts,
+	}
+
+	if req.DispatchedAt != nil {
+		t := unixNano(*req.DispatchedAt)
+		data.DispatchedAt = &t
+	}
+	if req.CompletedAt != nil {
+		t := unixNano(*req.CompletedAt)
+		data.CompletedAt = &t
+	}
+	if req.LeaseExpiresAt != nil {
+		t := unixNano(*req.LeaseExpiresAt)
+		data.LeaseExpiresAt = &t
+	}
+
+	return data
+}
+
+// leaseHeld reports whether a write on behalf of leaseOwner may change
+// data: always for an empty leaseOwner, and otherwise only while data is
+// processing under leaseOwner.
+func leaseHeld(data *requestData, leaseOwner string) bool {
+	if leaseOwner == "" {
+		return true
+	}
+	return data.Status == string(types.StatusProcessing) && data.LeaseOwner != nil && *data.LeaseOwner == leaseOwner
 }
 
 // extractIDFromStKey extracts the request ID from a status key
@@ -0,0 +1,83 @@
+package pebbledb
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/georgeshao/ai-inference-dam/internal/storage"
+	"github.com/georgeshao/ai-inference-dam/internal/storage/blob"
+	"github.com/georgeshao/ai-inference-dam/internal/storage/compression"
+	"github.com/georgeshao/ai-inference-dam/internal/storage/storagetest"
+)
+
+// The suite reads its own writes, so it runs without the asynchronous
+// BatchWriter.
+func TestStore(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Store {
+		store, err := New(filepath.Join(t.TempDir(), "test.db"), false)
+		if err != nil {
+			t.Fatalf("Failed to create store: %v", err)
+		}
+		t.Cleanup(func() {
+			if err := store.Close(); err != nil {
+				t.Logf("Failed to close store: %v", err)
+			}
+		})
+		return store
+	})
+}
+
+func TestStoreCompressed(t *testing.T) {
+	opts := WithCompression(compression.Options{Enabled: true, MinSize: 1})
+	storagetest.Run(t, func(t *testing.T) storage.Store {
+		store, err := New(filepath.Join(t.TempDir(), "test.db"), false, opts)
+		if err != nil {
+			t.Fatalf("Failed to create store: %v", err)
+		}
+		t.Cleanup(func() {
+			if err := store.Close(); err != nil {
+				t.Logf("Failed to close store: %v", err)
+			}
+		})
+		return store
+	})
+}
+
+func TestCompression(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	storagetest.RunCompression(t, func(t *testing.T) storage.Store {
+		store, err := New(path, false, WithCompression(compression.Options{Enabled: true}))
+		if err != nil {
+			t.Fatalf("Failed to open store: %v", err)
+		}
+		return store
+	})
+}
+
+func TestStoreBlobs(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Store {
+		opts := WithBlobs(blob.Options{Dir: t.TempDir(), Threshold: 1, GracePeriod: time.Nanosecond})
+		store, err := New(filepath.Join(t.TempDir(), "test.db"), false, opts)
+		if err != nil {
+			t.Fatalf("Failed to create store: %v", err)
+		}
+		t.Cleanup(func() {
+			if err := store.Close(); err != nil {
+				t.Logf("Failed to close store: %v", err)
+			}
+		})
+		return store
+	})
+}
+
+func TestBlobs(t *testing.T) {
+	storagetest.RunBlobs(t, func(t *testing.T, opts blob.Options) storage.Store {
+		store, err := New(filepath.Join(t.TempDir(), "test.db"), false, WithBlobs(opts))
+		if err != nil {
+			t.Fatalf("Failed to create store: %v", err)
+		}
+		t.Cleanup(func() { store.Close() })
+		return store
+	})
+}
@@ -0,0 +1,891 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/sqlc-dev/pqtype"
+
+	"github.com/georgeshao/ai-inference-dam/internal/storage"
+	"github.com/georgeshao/ai-inference-dam/internal/storage/postgres/sqlc"
+	"github.com/georgeshao/ai-inference-dam/pkg/types"
+)
+
+//go:embed schema.sql
+var schemaSQL string
+
+type PostgresStore struct {
+	db      *sql.DB
+	queries *sqlc.Queries
+}
+
+func New(dsn string) (*PostgresStore, error) {
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	// Set connection pool settings
+	db.SetMaxOpenConns(25)
+	db.SetMaxIdleConns(5)
+	db.SetConnMaxLifetime(time.Hour)
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	store := &PostgresStore{
+		db:      db,
+		queries: sqlc.New(db),
+	}
+
+	if err := store.initSchema(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize schema: %w", err)
+	}
+
+	return store, nil
+}
+
+// schemaLockID keys the advisory lock that serializes schema setup when
+// several instances start against the same database at once.
+const schemaLockID = 0x64616d
+
+func (s *PostgresStore) initSchema() error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1)", schemaLockID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(schemaSQL); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *PostgresStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *PostgresStore) CreateNamespace(ctx context.Context, ns *storage.NamespaceRecord) error {
+	headers, err := json.Marshal(ns.ProviderHeaders)
+	if err != nil {
+		return fmt.Errorf("failed to marshal headers: %w", err)
+	}
+
+	aws, err := json.Marshal(ns.ProviderAWS)
+	if err != nil {
+		return fmt.Errorf("failed to marshal aws credentials: %w", err)
+	}
+
+	queryParams, err := json.Marshal(ns.QueryParams)
+	if err != nil {
+		return fmt.Errorf("failed to marshal query params: %w", err)
+	}
+
+	budget, err := json.Marshal(ns.Budget)
+	if err != nil {
+		return fmt.Errorf("failed to marshal budget: %w", err)
+	}
+
+	cacheConfig, err := json.Marshal(ns.Cache)
+	if err != nil {
+		return fmt.Errorf("failed to marshal cache config: %w", err)
+	}
+
+	retention, err := json.Marshal(ns.Retention)
+	if err != nil {
+		return fmt.Errorf("failed to marshal retention policy: %w", err)
+	}
+
+	return s.queries.CreateNamespace(ctx, sqlc.CreateNamespaceParams{
+		Name:             ns.Name,
+		Description:      ns.Description,
+		ProviderEndpoint: toNullString(ns.ProviderEndpoint),
+		ProviderApiKey:   toNullString(ns.ProviderAPIKey),
+		ProviderModel:    toNullString(ns.ProviderModel),
+		ProviderHeaders:  pqtype.NullRawMessage{RawMessage: headers, Valid: len(ns.ProviderHeaders) > 0},
+		ProviderType:     string(ns.ProviderType),
+		ProviderAws:      pqtype.NullRawMessage{RawMessage: aws, Valid: ns.ProviderAWS != nil},
+		UrlTemplate:      toNullString(ns.URLTemplate),
+		QueryParams:      pqtype.NullRawMessage{RawMessage: queryParams, Valid: len(ns.QueryParams) > 0},
+		Budget:           pqtype.NullRawMessage{RawMessage: budget, Valid: ns.Budget != nil},
+		CacheConfig:      pqtype.NullRawMessage{RawMessage: cacheConfig, Valid: ns.Cache != nil},
+		Retention:        pqtype.NullRawMessage{RawMessage: retention, Valid: ns.Retention != nil},
+		CreatedAt:        ns.CreatedAt.Unix(),
+		UpdatedAt:        ns.UpdatedAt.Unix(),
+	})
+}
+
+func (s *PostgresStore) GetNamespace(ctx context.Context, name string) (*storage.NamespaceRecord, error) {
+	ns, err := s.queries.GetNamespace(ctx, name)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get namespace: %w", err)
+	}
+
+	return sqlcNamespaceToRecord(&ns)
+}
+
+func (s *PostgresStore) UpdateNamespace(ctx context.Context, name string, ns *storage.NamespaceRecord) error {
+	headers, err := json.Marshal(ns.ProviderHeaders)
+	if err != nil {
+		return fmt.Errorf("failed to marshal headers: %w", err)
+	}
+
+	aws, err := json.Marshal(ns.ProviderAWS)
+	if err != nil {
+		return fmt.Errorf("failed to marshal aws credentials: %w", err)
+	}
+
+	queryParams, err := json.Marshal(ns.QueryParams)
+	if err != nil {
+		return fmt.Errorf("failed to marshal query params: %w", err)
+	}
+
+	budget, err := json.Marshal(ns.Budget)
+	if err != nil {
+		return fmt.Errorf("failed to marshal budget: %w", err)
+	}
+
+	cacheConfig, err := json.Marshal(ns.Cache)
+	if err != nil {
+		return fmt.Errorf("failed to marshal cache config: %w", err)
+	}
+
+	retention, err := json.Marshal(ns.Retention)
+	if err != nil {
+		return fmt.Errorf("failed to marshal retention policy: %w", err)
+	}
+
+	return s.queries.UpdateNamespace(ctx, sqlc.UpdateNamespaceParams{
+		Name:             name,
+		Description:      ns.Description,
+		ProviderEndpoint: toNullString(ns.ProviderEndpoint),
+		ProviderApiKey:   toNullString(ns.ProviderAPIKey),
+		ProviderModel:    toNullString(ns.ProviderModel),
+		ProviderHeaders:  pqtype.NullRawMessage{RawMessage: headers, Valid: len(ns.ProviderHeaders) > 0},
+		ProviderType:     string(ns.ProviderType),
+		ProviderAws:      pqtype.NullRawMessage{RawMessage: aws, Valid: ns.ProviderAWS != nil},
+		UrlTemplate:      toNullString(ns.URLTemplate),
+		QueryParams:      pqtype.NullRawMessage{RawMessage: queryParams, Valid: len(ns.QueryParams) > 0},
+		Budget:           pqtype.NullRawMessage{RawMessage: budget, Valid: ns.Budget != nil},
+		CacheConfig:      pqtype.NullRawMessage{RawMessage: cacheConfig, Valid: ns.Cache != nil},
+		Retention:        pqtype.NullRawMessage{RawMessage: retention, Valid: ns.Retention != nil},
+		UpdatedAt:        ns.UpdatedAt.Unix(),
+	})
+}
+
+func (s *PostgresStore) DeleteNamespace(ctx context.Context, name string) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	qtx := s.queries.WithTx(tx)
+
+	deletedRequests, err := qtx.DeleteRequestsByNamespace(ctx, name)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete requests: %w", err)
+	}
+
+	if err := qtx.DeleteBudgetSpend(ctx, name); err != nil {
+		return 0, fmt.Errorf("failed to delete budget spend: %w", err)
+	}
+
+	if err := qtx.DeleteCachedResponsesByNamespace(ctx, name); err != nil {
+		return 0, fmt.Errorf("failed to delete cached responses: %w", err)
+	}
+
+	if err := qtx.DeleteCacheStats(ctx, name); err != nil {
+		return 0, fmt.Errorf("failed to delete cache stats: %w", err)
+	}
+
+	if err := qtx.DeleteDispatchLease(ctx, name); err != nil {
+		return 0, fmt.Errorf("failed to delete dispatch lease: %w", err)
+	}
+
+	if err := qtx.DeleteNamespace(ctx, name); err != nil {
+		return 0, fmt.Errorf("failed to delete namespace: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return int(deletedRequests), nil
+}
+
+func (s *PostgresStore) ListNamespaces(ctx context.Context) ([]*storage.NamespaceRecord, error) {
+	namespaces, err := s.queries.ListNamespaces(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list namespaces: %w", err)
+	}
+
+	records := make([]*storage.NamespaceRecord, len(namespaces))
+	for i, ns := range namespaces {
+		record, err := sqlcNamespaceToRecord(&ns)
+		if err != nil {
+			return nil, err
+		}
+		records[i] = record
+	}
+
+	return records, nil
+}
+
+func (s *PostgresStore) GetNamespaceStats(ctx context.Context, name string) (*types.NamespaceStats, error) {
+	stats, err := s.queries.GetNamespaceStats(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get namespace stats: %w", err)
+	}
+
+	cacheStats, err := s.queries.GetCacheStats(ctx, name)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to get cache stats: %w", err)
+	}
+
+	return &types.NamespaceStats{
+		TotalRequests: int(stats.TotalRequests),
+		Queued:        int(stats.Queued),
+		Processing:    int(stats.Processing),
+		Completed:     int(stats.Completed),
+		Failed:        int(stats.Failed),
+
+		PromptTokens:     stats.PromptTokens,
+		CompletionTokens: stats.CompletionTokens,
+		CachedTokens:     stats.CachedTokens,
+		ReasoningTokens:  stats.ReasoningTokens,
+		CostUSD:          stats.CostUsd,
+
+		CacheHits:   cacheStats.Hits,
+		CacheMisses: cacheStats.Misses,
+	}, nil
+}
+
+func (s *PostgresStore) GetBudgetSpend(ctx context.Context, namespace, periodKey string) (*storage.BudgetSpend, error) {
+	row, err := s.queries.GetBudgetSpend(ctx, namespace)
+	if err == sql.ErrNoRows || (err == nil && row.PeriodKey != periodKey) {
+		return &storage.BudgetSpend{PeriodKey: periodKey}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get budget spend: %w", err)
+	}
+
+	spend := &storage.BudgetSpend{
+		PeriodKey:   row.PeriodKey,
+		SpentUSD:    row.SpentUsd,
+		SpentTokens: row.SpentTokens,
+	}
+	if row.ExhaustedAt.Valid {
+		exhaustedAt := time.Unix(row.ExhaustedAt.Int64, 0)
+		spend.ExhaustedAt = &exhaustedAt
+	}
+	return spend, nil
+}
+
+func (s *PostgresStore) AddBudgetSpend(ctx context.Context, namespace, periodKey string, costUSD float64, tokens int64) error {
+	return s.queries.AddBudgetSpend(ctx, sqlc.AddBudgetSpendParams{
+		Namespace:   namespace,
+		PeriodKey:   periodKey,
+		SpentUsd:    costUSD,
+		SpentTokens: tokens,
+	})
+}
+
+func (s *PostgresStore) SetBudgetExhausted(ctx context.Context, namespace, periodKey string, exhaustedAt *time.Time) error {
+	params := sqlc.SetBudgetExhaustedParams{
+		Namespace: namespace,
+		PeriodKey: periodKey,
+	}
+	if exhaustedAt != nil {
+		params.ExhaustedAt = sql.NullInt64{Int64: exhaustedAt.Unix(), Valid: true}
+	}
+	return s.queries.SetBudgetExhausted(ctx, params)
+}
+
+func (s *PostgresStore) ResetBudget(ctx context.Context, namespace string) error {
+	return s.queries.DeleteBudgetSpend(ctx, namespace)
+}
+
+func (s *PostgresStore) GetCachedResponse(ctx context.Context, namespace, key string) (*storage.CacheEntry, error) {
+	row, err := s.queries.GetCachedResponse(ctx, sqlc.GetCachedResponseParams{
+		Namespace: namespace,
+		CacheKey:  key,
+		ExpiresAt: time.Now().Unix(),
+	})
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cached response: %w", err)
+	}
+
+	entry := &storage.CacheEntry{
+		Namespace: row.Namespace,
+		Key:       row.CacheKey,
+		CreatedAt: time.Unix(row.CreatedAt, 0),
+		ExpiresAt: time.Unix(row.ExpiresAt, 0),
+	}
+	entry.Response = row.ResponsePayload
+	return entry, nil
+}
+
+func (s *PostgresStore) PutCachedResponse(ctx context.Context, entry *storage.CacheEntry) error {
+	return s.queries.PutCachedResponse(ctx, sqlc.PutCachedResponseParams{
+		Namespace:       entry.Namespace,
+		CacheKey:        entry.Key,
+		ResponsePayload: entry.Response,
+		CreatedAt:       entry.CreatedAt.Unix(),
+		ExpiresAt:       entry.ExpiresAt.Unix(),
+	})
+}
+
+func (s *PostgresStore) RecordCacheLookup(ctx context.Context, namespace string, hit bool) error {
+	if hit {
+		return s.queries.RecordCacheHit(ctx, namespace)
+	}
+	return s.queries.RecordCacheMiss(ctx, namespace)
+}
+
+func (s *PostgresStore) AcquireDispatchLease(ctx context.Context, namespace, owner string, now, leaseUntil time.Time) (bool, error) {
+	acquired, err := s.queries.AcquireDispatchLease(ctx, sqlc.AcquireDispatchLeaseParams{
+		Namespace: namespace,
+		Owner:     owner,
+		ExpiresAt: leaseUntil.Unix(),
+		Now:       now.Unix(),
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire dispatch lease: %w", err)
+	}
+	return acquired > 0, nil
+}
+
+func (s *PostgresStore) ReleaseDispatchLease(ctx context.Context, namespace, owner string) error {
+	return s.queries.ReleaseDispatchLease(ctx, sqlc.ReleaseDispatchLeaseParams{
+		Namespace: namespace,
+		Owner:     owner,
+	})
+}
+
+func (s *PostgresStore) CreateRequest(ctx context.Context, req *storage.RequestRecord) error {
+	headers, err := json.Marshal(req.PassthroughHeaders)
+	if err != nil {
+		return fmt.Errorf("failed to marshal passthrough headers: %w", err)
+	}
+
+	return s.queries.CreateRequest(ctx, sqlc.CreateRequestParams{
+		ID:                 req.ID,
+		Namespace:          req.Namespace,
+		Status:             string(req.Status),
+		RequestPayload:     req.RequestPayload,
+		PassthroughHeaders: pqtype.NullRawMessage{RawMessage: headers, Valid: len(req.PassthroughHeaders) > 0},
+		HeaderEndpoint:     toNullString(req.HeaderEndpoint),
+		HeaderApiKey:       toNullString(req.HeaderAPIKey),
+		CreatedAt:          req.CreatedAt.Unix(),
+	})
+}
+
+func (s *PostgresStore) GetRequest(ctx context.Context, id string) (*storage.RequestRecord, error) {
+	req, err := s.queries.GetRequest(ctx, id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get request: %w", err)
+	}
+
+	return sqlcRequestToRecord(&req)
+}
+
+func (s *PostgresStore) ListRequests(ctx context.Context, filter storage.RequestFilter) ([]*storage.RequestRecord, int, error) {
+	limit := int32(filter.Limit)
+	if limit == 0 {
+		limit = 100 // Default limit
+	}
+
+	var requests []sqlc.Request
+	var total int64
+	var err error
+
+	if filter.Namespace == nil {
+		return nil, 0, fmt.Errorf("namespace is required")
+	}
+
+	if filter.Status != nil {
+		if filter.Cursor != nil {
+			requests, err = s.queries.ListRequestsByNamespaceAndStatusWithCursor(ctx, sqlc.ListRequestsByNamespaceAndStatusWithCursorParams{
+				Namespace: *filter.Namespace,
+				Status:    string(*filter.Status),
+				CreatedAt: filter.Cursor.Unix(),
+				CursorID:  filter.CursorID,
+				Limit:     limit,
+			})
+		} else {
+			requests, err = s.queries.ListRequestsByNamespaceAndStatus(ctx, sqlc.ListRequestsByNamespaceAndStatusParams{
+				Namespace: *filter.Namespace,
+				Status:    string(*filter.Status),
+				Limit:     limit,
+			})
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to list requests: %w", err)
+		}
+		total, err = s.queries.CountRequestsByNamespaceAndStatus(ctx, sqlc.CountRequestsByNamespaceAndStatusParams{
+			Namespace: *filter.Namespace,
+			Status:    string(*filter.Status),
+		})
+	} else {
+		if filter.Cursor != nil {
+			requests, err = s.queries.ListRequestsByNamespaceWithCursor(ctx, sqlc.ListRequestsByNamespaceWithCursorParams{
+				Namespace: *filter.Namespace,
+				CreatedAt: filter.Cursor.Unix(),
+				CursorID:  filter.CursorID,
+				Limit:     limit,
+			})
+		} else {
+			requests, err = s.queries.ListRequestsByNamespace(ctx, sqlc.ListRequestsByNamespaceParams{
+				Namespace: *filter.Namespace,
+				Limit:     limit,
+			})
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to list requests: %w", err)
+		}
+		total, err = s.queries.CountRequestsByNamespace(ctx, *filter.Namespace)
+	}
+
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count requests: %w", err)
+	}
+
+	records := make([]*storage.RequestRecord, len(requests))
+	for i, req := range requests {
+		record, err := sqlcRequestToRecord(&req)
+		if err != nil {
+			return nil, 0, err
+		}
+		records[i] = record
+	}
+
+	return records, int(total), nil
+}
+
+func (s *PostgresStore) UpdateRequestStatus(ctx context.Context, id string, status types.RequestStatus, dispatchedAt time.Time) error {
+	return s.queries.UpdateRequestStatus(ctx, sqlc.UpdateRequestStatusParams{
+		ID:           id,
+		Status:       string(status),
+		DispatchedAt: sql.NullInt64{Int64: dispatchedAt.Unix(), Valid: true},
+	})
+}
+
+func (s *PostgresStore) UpdateRequestResponse(ctx context.Context, id, leaseOwner string, response json.RawMessage, usage storage.Usage) error {
+	rows, err := s.queries.UpdateRequestResponse(ctx, sqlc.UpdateRequestResponseParams{
+		ID:               id,
+		LeaseOwner:       leaseOwner,
+		ResponsePayload:  toNullJSON(response),
+		CompletedAt:      sql.NullInt64{Int64: time.Now().Unix(), Valid: true},
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		CachedTokens:     usage.CachedTokens,
+		ReasoningTokens:  usage.ReasoningTokens,
+		CostUsd:          usage.CostUSD,
+	})
+	return checkLease(rows, err, leaseOwner)
+}
+
+func (s *PostgresStore) UpdateRequestCacheHit(ctx context.Context, id, leaseOwner string, response json.RawMessage) error {
+	rows, err := s.queries.UpdateRequestCacheHit(ctx, sqlc.UpdateRequestCacheHitParams{
+		ID:              id,
+		LeaseOwner:      leaseOwner,
+		ResponsePayload: toNullJSON(response),
+		CompletedAt:     sql.NullInt64{Int64: time.Now().Unix(), Valid: true},
+	})
+	return checkLease(rows, err, leaseOwner)
+}
+
+func (s *PostgresStore) UpdateRequestCoalesced(ctx context.Context, id, leaseOwner, primaryID string, response json.RawMessage, errMsg *string) error {
+	params := sqlc.UpdateRequestCoalescedParams{
+		ID:            id,
+		LeaseOwner:    leaseOwner,
+		Status:        string(types.StatusCompleted),
+		Error:         toNullString(errMsg),
+		CompletedAt:   sql.NullInt64{Int64: time.Now().Unix(), Valid: true},
+		CoalescedWith: sql.NullString{String: primaryID, Valid: true},
+	}
+
+	if errMsg != nil {
+		params.Status = string(types.StatusFailed)
+	} else {
+		params.ResponsePayload = toNullJSON(response)
+	}
+
+	rows, err := s.queries.UpdateRequestCoalesced(ctx, params)
+	return checkLease(rows, err, leaseOwner)
+}
+
+func (s *PostgresStore) UpdateRequestError(ctx context.Context, id, leaseOwner string, errMsg string) error {
+	rows, err := s.queries.UpdateRequestError(ctx, sqlc.UpdateRequestErrorParams{
+		ID:          id,
+		LeaseOwner:  leaseOwner,
+		Error:       sql.NullString{String: errMsg, Valid: true},
+		CompletedAt: sql.NullInt64{Int64: time.Now().Unix(), Valid: true},
+	})
+	return checkLease(rows, err, leaseOwner)
+}
+
+// checkLease turns a finishing update on behalf of a lease owner that
+// matched no row into ErrLeaseLost.
+func checkLease(rows int64, err error, leaseOwner string) error {
+	if err != nil {
+		return err
+	}
+	if rows == 0 && leaseOwner != "" {
+		return storage.ErrLeaseLost
+	}
+	return nil
+}
+
+func (s *PostgresStore) GetQueuedRequests(ctx context.Context, namespace string) ([]*storage.RequestRecord, error) {
+	requests, err := s.queries.GetQueuedRequestsByNamespace(ctx, namespace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get queued requests: %w", err)
+	}
+
+	records := make([]*storage.RequestRecord, len(requests))
+	for i, req := range requests {
+		record, err := sqlcRequestToRecord(&req)
+		if err != nil {
+			return nil, err
+		}
+		records[i] = record
+	}
+
+	return records, nil
+}
+
+func (s *PostgresStore) ExportRequests(ctx context.Context, afterID string, limit int) ([]*storage.RequestRecord, error) {
+	requests, err := s.queries.ExportRequests(ctx, sqlc.ExportRequestsParams{
+		ID:    afterID,
+		Limit: int32(limit),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export requests: %w", err)
+	}
+
+	records := make([]*storage.RequestRecord, len(requests))
+	for i, req := range requests {
+		record, err := sqlcRequestToRecord(&req)
+		if err != nil {
+			return nil, err
+		}
+		records[i] = record
+	}
+
+	return records, nil
+}
+
+func (s *PostgresStore) ListFinishedRequests(ctx context.Context, namespace string, status types.RequestStatus, since, until time.Time, afterID string, limit int) ([]*storage.RequestRecord, error) {
+	requests, err := s.queries.ListFinishedRequests(ctx, sqlc.ListFinishedRequestsParams{
+		Namespace: namespace,
+		Status:    string(status),
+		Since:     sql.NullInt64{Int64: since.Unix(), Valid: true},
+		AfterID:   afterID,
+		Until:     sql.NullInt64{Int64: until.Unix(), Valid: true},
+		Limit:     int32(limit),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list finished requests: %w", err)
+	}
+
+	records := make([]*storage.RequestRecord, len(requests))
+	for i, req := range requests {
+		record, err := sqlcRequestToRecord(&req)
+		if err != nil {
+			return nil, err
+		}
+		records[i] = record
+	}
+
+	return records, nil
+}
+
+func (s *PostgresStore) ImportRequest(ctx context.Context, req *storage.RequestRecord) error {
+	headers, err := json.Marshal(req.PassthroughHeaders)
+	if err != nil {
+		return fmt.Errorf("failed to marshal passthrough headers: %w", err)
+	}
+
+	return s.queries.ImportRequest(ctx, sqlc.ImportRequestParams{
+		ID:                 req.ID,
+		Namespace:          req.Namespace,
+		Status:             string(req.Status),
+		RequestPayload:     req.RequestPayload,
+		PassthroughHeaders: pqtype.NullRawMessage{RawMessage: headers, Valid: len(req.PassthroughHeaders) > 0},
+		HeaderEndpoint:     toNullString(req.HeaderEndpoint),
+		HeaderApiKey:       toNullString(req.HeaderAPIKey),
+		ResponsePayload:    toNullJSON(req.ResponsePayload),
+		Error:              toNullString(req.Error),
+		CreatedAt:          req.CreatedAt.Unix(),
+		DispatchedAt:       toNullUnix(req.DispatchedAt),
+		CompletedAt:        toNullUnix(req.CompletedAt),
+		PromptTokens:       req.Usage.PromptTokens,
+		CompletionTokens:   req.Usage.CompletionTokens,
+		CachedTokens:       req.Usage.CachedTokens,
+		ReasoningTokens:    req.Usage.ReasoningTokens,
+		CostUsd:            req.Usage.CostUSD,
+		CacheHit:           req.CacheHit,
+		CoalescedWith:      toNullString(req.CoalescedWith),
+		LeaseOwner:         toNullString(req.LeaseOwner),
+		LeaseExpiresAt:     toNullUnix(req.LeaseExpiresAt),
+		Attempts:           int32(req.Attempts),
+	})
+}
+
+func (s *PostgresStore) PurgeRequests(ctx context.Context, namespace string, status types.RequestStatus, before time.Time, limit int) (int, error) {
+	purged, err := s.queries.PurgeRequests(ctx, sqlc.PurgeRequestsParams{
+		Namespace:   namespace,
+		Status:      string(status),
+		CompletedAt: sql.NullInt64{Int64: before.Unix(), Valid: true},
+		Limit:       int32(limit),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge requests: %w", err)
+	}
+	return int(purged), nil
+}
+
+func (s *PostgresStore) DeleteRequests(ctx context.Context, ids []string) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	qtx := s.queries.WithTx(tx)
+	deleted := 0
+	for _, id := range ids {
+		n, err := qtx.DeleteRequest(ctx, id)
+		if err != nil {
+			return 0, fmt.Errorf("failed to delete request: %w", err)
+		}
+		deleted += int(n)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return deleted, nil
+}
+
+func (s *PostgresStore) ClaimQueuedRequests(ctx context.Context, namespace string, n int, leaseOwner string, leaseUntil time.Time) ([]*storage.RequestRecord, error) {
+	requests, err := s.queries.ClaimQueuedRequests(ctx, sqlc.ClaimQueuedRequestsParams{
+		DispatchedAt:   sql.NullInt64{Int64: time.Now().Unix(), Valid: true},
+		LeaseOwner:     sql.NullString{String: leaseOwner, Valid: true},
+		LeaseExpiresAt: sql.NullInt64{Int64: leaseUntil.Unix(), Valid: true},
+		Namespace:      namespace,
+		Limit:          int32(n),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim queued requests: %w", err)
+	}
+
+	records := make([]*storage.RequestRecord, len(requests))
+	for i, req := range requests {
+		record, err := sqlcRequestToRecord(&req)
+		if err != nil {
+			return nil, err
+		}
+		records[i] = record
+	}
+
+	// RETURNING does not preserve the subquery's order
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].CreatedAt.Before(records[j].CreatedAt)
+	})
+
+	return records, nil
+}
+
+func (s *PostgresStore) ReleaseRequest(ctx context.Context, id, leaseOwner string) error {
+	return s.queries.ReleaseRequest(ctx, sqlc.ReleaseRequestParams{ID: id, LeaseOwner: leaseOwner})
+}
+
+func (s *PostgresStore) RecoverExpiredLeases(ctx context.Context, owner string, now time.Time, maxAttempts int) (int, int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	qtx := s.queries.WithTx(tx)
+	ownerParam := sql.NullString{String: owner, Valid: owner != ""}
+	nowParam := sql.NullInt64{Int64: now.Unix(), Valid: true}
+
+	failed, err := qtx.FailExpiredLeases(ctx, sqlc.FailExpiredLeasesParams{
+		Error:       sql.NullString{String: storage.MaxAttemptsError, Valid: true},
+		Now:         nowParam,
+		Owner:       ownerParam,
+		MaxAttempts: int32(maxAttempts),
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to fail expired leases: %w", err)
+	}
+
+	requeued, err := qtx.RequeueExpiredLeases(ctx, sqlc.RequeueExpiredLeasesParams{
+		Now:   nowParam,
+		Owner: ownerParam,
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to requeue expired leases: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return int(requeued), int(failed), nil
+}
+
+func toNullString(s *string) sql.NullString {
+	if s == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: *s, Valid: true}
+}
+
+func toNullJSON(raw json.RawMessage) pqtype.NullRawMessage {
+	return pqtype.NullRawMessage{RawMessage: raw, Valid: raw != nil}
+}
+
+func toNullUnix(t *time.Time) sql.NullInt64 {
+	if t == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: t.Unix(), Valid: true}
+}
+
+func fromNullString(ns sql.NullString) *string {
+	if !ns.Valid {
+		return nil
+	}
+	return &ns.String
+}
+
+func sqlcNamespaceToRecord(ns *sqlc.Namespace) (*storage.NamespaceRecord, error) {
+	record := &storage.NamespaceRecord{
+		Name:             ns.Name,
+		Description:      ns.Description,
+		ProviderEndpoint: fromNullString(ns.ProviderEndpoint),
+		ProviderAPIKey:   fromNullString(ns.ProviderApiKey),
+		ProviderModel:    fromNullString(ns.ProviderModel),
+		ProviderType:     types.ProviderType(ns.ProviderType),
+		URLTemplate:      fromNullString(ns.UrlTemplate),
+		CreatedAt:        time.Unix(ns.CreatedAt, 0),
+		UpdatedAt:        time.Unix(ns.UpdatedAt, 0),
+	}
+
+	if ns.ProviderHeaders.Valid {
+		if err := json.Unmarshal(ns.ProviderHeaders.RawMessage, &record.ProviderHeaders); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal headers: %w", err)
+		}
+	}
+
+	if ns.ProviderAws.Valid {
+		if err := json.Unmarshal(ns.ProviderAws.RawMessage, &record.ProviderAWS); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal aws credentials: %w", err)
+		}
+	}
+
+	if ns.QueryParams.Valid {
+		if err := json.Unmarshal(ns.QueryParams.RawMessage, &record.QueryParams); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal query params: %w", err)
+		}
+	}
+
+	if ns.Budget.Valid {
+		if err := json.Unmarshal(ns.Budget.RawMessage, &record.Budget); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal budget: %w", err)
+		}
+	}
+
+	if ns.CacheConfig.Valid {
+		if err := json.Unmarshal(ns.CacheConfig.RawMessage, &record.Cache); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal cache config: %w", err)
+		}
+	}
+
+	if ns.Retention.Valid {
+		if err := json.Unmarshal(ns.Retention.RawMessage, &record.Retention); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal retention policy: %w", err)
+		}
+	}
+
+	return record, nil
+}
+
+func sqlcRequestToRecord(req *sqlc.Request) (*storage.RequestRecord, error) {
+	record := &storage.RequestRecord{
+		ID:             req.ID,
+		Namespace:      req.Namespace,
+		Status:         types.RequestStatus(req.Status),
+		HeaderEndpoint: fromNullString(req.HeaderEndpoint),
+		HeaderAPIKey:   fromNullString(req.HeaderApiKey),
+		Error:          fromNullString(req.Error),
+		CreatedAt:      time.Unix(req.CreatedAt, 0),
+		Usage: storage.Usage{
+			PromptTokens:     req.PromptTokens,
+			CompletionTokens: req.CompletionTokens,
+			CachedTokens:     req.CachedTokens,
+			ReasoningTokens:  req.ReasoningTokens,
+			CostUSD:          req.CostUsd,
+		},
+		CacheHit:      req.CacheHit,
+		CoalescedWith: fromNullString(req.CoalescedWith),
+		LeaseOwner:    fromNullString(req.LeaseOwner),
+		Attempts:      int(req.Attempts),
+	}
+
+	if req.LeaseExpiresAt.Valid {
+		t := time.Unix(req.LeaseExpiresAt.Int64, 0)
+		record.LeaseExpiresAt = &t
+	}
+
+	if req.DispatchedAt.Valid {
+		t := time.Unix(req.DispatchedAt.Int64, 0)
+		record.DispatchedAt = &t
+	}
+
+	if req.CompletedAt.Valid {
+		t := time.Unix(req.CompletedAt.Int64, 0)
+		record.CompletedAt = &t
+	}
+
+	record.RequestPayload = req.RequestPayload
+
+	if req.PassthroughHeaders.Valid {
+		if err := json.Unmarshal(req.PassthroughHeaders.RawMessage, &record.PassthroughHeaders); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal passthrough headers: %w", err)
+		}
+	}
+
+	if req.ResponsePayload.Valid {
+		record.ResponsePayload = req.ResponsePayload.RawMessage
+	}
+
+	return record, nil
+}
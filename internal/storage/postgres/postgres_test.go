@@ -0,0 +1,65 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/georgeshao/ai-inference-dam/internal/storage"
+	"github.com/georgeshao/ai-inference-dam/internal/storage/storagetest"
+)
+
+// setupTestStore connects to the database named by POSTGRES_TEST_DSN and
+// isolates the test in a fresh schema that is dropped on cleanup.
+func setupTestStore(t *testing.T) storage.Store {
+	t.Helper()
+
+	dsn := os.Getenv("POSTGRES_TEST_DSN")
+	if dsn == "" {
+		t.Skip("POSTGRES_TEST_DSN not set")
+	}
+
+	admin, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+
+	schema := fmt.Sprintf("dam_test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		admin.Close()
+		t.Fatalf("Failed to create schema: %v", err)
+	}
+
+	sep := " "
+	if strings.Contains(dsn, "://") {
+		sep = "&"
+		if !strings.Contains(dsn, "?") {
+			sep = "?"
+		}
+	}
+	store, err := New(dsn + sep + "search_path=" + schema)
+	if err != nil {
+		admin.Exec("DROP SCHEMA " + schema + " CASCADE")
+		admin.Close()
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	t.Cleanup(func() {
+		if closeErr := store.Close(); closeErr != nil {
+			t.Logf("Failed to close store: %v", closeErr)
+		}
+		if _, dropErr := admin.Exec("DROP SCHEMA " + schema + " CASCADE"); dropErr != nil {
+			t.Logf("Failed to drop schema: %v", dropErr)
+		}
+		admin.Close()
+	})
+
+	return store
+}
+
+func TestStore(t *testing.T) {
+	storagetest.Run(t, setupTestStore)
+}
@@ -0,0 +1,271 @@
+-- name: CreateNamespace :exec
+INSERT INTO namespaces (name, description, provider_endpoint, provider_api_key, provider_model, provider_headers, provider_type, provider_aws, url_template, query_params, budget, cache_config, created_at, updated_at, retention)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15);
+
+-- name: GetNamespace :one
+SELECT name, description, provider_endpoint, provider_api_key, provider_model, provider_headers, provider_type, provider_aws, url_template, query_params, budget, cache_config, created_at, updated_at, retention
+FROM namespaces
+WHERE name = $1;
+
+-- name: UpdateNamespace :exec
+UPDATE namespaces
+SET description = $2, provider_endpoint = $3, provider_api_key = $4, provider_model = $5, provider_headers = $6, provider_type = $7, provider_aws = $8, url_template = $9, query_params = $10, budget = $11, cache_config = $12, updated_at = $13, retention = $14
+WHERE name = $1;
+
+-- name: DeleteNamespace :exec
+DELETE FROM namespaces WHERE name = $1;
+
+-- name: ListNamespaces :many
+SELECT name, description, provider_endpoint, provider_api_key, provider_model, provider_headers, provider_type, provider_aws, url_template, query_params, budget, cache_config, created_at, updated_at, retention
+FROM namespaces
+ORDER BY name;
+
+-- name: GetBudgetSpend :one
+SELECT namespace, period_key, spent_usd, spent_tokens, exhausted_at
+FROM budget_spend
+WHERE namespace = $1;
+
+-- name: AddBudgetSpend :exec
+INSERT INTO budget_spend (namespace, period_key, spent_usd, spent_tokens)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (namespace) DO UPDATE SET
+    spent_usd = CASE WHEN budget_spend.period_key = excluded.period_key THEN budget_spend.spent_usd + excluded.spent_usd ELSE excluded.spent_usd END,
+    spent_tokens = CASE WHEN budget_spend.period_key = excluded.period_key THEN budget_spend.spent_tokens + excluded.spent_tokens ELSE excluded.spent_tokens END,
+    exhausted_at = CASE WHEN budget_spend.period_key = excluded.period_key THEN budget_spend.exhausted_at ELSE NULL END,
+    period_key = excluded.period_key;
+
+-- name: SetBudgetExhausted :exec
+INSERT INTO budget_spend (namespace, period_key, exhausted_at)
+VALUES ($1, $2, $3)
+ON CONFLICT (namespace) DO UPDATE SET
+    spent_usd = CASE WHEN budget_spend.period_key = excluded.period_key THEN budget_spend.spent_usd ELSE 0 END,
+    spent_tokens = CASE WHEN budget_spend.period_key = excluded.period_key THEN budget_spend.spent_tokens ELSE 0 END,
+    exhausted_at = excluded.exhausted_at,
+    period_key = excluded.period_key;
+
+-- name: DeleteBudgetSpend :exec
+DELETE FROM budget_spend WHERE namespace = $1;
+
+-- name: GetCachedResponse :one
+SELECT namespace, cache_key, response_payload, created_at, expires_at
+FROM response_cache
+WHERE namespace = $1 AND cache_key = $2 AND expires_at > $3;
+
+-- name: PutCachedResponse :exec
+INSERT INTO response_cache (namespace, cache_key, response_payload, created_at, expires_at)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (namespace, cache_key) DO UPDATE SET
+    response_payload = excluded.response_payload,
+    created_at = excluded.created_at,
+    expires_at = excluded.expires_at;
+
+-- name: DeleteCachedResponsesByNamespace :exec
+DELETE FROM response_cache WHERE namespace = $1;
+
+-- name: RecordCacheHit :exec
+INSERT INTO cache_stats (namespace, hits, misses)
+VALUES ($1, 1, 0)
+ON CONFLICT (namespace) DO UPDATE SET hits = cache_stats.hits + 1;
+
+-- name: RecordCacheMiss :exec
+INSERT INTO cache_stats (namespace, hits, misses)
+VALUES ($1, 0, 1)
+ON CONFLICT (namespace) DO UPDATE SET misses = cache_stats.misses + 1;
+
+-- name: GetCacheStats :one
+SELECT hits, misses FROM cache_stats WHERE namespace = $1;
+
+-- name: DeleteCacheStats :exec
+DELETE FROM cache_stats WHERE namespace = $1;
+
+-- name: AcquireDispatchLease :execrows
+INSERT INTO dispatch_leases (namespace, owner, expires_at)
+VALUES ($1, $2, $3)
+ON CONFLICT (namespace) DO UPDATE SET
+    owner = excluded.owner,
+    expires_at = excluded.expires_at
+WHERE dispatch_leases.owner = excluded.owner OR dispatch_leases.expires_at < sqlc.arg(now);
+
+-- name: ReleaseDispatchLease :exec
+DELETE FROM dispatch_leases WHERE namespace = $1 AND owner = $2;
+
+-- name: DeleteDispatchLease :exec
+DELETE FROM dispatch_leases WHERE namespace = $1;
+
+-- name: CreateRequest :exec
+INSERT INTO requests (id, namespace, status, request_payload, passthrough_headers, header_endpoint, header_api_key, created_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8);
+
+-- name: GetRequest :one
+SELECT id, namespace, status, request_payload, passthrough_headers, header_endpoint, header_api_key, response_payload, error, created_at, dispatched_at, completed_at, prompt_tokens, completion_tokens, cached_tokens, reasoning_tokens, cost_usd, cache_hit, coalesced_with, lease_owner, lease_expires_at, attempts
+FROM requests
+WHERE id = $1;
+
+-- name: PurgeRequests :execrows
+DELETE FROM requests
+WHERE id IN (
+    SELECT purged.id FROM requests purged
+    WHERE purged.namespace = $1 AND purged.status = $2 AND purged.completed_at < $3
+    ORDER BY purged.completed_at
+    LIMIT $4
+);
+
+-- name: DeleteRequest :execrows
+DELETE FROM requests WHERE id = $1;
+
+-- name: DeleteRequestsByNamespace :execrows
+DELETE FROM requests WHERE namespace = $1;
+
+-- name: ExportRequests :many
+SELECT id, namespace, status, request_payload, passthrough_headers, header_endpoint, header_api_key, response_payload, error, created_at, dispatched_at, completed_at, prompt_tokens, completion_tokens, cached_tokens, reasoning_tokens, cost_usd, cache_hit, coalesced_with, lease_owner, lease_expires_at, attempts
+FROM requests
+WHERE id > $1
+ORDER BY id ASC
+LIMIT $2;
+
+-- name: ListFinishedRequests :many
+SELECT id, namespace, status, request_payload, passthrough_headers, header_endpoint, header_api_key, response_payload, error, created_at, dispatched_at, completed_at, prompt_tokens, completion_tokens, cached_tokens, reasoning_tokens, cost_usd, cache_hit, coalesced_with, lease_owner, lease_expires_at, attempts
+FROM requests
+WHERE namespace = sqlc.arg(namespace) AND status = sqlc.arg(status)
+  AND (completed_at > sqlc.arg(since) OR (completed_at = sqlc.arg(since) AND id > sqlc.arg(after_id)))
+  AND completed_at < sqlc.arg(until)
+ORDER BY completed_at, id
+LIMIT sqlc.arg('limit');
+
+-- name: ImportRequest :exec
+INSERT INTO requests (id, namespace, status, request_payload, passthrough_headers, header_endpoint, header_api_key, response_payload, error, created_at, dispatched_at, completed_at, prompt_tokens, completion_tokens, cached_tokens, reasoning_tokens, cost_usd, cache_hit, coalesced_with, lease_owner, lease_expires_at, attempts)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22)
+ON CONFLICT (id) DO UPDATE SET
+    namespace = excluded.namespace,
+    status = excluded.status,
+    request_payload = excluded.request_payload,
+    passthrough_headers = excluded.passthrough_headers,
+    header_endpoint = excluded.header_endpoint,
+    header_api_key = excluded.header_api_key,
+    response_payload = excluded.response_payload,
+    error = excluded.error,
+    created_at = excluded.created_at,
+    dispatched_at = excluded.dispatched_at,
+    completed_at = excluded.completed_at,
+    prompt_tokens = excluded.prompt_tokens,
+    completion_tokens = excluded.completion_tokens,
+    cached_tokens = excluded.cached_tokens,
+    reasoning_tokens = excluded.reasoning_tokens,
+    cost_usd = excluded.cost_usd,
+    cache_hit = excluded.cache_hit,
+    coalesced_with = excluded.coalesced_with,
+    lease_owner = excluded.lease_owner,
+    lease_expires_at = excluded.lease_expires_at,
+    attempts = excluded.attempts;
+
+-- name: UpdateRequestStatus :exec
+UPDATE requests SET status = $2, dispatched_at = $3 WHERE id = $1;
+
+-- name: UpdateRequestResponse :execrows
+UPDATE requests
+SET status = 'completed', response_payload = sqlc.arg(response_payload), completed_at = sqlc.arg(completed_at),
+    prompt_tokens = sqlc.arg(prompt_tokens), completion_tokens = sqlc.arg(completion_tokens), cached_tokens = sqlc.arg(cached_tokens),
+    reasoning_tokens = sqlc.arg(reasoning_tokens), cost_usd = sqlc.arg(cost_usd),
+    lease_owner = NULL, lease_expires_at = NULL
+WHERE id = sqlc.arg(id) AND (sqlc.arg(lease_owner)::text = '' OR (status = 'processing' AND lease_owner = sqlc.arg(lease_owner)::text));
+
+-- name: UpdateRequestCoalesced :execrows
+UPDATE requests
+SET status = sqlc.arg(status), response_payload = sqlc.arg(response_payload), error = sqlc.arg(error), completed_at = sqlc.arg(completed_at),
+    coalesced_with = sqlc.arg(coalesced_with), lease_owner = NULL, lease_expires_at = NULL
+WHERE id = sqlc.arg(id) AND (sqlc.arg(lease_owner)::text = '' OR (status = 'processing' AND lease_owner = sqlc.arg(lease_owner)::text));
+
+-- name: UpdateRequestError :execrows
+UPDATE requests SET status = 'failed', error = sqlc.arg(error), completed_at = sqlc.arg(completed_at), lease_owner = NULL, lease_expires_at = NULL
+WHERE id = sqlc.arg(id) AND (sqlc.arg(lease_owner)::text = '' OR (status = 'processing' AND lease_owner = sqlc.arg(lease_owner)::text));
+
+-- name: ClaimQueuedRequests :many
+UPDATE requests
+SET status = 'processing', dispatched_at = $1, lease_owner = $2, lease_expires_at = $3, attempts = requests.attempts + 1
+WHERE requests.id IN (
+    SELECT q.id FROM requests q
+    WHERE q.namespace = $4 AND q.status = 'queued'
+    ORDER BY q.created_at ASC
+    LIMIT $5
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING id, namespace, status, request_payload, passthrough_headers, header_endpoint, header_api_key, response_payload, error, created_at, dispatched_at, completed_at, prompt_tokens, completion_tokens, cached_tokens, reasoning_tokens, cost_usd, cache_hit, coalesced_with, lease_owner, lease_expires_at, attempts;
+
+-- name: FailExpiredLeases :execrows
+UPDATE requests
+SET status = 'failed', error = sqlc.arg(error), completed_at = sqlc.arg(now), lease_owner = NULL, lease_expires_at = NULL
+WHERE status = 'processing'
+  AND (lease_expires_at IS NULL OR lease_expires_at < sqlc.arg(now) OR lease_owner = sqlc.narg(owner))
+  AND attempts >= sqlc.arg(max_attempts);
+
+-- name: ReleaseRequest :exec
+UPDATE requests
+SET status = 'queued', dispatched_at = NULL, lease_owner = NULL, lease_expires_at = NULL, attempts = GREATEST(attempts - 1, 0)
+WHERE id = sqlc.arg(id) AND status = 'processing' AND (sqlc.arg(lease_owner)::text = '' OR lease_owner = sqlc.arg(lease_owner)::text);
+
+-- name: RequeueExpiredLeases :execrows
+UPDATE requests
+SET status = 'queued', dispatched_at = NULL, lease_owner = NULL, lease_expires_at = NULL
+WHERE status = 'processing'
+  AND (lease_expires_at IS NULL OR lease_expires_at < sqlc.arg(now) OR lease_owner = sqlc.narg(owner));
+
+-- name: UpdateRequestCacheHit :execrows
+UPDATE requests SET status = 'completed', response_payload = sqlc.arg(response_payload), completed_at = sqlc.arg(completed_at), cache_hit = TRUE, lease_owner = NULL, lease_expires_at = NULL
+WHERE id = sqlc.arg(id) AND (sqlc.arg(lease_owner)::text = '' OR (status = 'processing' AND lease_owner = sqlc.arg(lease_owner)::text));
+
+-- name: GetQueuedRequestsByNamespace :many
+SELECT id, namespace, status, request_payload, passthrough_headers, header_endpoint, header_api_key, response_payload, error, created_at, dispatched_at, completed_at, prompt_tokens, completion_tokens, cached_tokens, reasoning_tokens, cost_usd, cache_hit, coalesced_with, lease_owner, lease_expires_at, attempts
+FROM requests
+WHERE namespace = $1 AND status = 'queued'
+ORDER BY created_at ASC;
+
+-- name: CountRequestsByNamespace :one
+SELECT COUNT(*) as total FROM requests WHERE namespace = $1;
+
+-- name: CountRequestsByNamespaceAndStatus :one
+SELECT COUNT(*) as total FROM requests WHERE namespace = $1 AND status = $2;
+
+-- name: GetNamespaceStats :one
+SELECT
+    COUNT(*) as total_requests,
+    COUNT(*) FILTER (WHERE status = 'queued') as queued,
+    COUNT(*) FILTER (WHERE status = 'processing') as processing,
+    COUNT(*) FILTER (WHERE status = 'completed') as completed,
+    COUNT(*) FILTER (WHERE status = 'failed') as failed,
+    COALESCE(SUM(prompt_tokens), 0)::BIGINT as prompt_tokens,
+    COALESCE(SUM(completion_tokens), 0)::BIGINT as completion_tokens,
+    COALESCE(SUM(cached_tokens), 0)::BIGINT as cached_tokens,
+    COALESCE(SUM(reasoning_tokens), 0)::BIGINT as reasoning_tokens,
+    COALESCE(SUM(cost_usd), 0)::DOUBLE PRECISION as cost_usd
+FROM requests
+WHERE namespace = $1;
+
+-- name: ListRequestsByNamespace :many
+SELECT id, namespace, status, request_payload, passthrough_headers, header_endpoint, header_api_key, response_payload, error, created_at, dispatched_at, completed_at, prompt_tokens, completion_tokens, cached_tokens, reasoning_tokens, cost_usd, cache_hit, coalesced_with, lease_owner, lease_expires_at, attempts
+FROM requests
+WHERE namespace = $1
+ORDER BY created_at DESC, id DESC
+LIMIT $2;
+
+-- name: ListRequestsByNamespaceWithCursor :many
+SELECT id, namespace, status, request_payload, passthrough_headers, header_endpoint, header_api_key, response_payload, error, created_at, dispatched_at, completed_at, prompt_tokens, completion_tokens, cached_tokens, reasoning_tokens, cost_usd, cache_hit, coalesced_with, lease_owner, lease_expires_at, attempts
+FROM requests
+WHERE namespace = sqlc.arg(namespace)
+  AND (created_at < sqlc.arg(created_at) OR (created_at = sqlc.arg(created_at) AND id < sqlc.arg(cursor_id)))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: ListRequestsByNamespaceAndStatus :many
+SELECT id, namespace, status, request_payload, passthrough_headers, header_endpoint, header_api_key, response_payload, error, created_at, dispatched_at, completed_at, prompt_tokens, completion_tokens, cached_tokens, reasoning_tokens, cost_usd, cache_hit, coalesced_with, lease_owner, lease_expires_at, attempts
+FROM requests
+WHERE namespace = $1 AND status = $2
+ORDER BY created_at DESC, id DESC
+LIMIT $3;
+
+-- name: ListRequestsByNamespaceAndStatusWithCursor :many
+SELECT id, namespace, status, request_payload, passthrough_headers, header_endpoint, header_api_key, response_payload, error, created_at, dispatched_at, completed_at, prompt_tokens, completion_tokens, cached_tokens, reasoning_tokens, cost_usd, cache_hit, coalesced_with, lease_owner, lease_expires_at, attempts
+FROM requests
+WHERE namespace = sqlc.arg(namespace) AND status = sqlc.arg(status)
+  AND (created_at < sqlc.arg(created_at) OR (created_at = sqlc.arg(created_at) AND id < sqlc.arg(cursor_id)))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('limit');
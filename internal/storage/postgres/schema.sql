@@ -0,0 +1,90 @@
+CREATE TABLE IF NOT EXISTS namespaces (
+    name TEXT PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT '',
+    provider_endpoint TEXT,
+    provider_api_key TEXT,
+    provider_model TEXT,
+    provider_headers JSONB,
+    provider_type TEXT NOT NULL DEFAULT '',
+    provider_aws JSONB,
+    url_template TEXT,
+    query_params JSONB,
+    budget JSONB,
+    cache_config JSONB,
+    created_at BIGINT NOT NULL,
+    updated_at BIGINT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS requests (
+    id TEXT PRIMARY KEY,
+    namespace TEXT NOT NULL REFERENCES namespaces(name),
+    status TEXT NOT NULL,
+    request_payload JSON NOT NULL,
+    passthrough_headers JSONB,
+    header_endpoint TEXT,
+    header_api_key TEXT,
+    response_payload JSON,
+    error TEXT,
+    created_at BIGINT NOT NULL,
+    dispatched_at BIGINT,
+    completed_at BIGINT,
+    prompt_tokens BIGINT NOT NULL DEFAULT 0,
+    completion_tokens BIGINT NOT NULL DEFAULT 0,
+    cached_tokens BIGINT NOT NULL DEFAULT 0,
+    reasoning_tokens BIGINT NOT NULL DEFAULT 0,
+    cost_usd DOUBLE PRECISION NOT NULL DEFAULT 0,
+    cache_hit BOOLEAN NOT NULL DEFAULT FALSE,
+    coalesced_with TEXT,
+    lease_owner TEXT,
+    lease_expires_at BIGINT,
+    attempts INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS budget_spend (
+    namespace TEXT PRIMARY KEY REFERENCES namespaces(name),
+    period_key TEXT NOT NULL,
+    spent_usd DOUBLE PRECISION NOT NULL DEFAULT 0,
+    spent_tokens BIGINT NOT NULL DEFAULT 0,
+    exhausted_at BIGINT
+);
+
+CREATE TABLE IF NOT EXISTS response_cache (
+    namespace TEXT NOT NULL,
+    cache_key TEXT NOT NULL,
+    response_payload JSON NOT NULL,
+    created_at BIGINT NOT NULL,
+    expires_at BIGINT NOT NULL,
+    PRIMARY KEY (namespace, cache_key)
+);
+
+CREATE TABLE IF NOT EXISTS cache_stats (
+    namespace TEXT PRIMARY KEY,
+    hits BIGINT NOT NULL DEFAULT 0,
+    misses BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS dispatch_leases (
+    namespace TEXT PRIMARY KEY,
+    owner TEXT NOT NULL,
+    expires_at BIGINT NOT NULL
+);
+
+ALTER TABLE namespaces ADD COLUMN IF NOT EXISTS retention JSONB;
+
+CREATE INDEX IF NOT EXISTS idx_requests_namespace_status_created ON requests(namespace, status, created_at);
+CREATE INDEX IF NOT EXISTS idx_requests_namespace_created ON requests(namespace, created_at);
+CREATE INDEX IF NOT EXISTS idx_requests_namespace_status_completed ON requests(namespace, status, completed_at);
+CREATE INDEX IF NOT EXISTS idx_requests_status_lease ON requests(status, lease_expires_at);
+
+-- Payloads are JSON rather than JSONB so they are stored exactly as sent and
+-- received. Convert columns created as JSONB by earlier versions.
+DO $$
+BEGIN
+    IF (SELECT data_type FROM information_schema.columns
+        WHERE table_schema = current_schema() AND table_name = 'requests' AND column_name = 'request_payload') = 'jsonb' THEN
+        ALTER TABLE requests ALTER COLUMN request_payload TYPE JSON;
+        ALTER TABLE requests ALTER COLUMN response_payload TYPE JSON;
+        ALTER TABLE response_cache ALTER COLUMN response_payload TYPE JSON;
+    END IF;
+END
+$$;
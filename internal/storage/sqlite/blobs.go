@@ -0,0 +1,148 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/georgeshao/ai-inference-dam/internal/storage/blob"
+	"github.com/georgeshao/ai-inference-dam/internal/storage/sqlite/sqlc"
+)
+
+// An offloaded payload's column holds its blob reference, and request_blobs
+// records which requests reference which blobs so that a blob can be
+// removed once the last of them is deleted.
+
+// storedPayload is a payload as written to its column. Hash names the blob
+// holding it when it was offloaded.
+type storedPayload struct {
+	value sql.NullString
+	size  sql.NullInt64
+	hash  string
+}
+
+// storePayload offloads a payload of namespace to a blob when it is over the
+// threshold, and compresses it otherwise.
+func (s *SQLiteStore) storePayload(namespace string, raw json.RawMessage) (storedPayload, error) {
+	if s.blobs == nil || !s.blobs.Offload(raw) {
+		value, size := s.compress(namespace, raw)
+		return storedPayload{value: value, size: size}, nil
+	}
+
+	ref, err := s.blobs.Put(raw)
+	if err != nil {
+		return storedPayload{}, err
+	}
+	return storedPayload{
+		value: sql.NullString{String: string(ref.Encode()), Valid: true},
+		size:  sql.NullInt64{Int64: ref.Size, Valid: true},
+		hash:  ref.Hash,
+	}, nil
+}
+
+// storeResponse stores a response for request id, looking up its namespace
+// to pick the compression dictionary.
+func (s *SQLiteStore) storeResponse(ctx context.Context, id string, response json.RawMessage) (storedPayload, error) {
+	var namespace string
+	if response != nil && s.codec.Enabled() {
+		var err error
+		namespace, err = s.queries.GetRequestNamespace(ctx, id)
+		if err != nil && err != sql.ErrNoRows {
+			return storedPayload{}, fmt.Errorf("failed to get request namespace: %w", err)
+		}
+	}
+
+	return s.storePayload(namespace, response)
+}
+
+// loadPayload returns the payload for a stored value.
+func (s *SQLiteStore) loadPayload(value []byte) ([]byte, error) {
+	if ref, ok := blob.ParseRef(value); ok {
+		if s.blobs == nil {
+			return nil, blob.ErrNoStore
+		}
+		return s.blobs.Get(ref)
+	}
+	return s.codec.Decompress(value)
+}
+
+// writeRequest runs write, recording the references of request id to the
+// blobs of payloads in the same transaction.
+func (s *SQLiteStore) writeRequest(ctx context.Context, id string, payloads []storedPayload, write func(*sqlc.Queries) error) error {
+	var hashes []string
+	for _, p := range payloads {
+		if p.hash != "" {
+			hashes = append(hashes, p.hash)
+		}
+	}
+	if len(hashes) == 0 {
+		return write(s.queries)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	qtx := s.queries.WithTx(tx)
+	if err := addRequestBlobs(ctx, qtx, id, hashes); err != nil {
+		return err
+	}
+	if err := write(qtx); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+func addRequestBlobs(ctx context.Context, q *sqlc.Queries, id string, hashes []string) error {
+	for _, hash := range hashes {
+		if err := q.AddRequestBlob(ctx, sqlc.AddRequestBlobParams{RequestID: id, Hash: hash}); err != nil {
+			return fmt.Errorf("failed to record blob reference: %w", err)
+		}
+	}
+	return nil
+}
+
+// collectBlobs removes the blobs among hashes that no request references.
+func (s *SQLiteStore) collectBlobs(ctx context.Context, hashes []string) (int, error) {
+	if s.blobs == nil || len(hashes) == 0 {
+		return 0, nil
+	}
+
+	return s.blobs.Collect(hashes, func(hash string) (bool, error) {
+		referenced, err := s.queries.IsBlobReferenced(ctx, hash)
+		if err != nil {
+			return false, fmt.Errorf("failed to check blob references: %w", err)
+		}
+		return referenced != 0, nil
+	})
+}
+
+// releaseBlobs removes the blobs among hashes that a committed write stopped
+// referencing. The write has already succeeded, so a blob that fails to be
+// removed is only logged and left for CollectBlobs.
+func (s *SQLiteStore) releaseBlobs(ctx context.Context, hashes []string) {
+	if _, err := s.collectBlobs(ctx, hashes); err != nil {
+		log.Printf("Failed to remove released blobs: %v", err)
+	}
+}
+
+// CollectBlobs removes every blob no request references.
+func (s *SQLiteStore) CollectBlobs(ctx context.Context) (int, error) {
+	if s.blobs == nil {
+		return 0, nil
+	}
+
+	hashes, err := s.blobs.Hashes()
+	if err != nil {
+		return 0, err
+	}
+	return s.collectBlobs(ctx, hashes)
+}
@@ -0,0 +1,124 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/georgeshao/ai-inference-dam/internal/storage"
+	"github.com/georgeshao/ai-inference-dam/internal/storage/blob"
+	"github.com/georgeshao/ai-inference-dam/internal/storage/compression"
+	"github.com/georgeshao/ai-inference-dam/internal/storage/sqlite/sqlc"
+)
+
+// Compressed payloads are kept in the same TEXT columns as plain JSON. SQLite
+// stores the bytes as given, and the stats queries measure them with
+// octet_length, so the column type only matters to SQL string functions.
+
+// compress returns the stored value and uncompressed size for a payload of
+// namespace, both NULL for a nil payload.
+func (s *SQLiteStore) compress(namespace string, raw json.RawMessage) (sql.NullString, sql.NullInt64) {
+	if raw == nil {
+		return sql.NullString{}, sql.NullInt64{}
+	}
+	return sql.NullString{String: string(s.codec.Compress(namespace, raw)), Valid: true},
+		sql.NullInt64{Int64: int64(len(raw)), Valid: true}
+}
+
+func (s *SQLiteStore) loadDictionaries(ctx context.Context) error {
+	dicts, err := s.queries.ListCompressionDictionaries(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list compression dictionaries: %w", err)
+	}
+
+	for _, d := range dicts {
+		if err := s.codec.AddDictionary(&compression.Dictionary{
+			ID:        uint32(d.ID),
+			Namespace: d.Namespace,
+			Data:      d.Dictionary,
+			CreatedAt: time.Unix(d.CreatedAt, 0),
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TrainDictionary trains a dictionary on the newest payloads of namespace
+// and compresses its new payloads with it.
+func (s *SQLiteStore) TrainDictionary(ctx context.Context, namespace string) (*storage.CompressionDictionary, error) {
+	if !s.codec.Enabled() {
+		return nil, compression.ErrDisabled
+	}
+
+	rows, err := s.queries.ListPayloadSamples(ctx, sqlc.ListPayloadSamplesParams{
+		Namespace: namespace,
+		Limit:     storage.DictionarySampleLimit,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list payload samples: %w", err)
+	}
+
+	// Rows are newest first and Train wants the oldest first. Payloads
+	// offloaded to blobs are never compressed with a dictionary, so they are
+	// left out.
+	var values []string
+	for i := len(rows) - 1; i >= 0; i-- {
+		values = append(values, rows[i].RequestPayload)
+		if rows[i].ResponsePayload.Valid {
+			values = append(values, rows[i].ResponsePayload.String)
+		}
+	}
+
+	var samples [][]byte
+	for _, value := range values {
+		if _, ok := blob.ParseRef([]byte(value)); ok {
+			continue
+		}
+		payload, err := s.codec.Decompress([]byte(value))
+		if err != nil {
+			return nil, err
+		}
+		samples = append(samples, payload)
+	}
+
+	maxID, err := s.queries.GetMaxCompressionDictionaryID(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dictionary id: %w", err)
+	}
+	id := max(uint32(maxID)+1, compression.FirstDictionaryID)
+
+	data, err := compression.Train(id, samples)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if err := s.queries.CreateCompressionDictionary(ctx, sqlc.CreateCompressionDictionaryParams{
+		ID:         int64(id),
+		Namespace:  namespace,
+		Dictionary: data,
+		CreatedAt:  now.Unix(),
+	}); err != nil {
+		return nil, fmt.Errorf("failed to save compression dictionary: %w", err)
+	}
+
+	if err := s.codec.AddDictionary(&compression.Dictionary{
+		ID:        id,
+		Namespace: namespace,
+		Data:      data,
+		CreatedAt: now,
+	}); err != nil {
+		return nil, err
+	}
+
+	return &storage.CompressionDictionary{
+		ID:        id,
+		Namespace: namespace,
+		Size:      len(data),
+		Samples:   len(samples),
+		CreatedAt: time.Unix(now.Unix(), 0),
+	}, nil
+}
@@ -0,0 +1,146 @@
+package sqlite
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/georgeshao/ai-inference-dam/internal/storage"
+	"github.com/georgeshao/ai-inference-dam/pkg/types"
+)
+
+func openTestDB(t *testing.T) *SQLiteStore {
+	t.Helper()
+	store, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func execMigrations(t *testing.T, store *SQLiteStore, n int) {
+	t.Helper()
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatalf("loadMigrations failed: %v", err)
+	}
+	for _, m := range migrations[:n] {
+		if _, err := store.db.Exec(m.SQL); err != nil {
+			t.Fatalf("Failed to run %s: %v", m.Name, err)
+		}
+	}
+}
+
+func TestMigrateFreshDatabase(t *testing.T) {
+	ctx := context.Background()
+	store := openTestDB(t)
+
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatalf("loadMigrations failed: %v", err)
+	}
+
+	pending, err := store.PendingMigrations(ctx)
+	if err != nil {
+		t.Fatalf("PendingMigrations failed: %v", err)
+	}
+	if len(pending) != len(migrations) {
+		t.Fatalf("Expected %d pending migrations, got %d", len(migrations), len(pending))
+	}
+	if version, _ := store.SchemaVersion(ctx); version != 0 {
+		t.Errorf("Listing pending migrations should not change the schema, got version %d", version)
+	}
+
+	applied, err := store.Migrate(ctx)
+	if err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+	if len(applied) != len(migrations) {
+		t.Errorf("Expected %d applied migrations, got %d", len(migrations), len(applied))
+	}
+
+	version, err := store.SchemaVersion(ctx)
+	if err != nil {
+		t.Fatalf("SchemaVersion failed: %v", err)
+	}
+	if version != len(migrations) {
+		t.Errorf("Expected version %d, got %d", len(migrations), version)
+	}
+
+	applied, err = store.Migrate(ctx)
+	if err != nil || len(applied) != 0 {
+		t.Errorf("Expected second Migrate to be a no-op, got %d applied, err %v", len(applied), err)
+	}
+}
+
+func TestMigrateUpgradesBaselineSchema(t *testing.T) {
+	ctx := context.Background()
+	store := openTestDB(t)
+
+	// A database from before any columns were added, holding a request
+	execMigrations(t, store, 1)
+	now := time.Now().Unix()
+	if _, err := store.db.Exec(`INSERT INTO namespaces (name, description, created_at, updated_at) VALUES ('old', '', ?, ?)`, now, now); err != nil {
+		t.Fatalf("Failed to seed namespace: %v", err)
+	}
+	if _, err := store.db.Exec(`INSERT INTO requests (id, namespace, status, request_payload, created_at) VALUES ('req_old', 'old', 'completed', '{}', ?)`, now); err != nil {
+		t.Fatalf("Failed to seed request: %v", err)
+	}
+
+	if _, err := store.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+
+	req, err := store.GetRequest(ctx, "req_old")
+	if err != nil || req == nil {
+		t.Fatalf("GetRequest failed: %v", err)
+	}
+	if req.Status != types.StatusCompleted || req.Attempts != 0 {
+		t.Errorf("Unexpected request after migration: %+v", req)
+	}
+
+	limit := 5.0
+	ns := &storage.NamespaceRecord{Name: "old", Budget: &storage.Budget{LimitUSD: &limit, Period: types.BudgetPeriodDay}}
+	if err := store.UpdateNamespace(ctx, "old", ns); err != nil {
+		t.Fatalf("UpdateNamespace with new columns failed: %v", err)
+	}
+}
+
+func TestMigrateAdoptsUntrackedDatabase(t *testing.T) {
+	ctx := context.Background()
+	store := openTestDB(t)
+
+	// Databases created by the old initSchema already have every column
+	// but no schema_migrations table
+	migrations, _ := loadMigrations()
+	execMigrations(t, store, len(migrations))
+
+	applied, err := store.Migrate(ctx)
+	if err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+	if len(applied) != len(migrations) {
+		t.Errorf("Expected all migrations recorded, got %d", len(applied))
+	}
+	if version, _ := store.SchemaVersion(ctx); version != len(migrations) {
+		t.Errorf("Expected version %d, got %d", len(migrations), version)
+	}
+}
+
+func TestMigrateRefusesNewerSchema(t *testing.T) {
+	ctx := context.Background()
+	store := openTestDB(t)
+
+	if _, err := store.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+	if _, err := store.db.Exec(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (9999, '9999_future', 0)`); err != nil {
+		t.Fatalf("Failed to record future migration: %v", err)
+	}
+
+	if _, err := store.Migrate(ctx); err == nil {
+		t.Error("Expected Migrate to refuse a newer schema")
+	}
+}
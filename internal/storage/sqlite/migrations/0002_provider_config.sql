@@ -0,0 +1,4 @@
+ALTER TABLE namespaces ADD COLUMN provider_type TEXT NOT NULL DEFAULT '';
+ALTER TABLE namespaces ADD COLUMN provider_aws TEXT;
+ALTER TABLE namespaces ADD COLUMN url_template TEXT;
+ALTER TABLE namespaces ADD COLUMN query_params TEXT;
@@ -0,0 +1,10 @@
+ALTER TABLE namespaces ADD COLUMN budget TEXT;
+
+CREATE TABLE IF NOT EXISTS budget_spend (
+    namespace TEXT PRIMARY KEY,
+    period_key TEXT NOT NULL,
+    spent_usd REAL NOT NULL DEFAULT 0,
+    spent_tokens INTEGER NOT NULL DEFAULT 0,
+    exhausted_at INTEGER,
+    FOREIGN KEY (namespace) REFERENCES namespaces(name)
+);
@@ -0,0 +1,17 @@
+ALTER TABLE namespaces ADD COLUMN cache_config TEXT;
+ALTER TABLE requests ADD COLUMN cache_hit INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS response_cache (
+    namespace TEXT NOT NULL,
+    cache_key TEXT NOT NULL,
+    response_payload TEXT NOT NULL,
+    created_at INTEGER NOT NULL,
+    expires_at INTEGER NOT NULL,
+    PRIMARY KEY (namespace, cache_key)
+);
+
+CREATE TABLE IF NOT EXISTS cache_stats (
+    namespace TEXT PRIMARY KEY,
+    hits INTEGER NOT NULL DEFAULT 0,
+    misses INTEGER NOT NULL DEFAULT 0
+);
@@ -0,0 +1,5 @@
+ALTER TABLE requests ADD COLUMN lease_owner TEXT;
+ALTER TABLE requests ADD COLUMN lease_expires_at INTEGER;
+ALTER TABLE requests ADD COLUMN attempts INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_requests_status_lease ON requests(status, lease_expires_at);
@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS dispatch_leases (
+    namespace TEXT PRIMARY KEY,
+    owner TEXT NOT NULL,
+    expires_at INTEGER NOT NULL
+);
@@ -0,0 +1,9 @@
+ALTER TABLE requests ADD COLUMN request_size INTEGER;
+ALTER TABLE requests ADD COLUMN response_size INTEGER;
+CREATE TABLE IF NOT EXISTS compression_dictionaries (
+    id INTEGER PRIMARY KEY,
+    namespace TEXT NOT NULL,
+    dictionary BLOB NOT NULL,
+    created_at INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_compression_dictionaries_namespace ON compression_dictionaries(namespace);
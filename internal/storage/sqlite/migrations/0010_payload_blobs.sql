@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS request_blobs (
+    request_id TEXT NOT NULL,
+    hash TEXT NOT NULL,
+    PRIMARY KEY (request_id, hash)
+);
+CREATE INDEX IF NOT EXISTS idx_request_blobs_hash ON request_blobs(hash);
@@ -0,0 +1 @@
+ALTER TABLE namespaces ADD COLUMN retention TEXT;
@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS idx_requests_namespace_status_completed ON requests(namespace, status, completed_at);
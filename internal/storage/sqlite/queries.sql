@@ -1,48 +1,275 @@
 -- name: CreateNamespace :exec
-INSERT INTO namespaces (name, description, provider_endpoint, provider_api_key, provider_model, provider_headers, created_at, updated_at)
-VALUES (?, ?, ?, ?, ?, ?, ?, ?);
+INSERT INTO namespaces (name, description, provider_endpoint, provider_api_key, provider_model, provider_headers, provider_type, provider_aws, url_template, query_params, budget, cache_config, retention, created_at, updated_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
 
 -- name: GetNamespace :one
-SELECT name, description, provider_endpoint, provider_api_key, provider_model, provider_headers, created_at, updated_at
+SELECT name, description, provider_endpoint, provider_api_key, provider_model, provider_headers, created_at, updated_at, provider_type, provider_aws, url_template, query_params, budget, cache_config, retention
 FROM namespaces
 WHERE name = ?;
 
 -- name: UpdateNamespace :exec
 UPDATE namespaces
-SET description = ?, provider_endpoint = ?, provider_api_key = ?, provider_model = ?, provider_headers = ?, updated_at = ?
+SET description = ?, provider_endpoint = ?, provider_api_key = ?, provider_model = ?, provider_headers = ?, provider_type = ?, provider_aws = ?, url_template = ?, query_params = ?, budget = ?, cache_config = ?, retention = ?, updated_at = ?
 WHERE name = ?;
 
 -- name: DeleteNamespace :exec
 DELETE FROM namespaces WHERE name = ?;
 
 -- name: ListNamespaces :many
-SELECT name, description, provider_endpoint, provider_api_key, provider_model, provider_headers, created_at, updated_at
+SELECT name, description, provider_endpoint, provider_api_key, provider_model, provider_headers, created_at, updated_at, provider_type, provider_aws, url_template, query_params, budget, cache_config, retention
 FROM namespaces
 ORDER BY name;
 
+-- name: GetBudgetSpend :one
+SELECT namespace, period_key, spent_usd, spent_tokens, exhausted_at
+FROM budget_spend
+WHERE namespace = ?;
+
+-- name: AddBudgetSpend :exec
+INSERT INTO budget_spend (namespace, period_key, spent_usd, spent_tokens)
+VALUES (?, ?, ?, ?)
+ON CONFLICT (namespace) DO UPDATE SET
+    spent_usd = CASE WHEN budget_spend.period_key = excluded.period_key THEN budget_spend.spent_usd + excluded.spent_usd ELSE excluded.spent_usd END,
+    spent_tokens = CASE WHEN budget_spend.period_key = excluded.period_key THEN budget_spend.spent_tokens + excluded.spent_tokens ELSE excluded.spent_tokens END,
+    exhausted_at = CASE WHEN budget_spend.period_key = excluded.period_key THEN budget_spend.exhausted_at ELSE NULL END,
+    period_key = excluded.period_key;
+
+-- name: SetBudgetExhausted :exec
+INSERT INTO budget_spend (namespace, period_key, exhausted_at)
+VALUES (?, ?, ?)
+ON CONFLICT (namespace) DO UPDATE SET
+    spent_usd = CASE WHEN budget_spend.period_key = excluded.period_key THEN budget_spend.spent_usd ELSE 0 END,
+    spent_tokens = CASE WHEN budget_spend.period_key = excluded.period_key THEN budget_spend.spent_tokens ELSE 0 END,
+    exhausted_at = excluded.exhausted_at,
+    period_key = excluded.period_key;
+
+-- name: DeleteBudgetSpend :exec
+DELETE FROM budget_spend WHERE namespace = ?;
+
+-- name: GetCachedResponse :one
+SELECT namespace, cache_key, response_payload, created_at, expires_at
+FROM response_cache
+WHERE namespace = ? AND cache_key = ? AND expires_at > ?;
+
+-- name: PutCachedResponse :exec
+INSERT INTO response_cache (namespace, cache_key, response_payload, created_at, expires_at)
+VALUES (?, ?, ?, ?, ?)
+ON CONFLICT (namespace, cache_key) DO UPDATE SET
+    response_payload = excluded.response_payload,
+    created_at = excluded.created_at,
+    expires_at = excluded.expires_at;
+
+-- name: DeleteCachedResponsesByNamespace :exec
+DELETE FROM response_cache WHERE namespace = ?;
+
+-- name: RecordCacheHit :exec
+INSERT INTO cache_stats (namespace, hits, misses)
+VALUES (?, 1, 0)
+ON CONFLICT (namespace) DO UPDATE SET hits = cache_stats.hits + 1;
+
+-- name: RecordCacheMiss :exec
+INSERT INTO cache_stats (namespace, hits, misses)
+VALUES (?, 0, 1)
+ON CONFLICT (namespace) DO UPDATE SET misses = cache_stats.misses + 1;
+
+-- name: GetCacheStats :one
+SELECT hits, misses FROM cache_stats WHERE namespace = ?;
+
+-- name: DeleteCacheStats :exec
+DELETE FROM cache_stats WHERE namespace = ?;
+
+-- name: InsertDispatchLease :execrows
+INSERT INTO dispatch_leases (namespace, owner, expires_at)
+VALUES (?, ?, ?)
+ON CONFLICT (namespace) DO NOTHING;
+
+-- name: TakeDispatchLease :execrows
+UPDATE dispatch_leases
+SET owner = ?, expires_at = ?
+WHERE namespace = ? AND (owner = ? OR expires_at < ?);
+
+-- name: ReleaseDispatchLease :exec
+DELETE FROM dispatch_leases WHERE namespace = ? AND owner = ?;
+
+-- name: DeleteDispatchLease :exec
+DELETE FROM dispatch_leases WHERE namespace = ?;
+
+-- name: CreateCompressionDictionary :exec
+INSERT INTO compression_dictionaries (id, namespace, dictionary, created_at)
+VALUES (?, ?, ?, ?);
+
+-- name: ListCompressionDictionaries :many
+SELECT id, namespace, dictionary, created_at
+FROM compression_dictionaries
+ORDER BY id;
+
+-- name: GetMaxCompressionDictionaryID :one
+SELECT CAST(COALESCE(MAX(id), 0) AS INTEGER) AS id FROM compression_dictionaries;
+
+-- name: DeleteCompressionDictionariesByNamespace :exec
+DELETE FROM compression_dictionaries WHERE namespace = ?;
+
+-- name: ListPayloadSamples :many
+SELECT request_payload, response_payload
+FROM requests
+WHERE namespace = ?
+ORDER BY created_at DESC
+LIMIT ?;
+
 -- name: CreateRequest :exec
-INSERT INTO requests (id, namespace, status, request_payload, passthrough_headers, header_endpoint, header_api_key, created_at)
-VALUES (?, ?, ?, ?, ?, ?, ?, ?);
+INSERT INTO requests (id, namespace, status, request_payload, passthrough_headers, header_endpoint, header_api_key, created_at, request_size)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?);
 
 -- name: GetRequest :one
-SELECT id, namespace, status, request_payload, passthrough_headers, header_endpoint, header_api_key, response_payload, error, created_at, dispatched_at, completed_at
+SELECT id, namespace, status, request_payload, passthrough_headers, header_endpoint, header_api_key, response_payload, error, created_at, dispatched_at, completed_at, prompt_tokens, completion_tokens, cached_tokens, reasoning_tokens, cost_usd, cache_hit, coalesced_with, lease_owner, lease_expires_at, attempts, request_size, response_size
 FROM requests
 WHERE id = ?;
 
+-- name: GetRequestNamespace :one
+SELECT namespace FROM requests WHERE id = ?;
+
+-- name: AddRequestBlob :exec
+INSERT OR IGNORE INTO request_blobs (request_id, hash) VALUES (?, ?);
+
+-- name: ListRequestBlobs :many
+SELECT hash FROM request_blobs WHERE request_id = ?;
+
+-- name: DeleteRequestBlobs :exec
+DELETE FROM request_blobs WHERE request_id = ?;
+
+-- name: ListNamespaceBlobs :many
+SELECT DISTINCT request_blobs.hash
+FROM request_blobs
+JOIN requests ON requests.id = request_blobs.request_id
+WHERE requests.namespace = ?;
+
+-- name: DeleteNamespaceBlobs :exec
+DELETE FROM request_blobs
+WHERE request_id IN (SELECT id FROM requests WHERE namespace = ?);
+
+-- name: IsBlobReferenced :one
+SELECT EXISTS (SELECT 1 FROM request_blobs WHERE hash = ?) AS referenced;
+
+-- name: ListPurgeableRequests :many
+SELECT id FROM requests
+WHERE namespace = ? AND status = ? AND completed_at < ?
+ORDER BY completed_at
+LIMIT ?;
+
+-- name: DeleteRequest :execrows
+DELETE FROM requests WHERE id = ?;
+
 -- name: DeleteRequestsByNamespace :execrows
 DELETE FROM requests WHERE namespace = ?;
 
+-- name: ExportRequests :many
+SELECT id, namespace, status, request_payload, passthrough_headers, header_endpoint, header_api_key, response_payload, error, created_at, dispatched_at, completed_at, prompt_tokens, completion_tokens, cached_tokens, reasoning_tokens, cost_usd, cache_hit, coalesced_with, lease_owner, lease_expires_at, attempts, request_size, response_size
+FROM requests
+WHERE id > ?
+ORDER BY id ASC
+LIMIT ?;
+
+-- name: ListFinishedRequests :many
+SELECT id, namespace, status, request_payload, passthrough_headers, header_endpoint, header_api_key, response_payload, error, created_at, dispatched_at, completed_at, prompt_tokens, completion_tokens, cached_tokens, reasoning_tokens, cost_usd, cache_hit, coalesced_with, lease_owner, lease_expires_at, attempts, request_size, response_size
+FROM requests
+WHERE namespace = sqlc.arg(namespace) AND status = sqlc.arg(status)
+  AND (completed_at > sqlc.arg(since) OR (completed_at = sqlc.arg(since) AND id > sqlc.arg(after_id)))
+  AND completed_at < sqlc.arg(until)
+ORDER BY completed_at, id
+LIMIT sqlc.arg('limit');
+
+-- name: ImportRequest :exec
+INSERT INTO requests (id, namespace, status, request_payload, passthrough_headers, header_endpoint, header_api_key, response_payload, error, created_at, dispatched_at, completed_at, prompt_tokens, completion_tokens, cached_tokens, reasoning_tokens, cost_usd, cache_hit, coalesced_with, lease_owner, lease_expires_at, attempts, request_size, response_size)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT (id) DO UPDATE SET
+    namespace = excluded.namespace,
+    status = excluded.status,
+    request_payload = excluded.request_payload,
+    passthrough_headers = excluded.passthrough_headers,
+    header_endpoint = excluded.header_endpoint,
+    header_api_key = excluded.header_api_key,
+    response_payload = excluded.response_payload,
+    error = excluded.error,
+    created_at = excluded.created_at,
+    dispatched_at = excluded.dispatched_at,
+    completed_at = excluded.completed_at,
+    prompt_tokens = excluded.prompt_tokens,
+    completion_tokens = excluded.completion_tokens,
+    cached_tokens = excluded.cached_tokens,
+    reasoning_tokens = excluded.reasoning_tokens,
+    cost_usd = excluded.cost_usd,
+    cache_hit = excluded.cache_hit,
+    coalesced_with = excluded.coalesced_with,
+    lease_owner = excluded.lease_owner,
+    lease_expires_at = excluded.lease_expires_at,
+    attempts = excluded.attempts,
+    request_size = excluded.request_size,
+    response_size = excluded.response_size;
+
 -- name: UpdateRequestStatus :exec
 UPDATE requests SET status = ?, dispatched_at = ? WHERE id = ?;
 
--- name: UpdateRequestResponse :exec
-UPDATE requests SET status = 'completed', response_payload = ?, completed_at = ? WHERE id = ?;
+-- name: UpdateRequestResponse :execrows
+UPDATE requests
+SET status = 'completed', response_payload = sqlc.arg(response_payload), response_size = sqlc.arg(response_size), completed_at = sqlc.arg(completed_at),
+    prompt_tokens = sqlc.arg(prompt_tokens), completion_tokens = sqlc.arg(completion_tokens), cached_tokens = sqlc.arg(cached_tokens),
+    reasoning_tokens = sqlc.arg(reasoning_tokens), cost_usd = sqlc.arg(cost_usd),
+    lease_owner = NULL, lease_expires_at = NULL
+WHERE id = sqlc.arg(id)
+  AND (CAST(sqlc.arg(lease_owner) AS TEXT) = '' OR (status = 'processing' AND lease_owner = sqlc.arg(lease_owner)));
+
+-- name: UpdateRequestCoalesced :execrows
+UPDATE requests
+SET status = sqlc.arg(status), response_payload = sqlc.arg(response_payload), response_size = sqlc.arg(response_size), error = sqlc.arg(error),
+    completed_at = sqlc.arg(completed_at), coalesced_with = sqlc.arg(coalesced_with), lease_owner = NULL, lease_expires_at = NULL
+WHERE id = sqlc.arg(id)
+  AND (CAST(sqlc.arg(lease_owner) AS TEXT) = '' OR (status = 'processing' AND lease_owner = sqlc.arg(lease_owner)));
+
+-- name: UpdateRequestError :execrows
+UPDATE requests
+SET status = 'failed', error = sqlc.arg(error), completed_at = sqlc.arg(completed_at), lease_owner = NULL, lease_expires_at = NULL
+WHERE id = sqlc.arg(id)
+  AND (CAST(sqlc.arg(lease_owner) AS TEXT) = '' OR (status = 'processing' AND lease_owner = sqlc.arg(lease_owner)));
+
+-- name: ClaimQueuedRequests :many
+UPDATE requests
+SET status = 'processing', dispatched_at = ?, lease_owner = ?, lease_expires_at = ?, attempts = attempts + 1
+WHERE id IN (
+    SELECT q.id FROM requests q
+    WHERE q.namespace = ? AND q.status = 'queued'
+    ORDER BY q.created_at ASC
+    LIMIT ?
+)
+RETURNING id, namespace, status, request_payload, passthrough_headers, header_endpoint, header_api_key, response_payload, error, created_at, dispatched_at, completed_at, prompt_tokens, completion_tokens, cached_tokens, reasoning_tokens, cost_usd, cache_hit, coalesced_with, lease_owner, lease_expires_at, attempts, request_size, response_size;
+
+-- name: FailExpiredLeases :execrows
+UPDATE requests
+SET status = 'failed', error = ?, completed_at = ?, lease_owner = NULL, lease_expires_at = NULL
+WHERE status = 'processing'
+  AND (lease_expires_at IS NULL OR lease_expires_at < ? OR lease_owner = ?)
+  AND attempts >= ?;
+
+-- name: ReleaseRequest :exec
+UPDATE requests
+SET status = 'queued', dispatched_at = NULL, lease_owner = NULL, lease_expires_at = NULL, attempts = MAX(attempts - 1, 0)
+WHERE id = sqlc.arg(id) AND status = 'processing'
+  AND (CAST(sqlc.arg(lease_owner) AS TEXT) = '' OR lease_owner = sqlc.arg(lease_owner));
+
+-- name: RequeueExpiredLeases :execrows
+UPDATE requests
+SET status = 'queued', dispatched_at = NULL, lease_owner = NULL, lease_expires_at = NULL
+WHERE status = 'processing'
+  AND (lease_expires_at IS NULL OR lease_expires_at < ? OR lease_owner = ?);
 
--- name: UpdateRequestError :exec
-UPDATE requests SET status = 'failed', error = ?, completed_at = ? WHERE id = ?;
+-- name: UpdateRequestCacheHit :execrows
+UPDATE requests
+SET status = 'completed', response_payload = sqlc.arg(response_payload), response_size = sqlc.arg(response_size), completed_at = sqlc.arg(completed_at),
+    cache_hit = 1, lease_owner = NULL, lease_expires_at = NULL
+WHERE id = sqlc.arg(id)
+  AND (CAST(sqlc.arg(lease_owner) AS TEXT) = '' OR (status = 'processing' AND lease_owner = sqlc.arg(lease_owner)));
 
 -- name: GetQueuedRequestsByNamespace :many
-SELECT id, namespace, status, request_payload, passthrough_headers, header_endpoint, header_api_key, response_payload, error, created_at, dispatched_at, completed_at
+SELECT id, namespace, status, request_payload, passthrough_headers, header_endpoint, header_api_key, response_payload, error, created_at, dispatched_at, completed_at, prompt_tokens, completion_tokens, cached_tokens, reasoning_tokens, cost_usd, cache_hit, coalesced_with, lease_owner, lease_expires_at, attempts, request_size, response_size
 FROM requests
 WHERE namespace = ? AND status = 'queued'
 ORDER BY created_at ASC;
@@ -59,34 +286,43 @@ SELECT
     SUM(CASE WHEN status = 'queued' THEN 1 ELSE 0 END) as queued,
     SUM(CASE WHEN status = 'processing' THEN 1 ELSE 0 END) as processing,
     SUM(CASE WHEN status = 'completed' THEN 1 ELSE 0 END) as completed,
-    SUM(CASE WHEN status = 'failed' THEN 1 ELSE 0 END) as failed
+    SUM(CASE WHEN status = 'failed' THEN 1 ELSE 0 END) as failed,
+    SUM(prompt_tokens) as prompt_tokens,
+    SUM(completion_tokens) as completion_tokens,
+    SUM(cached_tokens) as cached_tokens,
+    SUM(reasoning_tokens) as reasoning_tokens,
+    SUM(cost_usd) as cost_usd,
+    SUM(COALESCE(request_size, octet_length(request_payload)) + COALESCE(response_size, octet_length(response_payload), 0)) as payload_bytes,
+    SUM(octet_length(request_payload) + COALESCE(octet_length(response_payload), 0)) as stored_payload_bytes
 FROM requests
 WHERE namespace = ?;
 
 -- name: ListRequestsByNamespace :many
-SELECT id, namespace, status, request_payload, passthrough_headers, header_endpoint, header_api_key, response_payload, error, created_at, dispatched_at, completed_at
+SELECT id, namespace, status, request_payload, passthrough_headers, header_endpoint, header_api_key, response_payload, error, created_at, dispatched_at, completed_at, prompt_tokens, completion_tokens, cached_tokens, reasoning_tokens, cost_usd, cache_hit, coalesced_with, lease_owner, lease_expires_at, attempts, request_size, response_size
 FROM requests
 WHERE namespace = ?
-ORDER BY created_at DESC
+ORDER BY created_at DESC, id DESC
 LIMIT ?;
 
 -- name: ListRequestsByNamespaceWithCursor :many
-SELECT id, namespace, status, request_payload, passthrough_headers, header_endpoint, header_api_key, response_payload, error, created_at, dispatched_at, completed_at
+SELECT id, namespace, status, request_payload, passthrough_headers, header_endpoint, header_api_key, response_payload, error, created_at, dispatched_at, completed_at, prompt_tokens, completion_tokens, cached_tokens, reasoning_tokens, cost_usd, cache_hit, coalesced_with, lease_owner, lease_expires_at, attempts, request_size, response_size
 FROM requests
-WHERE namespace = ? AND created_at < ?
-ORDER BY created_at DESC
-LIMIT ?;
+WHERE namespace = sqlc.arg(namespace)
+  AND (created_at < sqlc.arg(created_at) OR (created_at = sqlc.arg(created_at) AND id < sqlc.arg(cursor_id)))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('limit');
 
 -- name: ListRequestsByNamespaceAndStatus :many
-SELECT id, namespace, status, request_payload, passthrough_headers, header_endpoint, header_api_key, response_payload, error, created_at, dispatched_at, completed_at
+SELECT id, namespace, status, request_payload, passthrough_headers, header_endpoint, header_api_key, response_payload, error, created_at, dispatched_at, completed_at, prompt_tokens, completion_tokens, cached_tokens, reasoning_tokens, cost_usd, cache_hit, coalesced_with, lease_owner, lease_expires_at, attempts, request_size, response_size
 FROM requests
 WHERE namespace = ? AND status = ?
-ORDER BY created_at DESC
+ORDER BY created_at DESC, id DESC
 LIMIT ?;
 
 -- name: ListRequestsByNamespaceAndStatusWithCursor :many
-SELECT id, namespace, status, request_payload, passthrough_headers, header_endpoint, header_api_key, response_payload, error, created_at, dispatched_at, completed_at
+SELECT id, namespace, status, request_payload, passthrough_headers, header_endpoint, header_api_key, response_payload, error, created_at, dispatched_at, completed_at, prompt_tokens, completion_tokens, cached_tokens, reasoning_tokens, cost_usd, cache_hit, coalesced_with, lease_owner, lease_expires_at, attempts, request_size, response_size
 FROM requests
-WHERE namespace = ? AND status = ? AND created_at < ?
-ORDER BY created_at DESC
-LIMIT ?;
+WHERE namespace = sqlc.arg(namespace) AND status = sqlc.arg(status)
+  AND (created_at < sqlc.arg(created_at) OR (created_at = sqlc.arg(created_at) AND id < sqlc.arg(cursor_id)))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('limit');
@@ -8,6 +8,33 @@ import (
 	"database/sql"
 )
 
+type BudgetSpend struct {
+	Namespace   string        `json:"namespace"`
+	PeriodKey   string        `json:"period_key"`
+	SpentUsd    float64       `json:"spent_usd"`
+	SpentTokens int64         `json:"spent_tokens"`
+	ExhaustedAt sql.NullInt64 `json:"exhausted_at"`
+}
+
+type CacheStat struct {
+	Namespace string `json:"namespace"`
+	Hits      int64  `json:"hits"`
+	Misses    int64  `json:"misses"`
+}
+
+type CompressionDictionary struct {
+	ID         int64  `json:"id"`
+	Namespace  string `json:"namespace"`
+	Dictionary []byte `json:"dictionary"`
+	CreatedAt  int64  `json:"created_at"`
+}
+
+type DispatchLease struct {
+	Namespace string `json:"namespace"`
+	Owner     string `json:"owner"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
 type Namespace struct {
 	Name             string         `json:"name"`
 	Description      string         `json:"description"`
@@ -17,6 +44,13 @@ type Namespace struct {
 	ProviderHeaders  sql.NullString `json:"provider_headers"`
 	CreatedAt        int64          `json:"created_at"`
 	UpdatedAt        int64          `json:"updated_at"`
+	ProviderType     string         `json:"provider_type"`
+	ProviderAws      sql.NullString `json:"provider_aws"`
+	UrlTemplate      sql.NullString `json:"url_template"`
+	QueryParams      sql.NullString `json:"query_params"`
+	Budget           sql.NullString `json:"budget"`
+	CacheConfig      sql.NullString `json:"cache_config"`
+	Retention        sql.NullString `json:"retention"`
 }
 
 type Request struct {
@@ -32,4 +66,29 @@ type Request struct {
 	CreatedAt          int64          `json:"created_at"`
 	DispatchedAt       sql.NullInt64  `json:"dispatched_at"`
 	CompletedAt        sql.NullInt64  `json:"completed_at"`
+	PromptTokens       int64          `json:"prompt_tokens"`
+	CompletionTokens   int64          `json:"completion_tokens"`
+	CachedTokens       int64          `json:"cached_tokens"`
+	ReasoningTokens    int64          `json:"reasoning_tokens"`
+	CostUsd            float64        `json:"cost_usd"`
+	CacheHit           int64          `json:"cache_hit"`
+	CoalescedWith      sql.NullString `json:"coalesced_with"`
+	LeaseOwner         sql.NullString `json:"lease_owner"`
+	LeaseExpiresAt     sql.NullInt64  `json:"lease_expires_at"`
+	Attempts           int64          `json:"attempts"`
+	RequestSize        sql.NullInt64  `json:"request_size"`
+	ResponseSize       sql.NullInt64  `json:"response_size"`
+}
+
+type RequestBlob struct {
+	RequestID string `json:"request_id"`
+	Hash      string `json:"hash"`
+}
+
+type ResponseCache struct {
+	Namespace       string `json:"namespace"`
+	CacheKey        string `json:"cache_key"`
+	ResponsePayload string `json:"response_payload"`
+	CreatedAt       int64  `json:"created_at"`
+	ExpiresAt       int64  `json:"expires_at"`
 }
@@ -9,24 +9,62 @@ import (
 )
 
 type Querier interface {
+	AddBudgetSpend(ctx context.Context, arg AddBudgetSpendParams) error
+	AddRequestBlob(ctx context.Context, arg AddRequestBlobParams) error
+	ClaimQueuedRequests(ctx context.Context, arg ClaimQueuedRequestsParams) ([]Request, error)
 	CountRequestsByNamespace(ctx context.Context, namespace string) (int64, error)
 	CountRequestsByNamespaceAndStatus(ctx context.Context, arg CountRequestsByNamespaceAndStatusParams) (int64, error)
+	CreateCompressionDictionary(ctx context.Context, arg CreateCompressionDictionaryParams) error
 	CreateNamespace(ctx context.Context, arg CreateNamespaceParams) error
 	CreateRequest(ctx context.Context, arg CreateRequestParams) error
+	DeleteBudgetSpend(ctx context.Context, namespace string) error
+	DeleteCacheStats(ctx context.Context, namespace string) error
+	DeleteCachedResponsesByNamespace(ctx context.Context, namespace string) error
+	DeleteCompressionDictionariesByNamespace(ctx context.Context, namespace string) error
+	DeleteDispatchLease(ctx context.Context, namespace string) error
 	DeleteNamespace(ctx context.Context, name string) error
+	DeleteNamespaceBlobs(ctx context.Context, namespace string) error
+	DeleteRequest(ctx context.Context, id string) (int64, error)
+	DeleteRequestBlobs(ctx context.Context, requestID string) error
 	DeleteRequestsByNamespace(ctx context.Context, namespace string) (int64, error)
+	ExportRequests(ctx context.Context, arg ExportRequestsParams) ([]Request, error)
+	FailExpiredLeases(ctx context.Context, arg FailExpiredLeasesParams) (int64, error)
+	GetBudgetSpend(ctx context.Context, namespace string) (BudgetSpend, error)
+	GetCacheStats(ctx context.Context, namespace string) (GetCacheStatsRow, error)
+	GetCachedResponse(ctx context.Context, arg GetCachedResponseParams) (ResponseCache, error)
+	GetMaxCompressionDictionaryID(ctx context.Context) (int64, error)
 	GetNamespace(ctx context.Context, name string) (Namespace, error)
 	GetNamespaceStats(ctx context.Context, namespace string) (GetNamespaceStatsRow, error)
 	GetQueuedRequestsByNamespace(ctx context.Context, namespace string) ([]Request, error)
 	GetRequest(ctx context.Context, id string) (Request, error)
+	GetRequestNamespace(ctx context.Context, id string) (string, error)
+	ImportRequest(ctx context.Context, arg ImportRequestParams) error
+	InsertDispatchLease(ctx context.Context, arg InsertDispatchLeaseParams) (int64, error)
+	IsBlobReferenced(ctx context.Context, hash string) (int64, error)
+	ListCompressionDictionaries(ctx context.Context) ([]CompressionDictionary, error)
+	ListFinishedRequests(ctx context.Context, arg ListFinishedRequestsParams) ([]Request, error)
+	ListNamespaceBlobs(ctx context.Context, namespace string) ([]string, error)
 	ListNamespaces(ctx context.Context) ([]Namespace, error)
+	ListPayloadSamples(ctx context.Context, arg ListPayloadSamplesParams) ([]ListPayloadSamplesRow, error)
+	ListPurgeableRequests(ctx context.Context, arg ListPurgeableRequestsParams) ([]string, error)
+	ListRequestBlobs(ctx context.Context, requestID string) ([]string, error)
 	ListRequestsByNamespace(ctx context.Context, arg ListRequestsByNamespaceParams) ([]Request, error)
 	ListRequestsByNamespaceAndStatus(ctx context.Context, arg ListRequestsByNamespaceAndStatusParams) ([]Request, error)
 	ListRequestsByNamespaceAndStatusWithCursor(ctx context.Context, arg ListRequestsByNamespaceAndStatusWithCursorParams) ([]Request, error)
 	ListRequestsByNamespaceWithCursor(ctx context.Context, arg ListRequestsByNamespaceWithCursorParams) ([]Request, error)
+	PutCachedResponse(ctx context.Context, arg PutCachedResponseParams) error
+	RecordCacheHit(ctx context.Context, namespace string) error
+	RecordCacheMiss(ctx context.Context, namespace string) error
+	ReleaseDispatchLease(ctx context.Context, arg ReleaseDispatchLeaseParams) error
+	ReleaseRequest(ctx context.Context, arg ReleaseRequestParams) error
+	RequeueExpiredLeases(ctx context.Context, arg RequeueExpiredLeasesParams) (int64, error)
+	SetBudgetExhausted(ctx context.Context, arg SetBudgetExhaustedParams) error
+	TakeDispatchLease(ctx context.Context, arg TakeDispatchLeaseParams) (int64, error)
 	UpdateNamespace(ctx context.Context, arg UpdateNamespaceParams) error
-	UpdateRequestError(ctx context.Context, arg UpdateRequestErrorParams) error
-	UpdateRequestResponse(ctx context.Context, arg UpdateRequestResponseParams) error
+	UpdateRequestCacheHit(ctx context.Context, arg UpdateRequestCacheHitParams) (int64, error)
+	UpdateRequestCoalesced(ctx context.Context, arg UpdateRequestCoalescedParams) (int64, error)
+	UpdateRequestError(ctx context.Context, arg UpdateRequestErrorParams) (int64, error)
+	UpdateRequestResponse(ctx context.Context, arg UpdateRequestResponseParams) (int64, error)
 	UpdateRequestStatus(ctx context.Context, arg UpdateRequestStatusParams) error
 }
 
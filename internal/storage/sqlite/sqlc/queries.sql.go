@@ -10,6 +10,121 @@ import (
 	"database/sql"
 )
 
+const addBudgetSpend = `-- name: AddBudgetSpend :exec
+INSERT INTO budget_spend (namespace, period_key, spent_usd, spent_tokens)
+VALUES (?, ?, ?, ?)
+ON CONFLICT (namespace) DO UPDATE SET
+    spent_usd = CASE WHEN budget_spend.period_key = excluded.period_key THEN budget_spend.spent_usd + excluded.spent_usd ELSE excluded.spent_usd END,
+    spent_tokens = CASE WHEN budget_spend.period_key = excluded.period_key THEN budget_spend.spent_tokens + excluded.spent_tokens ELSE excluded.spent_tokens END,
+    exhausted_at = CASE WHEN budget_spend.period_key = excluded.period_key THEN budget_spend.exhausted_at ELSE NULL END,
+    period_key = excluded.period_key
+`
+
+type AddBudgetSpendParams struct {
+	Namespace   string  `json:"namespace"`
+	PeriodKey   string  `json:"period_key"`
+	SpentUsd    float64 `json:"spent_usd"`
+	SpentTokens int64   `json:"spent_tokens"`
+}
+
+func (q *Queries) AddBudgetSpend(ctx context.Context, arg AddBudgetSpendParams) error {
+	_, err := q.db.ExecContext(ctx, addBudgetSpend,
+		arg.Namespace,
+		arg.PeriodKey,
+		arg.SpentUsd,
+		arg.SpentTokens,
+	)
+	return err
+}
+
+const addRequestBlob = `-- name: AddRequestBlob :exec
+INSERT OR IGNORE INTO request_blobs (request_id, hash) VALUES (?, ?)
+`
+
+type AddRequestBlobParams struct {
+	RequestID string `json:"request_id"`
+	Hash      string `json:"hash"`
+}
+
+func (q *Queries) AddRequestBlob(ctx context.Context, arg AddRequestBlobParams) error {
+	_, err := q.db.ExecContext(ctx, addRequestBlob, arg.RequestID, arg.Hash)
+	return err
+}
+
+const claimQueuedRequests = `-- name: ClaimQueuedRequests :many
+UPDATE requests
+SET status = 'processing', dispatched_at = ?, lease_owner = ?, lease_expires_at = ?, attempts = attempts + 1
+WHERE id IN (
+    SELECT q.id FROM requests q
+    WHERE q.namespace = ? AND q.status = 'queued'
+    ORDER BY q.created_at ASC
+    LIMIT ?
+)
+RETURNING id, namespace, status, request_payload, passthrough_headers, header_endpoint, header_api_key, response_payload, error, created_at, dispatched_at, completed_at, prompt_tokens, completion_tokens, cached_tokens, reasoning_tokens, cost_usd, cache_hit, coalesced_with, lease_owner, lease_expires_at, attempts, request_size, response_size
+`
+
+type ClaimQueuedRequestsParams struct {
+	DispatchedAt   sql.NullInt64  `json:"dispatched_at"`
+	LeaseOwner     sql.NullString `json:"lease_owner"`
+	LeaseExpiresAt sql.NullInt64  `json:"lease_expires_at"`
+	Namespace      string         `json:"namespace"`
+	Limit          int64          `json:"limit"`
+}
+
+func (q *Queries) ClaimQueuedRequests(ctx context.Context, arg ClaimQueuedRequestsParams) ([]Request, error) {
+	rows, err := q.db.QueryContext(ctx, claimQueuedRequests,
+		arg.DispatchedAt,
+		arg.LeaseOwner,
+		arg.LeaseExpiresAt,
+		arg.Namespace,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Request
+	for rows.Next() {
+		var i Request
+		if err := rows.Scan(
+			&i.ID,
+			&i.Namespace,
+			&i.Status,
+			&i.RequestPayload,
+			&i.PassthroughHeaders,
+			&i.HeaderEndpoint,
+			&i.HeaderApiKey,
+			&i.ResponsePayload,
+			&i.Error,
+			&i.CreatedAt,
+			&i.DispatchedAt,
+			&i.CompletedAt,
+			&i.PromptTokens,
+			&i.CompletionTokens,
+			&i.CachedTokens,
+			&i.ReasoningTokens,
+			&i.CostUsd,
+			&i.CacheHit,
+			&i.CoalescedWith,
+			&i.LeaseOwner,
+			&i.LeaseExpiresAt,
+			&i.Attempts,
+			&i.RequestSize,
+			&i.ResponseSize,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const countRequestsByNamespace = `-- name: CountRequestsByNamespace :one
 SELECT COUNT(*) as total FROM requests WHERE namespace = ?
 `
@@ -37,9 +152,31 @@ func (q *Queries) CountRequestsByNamespaceAndStatus(ctx context.Context, arg Cou
 	return total, err
 }
 
+const createCompressionDictionary = `-- name: CreateCompressionDictionary :exec
+INSERT INTO compression_dictionaries (id, namespace, dictionary, created_at)
+VALUES (?, ?, ?, ?)
+`
+
+type CreateCompressionDictionaryParams struct {
+	ID         int64  `json:"id"`
+	Namespace  string `json:"namespace"`
+	Dictionary []byte `json:"dictionary"`
+	CreatedAt  int64  `json:"created_at"`
+}
+
+func (q *Queries) CreateCompressionDictionary(ctx context.Context, arg CreateCompressionDictionaryParams) error {
+	_, err := q.db.ExecContext(ctx, createCompressionDictionary,
+		arg.ID,
+		arg.Namespace,
+		arg.Dictionary,
+		arg.CreatedAt,
+	)
+	return err
+}
+
 const createNamespace = `-- name: CreateNamespace :exec
-INSERT INTO namespaces (name, description, provider_endpoint, provider_api_key, provider_model, provider_headers, created_at, updated_at)
-VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+INSERT INTO namespaces (name, description, provider_endpoint, provider_api_key, provider_model, provider_headers, provider_type, provider_aws, url_template, query_params, budget, cache_config, retention, created_at, updated_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 `
 
 type CreateNamespaceParams struct {
@@ -49,6 +186,13 @@ type CreateNamespaceParams struct {
 	ProviderApiKey   sql.NullString `json:"provider_api_key"`
 	ProviderModel    sql.NullString `json:"provider_model"`
 	ProviderHeaders  sql.NullString `json:"provider_headers"`
+	ProviderType     string         `json:"provider_type"`
+	ProviderAws      sql.NullString `json:"provider_aws"`
+	UrlTemplate      sql.NullString `json:"url_template"`
+	QueryParams      sql.NullString `json:"query_params"`
+	Budget           sql.NullString `json:"budget"`
+	CacheConfig      sql.NullString `json:"cache_config"`
+	Retention        sql.NullString `json:"retention"`
 	CreatedAt        int64          `json:"created_at"`
 	UpdatedAt        int64          `json:"updated_at"`
 }
@@ -61,6 +205,13 @@ func (q *Queries) CreateNamespace(ctx context.Context, arg CreateNamespaceParams
 		arg.ProviderApiKey,
 		arg.ProviderModel,
 		arg.ProviderHeaders,
+		arg.ProviderType,
+		arg.ProviderAws,
+		arg.UrlTemplate,
+		arg.QueryParams,
+		arg.Budget,
+		arg.CacheConfig,
+		arg.Retention,
 		arg.CreatedAt,
 		arg.UpdatedAt,
 	)
@@ -68,8 +219,8 @@ func (q *Queries) CreateNamespace(ctx context.Context, arg CreateNamespaceParams
 }
 
 const createRequest = `-- name: CreateRequest :exec
-INSERT INTO requests (id, namespace, status, request_payload, passthrough_headers, header_endpoint, header_api_key, created_at)
-VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+INSERT INTO requests (id, namespace, status, request_payload, passthrough_headers, header_endpoint, header_api_key, created_at, request_size)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
 `
 
 type CreateRequestParams struct {
@@ -81,6 +232,7 @@ type CreateRequestParams struct {
 	HeaderEndpoint     sql.NullString `json:"header_endpoint"`
 	HeaderApiKey       sql.NullString `json:"header_api_key"`
 	CreatedAt          int64          `json:"created_at"`
+	RequestSize        sql.NullInt64  `json:"request_size"`
 }
 
 func (q *Queries) CreateRequest(ctx context.Context, arg CreateRequestParams) error {
@@ -93,10 +245,56 @@ func (q *Queries) CreateRequest(ctx context.Context, arg CreateRequestParams) er
 		arg.HeaderEndpoint,
 		arg.HeaderApiKey,
 		arg.CreatedAt,
+		arg.RequestSize,
 	)
 	return err
 }
 
+const deleteBudgetSpend = `-- name: DeleteBudgetSpend :exec
+DELETE FROM budget_spend WHERE namespace = ?
+`
+
+func (q *Queries) DeleteBudgetSpend(ctx context.Context, namespace string) error {
+	_, err := q.db.ExecContext(ctx, deleteBudgetSpend, namespace)
+	return err
+}
+
+const deleteCacheStats = `-- name: DeleteCacheStats :exec
+DELETE FROM cache_stats WHERE namespace = ?
+`
+
+func (q *Queries) DeleteCacheStats(ctx context.Context, namespace string) error {
+	_, err := q.db.ExecContext(ctx, deleteCacheStats, namespace)
+	return err
+}
+
+const deleteCachedResponsesByNamespace = `-- name: DeleteCachedResponsesByNamespace :exec
+DELETE FROM response_cache WHERE namespace = ?
+`
+
+func (q *Queries) DeleteCachedResponsesByNamespace(ctx context.Context, namespace string) error {
+	_, err := q.db.ExecContext(ctx, deleteCachedResponsesByNamespace, namespace)
+	return err
+}
+
+const deleteCompressionDictionariesByNamespace = `-- name: DeleteCompressionDictionariesByNamespace :exec
+DELETE FROM compression_dictionaries WHERE namespace = ?
+`
+
+func (q *Queries) DeleteCompressionDictionariesByNamespace(ctx context.Context, namespace string) error {
+	_, err := q.db.ExecContext(ctx, deleteCompressionDictionariesByNamespace, namespace)
+	return err
+}
+
+const deleteDispatchLease = `-- name: DeleteDispatchLease :exec
+DELETE FROM dispatch_leases WHERE namespace = ?
+`
+
+func (q *Queries) DeleteDispatchLease(ctx context.Context, namespace string) error {
+	_, err := q.db.ExecContext(ctx, deleteDispatchLease, namespace)
+	return err
+}
+
 const deleteNamespace = `-- name: DeleteNamespace :exec
 DELETE FROM namespaces WHERE name = ?
 `
@@ -106,6 +304,37 @@ func (q *Queries) DeleteNamespace(ctx context.Context, name string) error {
 	return err
 }
 
+const deleteNamespaceBlobs = `-- name: DeleteNamespaceBlobs :exec
+DELETE FROM request_blobs
+WHERE request_id IN (SELECT id FROM requests WHERE namespace = ?)
+`
+
+func (q *Queries) DeleteNamespaceBlobs(ctx context.Context, namespace string) error {
+	_, err := q.db.ExecContext(ctx, deleteNamespaceBlobs, namespace)
+	return err
+}
+
+const deleteRequest = `-- name: DeleteRequest :execrows
+DELETE FROM requests WHERE id = ?
+`
+
+func (q *Queries) DeleteRequest(ctx context.Context, id string) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteRequest, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteRequestBlobs = `-- name: DeleteRequestBlobs :exec
+DELETE FROM request_blobs WHERE request_id = ?
+`
+
+func (q *Queries) DeleteRequestBlobs(ctx context.Context, requestID string) error {
+	_, err := q.db.ExecContext(ctx, deleteRequestBlobs, requestID)
+	return err
+}
+
 const deleteRequestsByNamespace = `-- name: DeleteRequestsByNamespace :execrows
 DELETE FROM requests WHERE namespace = ?
 `
@@ -118,8 +347,170 @@ func (q *Queries) DeleteRequestsByNamespace(ctx context.Context, namespace strin
 	return result.RowsAffected()
 }
 
+const exportRequests = `-- name: ExportRequests :many
+SELECT id, namespace, status, request_payload, passthrough_headers, header_endpoint, header_api_key, response_payload, error, created_at, dispatched_at, completed_at, prompt_tokens, completion_tokens, cached_tokens, reasoning_tokens, cost_usd, cache_hit, coalesced_with, lease_owner, lease_expires_at, attempts, request_size, response_size
+FROM requests
+WHERE id > ?
+ORDER BY id ASC
+LIMIT ?
+`
+
+type ExportRequestsParams struct {
+	ID    string `json:"id"`
+	Limit int64  `json:"limit"`
+}
+
+func (q *Queries) ExportRequests(ctx context.Context, arg ExportRequestsParams) ([]Request, error) {
+	rows, err := q.db.QueryContext(ctx, exportRequests, arg.ID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Request
+	for rows.Next() {
+		var i Request
+		if err := rows.Scan(
+			&i.ID,
+			&i.Namespace,
+			&i.Status,
+			&i.RequestPayload,
+			&i.PassthroughHeaders,
+			&i.HeaderEndpoint,
+			&i.HeaderApiKey,
+			&i.ResponsePayload,
+			&i.Error,
+			&i.CreatedAt,
+			&i.DispatchedAt,
+			&i.CompletedAt,
+			&i.PromptTokens,
+			&i.CompletionTokens,
+			&i.CachedTokens,
+			&i.ReasoningTokens,
+			&i.CostUsd,
+			&i.CacheHit,
+			&i.CoalescedWith,
+			&i.LeaseOwner,
+			&i.LeaseExpiresAt,
+			&i.Attempts,
+			&i.RequestSize,
+			&i.ResponseSize,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const failExpiredLeases = `-- name: FailExpiredLeases :execrows
+UPDATE requests
+SET status = 'failed', error = ?, completed_at = ?, lease_owner = NULL, lease_expires_at = NULL
+WHERE status = 'processing'
+  AND (lease_expires_at IS NULL OR lease_expires_at < ? OR lease_owner = ?)
+  AND attempts >= ?
+`
+
+type FailExpiredLeasesParams struct {
+	Error          sql.NullString `json:"error"`
+	CompletedAt    sql.NullInt64  `json:"completed_at"`
+	LeaseExpiresAt sql.NullInt64  `json:"lease_expires_at"`
+	LeaseOwner     sql.NullString `json:"lease_owner"`
+	Attempts       int64          `json:"attempts"`
+}
+
+func (q *Queries) FailExpiredLeases(ctx context.Context, arg FailExpiredLeasesParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, failExpiredLeases,
+		arg.Error,
+		arg.CompletedAt,
+		arg.LeaseExpiresAt,
+		arg.LeaseOwner,
+		arg.Attempts,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getBudgetSpend = `-- name: GetBudgetSpend :one
+SELECT namespace, period_key, spent_usd, spent_tokens, exhausted_at
+FROM budget_spend
+WHERE namespace = ?
+`
+
+func (q *Queries) GetBudgetSpend(ctx context.Context, namespace string) (BudgetSpend, error) {
+	row := q.db.QueryRowContext(ctx, getBudgetSpend, namespace)
+	var i BudgetSpend
+	err := row.Scan(
+		&i.Namespace,
+		&i.PeriodKey,
+		&i.SpentUsd,
+		&i.SpentTokens,
+		&i.ExhaustedAt,
+	)
+	return i, err
+}
+
+const getCacheStats = `-- name: GetCacheStats :one
+SELECT hits, misses FROM cache_stats WHERE namespace = ?
+`
+
+type GetCacheStatsRow struct {
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+}
+
+func (q *Queries) GetCacheStats(ctx context.Context, namespace string) (GetCacheStatsRow, error) {
+	row := q.db.QueryRowContext(ctx, getCacheStats, namespace)
+	var i GetCacheStatsRow
+	err := row.Scan(&i.Hits, &i.Misses)
+	return i, err
+}
+
+const getCachedResponse = `-- name: GetCachedResponse :one
+SELECT namespace, cache_key, response_payload, created_at, expires_at
+FROM response_cache
+WHERE namespace = ? AND cache_key = ? AND expires_at > ?
+`
+
+type GetCachedResponseParams struct {
+	Namespace string `json:"namespace"`
+	CacheKey  string `json:"cache_key"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+func (q *Queries) GetCachedResponse(ctx context.Context, arg GetCachedResponseParams) (ResponseCache, error) {
+	row := q.db.QueryRowContext(ctx, getCachedResponse, arg.Namespace, arg.CacheKey, arg.ExpiresAt)
+	var i ResponseCache
+	err := row.Scan(
+		&i.Namespace,
+		&i.CacheKey,
+		&i.ResponsePayload,
+		&i.CreatedAt,
+		&i.ExpiresAt,
+	)
+	return i, err
+}
+
+const getMaxCompressionDictionaryID = `-- name: GetMaxCompressionDictionaryID :one
+SELECT CAST(COALESCE(MAX(id), 0) AS INTEGER) AS id FROM compression_dictionaries
+`
+
+func (q *Queries) GetMaxCompressionDictionaryID(ctx context.Context) (int64, error) {
+	row := q.db.QueryRowContext(ctx, getMaxCompressionDictionaryID)
+	var id int64
+	err := row.Scan(&id)
+	return id, err
+}
+
 const getNamespace = `-- name: GetNamespace :one
-SELECT name, description, provider_endpoint, provider_api_key, provider_model, provider_headers, created_at, updated_at
+SELECT name, description, provider_endpoint, provider_api_key, provider_model, provider_headers, created_at, updated_at, provider_type, provider_aws, url_template, query_params, budget, cache_config, retention
 FROM namespaces
 WHERE name = ?
 `
@@ -136,6 +527,13 @@ func (q *Queries) GetNamespace(ctx context.Context, name string) (Namespace, err
 		&i.ProviderHeaders,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.ProviderType,
+		&i.ProviderAws,
+		&i.UrlTemplate,
+		&i.QueryParams,
+		&i.Budget,
+		&i.CacheConfig,
+		&i.Retention,
 	)
 	return i, err
 }
@@ -146,17 +544,31 @@ SELECT
     SUM(CASE WHEN status = 'queued' THEN 1 ELSE 0 END) as queued,
     SUM(CASE WHEN status = 'processing' THEN 1 ELSE 0 END) as processing,
     SUM(CASE WHEN status = 'completed' THEN 1 ELSE 0 END) as completed,
-    SUM(CASE WHEN status = 'failed' THEN 1 ELSE 0 END) as failed
+    SUM(CASE WHEN status = 'failed' THEN 1 ELSE 0 END) as failed,
+    SUM(prompt_tokens) as prompt_tokens,
+    SUM(completion_tokens) as completion_tokens,
+    SUM(cached_tokens) as cached_tokens,
+    SUM(reasoning_tokens) as reasoning_tokens,
+    SUM(cost_usd) as cost_usd,
+    SUM(COALESCE(request_size, octet_length(request_payload)) + COALESCE(response_size, octet_length(response_payload), 0)) as payload_bytes,
+    SUM(octet_length(request_payload) + COALESCE(octet_length(response_payload), 0)) as stored_payload_bytes
 FROM requests
 WHERE namespace = ?
 `
 
 type GetNamespaceStatsRow struct {
-	TotalRequests int64           `json:"total_requests"`
-	Queued        sql.NullFloat64 `json:"queued"`
-	Processing    sql.NullFloat64 `json:"processing"`
-	Completed     sql.NullFloat64 `json:"completed"`
-	Failed        sql.NullFloat64 `json:"failed"`
+	TotalRequests      int64           `json:"total_requests"`
+	Queued             sql.NullFloat64 `json:"queued"`
+	Processing         sql.NullFloat64 `json:"processing"`
+	Completed          sql.NullFloat64 `json:"completed"`
+	Failed             sql.NullFloat64 `json:"failed"`
+	PromptTokens       sql.NullFloat64 `json:"prompt_tokens"`
+	CompletionTokens   sql.NullFloat64 `json:"completion_tokens"`
+	CachedTokens       sql.NullFloat64 `json:"cached_tokens"`
+	ReasoningTokens    sql.NullFloat64 `json:"reasoning_tokens"`
+	CostUsd            sql.NullFloat64 `json:"cost_usd"`
+	PayloadBytes       sql.NullFloat64 `json:"payload_bytes"`
+	StoredPayloadBytes sql.NullFloat64 `json:"stored_payload_bytes"`
 }
 
 func (q *Queries) GetNamespaceStats(ctx context.Context, namespace string) (GetNamespaceStatsRow, error) {
@@ -168,19 +580,300 @@ func (q *Queries) GetNamespaceStats(ctx context.Context, namespace string) (GetN
 		&i.Processing,
 		&i.Completed,
 		&i.Failed,
+		&i.PromptTokens,
+		&i.CompletionTokens,
+		&i.CachedTokens,
+		&i.ReasoningTokens,
+		&i.CostUsd,
+		&i.PayloadBytes,
+		&i.StoredPayloadBytes,
+	)
+	return i, err
+}
+
+const getQueuedRequestsByNamespace = `-- name: GetQueuedRequestsByNamespace :many
+SELECT id, namespace, status, request_payload, passthrough_headers, header_endpoint, header_api_key, response_payload, error, created_at, dispatched_at, completed_at, prompt_tokens, completion_tokens, cached_tokens, reasoning_tokens, cost_usd, cache_hit, coalesced_with, lease_owner, lease_expires_at, attempts, request_size, response_size
+FROM requests
+WHERE namespace = ? AND status = 'queued'
+ORDER BY created_at ASC
+`
+
+func (q *Queries) GetQueuedRequestsByNamespace(ctx context.Context, namespace string) ([]Request, error) {
+	rows, err := q.db.QueryContext(ctx, getQueuedRequestsByNamespace, namespace)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Request
+	for rows.Next() {
+		var i Request
+		if err := rows.Scan(
+			&i.ID,
+			&i.Namespace,
+			&i.Status,
+			&i.RequestPayload,
+			&i.PassthroughHeaders,
+			&i.HeaderEndpoint,
+			&i.HeaderApiKey,
+			&i.ResponsePayload,
+			&i.Error,
+			&i.CreatedAt,
+			&i.DispatchedAt,
+			&i.CompletedAt,
+			&i.PromptTokens,
+			&i.CompletionTokens,
+			&i.CachedTokens,
+			&i.ReasoningTokens,
+			&i.CostUsd,
+			&i.CacheHit,
+			&i.CoalescedWith,
+			&i.LeaseOwner,
+			&i.LeaseExpiresAt,
+			&i.Attempts,
+			&i.RequestSize,
+			&i.ResponseSize,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getRequest = `-- name: GetRequest :one
+SELECT id, namespace, status, request_payload, passthrough_headers, header_endpoint, header_api_key, response_payload, error, created_at, dispatched_at, completed_at, prompt_tokens, completion_tokens, cached_tokens, reasoning_tokens, cost_usd, cache_hit, coalesced_with, lease_owner, lease_expires_at, attempts, request_size, response_size
+FROM requests
+WHERE id = ?
+`
+
+func (q *Queries) GetRequest(ctx context.Context, id string) (Request, error) {
+	row := q.db.QueryRowContext(ctx, getRequest, id)
+	var i Request
+	err := row.Scan(
+		&i.ID,
+		&i.Namespace,
+		&i.Status,
+		&i.RequestPayload,
+		&i.PassthroughHeaders,
+		&i.HeaderEndpoint,
+		&i.HeaderApiKey,
+		&i.ResponsePayload,
+		&i.Error,
+		&i.CreatedAt,
+		&i.DispatchedAt,
+		&i.CompletedAt,
+		&i.PromptTokens,
+		&i.CompletionTokens,
+		&i.CachedTokens,
+		&i.ReasoningTokens,
+		&i.CostUsd,
+		&i.CacheHit,
+		&i.CoalescedWith,
+		&i.LeaseOwner,
+		&i.LeaseExpiresAt,
+		&i.Attempts,
+		&i.RequestSize,
+		&i.ResponseSize,
 	)
 	return i, err
 }
 
-const getQueuedRequestsByNamespace = `-- name: GetQueuedRequestsByNamespace :many
-SELECT id, namespace, status, request_payload, passthrough_headers, header_endpoint, header_api_key, response_payload, error, created_at, dispatched_at, completed_at
+const getRequestNamespace = `-- name: GetRequestNamespace :one
+SELECT namespace FROM requests WHERE id = ?
+`
+
+func (q *Queries) GetRequestNamespace(ctx context.Context, id string) (string, error) {
+	row := q.db.QueryRowContext(ctx, getRequestNamespace, id)
+	var namespace string
+	err := row.Scan(&namespace)
+	return namespace, err
+}
+
+const importRequest = `-- name: ImportRequest :exec
+INSERT INTO requests (id, namespace, status, request_payload, passthrough_headers, header_endpoint, header_api_key, response_payload, error, created_at, dispatched_at, completed_at, prompt_tokens, completion_tokens, cached_tokens, reasoning_tokens, cost_usd, cache_hit, coalesced_with, lease_owner, lease_expires_at, attempts, request_size, response_size)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT (id) DO UPDATE SET
+    namespace = excluded.namespace,
+    status = excluded.status,
+    request_payload = excluded.request_payload,
+    passthrough_headers = excluded.passthrough_headers,
+    header_endpoint = excluded.header_endpoint,
+    header_api_key = excluded.header_api_key,
+    response_payload = excluded.response_payload,
+    error = excluded.error,
+    created_at = excluded.created_at,
+    dispatched_at = excluded.dispatched_at,
+    completed_at = excluded.completed_at,
+    prompt_tokens = excluded.prompt_tokens,
+    completion_tokens = excluded.completion_tokens,
+    cached_tokens = excluded.cached_tokens,
+    reasoning_tokens = excluded.reasoning_tokens,
+    cost_usd = excluded.cost_usd,
+    cache_hit = excluded.cache_hit,
+    coalesced_with = excluded.coalesced_with,
+    lease_owner = excluded.lease_owner,
+    lease_expires_at = excluded.lease_expires_at,
+    attempts = excluded.attempts,
+    request_size = excluded.request_size,
+    response_size = excluded.response_size
+`
+
+type ImportRequestParams struct {
+	ID                 string         `json:"id"`
+	Namespace          string         `json:"namespace"`
+	Status             string         `json:"status"`
+	RequestPayload     string         `json:"request_payload"`
+	PassthroughHeaders sql.NullString `json:"passthrough_headers"`
+	HeaderEndpoint     sql.NullString `json:"header_endpoint"`
+	HeaderApiKey       sql.NullString `json:"header_api_key"`
+	ResponsePayload    sql.NullString `json:"response_payload"`
+	Error              sql.NullString `json:"error"`
+	CreatedAt          int64          `json:"created_at"`
+	DispatchedAt       sql.NullInt64  `json:"dispatched_at"`
+	CompletedAt        sql.NullInt64  `json:"completed_at"`
+	PromptTokens       int64          `json:"prompt_tokens"`
+	CompletionTokens   int64          `json:"completion_tokens"`
+	CachedTokens       int64          `json:"cached_tokens"`
+	ReasoningTokens    int64          `json:"reasoning_tokens"`
+	CostUsd            float64        `json:"cost_usd"`
+	CacheHit           int64          `json:"cache_hit"`
+	CoalescedWith      sql.NullString `json:"coalesced_with"`
+	LeaseOwner         sql.NullString `json:"lease_owner"`
+	LeaseExpiresAt     sql.NullInt64  `json:"lease_expires_at"`
+	Attempts           int64          `json:"attempts"`
+	RequestSize        sql.NullInt64  `json:"request_size"`
+	ResponseSize       sql.NullInt64  `json:"response_size"`
+}
+
+func (q *Queries) ImportRequest(ctx context.Context, arg ImportRequestParams) error {
+	_, err := q.db.ExecContext(ctx, importRequest,
+		arg.ID,
+		arg.Namespace,
+		arg.Status,
+		arg.RequestPayload,
+		arg.PassthroughHeaders,
+		arg.HeaderEndpoint,
+		arg.HeaderApiKey,
+		arg.ResponsePayload,
+		arg.Error,
+		arg.CreatedAt,
+		arg.DispatchedAt,
+		arg.CompletedAt,
+		arg.PromptTokens,
+		arg.CompletionTokens,
+		arg.CachedTokens,
+		arg.ReasoningTokens,
+		arg.CostUsd,
+		arg.CacheHit,
+		arg.CoalescedWith,
+		arg.LeaseOwner,
+		arg.LeaseExpiresAt,
+		arg.Attempts,
+		arg.RequestSize,
+		arg.ResponseSize,
+	)
+	return err
+}
+
+const insertDispatchLease = `-- name: InsertDispatchLease :execrows
+INSERT INTO dispatch_leases (namespace, owner, expires_at)
+VALUES (?, ?, ?)
+ON CONFLICT (namespace) DO NOTHING
+`
+
+type InsertDispatchLeaseParams struct {
+	Namespace string `json:"namespace"`
+	Owner     string `json:"owner"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+func (q *Queries) InsertDispatchLease(ctx context.Context, arg InsertDispatchLeaseParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, insertDispatchLease, arg.Namespace, arg.Owner, arg.ExpiresAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const isBlobReferenced = `-- name: IsBlobReferenced :one
+SELECT EXISTS (SELECT 1 FROM request_blobs WHERE hash = ?) AS referenced
+`
+
+func (q *Queries) IsBlobReferenced(ctx context.Context, hash string) (int64, error) {
+	row := q.db.QueryRowContext(ctx, isBlobReferenced, hash)
+	var referenced int64
+	err := row.Scan(&referenced)
+	return referenced, err
+}
+
+const listCompressionDictionaries = `-- name: ListCompressionDictionaries :many
+SELECT id, namespace, dictionary, created_at
+FROM compression_dictionaries
+ORDER BY id
+`
+
+func (q *Queries) ListCompressionDictionaries(ctx context.Context) ([]CompressionDictionary, error) {
+	rows, err := q.db.QueryContext(ctx, listCompressionDictionaries)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []CompressionDictionary
+	for rows.Next() {
+		var i CompressionDictionary
+		if err := rows.Scan(
+			&i.ID,
+			&i.Namespace,
+			&i.Dictionary,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listFinishedRequests = `-- name: ListFinishedRequests :many
+SELECT id, namespace, status, request_payload, passthrough_headers, header_endpoint, header_api_key, response_payload, error, created_at, dispatched_at, completed_at, prompt_tokens, completion_tokens, cached_tokens, reasoning_tokens, cost_usd, cache_hit, coalesced_with, lease_owner, lease_expires_at, attempts, request_size, response_size
 FROM requests
-WHERE namespace = ? AND status = 'queued'
-ORDER BY created_at ASC
+WHERE namespace = ?1 AND status = ?2
+  AND (completed_at > ?3 OR (completed_at = ?3 AND id > ?4))
+  AND completed_at < ?5
+ORDER BY completed_at, id
+LIMIT ?6
 `
 
-func (q *Queries) GetQueuedRequestsByNamespace(ctx context.Context, namespace string) ([]Request, error) {
-	rows, err := q.db.QueryContext(ctx, getQueuedRequestsByNamespace, namespace)
+type ListFinishedRequestsParams struct {
+	Namespace string        `json:"namespace"`
+	Status    string        `json:"status"`
+	Since     sql.NullInt64 `json:"since"`
+	AfterID   string        `json:"after_id"`
+	Until     sql.NullInt64 `json:"until"`
+	Limit     int64         `json:"limit"`
+}
+
+func (q *Queries) ListFinishedRequests(ctx context.Context, arg ListFinishedRequestsParams) ([]Request, error) {
+	rows, err := q.db.QueryContext(ctx, listFinishedRequests,
+		arg.Namespace,
+		arg.Status,
+		arg.Since,
+		arg.AfterID,
+		arg.Until,
+		arg.Limit,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -201,6 +894,18 @@ func (q *Queries) GetQueuedRequestsByNamespace(ctx context.Context, namespace st
 			&i.CreatedAt,
 			&i.DispatchedAt,
 			&i.CompletedAt,
+			&i.PromptTokens,
+			&i.CompletionTokens,
+			&i.CachedTokens,
+			&i.ReasoningTokens,
+			&i.CostUsd,
+			&i.CacheHit,
+			&i.CoalescedWith,
+			&i.LeaseOwner,
+			&i.LeaseExpiresAt,
+			&i.Attempts,
+			&i.RequestSize,
+			&i.ResponseSize,
 		); err != nil {
 			return nil, err
 		}
@@ -215,34 +920,38 @@ func (q *Queries) GetQueuedRequestsByNamespace(ctx context.Context, namespace st
 	return items, nil
 }
 
-const getRequest = `-- name: GetRequest :one
-SELECT id, namespace, status, request_payload, passthrough_headers, header_endpoint, header_api_key, response_payload, error, created_at, dispatched_at, completed_at
-FROM requests
-WHERE id = ?
+const listNamespaceBlobs = `-- name: ListNamespaceBlobs :many
+SELECT DISTINCT request_blobs.hash
+FROM request_blobs
+JOIN requests ON requests.id = request_blobs.request_id
+WHERE requests.namespace = ?
 `
 
-func (q *Queries) GetRequest(ctx context.Context, id string) (Request, error) {
-	row := q.db.QueryRowContext(ctx, getRequest, id)
-	var i Request
-	err := row.Scan(
-		&i.ID,
-		&i.Namespace,
-		&i.Status,
-		&i.RequestPayload,
-		&i.PassthroughHeaders,
-		&i.HeaderEndpoint,
-		&i.HeaderApiKey,
-		&i.ResponsePayload,
-		&i.Error,
-		&i.CreatedAt,
-		&i.DispatchedAt,
-		&i.CompletedAt,
-	)
-	return i, err
+func (q *Queries) ListNamespaceBlobs(ctx context.Context, namespace string) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, listNamespaceBlobs, namespace)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			return nil, err
+		}
+		items = append(items, hash)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
 }
 
 const listNamespaces = `-- name: ListNamespaces :many
-SELECT name, description, provider_endpoint, provider_api_key, provider_model, provider_headers, created_at, updated_at
+SELECT name, description, provider_endpoint, provider_api_key, provider_model, provider_headers, created_at, updated_at, provider_type, provider_aws, url_template, query_params, budget, cache_config, retention
 FROM namespaces
 ORDER BY name
 `
@@ -265,6 +974,13 @@ func (q *Queries) ListNamespaces(ctx context.Context) ([]Namespace, error) {
 			&i.ProviderHeaders,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.ProviderType,
+			&i.ProviderAws,
+			&i.UrlTemplate,
+			&i.QueryParams,
+			&i.Budget,
+			&i.CacheConfig,
+			&i.Retention,
 		); err != nil {
 			return nil, err
 		}
@@ -279,14 +995,124 @@ func (q *Queries) ListNamespaces(ctx context.Context) ([]Namespace, error) {
 	return items, nil
 }
 
-const listRequestsByNamespace = `-- name: ListRequestsByNamespace :many
-SELECT id, namespace, status, request_payload, passthrough_headers, header_endpoint, header_api_key, response_payload, error, created_at, dispatched_at, completed_at
+const listPayloadSamples = `-- name: ListPayloadSamples :many
+SELECT request_payload, response_payload
 FROM requests
 WHERE namespace = ?
 ORDER BY created_at DESC
 LIMIT ?
 `
 
+type ListPayloadSamplesParams struct {
+	Namespace string `json:"namespace"`
+	Limit     int64  `json:"limit"`
+}
+
+type ListPayloadSamplesRow struct {
+	RequestPayload  string         `json:"request_payload"`
+	ResponsePayload sql.NullString `json:"response_payload"`
+}
+
+func (q *Queries) ListPayloadSamples(ctx context.Context, arg ListPayloadSamplesParams) ([]ListPayloadSamplesRow, error) {
+	rows, err := q.db.QueryContext(ctx, listPayloadSamples, arg.Namespace, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListPayloadSamplesRow
+	for rows.Next() {
+		var i ListPayloadSamplesRow
+		if err := rows.Scan(&i.RequestPayload, &i.ResponsePayload); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listPurgeableRequests = `-- name: ListPurgeableRequests :many
+SELECT id FROM requests
+WHERE namespace = ? AND status = ? AND completed_at < ?
+ORDER BY completed_at
+LIMIT ?
+`
+
+type ListPurgeableRequestsParams struct {
+	Namespace   string        `json:"namespace"`
+	Status      string        `json:"status"`
+	CompletedAt sql.NullInt64 `json:"completed_at"`
+	Limit       int64         `json:"limit"`
+}
+
+func (q *Queries) ListPurgeableRequests(ctx context.Context, arg ListPurgeableRequestsParams) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, listPurgeableRequests,
+		arg.Namespace,
+		arg.Status,
+		arg.CompletedAt,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listRequestBlobs = `-- name: ListRequestBlobs :many
+SELECT hash FROM request_blobs WHERE request_id = ?
+`
+
+func (q *Queries) ListRequestBlobs(ctx context.Context, requestID string) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, listRequestBlobs, requestID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			return nil, err
+		}
+		items = append(items, hash)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listRequestsByNamespace = `-- name: ListRequestsByNamespace :many
+SELECT id, namespace, status, request_payload, passthrough_headers, header_endpoint, header_api_key, response_payload, error, created_at, dispatched_at, completed_at, prompt_tokens, completion_tokens, cached_tokens, reasoning_tokens, cost_usd, cache_hit, coalesced_with, lease_owner, lease_expires_at, attempts, request_size, response_size
+FROM requests
+WHERE namespace = ?
+ORDER BY created_at DESC, id DESC
+LIMIT ?
+`
+
 type ListRequestsByNamespaceParams struct {
 	Namespace string `json:"namespace"`
 	Limit     int64  `json:"limit"`
@@ -314,6 +1140,18 @@ func (q *Queries) ListRequestsByNamespace(ctx context.Context, arg ListRequestsB
 			&i.CreatedAt,
 			&i.DispatchedAt,
 			&i.CompletedAt,
+			&i.PromptTokens,
+			&i.CompletionTokens,
+			&i.CachedTokens,
+			&i.ReasoningTokens,
+			&i.CostUsd,
+			&i.CacheHit,
+			&i.CoalescedWith,
+			&i.LeaseOwner,
+			&i.LeaseExpiresAt,
+			&i.Attempts,
+			&i.RequestSize,
+			&i.ResponseSize,
 		); err != nil {
 			return nil, err
 		}
@@ -329,10 +1167,10 @@ func (q *Queries) ListRequestsByNamespace(ctx context.Context, arg ListRequestsB
 }
 
 const listRequestsByNamespaceAndStatus = `-- name: ListRequestsByNamespaceAndStatus :many
-SELECT id, namespace, status, request_payload, passthrough_headers, header_endpoint, header_api_key, response_payload, error, created_at, dispatched_at, completed_at
+SELECT id, namespace, status, request_payload, passthrough_headers, header_endpoint, header_api_key, response_payload, error, created_at, dispatched_at, completed_at, prompt_tokens, completion_tokens, cached_tokens, reasoning_tokens, cost_usd, cache_hit, coalesced_with, lease_owner, lease_expires_at, attempts, request_size, response_size
 FROM requests
 WHERE namespace = ? AND status = ?
-ORDER BY created_at DESC
+ORDER BY created_at DESC, id DESC
 LIMIT ?
 `
 
@@ -364,6 +1202,18 @@ func (q *Queries) ListRequestsByNamespaceAndStatus(ctx context.Context, arg List
 			&i.CreatedAt,
 			&i.DispatchedAt,
 			&i.CompletedAt,
+			&i.PromptTokens,
+			&i.CompletionTokens,
+			&i.CachedTokens,
+			&i.ReasoningTokens,
+			&i.CostUsd,
+			&i.CacheHit,
+			&i.CoalescedWith,
+			&i.LeaseOwner,
+			&i.LeaseExpiresAt,
+			&i.Attempts,
+			&i.RequestSize,
+			&i.ResponseSize,
 		); err != nil {
 			return nil, err
 		}
@@ -379,17 +1229,19 @@ func (q *Queries) ListRequestsByNamespaceAndStatus(ctx context.Context, arg List
 }
 
 const listRequestsByNamespaceAndStatusWithCursor = `-- name: ListRequestsByNamespaceAndStatusWithCursor :many
-SELECT id, namespace, status, request_payload, passthrough_headers, header_endpoint, header_api_key, response_payload, error, created_at, dispatched_at, completed_at
+SELECT id, namespace, status, request_payload, passthrough_headers, header_endpoint, header_api_key, response_payload, error, created_at, dispatched_at, completed_at, prompt_tokens, completion_tokens, cached_tokens, reasoning_tokens, cost_usd, cache_hit, coalesced_with, lease_owner, lease_expires_at, attempts, request_size, response_size
 FROM requests
-WHERE namespace = ? AND status = ? AND created_at < ?
-ORDER BY created_at DESC
-LIMIT ?
+WHERE namespace = ?1 AND status = ?2
+  AND (created_at < ?3 OR (created_at = ?3 AND id < ?4))
+ORDER BY created_at DESC, id DESC
+LIMIT ?5
 `
 
 type ListRequestsByNamespaceAndStatusWithCursorParams struct {
 	Namespace string `json:"namespace"`
 	Status    string `json:"status"`
 	CreatedAt int64  `json:"created_at"`
+	CursorID  string `json:"cursor_id"`
 	Limit     int64  `json:"limit"`
 }
 
@@ -398,6 +1250,7 @@ func (q *Queries) ListRequestsByNamespaceAndStatusWithCursor(ctx context.Context
 		arg.Namespace,
 		arg.Status,
 		arg.CreatedAt,
+		arg.CursorID,
 		arg.Limit,
 	)
 	if err != nil {
@@ -420,6 +1273,18 @@ func (q *Queries) ListRequestsByNamespaceAndStatusWithCursor(ctx context.Context
 			&i.CreatedAt,
 			&i.DispatchedAt,
 			&i.CompletedAt,
+			&i.PromptTokens,
+			&i.CompletionTokens,
+			&i.CachedTokens,
+			&i.ReasoningTokens,
+			&i.CostUsd,
+			&i.CacheHit,
+			&i.CoalescedWith,
+			&i.LeaseOwner,
+			&i.LeaseExpiresAt,
+			&i.Attempts,
+			&i.RequestSize,
+			&i.ResponseSize,
 		); err != nil {
 			return nil, err
 		}
@@ -435,21 +1300,28 @@ func (q *Queries) ListRequestsByNamespaceAndStatusWithCursor(ctx context.Context
 }
 
 const listRequestsByNamespaceWithCursor = `-- name: ListRequestsByNamespaceWithCursor :many
-SELECT id, namespace, status, request_payload, passthrough_headers, header_endpoint, header_api_key, response_payload, error, created_at, dispatched_at, completed_at
+SELECT id, namespace, status, request_payload, passthrough_headers, header_endpoint, header_api_key, response_payload, error, created_at, dispatched_at, completed_at, prompt_tokens, completion_tokens, cached_tokens, reasoning_tokens, cost_usd, cache_hit, coalesced_with, lease_owner, lease_expires_at, attempts, request_size, response_size
 FROM requests
-WHERE namespace = ? AND created_at < ?
-ORDER BY created_at DESC
-LIMIT ?
+WHERE namespace = ?1
+  AND (created_at < ?2 OR (created_at = ?2 AND id < ?3))
+ORDER BY created_at DESC, id DESC
+LIMIT ?4
 `
 
 type ListRequestsByNamespaceWithCursorParams struct {
 	Namespace string `json:"namespace"`
 	CreatedAt int64  `json:"created_at"`
+	CursorID  string `json:"cursor_id"`
 	Limit     int64  `json:"limit"`
 }
 
 func (q *Queries) ListRequestsByNamespaceWithCursor(ctx context.Context, arg ListRequestsByNamespaceWithCursorParams) ([]Request, error) {
-	rows, err := q.db.QueryContext(ctx, listRequestsByNamespaceWithCursor, arg.Namespace, arg.CreatedAt, arg.Limit)
+	rows, err := q.db.QueryContext(ctx, listRequestsByNamespaceWithCursor,
+		arg.Namespace,
+		arg.CreatedAt,
+		arg.CursorID,
+		arg.Limit,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -470,6 +1342,18 @@ func (q *Queries) ListRequestsByNamespaceWithCursor(ctx context.Context, arg Lis
 			&i.CreatedAt,
 			&i.DispatchedAt,
 			&i.CompletedAt,
+			&i.PromptTokens,
+			&i.CompletionTokens,
+			&i.CachedTokens,
+			&i.ReasoningTokens,
+			&i.CostUsd,
+			&i.CacheHit,
+			&i.CoalescedWith,
+			&i.LeaseOwner,
+			&i.LeaseExpiresAt,
+			&i.Attempts,
+			&i.RequestSize,
+			&i.ResponseSize,
 		); err != nil {
 			return nil, err
 		}
@@ -484,9 +1368,159 @@ func (q *Queries) ListRequestsByNamespaceWithCursor(ctx context.Context, arg Lis
 	return items, nil
 }
 
+const putCachedResponse = `-- name: PutCachedResponse :exec
+INSERT INTO response_cache (namespace, cache_key, response_payload, created_at, expires_at)
+VALUES (?, ?, ?, ?, ?)
+ON CONFLICT (namespace, cache_key) DO UPDATE SET
+    response_payload = excluded.response_payload,
+    created_at = excluded.created_at,
+    expires_at = excluded.expires_at
+`
+
+type PutCachedResponseParams struct {
+	Namespace       string `json:"namespace"`
+	CacheKey        string `json:"cache_key"`
+	ResponsePayload string `json:"response_payload"`
+	CreatedAt       int64  `json:"created_at"`
+	ExpiresAt       int64  `json:"expires_at"`
+}
+
+func (q *Queries) PutCachedResponse(ctx context.Context, arg PutCachedResponseParams) error {
+	_, err := q.db.ExecContext(ctx, putCachedResponse,
+		arg.Namespace,
+		arg.CacheKey,
+		arg.ResponsePayload,
+		arg.CreatedAt,
+		arg.ExpiresAt,
+	)
+	return err
+}
+
+const recordCacheHit = `-- name: RecordCacheHit :exec
+INSERT INTO cache_stats (namespace, hits, misses)
+VALUES (?, 1, 0)
+ON CONFLICT (namespace) DO UPDATE SET hits = cache_stats.hits + 1
+`
+
+func (q *Queries) RecordCacheHit(ctx context.Context, namespace string) error {
+	_, err := q.db.ExecContext(ctx, recordCacheHit, namespace)
+	return err
+}
+
+const recordCacheMiss = `-- name: RecordCacheMiss :exec
+INSERT INTO cache_stats (namespace, hits, misses)
+VALUES (?, 0, 1)
+ON CONFLICT (namespace) DO UPDATE SET misses = cache_stats.misses + 1
+`
+
+func (q *Queries) RecordCacheMiss(ctx context.Context, namespace string) error {
+	_, err := q.db.ExecContext(ctx, recordCacheMiss, namespace)
+	return err
+}
+
+const releaseDispatchLease = `-- name: ReleaseDispatchLease :exec
+DELETE FROM dispatch_leases WHERE namespace = ? AND owner = ?
+`
+
+type ReleaseDispatchLeaseParams struct {
+	Namespace string `json:"namespace"`
+	Owner     string `json:"owner"`
+}
+
+func (q *Queries) ReleaseDispatchLease(ctx context.Context, arg ReleaseDispatchLeaseParams) error {
+	_, err := q.db.ExecContext(ctx, releaseDispatchLease, arg.Namespace, arg.Owner)
+	return err
+}
+
+const releaseRequest = `-- name: ReleaseRequest :exec
+UPDATE requests
+SET status = 'queued', dispatched_at = NULL, lease_owner = NULL, lease_expires_at = NULL, attempts = MAX(attempts - 1, 0)
+WHERE id = ?1 AND status = 'processing'
+  AND (CAST(?2 AS TEXT) = '' OR lease_owner = ?2)
+`
+
+type ReleaseRequestParams struct {
+	ID         string `json:"id"`
+	LeaseOwner string `json:"lease_owner"`
+}
+
+func (q *Queries) ReleaseRequest(ctx context.Context, arg ReleaseRequestParams) error {
+	_, err := q.db.ExecContext(ctx, releaseRequest, arg.ID, arg.LeaseOwner)
+	return err
+}
+
+const requeueExpiredLeases = `-- name: RequeueExpiredLeases :execrows
+UPDATE requests
+SET status = 'queued', dispatched_at = NULL, lease_owner = NULL, lease_expires_at = NULL
+WHERE status = 'processing'
+  AND (lease_expires_at IS NULL OR lease_expires_at < ? OR lease_owner = ?)
+`
+
+type RequeueExpiredLeasesParams struct {
+	LeaseExpiresAt sql.NullInt64  `json:"lease_expires_at"`
+	LeaseOwner     sql.NullString `json:"lease_owner"`
+}
+
+func (q *Queries) RequeueExpiredLeases(ctx context.Context, arg RequeueExpiredLeasesParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, requeueExpiredLeases, arg.LeaseExpiresAt, arg.LeaseOwner)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const setBudgetExhausted = `-- name: SetBudgetExhausted :exec
+INSERT INTO budget_spend (namespace, period_key, exhausted_at)
+VALUES (?, ?, ?)
+ON CONFLICT (namespace) DO UPDATE SET
+    spent_usd = CASE WHEN budget_spend.period_key = excluded.period_key THEN budget_spend.spent_usd ELSE 0 END,
+    spent_tokens = CASE WHEN budget_spend.period_key = excluded.period_key THEN budget_spend.spent_tokens ELSE 0 END,
+    exhausted_at = excluded.exhausted_at,
+    period_key = excluded.period_key
+`
+
+type SetBudgetExhaustedParams struct {
+	Namespace   string        `json:"namespace"`
+	PeriodKey   string        `json:"period_key"`
+	ExhaustedAt sql.NullInt64 `json:"exhausted_at"`
+}
+
+func (q *Queries) SetBudgetExhausted(ctx context.Context, arg SetBudgetExhaustedParams) error {
+	_, err := q.db.ExecContext(ctx, setBudgetExhausted, arg.Namespace, arg.PeriodKey, arg.ExhaustedAt)
+	return err
+}
+
+const takeDispatchLease = `-- name: TakeDispatchLease :execrows
+UPDATE dispatch_leases
+SET owner = ?, expires_at = ?
+WHERE namespace = ? AND (owner = ? OR expires_at < ?)
+`
+
+type TakeDispatchLeaseParams struct {
+	Owner       string `json:"owner"`
+	ExpiresAt   int64  `json:"expires_at"`
+	Namespace   string `json:"namespace"`
+	Owner_2     string `json:"owner_2"`
+	ExpiresAt_2 int64  `json:"expires_at_2"`
+}
+
+func (q *Queries) TakeDispatchLease(ctx context.Context, arg TakeDispatchLeaseParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, takeDispatchLease,
+		arg.Owner,
+		arg.ExpiresAt,
+		arg.Namespace,
+		arg.Owner_2,
+		arg.ExpiresAt_2,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const updateNamespace = `-- name: UpdateNamespace :exec
 UPDATE namespaces
-SET description = ?, provider_endpoint = ?, provider_api_key = ?, provider_model = ?, provider_headers = ?, updated_at = ?
+SET description = ?, provider_endpoint = ?, provider_api_key = ?, provider_model = ?, provider_headers = ?, provider_type = ?, provider_aws = ?, url_template = ?, query_params = ?, budget = ?, cache_config = ?, retention = ?, updated_at = ?
 WHERE name = ?
 `
 
@@ -496,6 +1530,13 @@ type UpdateNamespaceParams struct {
 	ProviderApiKey   sql.NullString `json:"provider_api_key"`
 	ProviderModel    sql.NullString `json:"provider_model"`
 	ProviderHeaders  sql.NullString `json:"provider_headers"`
+	ProviderType     string         `json:"provider_type"`
+	ProviderAws      sql.NullString `json:"provider_aws"`
+	UrlTemplate      sql.NullString `json:"url_template"`
+	QueryParams      sql.NullString `json:"query_params"`
+	Budget           sql.NullString `json:"budget"`
+	CacheConfig      sql.NullString `json:"cache_config"`
+	Retention        sql.NullString `json:"retention"`
 	UpdatedAt        int64          `json:"updated_at"`
 	Name             string         `json:"name"`
 }
@@ -507,40 +1548,152 @@ func (q *Queries) UpdateNamespace(ctx context.Context, arg UpdateNamespaceParams
 		arg.ProviderApiKey,
 		arg.ProviderModel,
 		arg.ProviderHeaders,
+		arg.ProviderType,
+		arg.ProviderAws,
+		arg.UrlTemplate,
+		arg.QueryParams,
+		arg.Budget,
+		arg.CacheConfig,
+		arg.Retention,
 		arg.UpdatedAt,
 		arg.Name,
 	)
 	return err
 }
 
-const updateRequestError = `-- name: UpdateRequestError :exec
-UPDATE requests SET status = 'failed', error = ?, completed_at = ? WHERE id = ?
+const updateRequestCacheHit = `-- name: UpdateRequestCacheHit :execrows
+UPDATE requests
+SET status = 'completed', response_payload = ?1, response_size = ?2, completed_at = ?3,
+    cache_hit = 1, lease_owner = NULL, lease_expires_at = NULL
+WHERE id = ?4
+  AND (CAST(?5 AS TEXT) = '' OR (status = 'processing' AND lease_owner = ?5))
+`
+
+type UpdateRequestCacheHitParams struct {
+	ResponsePayload sql.NullString `json:"response_payload"`
+	ResponseSize    sql.NullInt64  `json:"response_size"`
+	CompletedAt     sql.NullInt64  `json:"completed_at"`
+	ID              string         `json:"id"`
+	LeaseOwner      string         `json:"lease_owner"`
+}
+
+func (q *Queries) UpdateRequestCacheHit(ctx context.Context, arg UpdateRequestCacheHitParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, updateRequestCacheHit,
+		arg.ResponsePayload,
+		arg.ResponseSize,
+		arg.CompletedAt,
+		arg.ID,
+		arg.LeaseOwner,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const updateRequestCoalesced = `-- name: UpdateRequestCoalesced :execrows
+UPDATE requests
+SET status = ?1, response_payload = ?2, response_size = ?3, error = ?4,
+    completed_at = ?5, coalesced_with = ?6, lease_owner = NULL, lease_expires_at = NULL
+WHERE id = ?7
+  AND (CAST(?8 AS TEXT) = '' OR (status = 'processing' AND lease_owner = ?8))
+`
+
+type UpdateRequestCoalescedParams struct {
+	Status          string         `json:"status"`
+	ResponsePayload sql.NullString `json:"response_payload"`
+	ResponseSize    sql.NullInt64  `json:"response_size"`
+	Error           sql.NullString `json:"error"`
+	CompletedAt     sql.NullInt64  `json:"completed_at"`
+	CoalescedWith   sql.NullString `json:"coalesced_with"`
+	ID              string         `json:"id"`
+	LeaseOwner      string         `json:"lease_owner"`
+}
+
+func (q *Queries) UpdateRequestCoalesced(ctx context.Context, arg UpdateRequestCoalescedParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, updateRequestCoalesced,
+		arg.Status,
+		arg.ResponsePayload,
+		arg.ResponseSize,
+		arg.Error,
+		arg.CompletedAt,
+		arg.CoalescedWith,
+		arg.ID,
+		arg.LeaseOwner,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const updateRequestError = `-- name: UpdateRequestError :execrows
+UPDATE requests
+SET status = 'failed', error = ?1, completed_at = ?2, lease_owner = NULL, lease_expires_at = NULL
+WHERE id = ?3
+  AND (CAST(?4 AS TEXT) = '' OR (status = 'processing' AND lease_owner = ?4))
 `
 
 type UpdateRequestErrorParams struct {
 	Error       sql.NullString `json:"error"`
 	CompletedAt sql.NullInt64  `json:"completed_at"`
 	ID          string         `json:"id"`
+	LeaseOwner  string         `json:"lease_owner"`
 }
 
-func (q *Queries) UpdateRequestError(ctx context.Context, arg UpdateRequestErrorParams) error {
-	_, err := q.db.ExecContext(ctx, updateRequestError, arg.Error, arg.CompletedAt, arg.ID)
-	return err
+func (q *Queries) UpdateRequestError(ctx context.Context, arg UpdateRequestErrorParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, updateRequestError,
+		arg.Error,
+		arg.CompletedAt,
+		arg.ID,
+		arg.LeaseOwner,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
 }
 
-const updateRequestResponse = `-- name: UpdateRequestResponse :exec
-UPDATE requests SET status = 'completed', response_payload = ?, completed_at = ? WHERE id = ?
+const updateRequestResponse = `-- name: UpdateRequestResponse :execrows
+UPDATE requests
+SET status = 'completed', response_payload = ?1, response_size = ?2, completed_at = ?3,
+    prompt_tokens = ?4, completion_tokens = ?5, cached_tokens = ?6,
+    reasoning_tokens = ?7, cost_usd = ?8,
+    lease_owner = NULL, lease_expires_at = NULL
+WHERE id = ?9
+  AND (CAST(?10 AS TEXT) = '' OR (status = 'processing' AND lease_owner = ?10))
 `
 
 type UpdateRequestResponseParams struct {
-	ResponsePayload sql.NullString `json:"response_payload"`
-	CompletedAt     sql.NullInt64  `json:"completed_at"`
-	ID              string         `json:"id"`
+	ResponsePayload  sql.NullString `json:"response_payload"`
+	ResponseSize     sql.NullInt64  `json:"response_size"`
+	CompletedAt      sql.NullInt64  `json:"completed_at"`
+	PromptTokens     int64          `json:"prompt_tokens"`
+	CompletionTokens int64          `json:"completion_tokens"`
+	CachedTokens     int64          `json:"cached_tokens"`
+	ReasoningTokens  int64          `json:"reasoning_tokens"`
+	CostUsd          float64        `json:"cost_usd"`
+	ID               string         `json:"id"`
+	LeaseOwner       string         `json:"lease_owner"`
 }
 
-func (q *Queries) UpdateRequestResponse(ctx context.Context, arg UpdateRequestResponseParams) error {
-	_, err := q.db.ExecContext(ctx, updateRequestResponse, arg.ResponsePayload, arg.CompletedAt, arg.ID)
-	return err
+func (q *Queries) UpdateRequestResponse(ctx context.Context, arg UpdateRequestResponseParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, updateRequestResponse,
+		arg.ResponsePayload,
+		arg.ResponseSize,
+		arg.CompletedAt,
+		arg.PromptTokens,
+		arg.CompletionTokens,
+		arg.CachedTokens,
+		arg.ReasoningTokens,
+		arg.CostUsd,
+		arg.ID,
+		arg.LeaseOwner,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
 }
 
 const updateRequestStatus = `-- name: UpdateRequestStatus :exec
@@ -3,29 +3,92 @@ package sqlite
 import (
 	"context"
 	"database/sql"
-	_ "embed"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 
 	"github.com/georgeshao/ai-inference-dam/internal/storage"
+	"github.com/georgeshao/ai-inference-dam/internal/storage/blob"
+	"github.com/georgeshao/ai-inference-dam/internal/storage/compression"
 	"github.com/georgeshao/ai-inference-dam/internal/storage/sqlite/sqlc"
 	"github.com/georgeshao/ai-inference-dam/pkg/types"
 )
 
-//go:embed schema.sql
-var schemaSQL string
-
 type SQLiteStore struct {
 	db      *sql.DB
 	queries *sqlc.Queries
+	codec   *compression.Codec
+	blobs   *blob.Store
+}
+
+// Option configures a store when it is opened.
+type Option func(*options)
+
+type options struct {
+	compression compression.Options
+	blobs       blob.Options
+}
+
+// WithCompression compresses new request and response payloads at rest.
+// Payloads already stored are readable whatever the options.
+func WithCompression(opts compression.Options) Option {
+	return func(o *options) {
+		o.compression = opts
+	}
+}
+
+// WithBlobs offloads new payloads over the threshold to a blob directory.
+// Payloads already offloaded need the directory to be read.
+func WithBlobs(opts blob.Options) Option {
+	return func(o *options) {
+		o.blobs = opts
+	}
 }
 
-func New(dbPath string) (*SQLiteStore, error) {
+// New opens the database and applies any pending schema migrations.
+func New(dbPath string, opts ...Option) (*SQLiteStore, error) {
+	store, err := Open(dbPath, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := store.Migrate(context.Background()); err != nil {
+		store.Close()
+		return nil, fmt.Errorf("failed to migrate schema: %w", err)
+	}
+
+	if err := store.loadDictionaries(context.Background()); err != nil {
+		store.Close()
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// Open opens the database without touching its schema, for inspecting
+// pending migrations before applying them.
+func Open(dbPath string, opts ...Option) (*SQLiteStore, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	codec, err := compression.NewCodec(o.compression)
+	if err != nil {
+		return nil, err
+	}
+
+	var blobs *blob.Store
+	if o.blobs.Dir != "" {
+		if blobs, err = blob.Open(o.blobs, codec); err != nil {
+			return nil, err
+		}
+	}
+
 	// Ensure directory exists
 	dir := filepath.Dir(dbPath)
 	if err := os.MkdirAll(dir, 0755); err != nil {
@@ -43,25 +106,16 @@ func New(dbPath string) (*SQLiteStore, error) {
 	db.SetMaxIdleConns(1)
 	db.SetConnMaxLifetime(time.Hour)
 
-	store := &SQLiteStore{
+	return &SQLiteStore{
 		db:      db,
 		queries: sqlc.New(db),
-	}
-
-	if err := store.initSchema(); err != nil {
-		db.Close()
-		return nil, fmt.Errorf("failed to initialize schema: %w", err)
-	}
-
-	return store, nil
-}
-
-func (s *SQLiteStore) initSchema() error {
-	_, err := s.db.Exec(schemaSQL)
-	return err
+		codec:   codec,
+		blobs:   blobs,
+	}, nil
 }
 
 func (s *SQLiteStore) Close() error {
+	s.codec.Close()
 	return s.db.Close()
 }
 
@@ -71,6 +125,31 @@ func (s *SQLiteStore) CreateNamespace(ctx context.Context, ns *storage.Namespace
 		return fmt.Errorf("failed to marshal headers: %w", err)
 	}
 
+	aws, err := json.Marshal(ns.ProviderAWS)
+	if err != nil {
+		return fmt.Errorf("failed to marshal aws credentials: %w", err)
+	}
+
+	queryParams, err := json.Marshal(ns.QueryParams)
+	if err != nil {
+		return fmt.Errorf("failed to marshal query params: %w", err)
+	}
+
+	budget, err := json.Marshal(ns.Budget)
+	if err != nil {
+		return fmt.Errorf("failed to marshal budget: %w", err)
+	}
+
+	cacheConfig, err := json.Marshal(ns.Cache)
+	if err != nil {
+		return fmt.Errorf("failed to marshal cache config: %w", err)
+	}
+
+	retention, err := json.Marshal(ns.Retention)
+	if err != nil {
+		return fmt.Errorf("failed to marshal retention policy: %w", err)
+	}
+
 	return s.queries.CreateNamespace(ctx, sqlc.CreateNamespaceParams{
 		Name:             ns.Name,
 		Description:      ns.Description,
@@ -78,6 +157,13 @@ func (s *SQLiteStore) CreateNamespace(ctx context.Context, ns *storage.Namespace
 		ProviderApiKey:   toNullString(ns.ProviderAPIKey),
 		ProviderModel:    toNullString(ns.ProviderModel),
 		ProviderHeaders:  sql.NullString{String: string(headers), Valid: len(ns.ProviderHeaders) > 0},
+		ProviderType:     string(ns.ProviderType),
+		ProviderAws:      sql.NullString{String: string(aws), Valid: ns.ProviderAWS != nil},
+		UrlTemplate:      toNullString(ns.URLTemplate),
+		QueryParams:      sql.NullString{String: string(queryParams), Valid: len(ns.QueryParams) > 0},
+		Budget:           sql.NullString{String: string(budget), Valid: ns.Budget != nil},
+		CacheConfig:      sql.NullString{String: string(cacheConfig), Valid: ns.Cache != nil},
+		Retention:        sql.NullString{String: string(retention), Valid: ns.Retention != nil},
 		CreatedAt:        ns.CreatedAt.Unix(),
 		UpdatedAt:        ns.UpdatedAt.Unix(),
 	})
@@ -101,6 +187,31 @@ func (s *SQLiteStore) UpdateNamespace(ctx context.Context, name string, ns *stor
 		return fmt.Errorf("failed to marshal headers: %w", err)
 	}
 
+	aws, err := json.Marshal(ns.ProviderAWS)
+	if err != nil {
+		return fmt.Errorf("failed to marshal aws credentials: %w", err)
+	}
+
+	queryParams, err := json.Marshal(ns.QueryParams)
+	if err != nil {
+		return fmt.Errorf("failed to marshal query params: %w", err)
+	}
+
+	budget, err := json.Marshal(ns.Budget)
+	if err != nil {
+		return fmt.Errorf("failed to marshal budget: %w", err)
+	}
+
+	cacheConfig, err := json.Marshal(ns.Cache)
+	if err != nil {
+		return fmt.Errorf("failed to marshal cache config: %w", err)
+	}
+
+	retention, err := json.Marshal(ns.Retention)
+	if err != nil {
+		return fmt.Errorf("failed to marshal retention policy: %w", err)
+	}
+
 	return s.queries.UpdateNamespace(ctx, sqlc.UpdateNamespaceParams{
 		Name:             name,
 		Description:      ns.Description,
@@ -108,6 +219,13 @@ func (s *SQLiteStore) UpdateNamespace(ctx context.Context, name string, ns *stor
 		ProviderApiKey:   toNullString(ns.ProviderAPIKey),
 		ProviderModel:    toNullString(ns.ProviderModel),
 		ProviderHeaders:  sql.NullString{String: string(headers), Valid: len(ns.ProviderHeaders) > 0},
+		ProviderType:     string(ns.ProviderType),
+		ProviderAws:      sql.NullString{String: string(aws), Valid: ns.ProviderAWS != nil},
+		UrlTemplate:      toNullString(ns.URLTemplate),
+		QueryParams:      sql.NullString{String: string(queryParams), Valid: len(ns.QueryParams) > 0},
+		Budget:           sql.NullString{String: string(budget), Valid: ns.Budget != nil},
+		CacheConfig:      sql.NullString{String: string(cacheConfig), Valid: ns.Cache != nil},
+		Retention:        sql.NullString{String: string(retention), Valid: ns.Retention != nil},
 		UpdatedAt:        ns.UpdatedAt.Unix(),
 	})
 }
@@ -121,11 +239,40 @@ func (s *SQLiteStore) DeleteNamespace(ctx context.Context, name string) (int, er
 
 	qtx := s.queries.WithTx(tx)
 
+	blobHashes, err := qtx.ListNamespaceBlobs(ctx, name)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list blob references: %w", err)
+	}
+
+	if err := qtx.DeleteNamespaceBlobs(ctx, name); err != nil {
+		return 0, fmt.Errorf("failed to delete blob references: %w", err)
+	}
+
 	deletedRequests, err := qtx.DeleteRequestsByNamespace(ctx, name)
 	if err != nil {
 		return 0, fmt.Errorf("failed to delete requests: %w", err)
 	}
 
+	if err := qtx.DeleteBudgetSpend(ctx, name); err != nil {
+		return 0, fmt.Errorf("failed to delete budget spend: %w", err)
+	}
+
+	if err := qtx.DeleteCachedResponsesByNamespace(ctx, name); err != nil {
+		return 0, fmt.Errorf("failed to delete cached responses: %w", err)
+	}
+
+	if err := qtx.DeleteCacheStats(ctx, name); err != nil {
+		return 0, fmt.Errorf("failed to delete cache stats: %w", err)
+	}
+
+	if err := qtx.DeleteDispatchLease(ctx, name); err != nil {
+		return 0, fmt.Errorf("failed to delete dispatch lease: %w", err)
+	}
+
+	if err := qtx.DeleteCompressionDictionariesByNamespace(ctx, name); err != nil {
+		return 0, fmt.Errorf("failed to delete compression dictionaries: %w", err)
+	}
+
 	if err := qtx.DeleteNamespace(ctx, name); err != nil {
 		return 0, fmt.Errorf("failed to delete namespace: %w", err)
 	}
@@ -134,6 +281,10 @@ func (s *SQLiteStore) DeleteNamespace(ctx context.Context, name string) (int, er
 		return 0, fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
+	s.codec.RemoveNamespace(name)
+
+	s.releaseBlobs(ctx, blobHashes)
+
 	return int(deletedRequests), nil
 }
 
@@ -161,35 +312,185 @@ func (s *SQLiteStore) GetNamespaceStats(ctx context.Context, name string) (*type
 		return nil, fmt.Errorf("failed to get namespace stats: %w", err)
 	}
 
+	cacheStats, err := s.queries.GetCacheStats(ctx, name)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to get cache stats: %w", err)
+	}
+
 	return &types.NamespaceStats{
 		TotalRequests: int(stats.TotalRequests),
 		Queued:        nullFloat64ToInt(stats.Queued),
 		Processing:    nullFloat64ToInt(stats.Processing),
 		Completed:     nullFloat64ToInt(stats.Completed),
 		Failed:        nullFloat64ToInt(stats.Failed),
+
+		PromptTokens:     nullFloat64ToInt64(stats.PromptTokens),
+		CompletionTokens: nullFloat64ToInt64(stats.CompletionTokens),
+		CachedTokens:     nullFloat64ToInt64(stats.CachedTokens),
+		ReasoningTokens:  nullFloat64ToInt64(stats.ReasoningTokens),
+		CostUSD:          stats.CostUsd.Float64,
+
+		CacheHits:   cacheStats.Hits,
+		CacheMisses: cacheStats.Misses,
+
+		PayloadBytes:       nullFloat64ToInt64(stats.PayloadBytes),
+		StoredPayloadBytes: nullFloat64ToInt64(stats.StoredPayloadBytes),
 	}, nil
 }
 
-func (s *SQLiteStore) CreateRequest(ctx context.Context, req *storage.RequestRecord) error {
-	payload, err := json.Marshal(req.RequestPayload)
+func (s *SQLiteStore) GetBudgetSpend(ctx context.Context, namespace, periodKey string) (*storage.BudgetSpend, error) {
+	row, err := s.queries.GetBudgetSpend(ctx, namespace)
+	if err == sql.ErrNoRows || (err == nil && row.PeriodKey != periodKey) {
+		return &storage.BudgetSpend{PeriodKey: periodKey}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get budget spend: %w", err)
+	}
+
+	spend := &storage.BudgetSpend{
+		PeriodKey:   row.PeriodKey,
+		SpentUSD:    row.SpentUsd,
+		SpentTokens: row.SpentTokens,
+	}
+	if row.ExhaustedAt.Valid {
+		exhaustedAt := time.Unix(row.ExhaustedAt.Int64, 0)
+		spend.ExhaustedAt = &exhaustedAt
+	}
+	return spend, nil
+}
+
+func (s *SQLiteStore) AddBudgetSpend(ctx context.Context, namespace, periodKey string, costUSD float64, tokens int64) error {
+	return s.queries.AddBudgetSpend(ctx, sqlc.AddBudgetSpendParams{
+		Namespace:   namespace,
+		PeriodKey:   periodKey,
+		SpentUsd:    costUSD,
+		SpentTokens: tokens,
+	})
+}
+
+func (s *SQLiteStore) SetBudgetExhausted(ctx context.Context, namespace, periodKey string, exhaustedAt *time.Time) error {
+	params := sqlc.SetBudgetExhaustedParams{
+		Namespace: namespace,
+		PeriodKey: periodKey,
+	}
+	if exhaustedAt != nil {
+		params.ExhaustedAt = sql.NullInt64{Int64: exhaustedAt.Unix(), Valid: true}
+	}
+	return s.queries.SetBudgetExhausted(ctx, params)
+}
+
+func (s *SQLiteStore) ResetBudget(ctx context.Context, namespace string) error {
+	return s.queries.DeleteBudgetSpend(ctx, namespace)
+}
+
+func (s *SQLiteStore) GetCachedResponse(ctx context.Context, namespace, key string) (*storage.CacheEntry, error) {
+	row, err := s.queries.GetCachedResponse(ctx, sqlc.GetCachedResponseParams{
+		Namespace: namespace,
+		CacheKey:  key,
+		ExpiresAt: time.Now().Unix(),
+	})
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cached response: %w", err)
+	}
+
+	entry := &storage.CacheEntry{
+		Namespace: row.Namespace,
+		Key:       row.CacheKey,
+		CreatedAt: time.Unix(row.CreatedAt, 0),
+		ExpiresAt: time.Unix(row.ExpiresAt, 0),
+	}
+	entry.Response = json.RawMessage(row.ResponsePayload)
+	return entry, nil
+}
+
+func (s *SQLiteStore) PutCachedResponse(ctx context.Context, entry *storage.CacheEntry) error {
+	return s.queries.PutCachedResponse(ctx, sqlc.PutCachedResponseParams{
+		Namespace:       entry.Namespace,
+		CacheKey:        entry.Key,
+		ResponsePayload: string(entry.Response),
+		CreatedAt:       entry.CreatedAt.Unix(),
+		ExpiresAt:       entry.ExpiresAt.Unix(),
+	})
+}
+
+func (s *SQLiteStore) RecordCacheLookup(ctx context.Context, namespace string, hit bool) error {
+	if hit {
+		return s.queries.RecordCacheHit(ctx, namespace)
+	}
+	return s.queries.RecordCacheMiss(ctx, namespace)
+}
+
+func (s *SQLiteStore) AcquireDispatchLease(ctx context.Context, namespace, owner string, now, leaseUntil time.Time) (bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("failed to marshal request payload: %w", err)
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer tx.Rollback()
+
+	qtx := s.queries.WithTx(tx)
 
+	acquired, err := qtx.InsertDispatchLease(ctx, sqlc.InsertDispatchLeaseParams{
+		Namespace: namespace,
+		Owner:     owner,
+		ExpiresAt: leaseUntil.Unix(),
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to insert dispatch lease: %w", err)
+	}
+
+	if acquired == 0 {
+		acquired, err = qtx.TakeDispatchLease(ctx, sqlc.TakeDispatchLeaseParams{
+			Owner:       owner,
+			ExpiresAt:   leaseUntil.Unix(),
+			Namespace:   namespace,
+			Owner_2:     owner,
+			ExpiresAt_2: now.Unix(),
+		})
+		if err != nil {
+			return false, fmt.Errorf("failed to take dispatch lease: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return acquired > 0, nil
+}
+
+func (s *SQLiteStore) ReleaseDispatchLease(ctx context.Context, namespace, owner string) error {
+	return s.queries.ReleaseDispatchLease(ctx, sqlc.ReleaseDispatchLeaseParams{
+		Namespace: namespace,
+		Owner:     owner,
+	})
+}
+
+func (s *SQLiteStore) CreateRequest(ctx context.Context, req *storage.RequestRecord) error {
 	headers, err := json.Marshal(req.PassthroughHeaders)
 	if err != nil {
 		return fmt.Errorf("failed to marshal passthrough headers: %w", err)
 	}
 
-	return s.queries.CreateRequest(ctx, sqlc.CreateRequestParams{
-		ID:                 req.ID,
-		Namespace:          req.Namespace,
-		Status:             string(req.Status),
-		RequestPayload:     string(payload),
-		PassthroughHeaders: sql.NullString{String: string(headers), Valid: len(req.PassthroughHeaders) > 0},
-		HeaderEndpoint:     toNullString(req.HeaderEndpoint),
-		HeaderApiKey:       toNullString(req.HeaderAPIKey),
-		CreatedAt:          req.CreatedAt.Unix(),
+	payload, err := s.storePayload(req.Namespace, req.RequestPayload)
+	if err != nil {
+		return err
+	}
+
+	return s.writeRequest(ctx, req.ID, []storedPayload{payload}, func(q *sqlc.Queries) error {
+		return q.CreateRequest(ctx, sqlc.CreateRequestParams{
+			ID:                 req.ID,
+			Namespace:          req.Namespace,
+			Status:             string(req.Status),
+			RequestPayload:     payload.value.String,
+			PassthroughHeaders: sql.NullString{String: string(headers), Valid: len(req.PassthroughHeaders) > 0},
+			HeaderEndpoint:     toNullString(req.HeaderEndpoint),
+			HeaderApiKey:       toNullString(req.HeaderAPIKey),
+			CreatedAt:          req.CreatedAt.Unix(),
+			RequestSize:        payload.size,
+		})
 	})
 }
 
@@ -202,7 +503,7 @@ func (s *SQLiteStore) GetRequest(ctx context.Context, id string) (*storage.Reque
 		return nil, fmt.Errorf("failed to get request: %w", err)
 	}
 
-	return sqlcRequestToRecord(&req)
+	return s.sqlcRequestToRecord(&req)
 }
 
 func (s *SQLiteStore) ListRequests(ctx context.Context, filter storage.RequestFilter) ([]*storage.RequestRecord, int, error) {
@@ -225,6 +526,7 @@ func (s *SQLiteStore) ListRequests(ctx context.Context, filter storage.RequestFi
 				Namespace: *filter.Namespace,
 				Status:    string(*filter.Status),
 				CreatedAt: filter.Cursor.Unix(),
+				CursorID:  filter.CursorID,
 				Limit:     limit,
 			})
 		} else {
@@ -246,6 +548,7 @@ func (s *SQLiteStore) ListRequests(ctx context.Context, filter storage.RequestFi
 			requests, err = s.queries.ListRequestsByNamespaceWithCursor(ctx, sqlc.ListRequestsByNamespaceWithCursorParams{
 				Namespace: *filter.Namespace,
 				CreatedAt: filter.Cursor.Unix(),
+				CursorID:  filter.CursorID,
 				Limit:     limit,
 			})
 		} else {
@@ -266,7 +569,7 @@ func (s *SQLiteStore) ListRequests(ctx context.Context, filter storage.RequestFi
 
 	records := make([]*storage.RequestRecord, len(requests))
 	for i, req := range requests {
-		record, err := sqlcRequestToRecord(&req)
+		record, err := s.sqlcRequestToRecord(&req)
 		if err != nil {
 			return nil, 0, err
 		}
@@ -284,25 +587,95 @@ func (s *SQLiteStore) UpdateRequestStatus(ctx context.Context, id string, status
 	})
 }
 
-func (s *SQLiteStore) UpdateRequestResponse(ctx context.Context, id string, response map[string]interface{}) error {
-	responseJSON, err := json.Marshal(response)
+func (s *SQLiteStore) UpdateRequestResponse(ctx context.Context, id, leaseOwner string, response json.RawMessage, usage storage.Usage) error {
+	payload, err := s.storeResponse(ctx, id, response)
 	if err != nil {
-		return fmt.Errorf("failed to marshal response: %w", err)
+		return err
 	}
 
-	return s.queries.UpdateRequestResponse(ctx, sqlc.UpdateRequestResponseParams{
-		ID:              id,
-		ResponsePayload: sql.NullString{String: string(responseJSON), Valid: true},
-		CompletedAt:     sql.NullInt64{Int64: time.Now().Unix(), Valid: true},
+	return s.writeRequest(ctx, id, []storedPayload{payload}, func(q *sqlc.Queries) error {
+		rows, err := q.UpdateRequestResponse(ctx, sqlc.UpdateRequestResponseParams{
+			ID:               id,
+			LeaseOwner:       leaseOwner,
+			ResponsePayload:  payload.value,
+			ResponseSize:     payload.size,
+			CompletedAt:      sql.NullInt64{Int64: time.Now().Unix(), Valid: true},
+			PromptTokens:     usage.PromptTokens,
+			CompletionTokens: usage.CompletionTokens,
+			CachedTokens:     usage.CachedTokens,
+			ReasoningTokens:  usage.ReasoningTokens,
+			CostUsd:          usage.CostUSD,
+		})
+		return checkLease(rows, err, leaseOwner)
 	})
 }
 
-func (s *SQLiteStore) UpdateRequestError(ctx context.Context, id string, errMsg string) error {
-	return s.queries.UpdateRequestError(ctx, sqlc.UpdateRequestErrorParams{
+func (s *SQLiteStore) UpdateRequestCacheHit(ctx context.Context, id, leaseOwner string, response json.RawMessage) error {
+	payload, err := s.storeResponse(ctx, id, response)
+	if err != nil {
+		return err
+	}
+
+	return s.writeRequest(ctx, id, []storedPayload{payload}, func(q *sqlc.Queries) error {
+		rows, err := q.UpdateRequestCacheHit(ctx, sqlc.UpdateRequestCacheHitParams{
+			ID:              id,
+			LeaseOwner:      leaseOwner,
+			ResponsePayload: payload.value,
+			ResponseSize:    payload.size,
+			CompletedAt:     sql.NullInt64{Int64: time.Now().Unix(), Valid: true},
+		})
+		return checkLease(rows, err, leaseOwner)
+	})
+}
+
+func (s *SQLiteStore) UpdateRequestCoalesced(ctx context.Context, id, leaseOwner, primaryID string, response json.RawMessage, errMsg *string) error {
+	params := sqlc.UpdateRequestCoalescedParams{
+		ID:            id,
+		LeaseOwner:    leaseOwner,
+		Status:        string(types.StatusCompleted),
+		Error:         toNullString(errMsg),
+		CompletedAt:   sql.NullInt64{Int64: time.Now().Unix(), Valid: true},
+		CoalescedWith: sql.NullString{String: primaryID, Valid: true},
+	}
+
+	var payload storedPayload
+	if errMsg != nil {
+		params.Status = string(types.StatusFailed)
+	} else {
+		var err error
+		payload, err = s.storeResponse(ctx, id, response)
+		if err != nil {
+			return err
+		}
+		params.ResponsePayload, params.ResponseSize = payload.value, payload.size
+	}
+
+	return s.writeRequest(ctx, id, []storedPayload{payload}, func(q *sqlc.Queries) error {
+		rows, err := q.UpdateRequestCoalesced(ctx, params)
+		return checkLease(rows, err, leaseOwner)
+	})
+}
+
+func (s *SQLiteStore) UpdateRequestError(ctx context.Context, id, leaseOwner string, errMsg string) error {
+	rows, err := s.queries.UpdateRequestError(ctx, sqlc.UpdateRequestErrorParams{
 		ID:          id,
+		LeaseOwner:  leaseOwner,
 		Error:       sql.NullString{String: errMsg, Valid: true},
 		CompletedAt: sql.NullInt64{Int64: time.Now().Unix(), Valid: true},
 	})
+	return checkLease(rows, err, leaseOwner)
+}
+
+// checkLease turns a finishing update on behalf of a lease owner that
+// matched no row into ErrLeaseLost.
+func checkLease(rows int64, err error, leaseOwner string) error {
+	if err != nil {
+		return err
+	}
+	if rows == 0 && leaseOwner != "" {
+		return storage.ErrLeaseLost
+	}
+	return nil
 }
 
 func (s *SQLiteStore) GetQueuedRequests(ctx context.Context, namespace string) ([]*storage.RequestRecord, error) {
@@ -313,7 +686,7 @@ func (s *SQLiteStore) GetQueuedRequests(ctx context.Context, namespace string) (
 
 	records := make([]*storage.RequestRecord, len(requests))
 	for i, req := range requests {
-		record, err := sqlcRequestToRecord(&req)
+		record, err := s.sqlcRequestToRecord(&req)
 		if err != nil {
 			return nil, err
 		}
@@ -323,6 +696,281 @@ func (s *SQLiteStore) GetQueuedRequests(ctx context.Context, namespace string) (
 	return records, nil
 }
 
+func (s *SQLiteStore) ExportRequests(ctx context.Context, afterID string, limit int) ([]*storage.RequestRecord, error) {
+	requests, err := s.queries.ExportRequests(ctx, sqlc.ExportRequestsParams{
+		ID:    afterID,
+		Limit: int64(limit),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export requests: %w", err)
+	}
+
+	records := make([]*storage.RequestRecord, len(requests))
+	for i, req := range requests {
+		record, err := s.sqlcRequestToRecord(&req)
+		if err != nil {
+			return nil, err
+		}
+		records[i] = record
+	}
+
+	return records, nil
+}
+
+func (s *SQLiteStore) ListFinishedRequests(ctx context.Context, namespace string, status types.RequestStatus, since, until time.Time, afterID string, limit int) ([]*storage.RequestRecord, error) {
+	requests, err := s.queries.ListFinishedRequests(ctx, sqlc.ListFinishedRequestsParams{
+		Namespace: namespace,
+		Status:    string(status),
+		Since:     sql.NullInt64{Int64: since.Unix(), Valid: true},
+		AfterID:   afterID,
+		Until:     sql.NullInt64{Int64: until.Unix(), Valid: true},
+		Limit:     int64(limit),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list finished requests: %w", err)
+	}
+
+	records := make([]*storage.RequestRecord, len(requests))
+	for i, req := range requests {
+		record, err := s.sqlcRequestToRecord(&req)
+		if err != nil {
+			return nil, err
+		}
+		records[i] = record
+	}
+
+	return records, nil
+}
+
+func (s *SQLiteStore) ImportRequest(ctx context.Context, req *storage.RequestRecord) error {
+	headers, err := json.Marshal(req.PassthroughHeaders)
+	if err != nil {
+		return fmt.Errorf("failed to marshal passthrough headers: %w", err)
+	}
+
+	payload, err := s.storePayload(req.Namespace, req.RequestPayload)
+	if err != nil {
+		return err
+	}
+	response, err := s.storePayload(req.Namespace, req.ResponsePayload)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	qtx := s.queries.WithTx(tx)
+
+	// The request being replaced may have been the last to reference its
+	// blobs
+	replacedBlobs, err := qtx.ListRequestBlobs(ctx, req.ID)
+	if err != nil {
+		return fmt.Errorf("failed to list blob references: %w", err)
+	}
+	if err := qtx.DeleteRequestBlobs(ctx, req.ID); err != nil {
+		return fmt.Errorf("failed to delete blob references: %w", err)
+	}
+
+	var hashes []string
+	for _, p := range []storedPayload{payload, response} {
+		if p.hash != "" {
+			hashes = append(hashes, p.hash)
+		}
+	}
+	if err := addRequestBlobs(ctx, qtx, req.ID, hashes); err != nil {
+		return err
+	}
+
+	if err := qtx.ImportRequest(ctx, sqlc.ImportRequestParams{
+		ID:                 req.ID,
+		Namespace:          req.Namespace,
+		Status:             string(req.Status),
+		RequestPayload:     payload.value.String,
+		PassthroughHeaders: sql.NullString{String: string(headers), Valid: len(req.PassthroughHeaders) > 0},
+		HeaderEndpoint:     toNullString(req.HeaderEndpoint),
+		HeaderApiKey:       toNullString(req.HeaderAPIKey),
+		ResponsePayload:    response.value,
+		Error:              toNullString(req.Error),
+		CreatedAt:          req.CreatedAt.Unix(),
+		DispatchedAt:       toNullUnix(req.DispatchedAt),
+		CompletedAt:        toNullUnix(req.CompletedAt),
+		PromptTokens:       req.Usage.PromptTokens,
+		CompletionTokens:   req.Usage.CompletionTokens,
+		CachedTokens:       req.Usage.CachedTokens,
+		ReasoningTokens:    req.Usage.ReasoningTokens,
+		CostUsd:            req.Usage.CostUSD,
+		CacheHit:           boolToInt64(req.CacheHit),
+		CoalescedWith:      toNullString(req.CoalescedWith),
+		LeaseOwner:         toNullString(req.LeaseOwner),
+		LeaseExpiresAt:     toNullUnix(req.LeaseExpiresAt),
+		Attempts:           int64(req.Attempts),
+		RequestSize:        payload.size,
+		ResponseSize:       response.size,
+	}); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	s.releaseBlobs(ctx, replacedBlobs)
+	return nil
+}
+
+func (s *SQLiteStore) PurgeRequests(ctx context.Context, namespace string, status types.RequestStatus, before time.Time, limit int) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	qtx := s.queries.WithTx(tx)
+
+	ids, err := qtx.ListPurgeableRequests(ctx, sqlc.ListPurgeableRequestsParams{
+		Namespace:   namespace,
+		Status:      string(status),
+		CompletedAt: sql.NullInt64{Int64: before.Unix(), Valid: true},
+		Limit:       int64(limit),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to list requests to purge: %w", err)
+	}
+
+	purged, blobHashes, err := deleteRequests(ctx, qtx, ids)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	s.releaseBlobs(ctx, blobHashes)
+
+	return purged, nil
+}
+
+func (s *SQLiteStore) DeleteRequests(ctx context.Context, ids []string) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	deleted, blobHashes, err := deleteRequests(ctx, s.queries.WithTx(tx), ids)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	s.releaseBlobs(ctx, blobHashes)
+
+	return deleted, nil
+}
+
+// deleteRequests deletes the requests with ids and their blob references. It
+// returns how many existed and the hashes they referenced, to collect once
+// the transaction is committed.
+func deleteRequests(ctx context.Context, qtx *sqlc.Queries, ids []string) (int, []string, error) {
+	deleted := 0
+	var blobHashes []string
+	for _, id := range ids {
+		hashes, err := qtx.ListRequestBlobs(ctx, id)
+		if err != nil {
+			return 0, nil, fmt.Errorf("failed to list blob references: %w", err)
+		}
+		blobHashes = append(blobHashes, hashes...)
+
+		if err := qtx.DeleteRequestBlobs(ctx, id); err != nil {
+			return 0, nil, fmt.Errorf("failed to delete blob references: %w", err)
+		}
+		n, err := qtx.DeleteRequest(ctx, id)
+		if err != nil {
+			return 0, nil, fmt.Errorf("failed to delete request: %w", err)
+		}
+		deleted += int(n)
+	}
+	return deleted, blobHashes, nil
+}
+
+func (s *SQLiteStore) ClaimQueuedRequests(ctx context.Context, namespace string, n int, leaseOwner string, leaseUntil time.Time) ([]*storage.RequestRecord, error) {
+	requests, err := s.queries.ClaimQueuedRequests(ctx, sqlc.ClaimQueuedRequestsParams{
+		DispatchedAt:   sql.NullInt64{Int64: time.Now().Unix(), Valid: true},
+		LeaseOwner:     sql.NullString{String: leaseOwner, Valid: true},
+		LeaseExpiresAt: sql.NullInt64{Int64: leaseUntil.Unix(), Valid: true},
+		Namespace:      namespace,
+		Limit:          int64(n),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim queued requests: %w", err)
+	}
+
+	records := make([]*storage.RequestRecord, len(requests))
+	for i, req := range requests {
+		record, err := s.sqlcRequestToRecord(&req)
+		if err != nil {
+			return nil, err
+		}
+		records[i] = record
+	}
+
+	// RETURNING does not preserve the subquery's order
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].CreatedAt.Before(records[j].CreatedAt)
+	})
+
+	return records, nil
+}
+
+func (s *SQLiteStore) ReleaseRequest(ctx context.Context, id, leaseOwner string) error {
+	return s.queries.ReleaseRequest(ctx, sqlc.ReleaseRequestParams{ID: id, LeaseOwner: leaseOwner})
+}
+
+func (s *SQLiteStore) RecoverExpiredLeases(ctx context.Context, owner string, now time.Time, maxAttempts int) (int, int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	qtx := s.queries.WithTx(tx)
+	ownerParam := sql.NullString{String: owner, Valid: owner != ""}
+	expiresParam := sql.NullInt64{Int64: now.Unix(), Valid: true}
+
+	failed, err := qtx.FailExpiredLeases(ctx, sqlc.FailExpiredLeasesParams{
+		Error:          sql.NullString{String: storage.MaxAttemptsError, Valid: true},
+		CompletedAt:    sql.NullInt64{Int64: now.Unix(), Valid: true},
+		LeaseExpiresAt: expiresParam,
+		LeaseOwner:     ownerParam,
+		Attempts:       int64(maxAttempts),
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to fail expired leases: %w", err)
+	}
+
+	requeued, err := qtx.RequeueExpiredLeases(ctx, sqlc.RequeueExpiredLeasesParams{
+		LeaseExpiresAt: expiresParam,
+		LeaseOwner:     ownerParam,
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to requeue expired leases: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return int(requeued), int(failed), nil
+}
+
 func toNullString(s *string) sql.NullString {
 	if s == nil {
 		return sql.NullString{}
@@ -330,6 +978,20 @@ func toNullString(s *string) sql.NullString {
 	return sql.NullString{String: *s, Valid: true}
 }
 
+func toNullUnix(t *time.Time) sql.NullInt64 {
+	if t == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: t.Unix(), Valid: true}
+}
+
+func boolToInt64(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
 func fromNullString(ns sql.NullString) *string {
 	if !ns.Valid {
 		return nil
@@ -344,6 +1006,13 @@ func nullFloat64ToInt(nf sql.NullFloat64) int {
 	return int(nf.Float64)
 }
 
+func nullFloat64ToInt64(nf sql.NullFloat64) int64 {
+	if !nf.Valid {
+		return 0
+	}
+	return int64(nf.Float64)
+}
+
 func sqlcNamespaceToRecord(ns *sqlc.Namespace) (*storage.NamespaceRecord, error) {
 	record := &storage.NamespaceRecord{
 		Name:             ns.Name,
@@ -351,6 +1020,8 @@ func sqlcNamespaceToRecord(ns *sqlc.Namespace) (*storage.NamespaceRecord, error)
 		ProviderEndpoint: fromNullString(ns.ProviderEndpoint),
 		ProviderAPIKey:   fromNullString(ns.ProviderApiKey),
 		ProviderModel:    fromNullString(ns.ProviderModel),
+		ProviderType:     types.ProviderType(ns.ProviderType),
+		URLTemplate:      fromNullString(ns.UrlTemplate),
 		CreatedAt:        time.Unix(ns.CreatedAt, 0),
 		UpdatedAt:        time.Unix(ns.UpdatedAt, 0),
 	}
@@ -361,10 +1032,40 @@ func sqlcNamespaceToRecord(ns *sqlc.Namespace) (*storage.NamespaceRecord, error)
 		}
 	}
 
+	if ns.ProviderAws.Valid && ns.ProviderAws.String != "" {
+		if err := json.Unmarshal([]byte(ns.ProviderAws.String), &record.ProviderAWS); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal aws credentials: %w", err)
+		}
+	}
+
+	if ns.QueryParams.Valid && ns.QueryParams.String != "" {
+		if err := json.Unmarshal([]byte(ns.QueryParams.String), &record.QueryParams); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal query params: %w", err)
+		}
+	}
+
+	if ns.Budget.Valid && ns.Budget.String != "" {
+		if err := json.Unmarshal([]byte(ns.Budget.String), &record.Budget); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal budget: %w", err)
+		}
+	}
+
+	if ns.CacheConfig.Valid && ns.CacheConfig.String != "" {
+		if err := json.Unmarshal([]byte(ns.CacheConfig.String), &record.Cache); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal cache config: %w", err)
+		}
+	}
+
+	if ns.Retention.Valid && ns.Retention.String != "" {
+		if err := json.Unmarshal([]byte(ns.Retention.String), &record.Retention); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal retention policy: %w", err)
+		}
+	}
+
 	return record, nil
 }
 
-func sqlcRequestToRecord(req *sqlc.Request) (*storage.RequestRecord, error) {
+func (s *SQLiteStore) sqlcRequestToRecord(req *sqlc.Request) (*storage.RequestRecord, error) {
 	record := &storage.RequestRecord{
 		ID:             req.ID,
 		Namespace:      req.Namespace,
@@ -373,6 +1074,22 @@ func sqlcRequestToRecord(req *sqlc.Request) (*storage.RequestRecord, error) {
 		HeaderAPIKey:   fromNullString(req.HeaderApiKey),
 		Error:          fromNullString(req.Error),
 		CreatedAt:      time.Unix(req.CreatedAt, 0),
+		Usage: storage.Usage{
+			PromptTokens:     req.PromptTokens,
+			CompletionTokens: req.CompletionTokens,
+			CachedTokens:     req.CachedTokens,
+			ReasoningTokens:  req.ReasoningTokens,
+			CostUSD:          req.CostUsd,
+		},
+		CacheHit:      req.CacheHit != 0,
+		CoalescedWith: fromNullString(req.CoalescedWith),
+		LeaseOwner:    fromNullString(req.LeaseOwner),
+		Attempts:      int(req.Attempts),
+	}
+
+	if req.LeaseExpiresAt.Valid {
+		t := time.Unix(req.LeaseExpiresAt.Int64, 0)
+		record.LeaseExpiresAt = &t
 	}
 
 	if req.DispatchedAt.Valid {
@@ -385,9 +1102,11 @@ func sqlcRequestToRecord(req *sqlc.Request) (*storage.RequestRecord, error) {
 		record.CompletedAt = &t
 	}
 
-	if err := json.Unmarshal([]byte(req.RequestPayload), &record.RequestPayload); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal request payload: %w", err)
+	payload, err := s.loadPayload([]byte(req.RequestPayload))
+	if err != nil {
+		return nil, fmt.Errorf("request %s: %w", req.ID, err)
 	}
+	record.RequestPayload = json.RawMessage(payload)
 
 	if req.PassthroughHeaders.Valid && req.PassthroughHeaders.String != "" {
 		if err := json.Unmarshal([]byte(req.PassthroughHeaders.String), &record.PassthroughHeaders); err != nil {
@@ -396,9 +1115,11 @@ func sqlcRequestToRecord(req *sqlc.Request) (*storage.RequestRecord, error) {
 	}
 
 	if req.ResponsePayload.Valid && req.ResponsePayload.String != "" {
-		if err := json.Unmarshal([]byte(req.ResponsePayload.String), &record.ResponsePayload); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal response payload: %w", err)
+		response, err := s.loadPayload([]byte(req.ResponsePayload.String))
+		if err != nil {
+			return nil, fmt.Errorf("request %s: %w", req.ID, err)
 		}
+		record.ResponsePayload = json.RawMessage(response)
 	}
 
 	return record, nil
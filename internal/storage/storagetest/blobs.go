@@ -0,0 +1,146 @@
+package storagetest
+
+import (
+	"bytes"
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/georgeshao/ai-inference-dam/internal/storage"
+	"github.com/georgeshao/ai-inference-dam/internal/storage/blob"
+)
+
+// RunBlobs checks a store that offloads large payloads to a blob directory:
+// payloads read back transparently, identical payloads share a blob, and
+// blobs are removed once no request references them. open must configure
+// the store with opts.
+func RunBlobs(t *testing.T, open func(t *testing.T, opts blob.Options) storage.Store) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store := open(t, blob.Options{Dir: dir, Threshold: 1024, GracePeriod: time.Nanosecond})
+
+	collector, ok := store.(storage.BlobCollector)
+	if !ok {
+		t.Fatal("Store does not implement storage.BlobCollector")
+	}
+
+	now := time.Now()
+	for _, name := range []string{"images", "documents"} {
+		if err := store.CreateNamespace(ctx, &storage.NamespaceRecord{Name: name, CreatedAt: now, UpdatedAt: now}); err != nil {
+			t.Fatalf("CreateNamespace failed: %v", err)
+		}
+	}
+
+	image := []byte(`{"model":"gpt-4o","messages":[{"role":"user","content":[{"type":"image_url","image_url":{"url":"data:image/png;base64,` + strings.Repeat("iVBORw0KGgoAAAANSUhEUgAA", 200) + `"}}]}]}`)
+	small := []byte(`{"model":"gpt-4o","messages":[{"role":"user","content":"Hello"}]}`)
+	response := []byte(`{"choices":[{"message":{"role":"assistant","content":"` + strings.Repeat("A detailed description. ", 100) + `"}}]}`)
+
+	for i, req := range []struct {
+		id, namespace string
+		payload       []byte
+	}{
+		{"blob-1", "images", image},
+		{"blob-2", "images", image},
+		{"blob-3", "images", small},
+		{"blob-4", "documents", image},
+	} {
+		if err := store.CreateRequest(ctx, &storage.RequestRecord{
+			ID:             req.id,
+			Namespace:      req.namespace,
+			Status:         "queued",
+			RequestPayload: req.payload,
+			CreatedAt:      now.Add(time.Duration(i) * time.Second),
+		}); err != nil {
+			t.Fatalf("CreateRequest failed: %v", err)
+		}
+	}
+	if err := store.UpdateRequestResponse(ctx, "blob-1", "", response, storage.Usage{}); err != nil {
+		t.Fatalf("UpdateRequestResponse failed: %v", err)
+	}
+
+	if n := countBlobs(t, dir); n != 2 {
+		t.Errorf("Expected the image and the response in 2 blobs, got %d", n)
+	}
+
+	req, err := store.GetRequest(ctx, "blob-1")
+	if err != nil {
+		t.Fatalf("GetRequest failed: %v", err)
+	}
+	if !bytes.Equal(req.RequestPayload, image) || !bytes.Equal(req.ResponsePayload, response) {
+		t.Error("GetRequest did not resolve offloaded payloads")
+	}
+	exported, err := store.ExportRequests(ctx, "", 10)
+	if err != nil {
+		t.Fatalf("ExportRequests failed: %v", err)
+	}
+	for _, req := range exported {
+		if req.ID == "blob-4" && !bytes.Equal(req.RequestPayload, image) {
+			t.Error("ExportRequests did not resolve an offloaded payload")
+		}
+	}
+
+	stats, err := store.GetNamespaceStats(ctx, "images")
+	if err != nil {
+		t.Fatalf("GetNamespaceStats failed: %v", err)
+	}
+	if want := int64(2*len(image) + len(small) + len(response)); stats.PayloadBytes != want {
+		t.Errorf("Expected %d payload bytes, got %d", want, stats.PayloadBytes)
+	}
+
+	// The image is still referenced from the other namespace
+	if _, err := store.DeleteNamespace(ctx, "images"); err != nil {
+		t.Fatalf("DeleteNamespace failed: %v", err)
+	}
+	if n := countBlobs(t, dir); n != 1 {
+		t.Errorf("Expected only the shared image blob after deleting a namespace, got %d", n)
+	}
+	if req, err := store.GetRequest(ctx, "blob-4"); err != nil || !bytes.Equal(req.RequestPayload, image) {
+		t.Errorf("Shared blob unreadable after deleting a namespace: %v", err)
+	}
+
+	// Replacing the last request that references it releases the blob
+	if err := store.ImportRequest(ctx, &storage.RequestRecord{
+		ID:             "blob-4",
+		Namespace:      "documents",
+		Status:         "queued",
+		RequestPayload: small,
+		CreatedAt:      now,
+	}); err != nil {
+		t.Fatalf("ImportRequest failed: %v", err)
+	}
+	if n := countBlobs(t, dir); n != 0 {
+		t.Errorf("Expected no blobs once unreferenced, got %d", n)
+	}
+
+	// A blob whose request was never stored is swept up
+	orphan := filepath.Join(dir, "ab", strings.Repeat("ab", 32))
+	if err := os.MkdirAll(filepath.Dir(orphan), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(orphan, image, 0644); err != nil {
+		t.Fatal(err)
+	}
+	removed, err := collector.CollectBlobs(ctx)
+	if err != nil || removed != 1 {
+		t.Errorf("CollectBlobs = %d, %v; want 1 removed", removed, err)
+	}
+}
+
+func countBlobs(t *testing.T, dir string) int {
+	t.Helper()
+	n := 0
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() && !strings.HasPrefix(d.Name(), ".") {
+			n++
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Failed to list blobs: %v", err)
+	}
+	return n
+}
@@ -0,0 +1,134 @@
+package storagetest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/georgeshao/ai-inference-dam/internal/storage"
+	"github.com/georgeshao/ai-inference-dam/internal/storage/compression"
+)
+
+// Opener opens the same store on every call, so that a test can check what
+// survives a reopen. The test closes each store it is given.
+type Opener func(t *testing.T) storage.Store
+
+// RunCompression checks a store opened with payload compression enabled:
+// payloads read back byte for byte, stats report the space saved, and
+// dictionaries trained through storage.DictionaryTrainer survive a reopen.
+func RunCompression(t *testing.T, open Opener) {
+	ctx := context.Background()
+	store := open(t)
+
+	trainer, ok := store.(storage.DictionaryTrainer)
+	if !ok {
+		store.Close()
+		t.Fatal("Store does not implement storage.DictionaryTrainer")
+	}
+
+	now := time.Now()
+	if err := store.CreateNamespace(ctx, &storage.NamespaceRecord{Name: "compressed", CreatedAt: now, UpdatedAt: now}); err != nil {
+		t.Fatalf("CreateNamespace failed: %v", err)
+	}
+	if _, err := trainer.TrainDictionary(ctx, "compressed"); !errors.Is(err, compression.ErrNoSamples) {
+		t.Errorf("Expected ErrNoSamples for an empty namespace, got %v", err)
+	}
+
+	payloads := make(map[string][2][]byte)
+	var rawBytes int64
+	write := func(from, to int) {
+		for i := from; i < to; i++ {
+			id := fmt.Sprintf("compressed-%03d", i)
+			payload, response := compressiblePayload(i)
+			if err := store.CreateRequest(ctx, &storage.RequestRecord{
+				ID:             id,
+				Namespace:      "compressed",
+				Status:         "queued",
+				RequestPayload: payload,
+				CreatedAt:      now.Add(time.Duration(i) * time.Second),
+			}); err != nil {
+				t.Fatalf("CreateRequest failed: %v", err)
+			}
+			if err := store.UpdateRequestResponse(ctx, id, "", response, storage.Usage{}); err != nil {
+				t.Fatalf("UpdateRequestResponse failed: %v", err)
+			}
+			payloads[id] = [2][]byte{payload, response}
+			rawBytes += int64(len(payload) + len(response))
+		}
+	}
+	check := func(store storage.Store) {
+		t.Helper()
+		for id, want := range payloads {
+			req, err := store.GetRequest(ctx, id)
+			if err != nil || req == nil {
+				t.Fatalf("GetRequest(%s) = %v, %v", id, req, err)
+			}
+			if !bytes.Equal(req.RequestPayload, want[0]) || !bytes.Equal(req.ResponsePayload, want[1]) {
+				t.Errorf("Payloads of %s changed in storage", id)
+			}
+		}
+	}
+
+	write(0, 50)
+	dict, err := trainer.TrainDictionary(ctx, "compressed")
+	if err != nil {
+		t.Fatalf("TrainDictionary failed: %v", err)
+	}
+	if dict.ID < compression.FirstDictionaryID || dict.Namespace != "compressed" || dict.Size == 0 || dict.Samples != 100 {
+		t.Errorf("Unexpected dictionary: %+v", dict)
+	}
+	write(50, 60)
+	check(store)
+
+	stats, err := store.GetNamespaceStats(ctx, "compressed")
+	if err != nil {
+		t.Fatalf("GetNamespaceStats failed: %v", err)
+	}
+	if stats.PayloadBytes != rawBytes {
+		t.Errorf("Expected %d payload bytes, got %d", rawBytes, stats.PayloadBytes)
+	}
+	if stats.StoredPayloadBytes <= 0 || stats.StoredPayloadBytes >= stats.PayloadBytes/2 {
+		t.Errorf("Expected payloads to be stored compressed, got %d of %d bytes", stats.StoredPayloadBytes, stats.PayloadBytes)
+	}
+
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	store = open(t)
+	defer store.Close()
+
+	check(store)
+	next, err := store.(storage.DictionaryTrainer).TrainDictionary(ctx, "compressed")
+	if err != nil {
+		t.Fatalf("TrainDictionary after reopen failed: %v", err)
+	}
+	if next.ID <= dict.ID {
+		t.Errorf("Expected a new dictionary ID after %d, got %d", dict.ID, next.ID)
+	}
+
+	exported, err := store.ExportRequests(ctx, "", 100)
+	if err != nil {
+		t.Fatalf("ExportRequests failed: %v", err)
+	}
+	if len(exported) != len(payloads) {
+		t.Fatalf("Expected %d exported requests, got %d", len(payloads), len(exported))
+	}
+	for _, req := range exported {
+		if !bytes.Equal(req.RequestPayload, payloads[req.ID][0]) {
+			t.Errorf("Exported payload of %s changed", req.ID)
+		}
+	}
+}
+
+func compressiblePayload(i int) (payload, response []byte) {
+	var history bytes.Buffer
+	for turn := 0; turn < 8; turn++ {
+		fmt.Fprintf(&history, `{"role":"user","content":"Summarise ticket %d, turn %d: the customer reports that the checkout page times out after applying a discount code."},`, i, turn)
+	}
+	payload = []byte(fmt.Sprintf(`{"model":"gpt-4o","messages":[%s{"role":"user","content":"And now?"}],"seed":%d}`, history.String(), 9007199254740993+i))
+	response = []byte(fmt.Sprintf(`{"id":"chatcmpl-%d","object":"chat.completion","choices":[{"index":0,"message":{"role":"assistant","content":"The checkout page times out after a discount code is applied; escalate to the payments team. Ticket %d."},"finish_reason":"stop"}]}`, i, i))
+	return payload, response
+}
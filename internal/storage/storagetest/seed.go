@@ -0,0 +1,52 @@
+package storagetest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/georgeshao/ai-inference-dam/internal/storage"
+	"github.com/georgeshao/ai-inference-dam/pkg/types"
+)
+
+// Seed adds requests first to first+n-1 to namespace, creating it if it
+// does not exist, for tests of code built on a store. Request i has the ID
+// {namespace}_{i:03d} and payload; every third one is completed with the
+// response {"id": "resp_{id}"}, the next failed and the next left queued.
+func Seed(t *testing.T, store storage.Store, namespace string, first, n int, payload json.RawMessage) {
+	t.Helper()
+	ctx := context.Background()
+	now := time.Now()
+
+	if ns, err := store.GetNamespace(ctx, namespace); err != nil || ns == nil {
+		if err := store.CreateNamespace(ctx, &storage.NamespaceRecord{Name: namespace, CreatedAt: now, UpdatedAt: now}); err != nil {
+			t.Fatalf("CreateNamespace failed: %v", err)
+		}
+	}
+
+	for i := first; i < first+n; i++ {
+		id := fmt.Sprintf("%s_%03d", namespace, i)
+		if err := store.CreateRequest(ctx, &storage.RequestRecord{
+			ID:             id,
+			Namespace:      namespace,
+			Status:         types.StatusQueued,
+			RequestPayload: payload,
+			CreatedAt:      now,
+		}); err != nil {
+			t.Fatalf("CreateRequest failed: %v", err)
+		}
+
+		var err error
+		switch i % 3 {
+		case 0:
+			err = store.UpdateRequestResponse(ctx, id, "", json.RawMessage(`{"id": "resp_`+id+`"}`), storage.Usage{PromptTokens: 10, CompletionTokens: 5, CostUSD: 0.01})
+		case 1:
+			err = store.UpdateRequestError(ctx, id, "", "upstream failed")
+		}
+		if err != nil {
+			t.Fatalf("Failed to finish request: %v", err)
+		}
+	}
+}
@@ -0,0 +1,1869 @@
+// Package storagetest is a conformance suite for storage.Store
+// implementations. Every backend runs it from its own tests so that they all
+// honour the same contract.
+package storagetest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/georgeshao/ai-inference-dam/internal/storage"
+	"github.com/georgeshao/ai-inference-dam/pkg/types"
+)
+
+// Factory opens an empty store for a single test. It is responsible for
+// closing the store and removing any files, typically via t.Cleanup.
+type Factory func(t *testing.T) storage.Store
+
+// Run exercises the storage.Store contract against stores from newStore.
+func Run(t *testing.T, newStore Factory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, store storage.Store)
+	}{
+		{"NamespaceCRUD", testNamespaceCRUD},
+		{"NamespaceWithProviderConfig", testNamespaceWithProviderConfig},
+		{"NamespaceWithBedrockProvider", testNamespaceWithBedrockProvider},
+		{"RequestCRUD", testRequestCRUD},
+		{"RequestError", testRequestError},
+		{"ListRequests", testListRequests},
+		{"ListRequestsOrdering", testListRequestsOrdering},
+		{"ListRequestsSameSecond", testListRequestsSameSecond},
+		{"TimestampPrecision", testTimestampPrecision},
+		{"NamespaceStats", testNamespaceStats},
+		{"NamespaceUsageStats", testNamespaceUsageStats},
+		{"BudgetSpend", testBudgetSpend},
+		{"ResponseCache", testResponseCache},
+		{"GetQueuedRequests", testGetQueuedRequests},
+		{"ExportImportRequests", testExportImportRequests},
+		{"ClaimQueuedRequests", testClaimQueuedRequests},
+		{"RecoverExpiredLeases", testRecoverExpiredLeases},
+		{"LeaseOwnership", testLeaseOwnership},
+		{"ConcurrentLeaseUpdates", testConcurrentLeaseUpdates},
+		{"DispatchLease", testDispatchLease},
+		{"DeleteNamespaceWithRequests", testDeleteNamespaceWithRequests},
+		{"NamespaceNamePrefixes", testNamespaceNamePrefixes},
+		{"PurgeRequests", testPurgeRequests},
+		{"ListFinishedRequests", testListFinishedRequests},
+		{"DeleteRequests", testDeleteRequests},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStore(t))
+		})
+	}
+}
+
+func testNamespaceCRUD(t *testing.T, store storage.Store) {
+	ctx := context.Background()
+	now := time.Now()
+
+	// Create namespace
+	ns := &storage.NamespaceRecord{
+		Name:        "test-namespace",
+		Description: "Test description",
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	err := store.CreateNamespace(ctx, ns)
+	if err != nil {
+		t.Fatalf("CreateNamespace failed: %v", err)
+	}
+
+	// Get namespace
+	retrieved, err := store.GetNamespace(ctx, "test-namespace")
+	if err != nil {
+		t.Fatalf("GetNamespace failed: %v", err)
+	}
+	if retrieved == nil {
+		t.Fatal("GetNamespace returned nil")
+	}
+	if retrieved.Name != "test-namespace" {
+		t.Errorf("Name mismatch: got %s, want test-namespace", retrieved.Name)
+	}
+	if retrieved.Description != "Test description" {
+		t.Errorf("Description mismatch: got %s, want 'Test description'", retrieved.Description)
+	}
+
+	// Update namespace
+	endpoint := "https://api.example.com/v1"
+	retrieved.ProviderEndpoint = &endpoint
+	retrieved.Retention = &storage.RetentionPolicy{CompletedDays: 30, FailedDays: 90}
+	retrieved.UpdatedAt = time.Now()
+
+	err = store.UpdateNamespace(ctx, "test-namespace", retrieved)
+	if err != nil {
+		t.Fatalf("UpdateNamespace failed: %v", err)
+	}
+
+	// Verify update
+	updated, err := store.GetNamespace(ctx, "test-namespace")
+	if err != nil {
+		t.Fatalf("GetNamespace after update failed: %v", err)
+	}
+	if updated.ProviderEndpoint == nil || *updated.ProviderEndpoint != endpoint {
+		t.Errorf("ProviderEndpoint not updated correctly")
+	}
+	if updated.Retention == nil || *updated.Retention != (storage.RetentionPolicy{CompletedDays: 30, FailedDays: 90}) {
+		t.Errorf("Retention not updated correctly: %+v", updated.Retention)
+	}
+
+	// List namespaces
+	namespaces, err := store.ListNamespaces(ctx)
+	if err != nil {
+		t.Fatalf("ListNamespaces failed: %v", err)
+	}
+	if len(namespaces) != 1 {
+		t.Errorf("Expected 1 namespace, got %d", len(namespaces))
+	}
+
+	// Delete namespace
+	deleted, err := store.DeleteNamespace(ctx, "test-namespace")
+	if err != nil {
+		t.Fatalf("DeleteNamespace failed: %v", err)
+	}
+	if deleted != 0 {
+		t.Errorf("Expected 0 deleted requests, got %d", deleted)
+	}
+
+	// Verify deletion
+	retrieved, err = store.GetNamespace(ctx, "test-namespace")
+	if err != nil {
+		t.Fatalf("GetNamespace after delete failed: %v", err)
+	}
+	if retrieved != nil {
+		t.Error("Namespace should have been deleted")
+	}
+}
+
+func testNamespaceWithProviderConfig(t *testing.T, store storage.Store) {
+	ctx := context.Background()
+	now := time.Now()
+
+	endpoint := "https://api.openai.com/v1"
+	apiKey := "sk-test-key"
+	model := "gpt-4"
+	headers := map[string]string{
+		"OpenAI-Organization": "org-123",
+	}
+
+	ns := &storage.NamespaceRecord{
+		Name:             "openai-test",
+		Description:      "OpenAI namespace",
+		ProviderEndpoint: &endpoint,
+		ProviderAPIKey:   &apiKey,
+		ProviderModel:    &model,
+		ProviderHeaders:  headers,
+		CreatedAt:        now,
+		UpdatedAt:        now,
+	}
+
+	err := store.CreateNamespace(ctx, ns)
+	if err != nil {
+		t.Fatalf("CreateNamespace failed: %v", err)
+	}
+
+	retrieved, err := store.GetNamespace(ctx, "openai-test")
+	if err != nil {
+		t.Fatalf("GetNamespace failed: %v", err)
+	}
+
+	if retrieved.ProviderEndpoint == nil || *retrieved.ProviderEndpoint != endpoint {
+		t.Error("ProviderEndpoint mismatch")
+	}
+	if retrieved.ProviderAPIKey == nil || *retrieved.ProviderAPIKey != apiKey {
+		t.Error("ProviderAPIKey mismatch")
+	}
+	if retrieved.ProviderModel == nil || *retrieved.ProviderModel != model {
+		t.Error("ProviderModel mismatch")
+	}
+	if retrieved.ProviderHeaders["OpenAI-Organization"] != "org-123" {
+		t.Error("ProviderHeaders mismatch")
+	}
+}
+
+func testNamespaceWithBedrockProvider(t *testing.T, store storage.Store) {
+	ctx := context.Background()
+	now := time.Now()
+
+	ns := &storage.NamespaceRecord{
+		Name:         "bedrock-test",
+		ProviderType: types.ProviderBedrock,
+		ProviderAWS: &storage.AWSCredentials{
+			Region:          "us-east-1",
+			AccessKeyID:     "AKIDEXAMPLE",
+			SecretAccessKey: "secret",
+			SessionToken:    "token",
+		},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	if err := store.CreateNamespace(ctx, ns); err != nil {
+		t.Fatalf("CreateNamespace failed: %v", err)
+	}
+
+	retrieved, err := store.GetNamespace(ctx, "bedrock-test")
+	if err != nil {
+		t.Fatalf("GetNamespace failed: %v", err)
+	}
+
+	if retrieved.ProviderType != types.ProviderBedrock {
+		t.Errorf("ProviderType mismatch: got %s", retrieved.ProviderType)
+	}
+	if retrieved.ProviderAWS == nil || *retrieved.ProviderAWS != *ns.ProviderAWS {
+		t.Errorf("ProviderAWS mismatch: got %+v", retrieved.ProviderAWS)
+	}
+}
+
+func testRequestCRUD(t *testing.T, store storage.Store) {
+	ctx := context.Background()
+	now := time.Now()
+
+	// Create namespace first
+	ns := &storage.NamespaceRecord{
+		Name:      "test-ns",
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	err := store.CreateNamespace(ctx, ns)
+	if err != nil {
+		t.Fatalf("CreateNamespace failed: %v", err)
+	}
+
+	// Create request
+	req := &storage.RequestRecord{
+		ID:        "req_test123",
+		Namespace: "test-ns",
+		Status:    types.StatusQueued,
+		// Key order, spacing and a seed beyond float64 precision must all
+		// survive the round trip
+		RequestPayload: json.RawMessage(`{"seed": 9007199254740993, "model":"gpt-4","messages":[{"role":"user","content":"Hello!"}]}`),
+		PassthroughHeaders: map[string]string{
+			"Authorization": "Bearer test-token",
+		},
+		CreatedAt: now,
+	}
+
+	err = store.CreateRequest(ctx, req)
+	if err != nil {
+		t.Fatalf("CreateRequest failed: %v", err)
+	}
+
+	// Get request
+	retrieved, err := store.GetRequest(ctx, "req_test123")
+	if err != nil {
+		t.Fatalf("GetRequest failed: %v", err)
+	}
+	if retrieved == nil {
+		t.Fatal("GetRequest returned nil")
+	}
+	if retrieved.ID != "req_test123" {
+		t.Errorf("ID mismatch: got %s", retrieved.ID)
+	}
+	if retrieved.Status != types.StatusQueued {
+		t.Errorf("Status mismatch: got %s", retrieved.Status)
+	}
+	if string(retrieved.RequestPayload) != string(req.RequestPayload) {
+		t.Errorf("RequestPayload not preserved:\ngot  %s\nwant %s", retrieved.RequestPayload, req.RequestPayload)
+	}
+
+	// Update status
+	dispatchedAt := time.Now()
+	err = store.UpdateRequestStatus(ctx, "req_test123", types.StatusProcessing, dispatchedAt)
+	if err != nil {
+		t.Fatalf("UpdateRequestStatus failed: %v", err)
+	}
+
+	// Verify status update and dispatched_at
+	retrieved, _ = store.GetRequest(ctx, "req_test123")
+	if retrieved.Status != types.StatusProcessing {
+		t.Errorf("Status not updated: got %s", retrieved.Status)
+	}
+	if retrieved.DispatchedAt == nil {
+		t.Error("DispatchedAt should be set")
+	} else if retrieved.DispatchedAt.Unix() != dispatchedAt.Unix() {
+		t.Errorf("DispatchedAt mismatch: got %v, want %v", retrieved.DispatchedAt.Unix(), dispatchedAt.Unix())
+	}
+
+	// Update with response
+	response := json.RawMessage(`{"id":"chatcmpl-xyz","object":"chat.completion","created":1701784800,"choices":[{"index":0,"message":{"role":"assistant","content":"Hello! How can I help you?"}}]}`)
+
+	usage := storage.Usage{PromptTokens: 12, CompletionTokens: 8, CachedTokens: 4, CostUSD: 0.0021}
+	err = store.UpdateRequestResponse(ctx, "req_test123", "", response, usage)
+	if err != nil {
+		t.Fatalf("UpdateRequestResponse failed: %v", err)
+	}
+
+	// Verify response update
+	retrieved, _ = store.GetRequest(ctx, "req_test123")
+	if retrieved.Status != types.StatusCompleted {
+		t.Errorf("Status should be completed: got %s", retrieved.Status)
+	}
+	if string(retrieved.ResponsePayload) != string(response) {
+		t.Errorf("ResponsePayload not preserved:\ngot  %s\nwant %s", retrieved.ResponsePayload, response)
+	}
+	if retrieved.CompletedAt == nil {
+		t.Error("CompletedAt should not be nil")
+	}
+	if retrieved.Usage != usage {
+		t.Errorf("Usage mismatch: got %+v, want %+v", retrieved.Usage, usage)
+	}
+}
+
+func testRequestError(t *testing.T, store storage.Store) {
+	ctx := context.Background()
+	now := time.Now()
+
+	// Create namespace
+	ns := &storage.NamespaceRecord{
+		Name:      "test-ns",
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	err := store.CreateNamespace(ctx, ns)
+	if err != nil {
+		t.Fatalf("CreateNamespace failed: %v", err)
+	}
+
+	// Create request
+	req := &storage.RequestRecord{
+		ID:             "req_error123",
+		Namespace:      "test-ns",
+		Status:         types.StatusQueued,
+		RequestPayload: json.RawMessage(`{"model":"gpt-4"}`),
+		CreatedAt:      now,
+	}
+	err = store.CreateRequest(ctx, req)
+	if err != nil {
+		t.Fatalf("CreateRequest failed: %v", err)
+	}
+
+	// Update with error
+	err = store.UpdateRequestError(ctx, "req_error123", "", "Rate limit exceeded")
+	if err != nil {
+		t.Fatalf("UpdateRequestError failed: %v", err)
+	}
+
+	// Verify error update
+	retrieved, _ := store.GetRequest(ctx, "req_error123")
+	if retrieved.Status != types.StatusFailed {
+		t.Errorf("Status should be failed: got %s", retrieved.Status)
+	}
+	if retrieved.Error == nil || *retrieved.Error != "Rate limit exceeded" {
+		t.Error("Error message mismatch")
+	}
+}
+
+func testListRequests(t *testing.T, store storage.Store) {
+	ctx := context.Background()
+	now := time.Now()
+
+	// Create namespace
+	ns := &storage.NamespaceRecord{
+		Name:      "test-ns",
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	err := store.CreateNamespace(ctx, ns)
+	if err != nil {
+		t.Fatalf("CreateNamespace failed: %v", err)
+	}
+
+	// Create multiple requests
+	for i := 0; i < 5; i++ {
+		req := &storage.RequestRecord{
+			ID:             "req_" + string(rune('a'+i)),
+			Namespace:      "test-ns",
+			Status:         types.StatusQueued,
+			RequestPayload: json.RawMessage(`{"model":"gpt-4"}`),
+			CreatedAt:      now.Add(time.Duration(i) * time.Second),
+		}
+		err = store.CreateRequest(ctx, req)
+		if err != nil {
+			t.Fatalf("CreateRequest failed: %v", err)
+		}
+	}
+
+	// List all requests
+	namespace := "test-ns"
+	requests, total, err := store.ListRequests(ctx, storage.RequestFilter{
+		Namespace: &namespace,
+	})
+	if err != nil {
+		t.Fatalf("ListRequests failed: %v", err)
+	}
+	if total != 5 {
+		t.Errorf("Expected 5 total requests, got %d", total)
+	}
+	if len(requests) != 5 {
+		t.Errorf("Expected 5 requests, got %d", len(requests))
+	}
+
+	// List with cursor pagination - first page
+	requests, total, err = store.ListRequests(ctx, storage.RequestFilter{
+		Namespace: &namespace,
+		Limit:     2,
+	})
+	if err != nil {
+		t.Fatalf("ListRequests with pagination failed: %v", err)
+	}
+	if total != 5 {
+		t.Errorf("Total should still be 5, got %d", total)
+	}
+	if len(requests) != 2 {
+		t.Errorf("Expected 2 requests with limit, got %d", len(requests))
+	}
+
+	// List with cursor pagination - second page using cursor from first page
+	if len(requests) > 0 {
+		cursor := requests[len(requests)-1].CreatedAt
+		requests, total, err = store.ListRequests(ctx, storage.RequestFilter{
+			Namespace: &namespace,
+			Limit:     2,
+			Cursor:    &cursor,
+		})
+		if err != nil {
+			t.Fatalf("ListRequests with cursor failed: %v", err)
+		}
+		if total != 5 {
+			t.Errorf("Total should still be 5, got %d", total)
+		}
+		if len(requests) != 2 {
+			t.Errorf("Expected 2 requests on second page, got %d", len(requests))
+		}
+	}
+
+	// List by status
+	status := types.StatusQueued
+	requests, _, err = store.ListRequests(ctx, storage.RequestFilter{
+		Namespace: &namespace,
+		Status:    &status,
+	})
+	if err != nil {
+		t.Fatalf("ListRequests by status failed: %v", err)
+	}
+	if len(requests) != 5 {
+		t.Errorf("Expected 5 queued requests, got %d", len(requests))
+	}
+}
+
+func testListRequestsOrdering(t *testing.T, store storage.Store) {
+	ctx := context.Background()
+	now := time.Now()
+
+	if err := store.CreateNamespace(ctx, &storage.NamespaceRecord{Name: "test-ns", CreatedAt: now, UpdatedAt: now}); err != nil {
+		t.Fatalf("CreateNamespace failed: %v", err)
+	}
+
+	// Interleave statuses so that ordering by status and by time disagree
+	statuses := []types.RequestStatus{types.StatusQueued, types.StatusCompleted, types.StatusFailed, types.StatusProcessing}
+	for i := 0; i < 6; i++ {
+		req := &storage.RequestRecord{
+			ID:             fmt.Sprintf("req_%d", i),
+			Namespace:      "test-ns",
+			Status:         statuses[i%len(statuses)],
+			RequestPayload: json.RawMessage(`{"model":"gpt-4"}`),
+			CreatedAt:      now.Add(time.Duration(i) * time.Second),
+		}
+		if err := store.CreateRequest(ctx, req); err != nil {
+			t.Fatalf("CreateRequest failed: %v", err)
+		}
+	}
+
+	ids := func(records []*storage.RequestRecord) string {
+		var out []string
+		for _, r := range records {
+			out = append(out, r.ID)
+		}
+		return fmt.Sprint(out)
+	}
+
+	namespace := "test-ns"
+	requests, total, err := store.ListRequests(ctx, storage.RequestFilter{Namespace: &namespace})
+	if err != nil {
+		t.Fatalf("ListRequests failed: %v", err)
+	}
+	if total != 6 {
+		t.Errorf("Expected 6 total requests, got %d", total)
+	}
+	if got, want := ids(requests), "[req_5 req_4 req_3 req_2 req_1 req_0]"; got != want {
+		t.Errorf("Expected newest first %s, got %s", want, got)
+	}
+
+	// Pages continue strictly before the cursor across all statuses
+	page1, _, err := store.ListRequests(ctx, storage.RequestFilter{Namespace: &namespace, Limit: 4})
+	if err != nil {
+		t.Fatalf("ListRequests failed: %v", err)
+	}
+	if got, want := ids(page1), "[req_5 req_4 req_3 req_2]"; got != want {
+		t.Errorf("Expected first page %s, got %s", want, got)
+	}
+	cursor := page1[len(page1)-1].CreatedAt
+	page2, total, err := store.ListRequests(ctx, storage.RequestFilter{Namespace: &namespace, Limit: 4, Cursor: &cursor})
+	if err != nil {
+		t.Fatalf("ListRequests with cursor failed: %v", err)
+	}
+	if total != 6 {
+		t.Errorf("Total should ignore the cursor, got %d", total)
+	}
+	if got, want := ids(page2), "[req_1 req_0]"; got != want {
+		t.Errorf("Expected second page %s, got %s", want, got)
+	}
+
+	// Status filter with cursor
+	status := types.StatusCompleted
+	page1, total, err = store.ListRequests(ctx, storage.RequestFilter{Namespace: &namespace, Status: &status, Limit: 1})
+	if err != nil {
+		t.Fatalf("ListRequests by status failed: %v", err)
+	}
+	if total != 2 {
+		t.Errorf("Expected 2 completed requests, got %d", total)
+	}
+	if got, want := ids(page1), "[req_5]"; got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+	cursor = page1[0].CreatedAt
+	page2, _, err = store.ListRequests(ctx, storage.RequestFilter{Namespace: &namespace, Status: &status, Limit: 1, Cursor: &cursor})
+	if err != nil {
+		t.Fatalf("ListRequests by status with cursor failed: %v", err)
+	}
+	if got, want := ids(page2), "[req_1]"; got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
+
+// Many requests share a created_at second, so pages continue from the last
+// request's ID within the cursor's second rather than skipping the rest of it.
+func testListRequestsSameSecond(t *testing.T, store storage.Store) {
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Second)
+
+	if err := store.CreateNamespace(ctx, &storage.NamespaceRecord{Name: "test-ns", CreatedAt: now, UpdatedAt: now}); err != nil {
+		t.Fatalf("CreateNamespace failed: %v", err)
+	}
+
+	// Ten requests in one second, created out of ID order, and two before it
+	create := func(id string, status types.RequestStatus, createdAt time.Time) {
+		t.Helper()
+		if err := store.CreateRequest(ctx, &storage.RequestRecord{
+			ID:             id,
+			Namespace:      "test-ns",
+			Status:         status,
+			RequestPayload: json.RawMessage(`{"model":"gpt-4"}`),
+			CreatedAt:      createdAt,
+		}); err != nil {
+			t.Fatalf("CreateRequest failed: %v", err)
+		}
+	}
+	for _, i := range []int{3, 7, 0, 9, 4, 1, 8, 5, 2, 6} {
+		status := types.StatusQueued
+		if i%2 == 1 {
+			status = types.StatusCompleted
+		}
+		create(fmt.Sprintf("req_%d", i), status, now.Add(time.Duration(i)*time.Millisecond))
+	}
+	create("req_a", types.StatusQueued, now.Add(-time.Second))
+	create("req_b", types.StatusCompleted, now.Add(-time.Second))
+
+	list := func(status *types.RequestStatus) string {
+		t.Helper()
+		namespace := "test-ns"
+		filter := storage.RequestFilter{Namespace: &namespace, Status: status, Limit: 3}
+		var out []string
+		for page := 0; page < 10; page++ {
+			requests, _, err := store.ListRequests(ctx, filter)
+			if err != nil {
+				t.Fatalf("ListRequests failed: %v", err)
+			}
+			for _, r := range requests {
+				out = append(out, r.ID)
+			}
+			if len(requests) < filter.Limit {
+				return fmt.Sprint(out)
+			}
+			last := requests[len(requests)-1]
+			filter.Cursor = &last.CreatedAt
+			filter.CursorID = last.ID
+		}
+		t.Fatalf("Pagination did not end: %v", out)
+		return ""
+	}
+
+	if got, want := list(nil), "[req_9 req_8 req_7 req_6 req_5 req_4 req_3 req_2 req_1 req_0 req_b req_a]"; got != want {
+		t.Errorf("Expected every request once %s, got %s", want, got)
+	}
+	status := types.StatusCompleted
+	if got, want := list(&status), "[req_9 req_7 req_5 req_3 req_1 req_b]"; got != want {
+		t.Errorf("Expected every completed request once %s, got %s", want, got)
+	}
+
+	// Without an ID the cursor's whole second is skipped
+	namespace := "test-ns"
+	requests, _, err := store.ListRequests(ctx, storage.RequestFilter{Namespace: &namespace, Cursor: &now})
+	if err != nil {
+		t.Fatalf("ListRequests failed: %v", err)
+	}
+	if len(requests) != 2 || requests[0].ID != "req_b" || requests[1].ID != "req_a" {
+		t.Errorf("Expected only the earlier second, got %d requests", len(requests))
+	}
+}
+
+// Timestamps are stored with whole-second precision, the resolution of the
+// SQL backends' INTEGER columns.
+func testTimestampPrecision(t *testing.T, store storage.Store) {
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Second).Add(500 * time.Millisecond)
+	want := now.Truncate(time.Second)
+
+	checkTime := func(name string, got *time.Time) {
+		t.Helper()
+		if got == nil {
+			t.Errorf("%s is nil", name)
+			return
+		}
+		if got.Nanosecond() != 0 {
+			t.Errorf("%s has sub-second precision: %v", name, got)
+		}
+	}
+
+	if err := store.CreateNamespace(ctx, &storage.NamespaceRecord{Name: "test-ns", CreatedAt: now, UpdatedAt: now}); err != nil {
+		t.Fatalf("CreateNamespace failed: %v", err)
+	}
+	ns, err := store.GetNamespace(ctx, "test-ns")
+	if err != nil {
+		t.Fatalf("GetNamespace failed: %v", err)
+	}
+	if !ns.CreatedAt.Equal(want) || !ns.UpdatedAt.Equal(want) {
+		t.Errorf("Namespace timestamps: got %v/%v, want %v", ns.CreatedAt, ns.UpdatedAt, want)
+	}
+
+	if err := store.CreateRequest(ctx, &storage.RequestRecord{
+		ID:             "req_1",
+		Namespace:      "test-ns",
+		Status:         types.StatusQueued,
+		RequestPayload: json.RawMessage(`{"model":"gpt-4"}`),
+		CreatedAt:      now,
+	}); err != nil {
+		t.Fatalf("CreateRequest failed: %v", err)
+	}
+	req, err := store.GetRequest(ctx, "req_1")
+	if err != nil {
+		t.Fatalf("GetRequest failed: %v", err)
+	}
+	if !req.CreatedAt.Equal(want) {
+		t.Errorf("Request CreatedAt: got %v, want %v", req.CreatedAt, want)
+	}
+
+	// A cursor equal to the stored timestamp excludes the request
+	namespace := "test-ns"
+	requests, _, err := store.ListRequests(ctx, storage.RequestFilter{Namespace: &namespace, Cursor: &req.CreatedAt})
+	if err != nil {
+		t.Fatalf("ListRequests failed: %v", err)
+	}
+	if len(requests) != 0 {
+		t.Errorf("Expected cursor to exclude the request, got %d results", len(requests))
+	}
+
+	claimed, err := store.ClaimQueuedRequests(ctx, "test-ns", 1, "owner", now.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("ClaimQueuedRequests failed: %v", err)
+	}
+	if len(claimed) != 1 {
+		t.Fatalf("Expected 1 claimed request, got %d", len(claimed))
+	}
+	checkTime("DispatchedAt", claimed[0].DispatchedAt)
+	checkTime("LeaseExpiresAt", claimed[0].LeaseExpiresAt)
+	if claimed[0].LeaseExpiresAt != nil && !claimed[0].LeaseExpiresAt.Equal(want.Add(time.Minute)) {
+		t.Errorf("LeaseExpiresAt: got %v, want %v", claimed[0].LeaseExpiresAt, want.Add(time.Minute))
+	}
+
+	if err := store.UpdateRequestError(ctx, "req_1", "", "boom"); err != nil {
+		t.Fatalf("UpdateRequestError failed: %v", err)
+	}
+	req, err = store.GetRequest(ctx, "req_1")
+	if err != nil {
+		t.Fatalf("GetRequest failed: %v", err)
+	}
+	checkTime("CompletedAt", req.CompletedAt)
+
+	if err := store.SetBudgetExhausted(ctx, "test-ns", "2024-06", &now); err != nil {
+		t.Fatalf("SetBudgetExhausted failed: %v", err)
+	}
+	spend, err := store.GetBudgetSpend(ctx, "test-ns", "2024-06")
+	if err != nil {
+		t.Fatalf("GetBudgetSpend failed: %v", err)
+	}
+	checkTime("ExhaustedAt", spend.ExhaustedAt)
+
+	if err := store.PutCachedResponse(ctx, &storage.CacheEntry{
+		Namespace: "test-ns",
+		Key:       "key",
+		Response:  json.RawMessage(`{"id":"resp"}`),
+		CreatedAt: now,
+		ExpiresAt: now.Add(time.Hour),
+	}); err != nil {
+		t.Fatalf("PutCachedResponse failed: %v", err)
+	}
+	entry, err := store.GetCachedResponse(ctx, "test-ns", "key")
+	if err != nil {
+		t.Fatalf("GetCachedResponse failed: %v", err)
+	}
+	if entry == nil {
+		t.Fatal("GetCachedResponse returned nil")
+	}
+	if !entry.CreatedAt.Equal(want) || !entry.ExpiresAt.Equal(want.Add(time.Hour)) {
+		t.Errorf("Cache timestamps: got %v/%v, want %v/%v", entry.CreatedAt, entry.ExpiresAt, want, want.Add(time.Hour))
+	}
+}
+
+func testNamespaceStats(t *testing.T, store storage.Store) {
+	ctx := context.Background()
+	now := time.Now()
+
+	// Create namespace
+	ns := &storage.NamespaceRecord{
+		Name:      "test-ns",
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	err := store.CreateNamespace(ctx, ns)
+	if err != nil {
+		t.Fatalf("CreateNamespace failed: %v", err)
+	}
+
+	// Create requests with different statuses
+	statuses := []types.RequestStatus{
+		types.StatusQueued,
+		types.StatusQueued,
+		types.StatusProcessing,
+		types.StatusCompleted,
+		types.StatusFailed,
+	}
+
+	for i, status := range statuses {
+		req := &storage.RequestRecord{
+			ID:             "req_" + string(rune('a'+i)),
+			Namespace:      "test-ns",
+			Status:         status,
+			RequestPayload: json.RawMessage(`{"model":"gpt-4"}`),
+			CreatedAt:      now,
+		}
+		err = store.CreateRequest(ctx, req)
+		if err != nil {
+			t.Fatalf("CreateRequest failed: %v", err)
+		}
+	}
+
+	// Get stats
+	stats, err := store.GetNamespaceStats(ctx, "test-ns")
+	if err != nil {
+		t.Fatalf("GetNamespaceStats failed: %v", err)
+	}
+
+	if stats.TotalRequests != 5 {
+		t.Errorf("TotalRequests: got %d, want 5", stats.TotalRequests)
+	}
+	if stats.Queued != 2 {
+		t.Errorf("Queued: got %d, want 2", stats.Queued)
+	}
+	if stats.Processing != 1 {
+		t.Errorf("Processing: got %d, want 1", stats.Processing)
+	}
+	if stats.Completed != 1 {
+		t.Errorf("Completed: got %d, want 1", stats.Completed)
+	}
+	if stats.Failed != 1 {
+		t.Errorf("Failed: got %d, want 1", stats.Failed)
+	}
+}
+
+func testNamespaceUsageStats(t *testing.T, store storage.Store) {
+	ctx := context.Background()
+	now := time.Now()
+
+	ns := &storage.NamespaceRecord{
+		Name:      "test-ns",
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := store.CreateNamespace(ctx, ns); err != nil {
+		t.Fatalf("CreateNamespace failed: %v", err)
+	}
+
+	usages := []storage.Usage{
+		{PromptTokens: 100, CompletionTokens: 20, CachedTokens: 50, CostUSD: 0.25},
+		{PromptTokens: 10, CompletionTokens: 30, ReasoningTokens: 25, CostUSD: 0.5},
+	}
+	for i, usage := range usages {
+		id := "req_" + string(rune('a'+i))
+		req := &storage.RequestRecord{
+			ID:             id,
+			Namespace:      "test-ns",
+			Status:         types.StatusQueued,
+			RequestPayload: json.RawMessage(`{"model":"gpt-4"}`),
+			CreatedAt:      now,
+		}
+		if err := store.CreateRequest(ctx, req); err != nil {
+			t.Fatalf("CreateRequest failed: %v", err)
+		}
+		if err := store.UpdateRequestResponse(ctx, id, "", json.RawMessage(fmt.Sprintf(`{"id":%q}`, id)), usage); err != nil {
+			t.Fatalf("UpdateRequestResponse failed: %v", err)
+		}
+	}
+
+	stats, err := store.GetNamespaceStats(ctx, "test-ns")
+	if err != nil {
+		t.Fatalf("GetNamespaceStats failed: %v", err)
+	}
+
+	if stats.PromptTokens != 110 || stats.CompletionTokens != 50 {
+		t.Errorf("Token totals: got %d/%d, want 110/50", stats.PromptTokens, stats.CompletionTokens)
+	}
+	if stats.CachedTokens != 50 || stats.ReasoningTokens != 25 {
+		t.Errorf("Detail totals: got %d/%d, want 50/25", stats.CachedTokens, stats.ReasoningTokens)
+	}
+	if stats.CostUSD != 0.75 {
+		t.Errorf("CostUSD: got %v, want 0.75", stats.CostUSD)
+	}
+}
+
+func testBudgetSpend(t *testing.T, store storage.Store) {
+	ctx := context.Background()
+	now := time.Now()
+
+	limit := 1.0
+	ns := &storage.NamespaceRecord{
+		Name:      "test-ns",
+		Budget:    &storage.Budget{LimitUSD: &limit, Period: types.BudgetPeriodDay},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := store.CreateNamespace(ctx, ns); err != nil {
+		t.Fatalf("CreateNamespace failed: %v", err)
+	}
+
+	retrievedNs, err := store.GetNamespace(ctx, "test-ns")
+	if err != nil {
+		t.Fatalf("GetNamespace failed: %v", err)
+	}
+	if retrievedNs.Budget == nil || *retrievedNs.Budget.LimitUSD != 1.0 || retrievedNs.Budget.Period != types.BudgetPeriodDay {
+		t.Errorf("Budget mismatch: %+v", retrievedNs.Budget)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := store.AddBudgetSpend(ctx, "test-ns", "2024-06-01", 0.25, 100); err != nil {
+			t.Fatalf("AddBudgetSpend failed: %v", err)
+		}
+	}
+	if err := store.SetBudgetExhausted(ctx, "test-ns", "2024-06-01", &now); err != nil {
+		t.Fatalf("SetBudgetExhausted failed: %v", err)
+	}
+
+	spend, err := store.GetBudgetSpend(ctx, "test-ns", "2024-06-01")
+	if err != nil {
+		t.Fatalf("GetBudgetSpend failed: %v", err)
+	}
+	if spend.SpentUSD != 0.5 || spend.SpentTokens != 200 || spend.ExhaustedAt == nil {
+		t.Errorf("Spend mismatch: %+v", spend)
+	}
+
+	// A new period starts from zero
+	if err := store.AddBudgetSpend(ctx, "test-ns", "2024-06-02", 0.1, 10); err != nil {
+		t.Fatalf("AddBudgetSpend failed: %v", err)
+	}
+	spend, err = store.GetBudgetSpend(ctx, "test-ns", "2024-06-02")
+	if err != nil {
+		t.Fatalf("GetBudgetSpend failed: %v", err)
+	}
+	if spend.SpentUSD != 0.1 || spend.SpentTokens != 10 || spend.ExhaustedAt != nil {
+		t.Errorf("Spend after rollover mismatch: %+v", spend)
+	}
+
+	if err := store.ResetBudget(ctx, "test-ns"); err != nil {
+		t.Fatalf("ResetBudget failed: %v", err)
+	}
+	spend, err = store.GetBudgetSpend(ctx, "test-ns", "2024-06-02")
+	if err != nil {
+		t.Fatalf("GetBudgetSpend failed: %v", err)
+	}
+	if spend.SpentUSD != 0 || spend.SpentTokens != 0 {
+		t.Errorf("Spend after reset mismatch: %+v", spend)
+	}
+}
+
+func testResponseCache(t *testing.T, store storage.Store) {
+	ctx := context.Background()
+	now := time.Now()
+
+	ns := &storage.NamespaceRecord{
+		Name:      "test-ns",
+		Cache:     &storage.CacheConfig{TTLSeconds: 60},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := store.CreateNamespace(ctx, ns); err != nil {
+		t.Fatalf("CreateNamespace failed: %v", err)
+	}
+
+	retrievedNs, err := store.GetNamespace(ctx, "test-ns")
+	if err != nil {
+		t.Fatalf("GetNamespace failed: %v", err)
+	}
+	if retrievedNs.Cache == nil || retrievedNs.Cache.TTLSeconds != 60 {
+		t.Errorf("Cache config mismatch: %+v", retrievedNs.Cache)
+	}
+
+	entries := []*storage.CacheEntry{
+		{Namespace: "test-ns", Key: "fresh", Response: json.RawMessage(`{"id":"a"}`), CreatedAt: now, ExpiresAt: now.Add(time.Minute)},
+		{Namespace: "test-ns", Key: "stale", Response: json.RawMessage(`{"id":"b"}`), CreatedAt: now, ExpiresAt: now.Add(-time.Minute)},
+	}
+	for _, entry := range entries {
+		if err := store.PutCachedResponse(ctx, entry); err != nil {
+			t.Fatalf("PutCachedResponse failed: %v", err)
+		}
+	}
+
+	entry, err := store.GetCachedResponse(ctx, "test-ns", "fresh")
+	if err != nil {
+		t.Fatalf("GetCachedResponse failed: %v", err)
+	}
+	if entry == nil || string(entry.Response) != `{"id":"a"}` {
+		t.Errorf("Expected fresh entry, got %+v", entry)
+	}
+
+	for _, key := range []string{"stale", "missing"} {
+		entry, err = store.GetCachedResponse(ctx, "test-ns", key)
+		if err != nil {
+			t.Fatalf("GetCachedResponse failed: %v", err)
+		}
+		if entry != nil {
+			t.Errorf("Expected no entry for %s, got %+v", key, entry)
+		}
+	}
+
+	if err := store.RecordCacheLookup(ctx, "test-ns", true); err != nil {
+		t.Fatalf("RecordCacheLookup failed: %v", err)
+	}
+	if err := store.RecordCacheLookup(ctx, "test-ns", false); err != nil {
+		t.Fatalf("RecordCacheLookup failed: %v", err)
+	}
+
+	stats, err := store.GetNamespaceStats(ctx, "test-ns")
+	if err != nil {
+		t.Fatalf("GetNamespaceStats failed: %v", err)
+	}
+	if stats.CacheHits != 1 || stats.CacheMisses != 1 {
+		t.Errorf("Cache stats mismatch: %d hits, %d misses", stats.CacheHits, stats.CacheMisses)
+	}
+}
+
+func testGetQueuedRequests(t *testing.T, store storage.Store) {
+	ctx := context.Background()
+	now := time.Now()
+
+	// Create namespace
+	ns := &storage.NamespaceRecord{
+		Name:      "test-ns",
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	err := store.CreateNamespace(ctx, ns)
+	if err != nil {
+		t.Fatalf("CreateNamespace failed: %v", err)
+	}
+
+	// Create mixed requests
+	for i := 0; i < 3; i++ {
+		req := &storage.RequestRecord{
+			ID:             "req_queued_" + string(rune('a'+i)),
+			Namespace:      "test-ns",
+			Status:         types.StatusQueued,
+			RequestPayload: json.RawMessage(`{"model":"gpt-4"}`),
+			CreatedAt:      now,
+		}
+		err = store.CreateRequest(ctx, req)
+		if err != nil {
+			t.Fatalf("CreateRequest failed: %v", err)
+		}
+	}
+
+	// Create non-queued request
+	req := &storage.RequestRecord{
+		ID:             "req_completed",
+		Namespace:      "test-ns",
+		Status:         types.StatusCompleted,
+		RequestPayload: json.RawMessage(`{"model":"gpt-4"}`),
+		CreatedAt:      now,
+	}
+	err = store.CreateRequest(ctx, req)
+	if err != nil {
+		t.Fatalf("CreateRequest failed: %v", err)
+	}
+
+	// Get queued requests
+	queued, err := store.GetQueuedRequests(ctx, "test-ns")
+	if err != nil {
+		t.Fatalf("GetQueuedRequests failed: %v", err)
+	}
+
+	if len(queued) != 3 {
+		t.Errorf("Expected 3 queued requests, got %d", len(queued))
+	}
+
+	for _, r := range queued {
+		if r.Status != types.StatusQueued {
+			t.Errorf("Expected queued status, got %s", r.Status)
+		}
+	}
+}
+
+func testExportImportRequests(t *testing.T, store storage.Store) {
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Second)
+
+	for _, name := range []string{"ns-a", "ns-b"} {
+		if err := store.CreateNamespace(ctx, &storage.NamespaceRecord{Name: name, CreatedAt: now, UpdatedAt: now}); err != nil {
+			t.Fatalf("CreateNamespace failed: %v", err)
+		}
+	}
+
+	dispatchedAt := now.Add(time.Second)
+	completedAt := now.Add(2 * time.Second)
+	primary := "req_0"
+	errMsg := "upstream failed"
+	endpoint := "https://api.example.com/v1"
+
+	imported := []*storage.RequestRecord{
+		{
+			ID:             "req_0",
+			Namespace:      "ns-a",
+			Status:         types.StatusCompleted,
+			RequestPayload: json.RawMessage(`{"model":"gpt-4"}`),
+			PassthroughHeaders: map[string]string{
+				"X-Trace": "abc",
+			},
+			HeaderEndpoint:  &endpoint,
+			ResponsePayload: json.RawMessage(`{"id":"resp_0"}`),
+			Usage:           storage.Usage{PromptTokens: 10, CompletionTokens: 20, CachedTokens: 3, ReasoningTokens: 4, CostUSD: 0.5},
+			CreatedAt:       now,
+			DispatchedAt:    &dispatchedAt,
+			CompletedAt:     &completedAt,
+			Attempts:        2,
+		},
+		{
+			ID:             "req_1",
+			Namespace:      "ns-b",
+			Status:         types.StatusFailed,
+			RequestPayload: json.RawMessage(`{"model":"gpt-4"}`),
+			Error:          &errMsg,
+			CoalescedWith:  &primary,
+			CreatedAt:      now,
+			CompletedAt:    &completedAt,
+		},
+		{
+			ID:              "req_2",
+			Namespace:       "ns-a",
+			Status:          types.StatusCompleted,
+			RequestPayload:  json.RawMessage(`{"model":"gpt-4"}`),
+			ResponsePayload: json.RawMessage(`{"id":"resp_0"}`),
+			CacheHit:        true,
+			CreatedAt:       now,
+			CompletedAt:     &completedAt,
+		},
+	}
+	for _, req := range imported {
+		if err := store.ImportRequest(ctx, req); err != nil {
+			t.Fatalf("ImportRequest failed: %v", err)
+		}
+	}
+
+	// Export pages through every namespace in ID order
+	var exported []*storage.RequestRecord
+	afterID := ""
+	for {
+		page, err := store.ExportRequests(ctx, afterID, 2)
+		if err != nil {
+			t.Fatalf("ExportRequests failed: %v", err)
+		}
+		if len(page) == 0 {
+			break
+		}
+		exported = append(exported, page...)
+		afterID = page[len(page)-1].ID
+	}
+	if len(exported) != len(imported) {
+		t.Fatalf("Expected %d exported requests, got %d", len(imported), len(exported))
+	}
+
+	for i, got := range exported {
+		want := imported[i]
+		if got.ID != want.ID || got.Namespace != want.Namespace || got.Status != want.Status {
+			t.Errorf("Request %d: got %s/%s/%s, want %s/%s/%s", i, got.ID, got.Namespace, got.Status, want.ID, want.Namespace, want.Status)
+		}
+		if got.Usage != want.Usage {
+			t.Errorf("Request %s usage: got %+v, want %+v", want.ID, got.Usage, want.Usage)
+		}
+		if got.CacheHit != want.CacheHit || got.Attempts != want.Attempts {
+			t.Errorf("Request %s: got cache_hit=%v attempts=%d", want.ID, got.CacheHit, got.Attempts)
+		}
+		if !got.CreatedAt.Equal(want.CreatedAt) {
+			t.Errorf("Request %s CreatedAt: got %v, want %v", want.ID, got.CreatedAt, want.CreatedAt)
+		}
+		if (got.CompletedAt == nil) != (want.CompletedAt == nil) || (got.CompletedAt != nil && !got.CompletedAt.Equal(*want.CompletedAt)) {
+			t.Errorf("Request %s CompletedAt: got %v, want %v", want.ID, got.CompletedAt, want.CompletedAt)
+		}
+		if (got.Error == nil) != (want.Error == nil) || (got.CoalescedWith == nil) != (want.CoalescedWith == nil) {
+			t.Errorf("Request %s error/coalesced mismatch: got %v/%v", want.ID, got.Error, got.CoalescedWith)
+		}
+		if (got.ResponsePayload == nil) != (want.ResponsePayload == nil) {
+			t.Errorf("Request %s response mismatch: got %v", want.ID, got.ResponsePayload)
+		}
+	}
+	if got := exported[0]; got.DispatchedAt == nil || !got.DispatchedAt.Equal(dispatchedAt) {
+		t.Errorf("DispatchedAt not preserved: %v", got.DispatchedAt)
+	}
+	if got := exported[0]; got.HeaderEndpoint == nil || *got.HeaderEndpoint != endpoint || got.PassthroughHeaders["X-Trace"] != "abc" {
+		t.Errorf("Headers not preserved: %v %v", got.HeaderEndpoint, got.PassthroughHeaders)
+	}
+
+	stats, err := store.GetNamespaceStats(ctx, "ns-a")
+	if err != nil {
+		t.Fatalf("GetNamespaceStats failed: %v", err)
+	}
+	if stats.TotalRequests != 2 || stats.Completed != 2 || stats.PromptTokens != 10 || stats.CostUSD != 0.5 {
+		t.Errorf("Unexpected stats after import: %+v", stats)
+	}
+
+	// Importing again replaces the request and its contribution to stats
+	replacement := *imported[0]
+	replacement.Status = types.StatusQueued
+	replacement.ResponsePayload = nil
+	replacement.Usage = storage.Usage{}
+	replacement.CompletedAt = nil
+	if err := store.ImportRequest(ctx, &replacement); err != nil {
+		t.Fatalf("ImportRequest replacement failed: %v", err)
+	}
+
+	stats, err = store.GetNamespaceStats(ctx, "ns-a")
+	if err != nil {
+		t.Fatalf("GetNamespaceStats failed: %v", err)
+	}
+	if stats.TotalRequests != 2 || stats.Queued != 1 || stats.Completed != 1 || stats.PromptTokens != 0 || stats.CostUSD != 0 {
+		t.Errorf("Unexpected stats after replacement: %+v", stats)
+	}
+
+	req, err := store.GetRequest(ctx, "req_0")
+	if err != nil {
+		t.Fatalf("GetRequest failed: %v", err)
+	}
+	if req.Status != types.StatusQueued || req.ResponsePayload != nil || req.CompletedAt != nil {
+		t.Errorf("Replacement not applied: %+v", req)
+	}
+
+	queued, err := store.GetQueuedRequests(ctx, "ns-a")
+	if err != nil {
+		t.Fatalf("GetQueuedRequests failed: %v", err)
+	}
+	if len(queued) != 1 || queued[0].ID != "req_0" {
+		t.Errorf("Expected req_0 to be queued, got %d requests", len(queued))
+	}
+}
+
+func testClaimQueuedRequests(t *testing.T, store storage.Store) {
+	ctx := context.Background()
+	now := time.Now()
+
+	err := store.CreateNamespace(ctx, &storage.NamespaceRecord{Name: "test-ns", CreatedAt: now, UpdatedAt: now})
+	if err != nil {
+		t.Fatalf("CreateNamespace failed: %v", err)
+	}
+
+	for i := 0; i < 20; i++ {
+		err := store.CreateRequest(ctx, &storage.RequestRecord{
+			ID:             fmt.Sprintf("req_%02d", i),
+			Namespace:      "test-ns",
+			Status:         types.StatusQueued,
+			RequestPayload: json.RawMessage(`{"model":"gpt-4"}`),
+			CreatedAt:      now.Add(time.Duration(i) * time.Second),
+		})
+		if err != nil {
+			t.Fatalf("CreateRequest failed: %v", err)
+		}
+	}
+
+	leaseUntil := now.Add(time.Minute)
+	first, err := store.ClaimQueuedRequests(ctx, "test-ns", 3, "owner-a", leaseUntil)
+	if err != nil {
+		t.Fatalf("ClaimQueuedRequests failed: %v", err)
+	}
+	if len(first) != 3 {
+		t.Fatalf("Expected 3 claimed requests, got %d", len(first))
+	}
+	for i, req := range first {
+		if req.ID != fmt.Sprintf("req_%02d", i) {
+			t.Errorf("Expected oldest requests first, got %s at %d", req.ID, i)
+		}
+		if req.Status != types.StatusProcessing || req.Attempts != 1 {
+			t.Errorf("Expected processing with 1 attempt, got %s with %d", req.Status, req.Attempts)
+		}
+		if req.LeaseOwner == nil || *req.LeaseOwner != "owner-a" || req.LeaseExpiresAt == nil {
+			t.Errorf("Lease not recorded: %v %v", req.LeaseOwner, req.LeaseExpiresAt)
+		}
+	}
+
+	// Concurrent claims never hand out the same request twice
+	var mu sync.Mutex
+	seen := make(map[string]int)
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				claimed, err := store.ClaimQueuedRequests(ctx, "test-ns", 2, "owner-b", leaseUntil)
+				if err != nil {
+					t.Errorf("ClaimQueuedRequests failed: %v", err)
+					return
+				}
+				if len(claimed) == 0 {
+					return
+				}
+				mu.Lock()
+				for _, req := range claimed {
+					seen[req.ID]++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(seen) != 17 {
+		t.Errorf("Expected the remaining 17 requests to be claimed, got %d", len(seen))
+	}
+	for id, count := range seen {
+		if count != 1 {
+			t.Errorf("%s claimed %d times", id, count)
+		}
+	}
+
+	stats, _ := store.GetNamespaceStats(ctx, "test-ns")
+	if stats.Queued != 0 || stats.Processing != 20 {
+		t.Errorf("Expected 20 processing, got %d queued and %d processing", stats.Queued, stats.Processing)
+	}
+}
+
+func testRecoverExpiredLeases(t *testing.T, store storage.Store) {
+	ctx := context.Background()
+	now := time.Now()
+
+	err := store.CreateNamespace(ctx, &storage.NamespaceRecord{Name: "test-ns", CreatedAt: now, UpdatedAt: now})
+	if err != nil {
+		t.Fatalf("CreateNamespace failed: %v", err)
+	}
+
+	// Queue and claim one request at a time so each claim takes exactly it
+	claim := func(id, owner string, until time.Time) {
+		t.Helper()
+		if existing, _ := store.GetRequest(ctx, id); existing == nil {
+			err := store.CreateRequest(ctx, &storage.RequestRecord{
+				ID:             id,
+				Namespace:      "test-ns",
+				Status:         types.StatusQueued,
+				RequestPayload: json.RawMessage(`{"model":"gpt-4"}`),
+				CreatedAt:      now,
+			})
+			if err != nil {
+				t.Fatalf("CreateRequest failed: %v", err)
+			}
+		}
+		claimed, err := store.ClaimQueuedRequests(ctx, "test-ns", 1, owner, until)
+		if err != nil || len(claimed) != 1 || claimed[0].ID != id {
+			t.Fatalf("ClaimQueuedRequests did not claim %s: %v %v", id, claimed, err)
+		}
+	}
+
+	expired := now.Add(-time.Minute)
+	live := now.Add(time.Hour)
+
+	for i := 0; i < 3; i++ {
+		if i > 0 {
+			if _, _, err := store.RecoverExpiredLeases(ctx, "", now, 10); err != nil {
+				t.Fatalf("RecoverExpiredLeases failed: %v", err)
+			}
+		}
+		claim("req_exhausted", "other", expired)
+	}
+	claim("req_expired", "other", expired)
+	claim("req_live", "other", live)
+	claim("req_restarted", "self", live)
+
+	leased, _ := store.GetRequest(ctx, "req_live")
+	if leased.Status != types.StatusProcessing || leased.Attempts != 1 {
+		t.Errorf("Expected processing with 1 attempt, got %s with %d", leased.Status, leased.Attempts)
+	}
+	if leased.LeaseOwner == nil || *leased.LeaseOwner != "other" || leased.LeaseExpiresAt == nil {
+		t.Errorf("Lease not recorded: %v %v", leased.LeaseOwner, leased.LeaseExpiresAt)
+	}
+
+	requeued, failed, err := store.RecoverExpiredLeases(ctx, "self", now, 3)
+	if err != nil {
+		t.Fatalf("RecoverExpiredLeases failed: %v", err)
+	}
+	if requeued != 2 || failed != 1 {
+		t.Errorf("Expected 2 requeued and 1 failed, got %d and %d", requeued, failed)
+	}
+
+	want := map[string]types.RequestStatus{
+		"req_expired":   types.StatusQueued,
+		"req_exhausted": types.StatusFailed,
+		"req_live":      types.StatusProcessing,
+		"req_restarted": types.StatusQueued,
+	}
+	for id, status := range want {
+		req, _ := store.GetRequest(ctx, id)
+		if req.Status != status {
+			t.Errorf("%s: expected %s, got %s", id, status, req.Status)
+		}
+		if status != types.StatusProcessing && req.LeaseOwner != nil {
+			t.Errorf("%s: lease should be cleared", id)
+		}
+	}
+
+	exhausted, _ := store.GetRequest(ctx, "req_exhausted")
+	if exhausted.Error == nil || *exhausted.Error != storage.MaxAttemptsError {
+		t.Errorf("Expected max attempts error, got %v", exhausted.Error)
+	}
+}
+
+func testLeaseOwnership(t *testing.T, store storage.Store) {
+	ctx := context.Background()
+	now := time.Now()
+
+	err := store.CreateNamespace(ctx, &storage.NamespaceRecord{Name: "test-ns", CreatedAt: now, UpdatedAt: now})
+	if err != nil {
+		t.Fatalf("CreateNamespace failed: %v", err)
+	}
+	err = store.CreateRequest(ctx, &storage.RequestRecord{
+		ID:             "req_1",
+		Namespace:      "test-ns",
+		Status:         types.StatusQueued,
+		RequestPayload: json.RawMessage(`{"model":"gpt-4"}`),
+		CreatedAt:      now,
+	})
+	if err != nil {
+		t.Fatalf("CreateRequest failed: %v", err)
+	}
+
+	// owner-a's lease expires and owner-b claims the request again
+	if _, err := store.ClaimQueuedRequests(ctx, "test-ns", 1, "owner-a", now.Add(-time.Minute)); err != nil {
+		t.Fatalf("ClaimQueuedRequests failed: %v", err)
+	}
+	if _, _, err := store.RecoverExpiredLeases(ctx, "", now, 10); err != nil {
+		t.Fatalf("RecoverExpiredLeases failed: %v", err)
+	}
+	if claimed, err := store.ClaimQueuedRequests(ctx, "test-ns", 1, "owner-b", now.Add(time.Hour)); err != nil || len(claimed) != 1 {
+		t.Fatalf("ClaimQueuedRequests = %v, %v; want req_1", claimed, err)
+	}
+
+	// owner-a's late writes are refused and leave the request alone
+	lost := map[string]error{
+		"UpdateRequestResponse":  store.UpdateRequestResponse(ctx, "req_1", "owner-a", json.RawMessage(`{"id":"a"}`), storage.Usage{PromptTokens: 10}),
+		"UpdateRequestCacheHit":  store.UpdateRequestCacheHit(ctx, "req_1", "owner-a", json.RawMessage(`{"id":"a"}`)),
+		"UpdateRequestCoalesced": store.UpdateRequestCoalesced(ctx, "req_1", "owner-a", "req_0", json.RawMessage(`{"id":"a"}`), nil),
+		"UpdateRequestError":     store.UpdateRequestError(ctx, "req_1", "owner-a", "late"),
+	}
+	for name, err := range lost {
+		if !errors.Is(err, storage.ErrLeaseLost) {
+			t.Errorf("%s by a former owner: got %v, want ErrLeaseLost", name, err)
+		}
+	}
+	if err := store.ReleaseRequest(ctx, "req_1", "owner-a"); err != nil {
+		t.Fatalf("ReleaseRequest failed: %v", err)
+	}
+
+	req, _ := store.GetRequest(ctx, "req_1")
+	if req.Status != types.StatusProcessing || req.LeaseOwner == nil || *req.LeaseOwner != "owner-b" {
+		t.Errorf("Expected req_1 still processing under owner-b, got %s under %v", req.Status, req.LeaseOwner)
+	}
+	stats, _ := store.GetNamespaceStats(ctx, "test-ns")
+	if stats.Processing != 1 || stats.Completed != 0 || stats.Failed != 0 || stats.PromptTokens != 0 {
+		t.Errorf("Unexpected stats after refused writes: %+v", stats)
+	}
+
+	// The current owner finishes it, after which nobody else can
+	if err := store.UpdateRequestResponse(ctx, "req_1", "owner-b", json.RawMessage(`{"id":"b"}`), storage.Usage{PromptTokens: 10}); err != nil {
+		t.Fatalf("UpdateRequestResponse by the owner failed: %v", err)
+	}
+	if err := store.UpdateRequestError(ctx, "req_1", "owner-b", "again"); !errors.Is(err, storage.ErrLeaseLost) {
+		t.Errorf("UpdateRequestError on a finished request: got %v, want ErrLeaseLost", err)
+	}
+	req, _ = store.GetRequest(ctx, "req_1")
+	if req.Status != types.StatusCompleted || string(req.ResponsePayload) != `{"id":"b"}` || req.Error != nil {
+		t.Errorf("Expected owner-b's response, got %s %s %v", req.Status, req.ResponsePayload, req.Error)
+	}
+	stats, _ = store.GetNamespaceStats(ctx, "test-ns")
+	if stats.Completed != 1 || stats.Processing != 0 || stats.PromptTokens != 10 {
+		t.Errorf("Unexpected stats after completion: %+v", stats)
+	}
+}
+
+func testConcurrentLeaseUpdates(t *testing.T, store storage.Store) {
+	ctx := context.Background()
+	now := time.Now()
+	const n = 30
+
+	err := store.CreateNamespace(ctx, &storage.NamespaceRecord{Name: "test-ns", CreatedAt: now, UpdatedAt: now})
+	if err != nil {
+		t.Fatalf("CreateNamespace failed: %v", err)
+	}
+	for i := 0; i < n; i++ {
+		err := store.CreateRequest(ctx, &storage.RequestRecord{
+			ID:             fmt.Sprintf("req_%02d", i),
+			Namespace:      "test-ns",
+			Status:         types.StatusQueued,
+			RequestPayload: json.RawMessage(`{"model":"gpt-4"}`),
+			CreatedAt:      now,
+		})
+		if err != nil {
+			t.Fatalf("CreateRequest failed: %v", err)
+		}
+	}
+
+	// Leases that are already expired, so the sweeper races every completion
+	expired := now.Add(-time.Minute)
+	if _, err := store.ClaimQueuedRequests(ctx, "test-ns", n, "owner", expired); err != nil {
+		t.Fatalf("ClaimQueuedRequests failed: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			if _, _, err := store.RecoverExpiredLeases(ctx, "", now, 100); err != nil {
+				t.Errorf("RecoverExpiredLeases failed: %v", err)
+				return
+			}
+			if _, err := store.ClaimQueuedRequests(ctx, "test-ns", n, "owner", expired); err != nil {
+				t.Errorf("ClaimQueuedRequests failed: %v", err)
+				return
+			}
+		}
+	}()
+
+	var mu sync.Mutex
+	completed := 0
+	for w := 0; w < 3; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < n; i += 3 {
+				err := store.UpdateRequestResponse(ctx, fmt.Sprintf("req_%02d", i), "owner", json.RawMessage(`{"id":"x"}`), storage.Usage{PromptTokens: 1})
+				switch {
+				case err == nil:
+					mu.Lock()
+					completed++
+					mu.Unlock()
+				case !errors.Is(err, storage.ErrLeaseLost):
+					t.Errorf("UpdateRequestResponse failed: %v", err)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	stats, err := store.GetNamespaceStats(ctx, "test-ns")
+	if err != nil {
+		t.Fatalf("GetNamespaceStats failed: %v", err)
+	}
+	if stats.TotalRequests != n || stats.Queued+stats.Processing+stats.Completed+stats.Failed != n {
+		t.Errorf("Status counts do not add up to %d: %+v", n, stats)
+	}
+	if stats.Completed != completed || stats.PromptTokens != int64(completed) {
+		t.Errorf("Expected %d completed with as many prompt tokens, got %+v", completed, stats)
+	}
+
+	// Every request is listed exactly once, under the status it is counted in
+	for status, count := range map[types.RequestStatus]int{
+		types.StatusQueued:     stats.Queued,
+		types.StatusProcessing: stats.Processing,
+		types.StatusCompleted:  stats.Completed,
+	} {
+		ns, status := "test-ns", status
+		listed, total, err := store.ListRequests(ctx, storage.RequestFilter{Namespace: &ns, Status: &status, Limit: n + 1})
+		if err != nil {
+			t.Fatalf("ListRequests failed: %v", err)
+		}
+		if len(listed) != count || total != count {
+			t.Errorf("%s: listed %d (total %d), counted %d", status, len(listed), total, count)
+		}
+	}
+}
+
+func testDispatchLease(t *testing.T, store storage.Store) {
+	ctx := context.Background()
+	now := time.Now()
+
+	acquire := func(owner string, now, until time.Time) bool {
+		t.Helper()
+		ok, err := store.AcquireDispatchLease(ctx, "test-ns", owner, now, until)
+		if err != nil {
+			t.Fatalf("AcquireDispatchLease failed: %v", err)
+		}
+		return ok
+	}
+
+	if !acquire("a", now, now.Add(30*time.Second)) {
+		t.Fatal("Expected a to acquire a free lease")
+	}
+	if acquire("b", now, now.Add(30*time.Second)) {
+		t.Error("Expected b to be refused while a holds the lease")
+	}
+	if !acquire("a", now, now.Add(60*time.Second)) {
+		t.Error("Expected a to renew its own lease")
+	}
+	if !acquire("b", now.Add(61*time.Second), now.Add(90*time.Second)) {
+		t.Error("Expected b to take over an expired lease")
+	}
+
+	// Releasing a lease held by someone else is a no-op
+	if err := store.ReleaseDispatchLease(ctx, "test-ns", "a"); err != nil {
+		t.Fatalf("ReleaseDispatchLease failed: %v", err)
+	}
+	if acquire("a", now.Add(61*time.Second), now.Add(90*time.Second)) {
+		t.Error("Expected b's lease to survive a release by a")
+	}
+
+	if err := store.ReleaseDispatchLease(ctx, "test-ns", "b"); err != nil {
+		t.Fatalf("ReleaseDispatchLease failed: %v", err)
+	}
+	if !acquire("a", now.Add(61*time.Second), now.Add(90*time.Second)) {
+		t.Error("Expected a to acquire a released lease")
+	}
+}
+
+func testDeleteNamespaceWithRequests(t *testing.T, store storage.Store) {
+	ctx := context.Background()
+	now := time.Now()
+
+	// Create namespace
+	ns := &storage.NamespaceRecord{
+		Name:      "test-ns",
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	err := store.CreateNamespace(ctx, ns)
+	if err != nil {
+		t.Fatalf("CreateNamespace failed: %v", err)
+	}
+
+	// Create requests
+	for i := 0; i < 3; i++ {
+		req := &storage.RequestRecord{
+			ID:             "req_" + string(rune('a'+i)),
+			Namespace:      "test-ns",
+			Status:         types.StatusQueued,
+			RequestPayload: json.RawMessage(`{"model":"gpt-4"}`),
+			CreatedAt:      now,
+		}
+		err = store.CreateRequest(ctx, req)
+		if err != nil {
+			t.Fatalf("CreateRequest failed: %v", err)
+		}
+	}
+
+	// Delete namespace
+	deleted, err := store.DeleteNamespace(ctx, "test-ns")
+	if err != nil {
+		t.Fatalf("DeleteNamespace failed: %v", err)
+	}
+
+	if deleted != 3 {
+		t.Errorf("Expected 3 deleted requests, got %d", deleted)
+	}
+
+	// Verify requests are deleted
+	namespace := "test-ns"
+	requests, total, err := store.ListRequests(ctx, storage.RequestFilter{Namespace: &namespace})
+	if err != nil {
+		t.Fatalf("ListRequests failed: %v", err)
+	}
+	if total != 0 {
+		t.Errorf("Expected 0 requests after delete, got %d", total)
+	}
+	if len(requests) != 0 {
+		t.Errorf("Expected empty requests list, got %d", len(requests))
+	}
+}
+
+// A namespace's bookkeeping is its own even when its name starts with the
+// name of another namespace and a colon.
+func testNamespaceNamePrefixes(t *testing.T, store storage.Store) {
+	ctx := context.Background()
+	now := time.Now()
+
+	for i, name := range []string{"a", "a:b"} {
+		if err := store.CreateNamespace(ctx, &storage.NamespaceRecord{Name: name, CreatedAt: now, UpdatedAt: now}); err != nil {
+			t.Fatalf("CreateNamespace failed: %v", err)
+		}
+		if err := store.AddBudgetSpend(ctx, name, "2024-06-01", 0.25, 100); err != nil {
+			t.Fatalf("AddBudgetSpend failed: %v", err)
+		}
+		if err := store.PutCachedResponse(ctx, &storage.CacheEntry{Namespace: name, Key: "key", Response: json.RawMessage(`{"id":"a"}`), CreatedAt: now, ExpiresAt: now.Add(time.Hour)}); err != nil {
+			t.Fatalf("PutCachedResponse failed: %v", err)
+		}
+		completedAt := now.Add(-time.Hour)
+		if err := store.ImportRequest(ctx, &storage.RequestRecord{
+			ID:             fmt.Sprintf("req_%d", i),
+			Namespace:      name,
+			Status:         types.StatusCompleted,
+			RequestPayload: json.RawMessage(`{"model":"gpt-4"}`),
+			CreatedAt:      completedAt,
+			CompletedAt:    &completedAt,
+		}); err != nil {
+			t.Fatalf("ImportRequest failed: %v", err)
+		}
+	}
+
+	if err := store.ResetBudget(ctx, "a"); err != nil {
+		t.Fatalf("ResetBudget failed: %v", err)
+	}
+	if spend, err := store.GetBudgetSpend(ctx, "a:b", "2024-06-01"); err != nil || spend.SpentUSD != 0.25 {
+		t.Errorf("Expected a:b's spend kept, got %+v, %v", spend, err)
+	}
+
+	if _, err := store.DeleteNamespace(ctx, "a"); err != nil {
+		t.Fatalf("DeleteNamespace failed: %v", err)
+	}
+	if spend, err := store.GetBudgetSpend(ctx, "a:b", "2024-06-01"); err != nil || spend.SpentUSD != 0.25 {
+		t.Errorf("Expected a:b's spend kept, got %+v, %v", spend, err)
+	}
+	if entry, err := store.GetCachedResponse(ctx, "a:b", "key"); err != nil || entry == nil {
+		t.Errorf("Expected a:b's cached response kept: %v", err)
+	}
+	if stats, err := store.GetNamespaceStats(ctx, "a:b"); err != nil || stats.TotalRequests != 1 {
+		t.Errorf("Expected a:b's request counted, got %+v, %v", stats, err)
+	}
+	if purged, err := store.PurgeRequests(ctx, "a:b", types.StatusCompleted, now, 10); err != nil || purged != 1 {
+		t.Errorf("PurgeRequests = %d, %v; want a:b's request", purged, err)
+	}
+}
+
+func testPurgeRequests(t *testing.T, store storage.Store) {
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Second)
+
+	for _, name := range []string{"test-ns", "other-ns"} {
+		if err := store.CreateNamespace(ctx, &storage.NamespaceRecord{Name: name, CreatedAt: now, UpdatedAt: now}); err != nil {
+			t.Fatalf("CreateNamespace failed: %v", err)
+		}
+	}
+
+	// Every request was created long ago; age is days since it finished
+	created := now.AddDate(0, 0, -60)
+	for _, req := range []struct {
+		id, namespace string
+		status        types.RequestStatus
+		age           int
+	}{
+		{"completed-40", "test-ns", types.StatusCompleted, 40},
+		{"completed-35", "test-ns", types.StatusCompleted, 35},
+		{"completed-31", "test-ns", types.StatusCompleted, 31},
+		{"completed-10", "test-ns", types.StatusCompleted, 10},
+		{"failed-40", "test-ns", types.StatusFailed, 40},
+		{"queued", "test-ns", types.StatusQueued, 0},
+		{"other-40", "other-ns", types.StatusCompleted, 40},
+	} {
+		record := &storage.RequestRecord{
+			ID:             req.id,
+			Namespace:      req.namespace,
+			Status:         req.status,
+			RequestPayload: json.RawMessage(`{"model":"gpt-4"}`),
+			CreatedAt:      created,
+		}
+		if req.status != types.StatusQueued {
+			completedAt := now.AddDate(0, 0, -req.age)
+			record.CompletedAt = &completedAt
+		}
+		if req.id == "completed-40" {
+			record.ResponsePayload = json.RawMessage(`{"id":"x"}`)
+			record.Usage = storage.Usage{PromptTokens: 10}
+		}
+		if err := store.ImportRequest(ctx, record); err != nil {
+			t.Fatalf("ImportRequest failed: %v", err)
+		}
+	}
+
+	before := now.AddDate(0, 0, -30)
+
+	// The longest finished go first
+	purged, err := store.PurgeRequests(ctx, "test-ns", types.StatusCompleted, before, 2)
+	if err != nil {
+		t.Fatalf("PurgeRequests failed: %v", err)
+	}
+	if purged != 2 {
+		t.Errorf("Expected 2 purged, got %d", purged)
+	}
+	for id, want := range map[string]bool{"completed-40": false, "completed-35": false, "completed-31": true} {
+		req, err := store.GetRequest(ctx, id)
+		if err != nil {
+			t.Fatalf("GetRequest failed: %v", err)
+		}
+		if (req != nil) != want {
+			t.Errorf("Request %s: exists = %v, want %v", id, req != nil, want)
+		}
+	}
+
+	purged, err = store.PurgeRequests(ctx, "test-ns", types.StatusCompleted, before, 10)
+	if err != nil {
+		t.Fatalf("PurgeRequests failed: %v", err)
+	}
+	if purged != 1 {
+		t.Errorf("Expected the last old completed request purged, got %d", purged)
+	}
+
+	stats, err := store.GetNamespaceStats(ctx, "test-ns")
+	if err != nil {
+		t.Fatalf("GetNamespaceStats failed: %v", err)
+	}
+	if stats.TotalRequests != 3 || stats.Completed != 1 || stats.Failed != 1 || stats.Queued != 1 {
+		t.Errorf("Unexpected stats after purge: %+v", stats)
+	}
+	if stats.PromptTokens != 0 {
+		t.Errorf("Expected purged usage removed from stats, got %d prompt tokens", stats.PromptTokens)
+	}
+
+	// Nothing left to purge, and other namespaces are untouched
+	purged, err = store.PurgeRequests(ctx, "test-ns", types.StatusCompleted, before, 10)
+	if err != nil || purged != 0 {
+		t.Errorf("PurgeRequests = %d, %v; want 0", purged, err)
+	}
+	other, err := store.GetRequest(ctx, "other-40")
+	if err != nil || other == nil {
+		t.Errorf("Request in another namespace was purged: %v", err)
+	}
+}
+
+func testListFinishedRequests(t *testing.T, store storage.Store) {
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Second)
+
+	for _, name := range []string{"test-ns", "other-ns"} {
+		if err := store.CreateNamespace(ctx, &storage.NamespaceRecord{Name: name, CreatedAt: now, UpdatedAt: now}); err != nil {
+			t.Fatalf("CreateNamespace failed: %v", err)
+		}
+	}
+
+	since := now.Add(-time.Hour)
+	until := now.Add(-time.Minute)
+	for _, req := range []struct {
+		id, namespace string
+		status        types.RequestStatus
+		completedAt   time.Time
+	}{
+		{"early", "test-ns", types.StatusCompleted, since.Add(-time.Second)},
+		// Several finish in the same second, so a page can end between them
+		{"same-c", "test-ns", types.StatusCompleted, since},
+		{"same-a", "test-ns", types.StatusCompleted, since},
+		{"same-b", "test-ns", types.StatusCompleted, since},
+		{"later", "test-ns", types.StatusCompleted, since.Add(time.Second)},
+		{"at-until", "test-ns", types.StatusCompleted, until},
+		{"failed", "test-ns", types.StatusFailed, since},
+		{"other", "other-ns", types.StatusCompleted, since},
+		{"queued", "test-ns", types.StatusQueued, time.Time{}},
+	} {
+		record := &storage.RequestRecord{
+			ID:             req.id,
+			Namespace:      req.namespace,
+			Status:         req.status,
+			RequestPayload: json.RawMessage(`{"model":"gpt-4"}`),
+			CreatedAt:      since.Add(-time.Hour),
+		}
+		if !req.completedAt.IsZero() {
+			completedAt := req.completedAt
+			record.CompletedAt = &completedAt
+		}
+		if err := store.ImportRequest(ctx, record); err != nil {
+			t.Fatalf("ImportRequest failed: %v", err)
+		}
+	}
+
+	var got []string
+	pageSince, afterID := since, ""
+	for page := 0; page < 5; page++ {
+		batch, err := store.ListFinishedRequests(ctx, "test-ns", types.StatusCompleted, pageSince, until, afterID, 2)
+		if err != nil {
+			t.Fatalf("ListFinishedRequests failed: %v", err)
+		}
+		if len(batch) == 0 {
+			break
+		}
+		for _, req := range batch {
+			got = append(got, req.ID)
+		}
+		last := batch[len(batch)-1]
+		pageSince, afterID = *last.CompletedAt, last.ID
+	}
+
+	want := []string{"same-a", "same-b", "same-c", "later"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+func testDeleteRequests(t *testing.T, store storage.Store) {
+	ctx := context.Background()
+	now := time.Now()
+
+	if err := store.CreateNamespace(ctx, &storage.NamespaceRecord{Name: "test-ns", CreatedAt: now, UpdatedAt: now}); err != nil {
+		t.Fatalf("CreateNamespace failed: %v", err)
+	}
+	for _, id := range []string{"req_a", "req_b", "req_c"} {
+		if err := store.CreateRequest(ctx, &storage.RequestRecord{
+			ID:             id,
+			Namespace:      "test-ns",
+			Status:         types.StatusQueued,
+			RequestPayload: json.RawMessage(`{"model":"gpt-4"}`),
+			CreatedAt:      now,
+		}); err != nil {
+			t.Fatalf("CreateRequest failed: %v", err)
+		}
+	}
+	if err := store.UpdateRequestResponse(ctx, "req_a", "", json.RawMessage(`{"id":"x"}`), storage.Usage{PromptTokens: 10}); err != nil {
+		t.Fatalf("UpdateRequestResponse failed: %v", err)
+	}
+
+	deleted, err := store.DeleteRequests(ctx, []string{"req_a", "req_b", "req_missing"})
+	if err != nil {
+		t.Fatalf("DeleteRequests failed: %v", err)
+	}
+	if deleted != 2 {
+		t.Errorf("Expected 2 deleted, got %d", deleted)
+	}
+
+	for id, want := range map[string]bool{"req_a": false, "req_b": false, "req_c": true} {
+		req, err := store.GetRequest(ctx, id)
+		if err != nil {
+			t.Fatalf("GetRequest failed: %v", err)
+		}
+		if (req != nil) != want {
+			t.Errorf("Request %s: exists = %v, want %v", id, req != nil, want)
+		}
+	}
+
+	stats, err := store.GetNamespaceStats(ctx, "test-ns")
+	if err != nil {
+		t.Fatalf("GetNamespaceStats failed: %v", err)
+	}
+	if stats.TotalRequests != 1 || stats.Queued != 1 || stats.Completed != 0 || stats.PromptTokens != 0 {
+		t.Errorf("Unexpected stats after delete: %+v", stats)
+	}
+}
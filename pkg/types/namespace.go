@@ -1,19 +1,86 @@
 package types
 
 type Namespace struct {
-	Name        string            `json:"name"`
-	Description string            `json:"description,omitempty"`
-	Provider    *ProviderOverride `json:"provider,omitempty"`
-	Stats       *NamespaceStats   `json:"stats,omitempty"`
-	CreatedAt   string            `json:"created_at"`
-	UpdatedAt   string            `json:"updated_at"`
+	Name         string            `json:"name"`
+	Description  string            `json:"description,omitempty"`
+	Provider     *ProviderOverride `json:"provider,omitempty"`
+	Budget       *Budget           `json:"budget,omitempty"`
+	BudgetStatus *BudgetStatus     `json:"budget_status,omitempty"`
+	Cache        *CacheConfig      `json:"cache,omitempty"`
+	Retention    *RetentionPolicy  `json:"retention,omitempty"`
+	Stats        *NamespaceStats   `json:"stats,omitempty"`
+	CreatedAt    string            `json:"created_at"`
+	UpdatedAt    string            `json:"updated_at"`
 }
 
+type ProviderType string
+
+const (
+	ProviderOpenAI  ProviderType = "openai"
+	ProviderBedrock ProviderType = "bedrock"
+)
+
 type ProviderOverride struct {
+	Type        ProviderType      `json:"type,omitempty"`
 	APIEndpoint *string           `json:"api_endpoint,omitempty"`
 	APIKey      *string           `json:"api_key,omitempty"`
 	Model       *string           `json:"model,omitempty"`
 	Headers     map[string]string `json:"headers,omitempty"`
+	AWS         *AWSCredentials   `json:"aws,omitempty"`
+	// URLTemplate overrides the default "{endpoint}/chat/completions" path. It
+	// may be a full URL or a path appended to the endpoint, and supports the
+	// {model} and {namespace} placeholders.
+	URLTemplate *string           `json:"url_template,omitempty"`
+	QueryParams map[string]string `json:"query_params,omitempty"`
+}
+
+// AWSCredentials configures SigV4 signing for the bedrock provider type.
+// The secret and session token are write-only and never returned by the API.
+type AWSCredentials struct {
+	Region          string  `json:"region"`
+	AccessKeyID     string  `json:"access_key_id"`
+	SecretAccessKey *string `json:"secret_access_key,omitempty"`
+	SessionToken    *string `json:"session_token,omitempty"`
+}
+
+type BudgetPeriod string
+
+const (
+	BudgetPeriodLifetime BudgetPeriod = ""
+	BudgetPeriodDay      BudgetPeriod = "day"
+	BudgetPeriodMonth    BudgetPeriod = "month"
+)
+
+// Budget caps what a namespace may spend. Once either limit is reached,
+// dispatch stops and the remaining requests stay queued. Day and month
+// periods follow the UTC calendar.
+type Budget struct {
+	LimitUSD    *float64     `json:"limit_usd,omitempty"`
+	LimitTokens *int64       `json:"limit_tokens,omitempty"`
+	Period      BudgetPeriod `json:"period,omitempty"`
+}
+
+// BudgetStatus is the spend recorded against a budget in the current period.
+type BudgetStatus struct {
+	Period      string  `json:"period"`
+	SpentUSD    float64 `json:"spent_usd"`
+	SpentTokens int64   `json:"spent_tokens"`
+	Exhausted   bool    `json:"exhausted"`
+	ExhaustedAt *string `json:"exhausted_at,omitempty"`
+}
+
+// CacheConfig enables the response cache for a namespace. Queued requests
+// whose normalized payload matches a cached response for the same provider
+// and model are completed from the cache at dispatch time.
+type CacheConfig struct {
+	TTLSeconds int64 `json:"ttl_seconds"`
+}
+
+// RetentionPolicy purges completed and failed requests once they are older
+// than the given number of days. Zero keeps them forever.
+type RetentionPolicy struct {
+	CompletedDays int `json:"completed_days,omitempty"`
+	FailedDays    int `json:"failed_days,omitempty"`
 }
 
 type NamespaceStats struct {
@@ -22,19 +89,66 @@ type NamespaceStats struct {
 	Processing    int `json:"processing"`
 	Completed     int `json:"completed"`
 	Failed        int `json:"failed"`
+
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	CachedTokens     int64   `json:"cached_tokens"`
+	ReasoningTokens  int64   `json:"reasoning_tokens"`
+	CostUSD          float64 `json:"cost_usd"`
+
+	CacheHits   int64 `json:"cache_hits"`
+	CacheMisses int64 `json:"cache_misses"`
+
+	// PayloadBytes is the size of the stored request and response payloads
+	// and StoredPayloadBytes the space they take in the database, where a
+	// payload offloaded to the blob store counts as its reference.
+	// CompressionRatio is PayloadBytes / StoredPayloadBytes.
+	PayloadBytes       int64   `json:"payload_bytes,omitempty"`
+	StoredPayloadBytes int64   `json:"stored_payload_bytes,omitempty"`
+	CompressionRatio   float64 `json:"compression_ratio,omitempty"`
+}
+
+type CompressionDictionaryResponse struct {
+	ID        uint32 `json:"id"`
+	Namespace string `json:"namespace"`
+	Size      int    `json:"size"`
+	Samples   int    `json:"samples"`
+	CreatedAt string `json:"created_at"`
 }
 
 type CreateNamespaceRequest struct {
 	Name        string            `json:"name"`
 	Description string            `json:"description,omitempty"`
 	Provider    *ProviderOverride `json:"provider,omitempty"`
+	Budget      *Budget           `json:"budget,omitempty"`
+	Cache       *CacheConfig      `json:"cache,omitempty"`
+	Retention   *RetentionPolicy  `json:"retention,omitempty"`
 }
 
 type UpdateNamespaceRequest struct {
 	Description *string           `json:"description,omitempty"`
 	Provider    *ProviderOverride `json:"provider,omitempty"`
+	// Budget replaces the namespace budget; an empty object removes it.
+	Budget *Budget `json:"budget,omitempty"`
+	// Cache replaces the cache configuration; a zero TTL disables it.
+	Cache *CacheConfig `json:"cache,omitempty"`
+	// Retention replaces the retention policy; zero days keeps requests
+	// forever.
+	Retention *RetentionPolicy `json:"retention,omitempty"`
 }
 
 type DeleteNamespaceResponse struct {
 	Message string `json:"message"`
 }
+
+// PurgeRequest deletes requests of a namespace that finished more than
+// OlderThanDays ago. OlderThanDays is required and must be positive. Status
+// is completed or failed; empty purges both.
+type PurgeRequest struct {
+	Status        RequestStatus `json:"status,omitempty"`
+	OlderThanDays *int          `json:"older_than_days"`
+}
+
+type PurgeResponse struct {
+	Purged int `json:"purged"`
+}
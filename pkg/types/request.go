@@ -1,5 +1,7 @@
 package types
 
+import "encoding/json"
+
 type RequestStatus string
 
 const (
@@ -10,15 +12,29 @@ const (
 )
 
 type Request struct {
-	ID           string                 `json:"id"`
-	Namespace    string                 `json:"namespace"`
-	Status       RequestStatus          `json:"status"`
-	Request      map[string]interface{} `json:"request,omitempty"`
-	Response     map[string]interface{} `json:"response,omitempty"`
-	Error        *string                `json:"error,omitempty"`
-	CreatedAt    string                 `json:"created_at"`
-	DispatchedAt *string                `json:"dispatched_at,omitempty"`
-	CompletedAt  *string                `json:"completed_at,omitempty"`
+	ID             string          `json:"id"`
+	Namespace      string          `json:"namespace"`
+	Status         RequestStatus   `json:"status"`
+	Request        json.RawMessage `json:"request,omitempty"`
+	Response       json.RawMessage `json:"response,omitempty"`
+	Usage          *RequestUsage   `json:"usage,omitempty"`
+	CacheHit       bool            `json:"cache_hit,omitempty"`
+	CoalescedWith  *string         `json:"coalesced_with,omitempty"`
+	Error          *string         `json:"error,omitempty"`
+	CreatedAt      string          `json:"created_at"`
+	DispatchedAt   *string         `json:"dispatched_at,omitempty"`
+	CompletedAt    *string         `json:"completed_at,omitempty"`
+	Attempts       int             `json:"attempts,omitempty"`
+	LeaseOwner     *string         `json:"lease_owner,omitempty"`
+	LeaseExpiresAt *string         `json:"lease_expires_at,omitempty"`
+}
+
+type RequestUsage struct {
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	CachedTokens     int64   `json:"cached_tokens"`
+	ReasoningTokens  int64   `json:"reasoning_tokens"`
+	CostUSD          float64 `json:"cost_usd"`
 }
 
 type QueuedRequestResponse struct {
@@ -27,15 +27,81 @@ export interface Namespace {
   name: string;
   description?: string;
   provider?: ProviderOverride;
+  budget?: Budget;
+  budget_status?: BudgetStatus;
+  cache?: CacheConfig;
+  retention?: RetentionPolicy;
   stats?: NamespaceStats;
   created_at: string;
   updated_at: string;
 }
+export type ProviderType = string;
+export const ProviderOpenAI: ProviderType = "openai";
+export const ProviderBedrock: ProviderType = "bedrock";
 export interface ProviderOverride {
+  type?: ProviderType;
   api_endpoint?: string;
   api_key?: string;
   model?: string;
   headers?: { [key: string]: string};
+  aws?: AWSCredentials;
+  /**
+   * URLTemplate overrides the default "{endpoint}/chat/completions" path. It
+   * may be a full URL or a path appended to the endpoint, and supports the
+   * {model} and {namespace} placeholders.
+   */
+  url_template?: string;
+  query_params?: { [key: string]: string};
+}
+/**
+ * AWSCredentials configures SigV4 signing for the bedrock provider type.
+ * The secret and session token are write-only and never returned by the API.
+ */
+export interface AWSCredentials {
+  region: string;
+  access_key_id: string;
+  secret_access_key?: string;
+  session_token?: string;
+}
+export type BudgetPeriod = string;
+export const BudgetPeriodLifetime: BudgetPeriod = "";
+export const BudgetPeriodDay: BudgetPeriod = "day";
+export const BudgetPeriodMonth: BudgetPeriod = "month";
+/**
+ * Budget caps what a namespace may spend. Once either limit is reached,
+ * dispatch stops and the remaining requests stay queued. Day and month
+ * periods follow the UTC calendar.
+ */
+export interface Budget {
+  limit_usd?: number /* float64 */;
+  limit_tokens?: number /* int64 */;
+  period?: BudgetPeriod;
+}
+/**
+ * BudgetStatus is the spend recorded against a budget in the current period.
+ */
+export interface BudgetStatus {
+  period: string;
+  spent_usd: number /* float64 */;
+  spent_tokens: number /* int64 */;
+  exhausted: boolean;
+  exhausted_at?: string;
+}
+/**
+ * CacheConfig enables the response cache for a namespace. Queued requests
+ * whose normalized payload matches a cached response for the same provider
+ * and model are completed from the cache at dispatch time.
+ */
+export interface CacheConfig {
+  ttl_seconds: number /* int64 */;
+}
+/**
+ * RetentionPolicy purges completed and failed requests once they are older
+ * than the given number of days. Zero keeps them forever.
+ */
+export interface RetentionPolicy {
+  completed_days?: number /* int */;
+  failed_days?: number /* int */;
 }
 export interface NamespaceStats {
   total_requests: number /* int */;
@@ -43,19 +109,70 @@ export interface NamespaceStats {
   processing: number /* int */;
   completed: number /* int */;
   failed: number /* int */;
+  prompt_tokens: number /* int64 */;
+  completion_tokens: number /* int64 */;
+  cached_tokens: number /* int64 */;
+  reasoning_tokens: number /* int64 */;
+  cost_usd: number /* float64 */;
+  cache_hits: number /* int64 */;
+  cache_misses: number /* int64 */;
+  /**
+   * PayloadBytes is the size of the stored request and response payloads
+   * and StoredPayloadBytes the space they take in the database, where a
+   * payload offloaded to the blob store counts as its reference.
+   * CompressionRatio is PayloadBytes / StoredPayloadBytes.
+   */
+  payload_bytes?: number /* int64 */;
+  stored_payload_bytes?: number /* int64 */;
+  compression_ratio?: number /* float64 */;
+}
+export interface CompressionDictionaryResponse {
+  id: number /* uint32 */;
+  namespace: string;
+  size: number /* int */;
+  samples: number /* int */;
+  created_at: string;
 }
 export interface CreateNamespaceRequest {
   name: string;
   description?: string;
   provider?: ProviderOverride;
+  budget?: Budget;
+  cache?: CacheConfig;
+  retention?: RetentionPolicy;
 }
 export interface UpdateNamespaceRequest {
   description?: string;
   provider?: ProviderOverride;
+  /**
+   * Budget replaces the namespace budget; an empty object removes it.
+   */
+  budget?: Budget;
+  /**
+   * Cache replaces the cache configuration; a zero TTL disables it.
+   */
+  cache?: CacheConfig;
+  /**
+   * Retention replaces the retention policy; zero days keeps requests
+   * forever.
+   */
+  retention?: RetentionPolicy;
 }
 export interface DeleteNamespaceResponse {
   message: string;
 }
+/**
+ * PurgeRequest deletes requests of a namespace that finished more than
+ * OlderThanDays ago. OlderThanDays is required and must be positive. Status
+ * is completed or failed; empty purges both.
+ */
+export interface PurgeRequest {
+  status?: RequestStatus;
+  older_than_days?: number /* int */;
+}
+export interface PurgeResponse {
+  purged: number /* int */;
+}
 
 //////////
 // source: request.go
@@ -69,12 +186,25 @@ export interface Request {
   id: string;
   namespace: string;
   status: RequestStatus;
-  request?: { [key: string]: any};
-  response?: { [key: string]: any};
+  request?: any /* json.RawMessage */;
+  response?: any /* json.RawMessage */;
+  usage?: RequestUsage;
+  cache_hit?: boolean;
+  coalesced_with?: string;
   error?: string;
   created_at: string;
   dispatched_at?: string;
   completed_at?: string;
+  attempts?: number /* int */;
+  lease_owner?: string;
+  lease_expires_at?: string;
+}
+export interface RequestUsage {
+  prompt_tokens: number /* int64 */;
+  completion_tokens: number /* int64 */;
+  cached_tokens: number /* int64 */;
+  reasoning_tokens: number /* int64 */;
+  cost_usd: number /* float64 */;
 }
 export interface QueuedRequestResponse {
   id: string;